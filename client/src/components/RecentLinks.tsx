@@ -34,6 +34,7 @@ type ShortUrl = {
   id: number;
   originalUrl: string;
   slug: string;
+  shortUrl: string;
   clicks: number;
   active: boolean;
   createdAt: string;
@@ -73,8 +74,7 @@ export default function RecentLinks() {
     },
   });
 
-  const handleCopyLink = (slug: string) => {
-    const shortUrl = `${window.location.origin}/api/r/${slug}`;
+  const handleCopyLink = (shortUrl: string) => {
     copy(shortUrl);
     toast({
       title: "Link copied!",
@@ -241,12 +241,12 @@ export default function RecentLinks() {
                       <td className="px-6 py-4 whitespace-nowrap">
                         <div className="text-sm text-primary font-medium">
                           <a 
-                            href={`/api/r/${link.slug}`} 
+                            href={link.shortUrl} 
                             target="_blank" 
                             rel="noopener noreferrer"
                             className="hover:underline flex items-center gap-1"
                           >
-                            shortlink.io/{link.slug}
+                            {link.shortUrl.replace(/^https?:\/\//, "")}
                           </a>
                         </div>
                       </td>
@@ -264,7 +264,7 @@ export default function RecentLinks() {
                           <Button
                             variant="ghost"
                             size="icon"
-                            onClick={() => handleCopyLink(link.slug)}
+                            onClick={() => handleCopyLink(link.shortUrl)}
                             className="text-gray-500 hover:text-primary transition-colors"
                             title="Copy link"
                           >
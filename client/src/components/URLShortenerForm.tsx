@@ -137,10 +137,8 @@ export default function URLShortenerForm() {
       apiRequest("POST", "/api/urls", data),
     onSuccess: async (response) => {
       const data = await response.json();
-      const host = window.location.origin;
-      const shortUrl = `${host}/api/r/${data.slug}`;
       
-      setShortenedUrl(shortUrl);
+      setShortenedUrl(data.shortUrl);
       queryClient.invalidateQueries({ queryKey: ["/api/urls"] });
       toast({
         title: "URL shortened successfully!",
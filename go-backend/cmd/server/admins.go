@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"shortlink/internal/database"
+	"shortlink/internal/models"
+	"strings"
+)
+
+// promoteAdmins gives the admin role to the existing accounts named in
+// usernames, a comma-separated list. Registering never grants the role, so
+// this is how the first admins are made; names without an account are
+// skipped and picked up on a later start once the account exists.
+func promoteAdmins(ctx context.Context, repo database.UserStore, usernames string) error {
+	for _, username := range strings.Split(usernames, ",") {
+		username = strings.TrimSpace(username)
+		if username == "" {
+			continue
+		}
+
+		user, err := repo.SetUserRole(ctx, username, models.RoleAdmin)
+		if errors.Is(err, database.ErrNotFound) {
+			log.Printf("Not promoting %q to admin: no such user", username)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("Promoted %q to admin", user.Username)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"shortlink/internal/database"
+	"shortlink/internal/models"
+	"testing"
+)
+
+func TestPromoteAdmins(t *testing.T) {
+	ctx := context.Background()
+	repo := database.NewMemoryRepository()
+	for _, username := range []string{"alice", "bob", "carol"} {
+		if _, err := repo.CreateUser(ctx, models.User{Username: username, Role: models.RoleUser}); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+	}
+
+	if err := promoteAdmins(ctx, repo, " alice ,,mallory, carol"); err != nil {
+		t.Fatalf("promoteAdmins: %v", err)
+	}
+
+	want := map[string]string{"alice": models.RoleAdmin, "bob": models.RoleUser, "carol": models.RoleAdmin}
+	for username, role := range want {
+		user, err := repo.GetUserByUsername(ctx, username)
+		if err != nil || user == nil || user.Role != role {
+			t.Fatalf("GetUserByUsername(%q) = %+v, %v, want role %q", username, user, err, role)
+		}
+	}
+	if user, _ := repo.GetUserByUsername(ctx, "mallory"); user != nil {
+		t.Fatalf("promoteAdmins created %+v", user)
+	}
+}
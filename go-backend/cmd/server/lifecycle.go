@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"shortlink/internal/database"
+	"shortlink/internal/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Lifecycle event types
+const (
+	eventLinkActivated   = "link.activated"
+	eventLinkExpired     = "link.expired"
+	eventLinksPurged     = "links.purged"
+	eventSessionsExpired = "sessions.expired"
+)
+
+// Reasons given for purging links
+const (
+	purgeReasonTrash   = "trash"
+	purgeReasonExpired = "expired"
+)
+
+// lifecycleEvent describes a change the lifecycle worker made
+type lifecycleEvent struct {
+	Type       string    `json:"type"`
+	ShortURLID string    `json:"shortUrlId,omitempty"`
+	UserID     string    `json:"userId,omitempty"`
+	Slug       string    `json:"slug,omitempty"`
+	Version    int       `json:"version,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	Count      int       `json:"count,omitempty"`
+	At         time.Time `json:"at"`
+}
+
+// lifecycleSink receives the events emitted by the lifecycle worker
+type lifecycleSink func(ctx context.Context, event lifecycleEvent)
+
+// lifecycleConfig controls the lifecycle worker
+type lifecycleConfig struct {
+	// Interval is how often the worker runs
+	Interval time.Duration
+
+	// TrashRetention and ExpiredRetention are how long trashed and expired
+	// links are kept before they are purged; zero keeps them forever
+	TrashRetention   time.Duration
+	ExpiredRetention time.Duration
+
+	// WebhookURL, if set, receives every event as a JSON POST
+	WebhookURL string
+}
+
+// lifecycleConfigFromEnv reads the lifecycle worker configuration, taking the
+// retention periods from the storage configuration
+func lifecycleConfigFromEnv(storage database.Config) lifecycleConfig {
+	cfg := lifecycleConfig{
+		Interval:         time.Minute,
+		TrashRetention:   storage.TrashRetention,
+		ExpiredRetention: storage.ExpiredRetention,
+		WebhookURL:       os.Getenv("LIFECYCLE_WEBHOOK_URL"),
+	}
+
+	if interval, err := time.ParseDuration(os.Getenv("LIFECYCLE_INTERVAL")); err == nil && interval > 0 {
+		cfg.Interval = interval
+	}
+
+	return cfg
+}
+
+// lifecycleWorker applies scheduled link state changes in the background:
+// it activates links whose activation time has come, deactivates expired
+// links, purges links past their retention period and removes expired sessions.
+// Redirects still check activation and expiry times themselves, so links
+// behave correctly between runs.
+type lifecycleWorker struct {
+	repo  database.Store
+	cfg   lifecycleConfig
+	sinks []lifecycleSink
+}
+
+// newLifecycleWorker creates a worker that logs its events, and posts them to
+// the configured webhook if there is one
+func newLifecycleWorker(repo database.Store, cfg lifecycleConfig) *lifecycleWorker {
+	w := &lifecycleWorker{
+		repo:  repo,
+		cfg:   cfg,
+		sinks: []lifecycleSink{logLifecycleEvent},
+	}
+	if cfg.WebhookURL != "" {
+		w.sinks = append(w.sinks, webhookLifecycleSink(cfg.WebhookURL))
+	}
+	return w
+}
+
+// Run runs the worker at startup and then every interval until ctx is cancelled
+func (w *lifecycleWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		w.runOnce(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runOnce performs every lifecycle task once. A failing task is logged and
+// doesn't stop the others.
+func (w *lifecycleWorker) runOnce(ctx context.Context, now time.Time) {
+	// Activate first, so links whose window has already closed are expired in the same run
+	activated, err := w.repo.ActivateScheduledShortURLs(ctx, now)
+	w.report(ctx, "activating scheduled links", err)
+	for i := range activated {
+		w.recordChange(ctx, &activated[i], models.RevisionActivate, []string{"active", "activateAt"}, eventLinkActivated, now)
+	}
+
+	expired, err := w.repo.ExpireShortURLs(ctx, now)
+	w.report(ctx, "expiring links", err)
+	for i := range expired {
+		w.recordChange(ctx, &expired[i], models.RevisionExpire, []string{"active"}, eventLinkExpired, now)
+	}
+
+	if w.cfg.ExpiredRetention > 0 {
+		purged, err := w.repo.PurgeExpiredShortURLs(ctx, now.Add(-w.cfg.ExpiredRetention))
+		w.report(ctx, "purging expired links", err)
+		if purged > 0 {
+			w.emit(ctx, lifecycleEvent{Type: eventLinksPurged, Reason: purgeReasonExpired, Count: purged, At: now})
+		}
+	}
+
+	if w.cfg.TrashRetention > 0 {
+		purged, err := w.repo.PurgeDeletedShortURLs(ctx, now.Add(-w.cfg.TrashRetention))
+		w.report(ctx, "purging the trash", err)
+		if purged > 0 {
+			w.emit(ctx, lifecycleEvent{Type: eventLinksPurged, Reason: purgeReasonTrash, Count: purged, At: now})
+		}
+	}
+
+	sessions, err := w.repo.DeleteExpiredSessions(ctx, now)
+	w.report(ctx, "removing expired sessions", err)
+	if sessions > 0 {
+		w.emit(ctx, lifecycleEvent{Type: eventSessionsExpired, Count: sessions, At: now})
+	}
+}
+
+// recordChange appends a revision for a link the worker changed and emits an event for it
+func (w *lifecycleWorker) recordChange(ctx context.Context, shortURL *models.ShortURL, action string, changes []string, eventType string, now time.Time) {
+	_, err := w.repo.CreateShortURLRevision(ctx, models.NewShortURLRevision(shortURL, action, primitive.NilObjectID, changes))
+	w.report(ctx, "recording revision", err)
+
+	w.emit(ctx, lifecycleEvent{
+		Type:       eventType,
+		ShortURLID: shortURL.ID.Hex(),
+		UserID:     shortURL.UserID.Hex(),
+		Slug:       shortURL.Slug,
+		Version:    shortURL.Version,
+		At:         now,
+	})
+}
+
+// report logs err unless it is nil or caused by shutdown
+func (w *lifecycleWorker) report(ctx context.Context, task string, err error) {
+	if err != nil && ctx.Err() == nil {
+		log.Printf("Lifecycle worker: error %s: %v", task, err)
+	}
+}
+
+// emit passes event to every sink
+func (w *lifecycleWorker) emit(ctx context.Context, event lifecycleEvent) {
+	for _, sink := range w.sinks {
+		sink(ctx, event)
+	}
+}
+
+// logLifecycleEvent writes event to the server log
+func logLifecycleEvent(ctx context.Context, event lifecycleEvent) {
+	switch {
+	case event.Slug != "":
+		log.Printf("Lifecycle: %s %s (version %d)", event.Type, event.Slug, event.Version)
+	case event.Reason != "":
+		log.Printf("Lifecycle: %s %d (%s)", event.Type, event.Count, event.Reason)
+	default:
+		log.Printf("Lifecycle: %s %d", event.Type, event.Count)
+	}
+}
+
+// webhookLifecycleSink posts each event as JSON to url. Failures are logged;
+// events are not retried.
+func webhookLifecycleSink(url string) lifecycleSink {
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	return func(ctx context.Context, event lifecycleEvent) {
+		body, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("Lifecycle webhook: error encoding event: %v", err)
+			return
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			log.Printf("Lifecycle webhook: %v", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				err = fmt.Errorf("unexpected status %s", resp.Status)
+			}
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Lifecycle webhook: error delivering %s event: %v", event.Type, err)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"shortlink/internal/database"
+	"shortlink/internal/models"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// mustCreateLink stores link and returns it as stored
+func mustCreateLink(t *testing.T, repo database.Store, link models.ShortURL) *models.ShortURL {
+	t.Helper()
+
+	created, err := repo.CreateShortURL(context.Background(), link)
+	if err != nil {
+		t.Fatalf("CreateShortURL(%s): %v", link.Slug, err)
+	}
+	return created
+}
+
+func TestLifecycleRunOnce(t *testing.T) {
+	ctx := context.Background()
+	repo := database.NewMemoryRepository()
+	userID := primitive.NewObjectID()
+	now := time.Now()
+	activateAt, expiresAt := now.Add(time.Hour), now.Add(time.Hour)
+
+	scheduled := mustCreateLink(t, repo, models.ShortURL{UserID: userID, Slug: "scheduled", OriginalURL: "https://example.com/", ActivateAt: &activateAt})
+	expiring := mustCreateLink(t, repo, models.ShortURL{UserID: userID, Slug: "expiring", OriginalURL: "https://example.com/", Active: true, ExpiresAt: &expiresAt})
+	deactivated := mustCreateLink(t, repo, models.ShortURL{UserID: userID, Slug: "deactivated", OriginalURL: "https://example.com/"})
+	deactivated.Active = false
+	if _, err := repo.UpdateShortURL(ctx, *deactivated, deactivated.Version); err != nil {
+		t.Fatalf("UpdateShortURL: %v", err)
+	}
+	trashed := mustCreateLink(t, repo, models.ShortURL{UserID: userID, Slug: "trashed", OriginalURL: "https://example.com/", Active: true})
+	if err := repo.DeleteShortURL(ctx, trashed.ID, userID); err != nil {
+		t.Fatalf("DeleteShortURL: %v", err)
+	}
+	if _, err := repo.CreateSession(ctx, models.Session{UserID: userID, TokenHash: "expiring", ExpiresAt: now.Add(time.Minute)}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	var events []lifecycleEvent
+	w := newLifecycleWorker(repo, lifecycleConfig{TrashRetention: 24 * time.Hour, ExpiredRetention: 24 * time.Hour})
+	w.sinks = []lifecycleSink{func(ctx context.Context, event lifecycleEvent) {
+		events = append(events, event)
+	}}
+
+	// Two hours on, the scheduled link is activated and the expiring one expired
+	w.runOnce(ctx, now.Add(2*time.Hour))
+
+	tests := []struct {
+		name    string
+		id      primitive.ObjectID
+		active  bool
+		version int
+		action  string
+	}{
+		{"scheduled", scheduled.ID, true, 2, models.RevisionActivate},
+		{"expiring", expiring.ID, false, 2, models.RevisionExpire},
+		{"deactivated", deactivated.ID, false, 2, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			link, err := repo.GetShortURL(ctx, tt.id)
+			if err != nil || link == nil || link.Active != tt.active || link.ActivateAt != nil || link.Version != tt.version {
+				t.Fatalf("GetShortURL = %+v, %v, want active %v at version %d", link, err, tt.active, tt.version)
+			}
+			revisions, err := repo.GetShortURLRevisions(ctx, tt.id)
+			if err != nil {
+				t.Fatalf("GetShortURLRevisions: %v", err)
+			}
+			if tt.action == "" {
+				if len(revisions) != 0 {
+					t.Fatalf("revisions = %+v, want none", revisions)
+				}
+				return
+			}
+			if len(revisions) != 1 || revisions[0].Action != tt.action || revisions[0].Version != tt.version {
+				t.Fatalf("revisions = %+v, want one %s revision at version %d", revisions, tt.action, tt.version)
+			}
+		})
+	}
+
+	want := map[string]int{eventLinkActivated: 1, eventLinkExpired: 1, eventSessionsExpired: 1}
+	if got := countEvents(events); !sameCounts(got, want) {
+		t.Fatalf("events after the first run = %v, want %v", got, want)
+	}
+
+	// Two days on, the expired and trashed links are past their retention
+	events = nil
+	w.runOnce(ctx, now.Add(48*time.Hour))
+
+	for _, id := range []primitive.ObjectID{expiring.ID, trashed.ID} {
+		if link, err := repo.GetShortURL(ctx, id); err != nil || link != nil {
+			t.Fatalf("GetShortURL after purging = %+v, %v, want nothing", link, err)
+		}
+	}
+	if link, err := repo.GetShortURL(ctx, scheduled.ID); err != nil || link == nil || !link.Active {
+		t.Fatalf("GetShortURL(scheduled) = %+v, %v, want it kept", link, err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("events after the second run = %+v, want two purges", events)
+	}
+	for _, event := range events {
+		if event.Type != eventLinksPurged || event.Count != 1 || (event.Reason != purgeReasonExpired && event.Reason != purgeReasonTrash) {
+			t.Fatalf("event = %+v, want one link purged", event)
+		}
+	}
+}
+
+// countEvents counts events by type
+func countEvents(events []lifecycleEvent) map[string]int {
+	counts := make(map[string]int)
+	for _, event := range events {
+		counts[event.Type]++
+	}
+	return counts
+}
+
+// sameCounts reports whether a and b hold the same counts
+func sameCounts(a, b map[string]int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, n := range a {
+		if b[key] != n {
+			return false
+		}
+	}
+	return true
+}
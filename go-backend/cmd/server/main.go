@@ -2,14 +2,22 @@ package main
 
 import (
         "context"
+        "fmt"
         "log"
         "net/http"
+        "net/url"
         "os"
         "os/signal"
+        "strings"
+        "shortlink/internal/auth"
         "shortlink/internal/database"
         "shortlink/internal/handlers"
+        "shortlink/internal/policy"
+        "shortlink/pkg/urlnorm"
+        "shortlink/pkg/utils"
         "syscall"
         "time"
+        _ "time/tzdata" // link schedules name IANA time zones; don't depend on the host's zone database
 
         "github.com/gorilla/mux"
         "github.com/joho/godotenv"
@@ -28,36 +36,122 @@ func main() {
                 port = "5000"
         }
 
-        // Create a new MongoDB client
-        db := database.NewDBClient()
+        // Open the configured storage backend, failing fast if it is unreachable
+        storageConfig := database.ConfigFromEnv()
+        openCtx, openCancel := context.WithTimeout(context.Background(), 10*time.Second)
+        backend, err := database.Open(openCtx, storageConfig)
+        openCancel()
+        if err != nil {
+                log.Fatalf("Error opening %s storage backend: %v", storageConfig.Backend, err)
+        }
+        log.Printf("Using %s storage backend", backend.Name)
+
+        // Promote the configured admins; registering never grants the admin role
+        repo := backend.Store
+        adminCtx, adminCancel := context.WithTimeout(context.Background(), 10*time.Second)
+        err = promoteAdmins(adminCtx, repo, os.Getenv("ADMIN_USERNAMES"))
+        adminCancel()
+        if err != nil {
+                log.Fatalf("Error promoting admins: %v", err)
+        }
+
+        // Set up slug generation; the sequential strategies share one counter
+        slugGenerators, err := utils.NewSlugGenerators(utils.SlugConfigFromEnv(), func(ctx context.Context) (int64, error) {
+                return repo.NextSequence(ctx, "slugs")
+        })
+        if err != nil {
+                log.Fatalf("Error configuring slug generation: %v", err)
+        }
+
+        // Short links are served at the root of the public base URL, if one is configured
+        publicBaseURL, publicHost, err := parsePublicBaseURL(os.Getenv("PUBLIC_BASE_URL"))
+        if err != nil {
+                log.Fatal(err)
+        }
+        policyConfig := policy.ConfigFromEnv()
+        if publicHost != "" {
+                policyConfig.ServiceHosts = append(policyConfig.ServiceHosts, publicHost)
+        }
+
+        // Load the destination policy
+        destinationPolicy, err := policy.New(policyConfig)
+        if err != nil {
+                log.Fatalf("Error loading destination policy: %v", err)
+        }
 
         // Create repositories and handlers
-        repo := database.NewRepository(db)
-        urlHandler := handlers.NewURLHandler(repo)
+        domains := handlers.NewDomains(repo)
+        urlHandler := handlers.NewURLHandler(repo, domains, slugGenerators, urlnorm.New(urlnorm.OptionsFromEnv()), destinationPolicy, handlers.AvailabilityConfigFromEnv(), handlers.LinkAccessConfigFromEnv(), handlers.RedirectConfigFromEnv(), publicBaseURL)
+        policyHandler := handlers.NewPolicyHandler(destinationPolicy)
+        authHandler := handlers.NewAuthHandler(repo)
+        apiKeyHandler := handlers.NewAPIKeyHandler(repo)
+        domainHandler := handlers.NewDomainHandler(repo, domains, destinationPolicy)
+        healthHandler := handlers.NewHealthHandler(backend)
+        authMiddleware := auth.NewMiddleware(repo)
 
         // Create a new router
         router := mux.NewRouter()
 
+        // Health check
+        router.HandleFunc("/health", healthHandler.Health).Methods(http.MethodGet)
+
         // Set up API routes
         apiRouter := router.PathPrefix("/api").Subrouter()
-        
+        apiRouter.Use(authMiddleware.Authenticate)
+
+        // Auth routes
+        apiRouter.HandleFunc("/register", authHandler.Register).Methods(http.MethodPost)
+        apiRouter.HandleFunc("/login", authHandler.Login).Methods(http.MethodPost)
+        apiRouter.HandleFunc("/logout", authHandler.Logout).Methods(http.MethodPost)
+        apiRouter.HandleFunc("/user", authHandler.CurrentUser).Methods(http.MethodGet)
+
+        // API key routes
+        apiRouter.HandleFunc("/keys", apiKeyHandler.CreateAPIKey).Methods(http.MethodPost)
+        apiRouter.HandleFunc("/keys", apiKeyHandler.GetAPIKeys).Methods(http.MethodGet)
+        apiRouter.HandleFunc("/keys/{id}", apiKeyHandler.RevokeAPIKey).Methods(http.MethodDelete)
+
+        // Branded domains the user may create links on
+        apiRouter.HandleFunc("/domains", auth.RequireScope(auth.ScopeRead, domainHandler.GetDomains)).Methods(http.MethodGet)
+
         // URL routes
-        apiRouter.HandleFunc("/urls", urlHandler.CreateShortURL).Methods(http.MethodPost)
-        apiRouter.HandleFunc("/urls", urlHandler.GetAllShortURLs).Methods(http.MethodGet)
-        apiRouter.HandleFunc("/urls/{id}", urlHandler.GetShortURL).Methods(http.MethodGet)
-        apiRouter.HandleFunc("/urls/{id}", urlHandler.DeleteShortURL).Methods(http.MethodDelete)
-        
+        apiRouter.HandleFunc("/urls", auth.RequireScope(auth.ScopeCreate, urlHandler.CreateShortURL)).Methods(http.MethodPost)
+        apiRouter.HandleFunc("/urls", auth.RequireScope(auth.ScopeRead, urlHandler.GetAllShortURLs)).Methods(http.MethodGet)
+        apiRouter.HandleFunc("/urls/{id}", auth.RequireScope(auth.ScopeRead, urlHandler.GetShortURL)).Methods(http.MethodGet)
+        apiRouter.HandleFunc("/urls/{id}", auth.RequireScope(auth.ScopeUpdate, urlHandler.UpdateShortURL)).Methods(http.MethodPatch)
+        apiRouter.HandleFunc("/urls/{id}", auth.RequireScope(auth.ScopeDelete, urlHandler.DeleteShortURL)).Methods(http.MethodDelete)
+        apiRouter.HandleFunc("/urls/{id}/revisions", auth.RequireScope(auth.ScopeRead, urlHandler.GetShortURLRevisions)).Methods(http.MethodGet)
+        apiRouter.HandleFunc("/urls/{id}/revisions/{version}/rollback", auth.RequireScope(auth.ScopeUpdate, urlHandler.RollbackShortURL)).Methods(http.MethodPost)
+
+        // Trash routes
+        apiRouter.HandleFunc("/trash", auth.RequireScope(auth.ScopeRead, urlHandler.GetDeletedShortURLs)).Methods(http.MethodGet)
+        apiRouter.HandleFunc("/trash/{id}/restore", auth.RequireScope(auth.ScopeDelete, urlHandler.RestoreShortURL)).Methods(http.MethodPost)
+
         // Redirect route
         apiRouter.HandleFunc("/r/{slug}", urlHandler.RedirectShortURL).Methods(http.MethodGet)
-        
+        apiRouter.HandleFunc("/r/{slug}", urlHandler.UnlockShortURL).Methods(http.MethodPost)
+        apiRouter.HandleFunc("/r/{slug}/{rest:.+}", urlHandler.RedirectShortURL).Methods(http.MethodGet)
+        apiRouter.HandleFunc("/r/{slug}/{rest:.+}", urlHandler.UnlockShortURL).Methods(http.MethodPost)
+
         // Analytics route
-        apiRouter.HandleFunc("/analytics", urlHandler.GetAnalytics).Methods(http.MethodGet)
+        apiRouter.HandleFunc("/analytics", auth.RequireScope(auth.ScopeAnalytics, urlHandler.GetAnalytics)).Methods(http.MethodGet)
+        apiRouter.HandleFunc("/admin/analytics", authMiddleware.RequireAdmin(urlHandler.GetGlobalAnalytics)).Methods(http.MethodGet)
+
+        // Admin routes
+        apiRouter.HandleFunc("/admin/policy/reload", authMiddleware.RequireAdmin(policyHandler.Reload)).Methods(http.MethodPost)
+        apiRouter.HandleFunc("/admin/domains", authMiddleware.RequireAdmin(domainHandler.GetAllDomains)).Methods(http.MethodGet)
+        apiRouter.HandleFunc("/admin/domains", authMiddleware.RequireAdmin(domainHandler.CreateDomain)).Methods(http.MethodPost)
+        apiRouter.HandleFunc("/admin/domains/{id}/grants", authMiddleware.RequireAdmin(domainHandler.GrantDomain)).Methods(http.MethodPost)
+        apiRouter.HandleFunc("/admin/domains/{id}/grants/{userId}", authMiddleware.RequireAdmin(domainHandler.RevokeDomain)).Methods(http.MethodDelete)
+
+        // Short links at the root. They are registered last, so /health and /api keep their routes.
+        registerRootShortLinks(router, urlHandler)
 
         // Configure CORS
         corsMiddleware := cors.New(cors.Options{
                 AllowedOrigins:   []string{"*"}, // Allow all origins in development
-                AllowedMethods:   []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions},
-                AllowedHeaders:   []string{"Content-Type", "Authorization"},
+                AllowedMethods:   []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions},
+                AllowedHeaders:   []string{"Content-Type", "Authorization", "If-Match", "X-Link-Password"},
+                ExposedHeaders:   []string{"ETag"},
                 AllowCredentials: true,
                 MaxAge:           300, // Maximum value not ignored by any of major browsers
         })
@@ -79,6 +173,27 @@ func main() {
                 }
         }()
 
+        // Reload the blocklist files on SIGHUP
+        reload := make(chan os.Signal, 1)
+        signal.Notify(reload, syscall.SIGHUP)
+        go func() {
+                for range reload {
+                        if err := destinationPolicy.Reload(); err != nil {
+                                log.Printf("Error reloading destination policy: %v", err)
+                                continue
+                        }
+                        log.Printf("Reloaded destination policy: %d blocklist entries", destinationPolicy.BlocklistSize())
+                }
+        }()
+
+        // Start the lifecycle worker: scheduled activation, expiry and purging
+        lifecycleCtx, stopLifecycle := context.WithCancel(context.Background())
+        lifecycleDone := make(chan struct{})
+        go func() {
+                defer close(lifecycleDone)
+                newLifecycleWorker(repo, lifecycleConfigFromEnv(storageConfig)).Run(lifecycleCtx)
+        }()
+
         // Wait for interrupt signal to gracefully shut down the server
         quit := make(chan os.Signal, 1)
         signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -89,15 +204,43 @@ func main() {
         ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
         defer cancel()
 
-        // Disconnect from MongoDB
-        if err := db.Disconnect(ctx); err != nil {
-                log.Fatalf("Error disconnecting from MongoDB: %v", err)
-        }
-
-        // Shutdown the server
+        // Shutdown the server first so in-flight requests can still reach storage
         if err := srv.Shutdown(ctx); err != nil {
                 log.Fatalf("Server forced to shutdown: %v", err)
         }
 
+        // Stop the lifecycle worker before the storage backend goes away
+        stopLifecycle()
+        <-lifecycleDone
+
+        // Close the storage backend
+        if err := backend.Close(ctx); err != nil {
+                log.Fatalf("Error closing storage backend: %v", err)
+        }
+
         log.Println("Server gracefully stopped")
-}
\ No newline at end of file
+}
+
+// parsePublicBaseURL checks PUBLIC_BASE_URL, raw, and returns it without a
+// trailing slash, along with its host. Both are empty if raw is.
+func parsePublicBaseURL(raw string) (baseURL, host string, err error) {
+        baseURL = strings.TrimSuffix(raw, "/")
+        if baseURL == "" {
+                return "", "", nil
+        }
+
+        base, err := url.Parse(baseURL)
+        if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+                return "", "", fmt.Errorf("invalid PUBLIC_BASE_URL %q: want an http or https URL", raw)
+        }
+        return baseURL, base.Host, nil
+}
+
+// registerRootShortLinks serves short links at the root of router, e.g.
+// https://sho.rt/abc123, or https://go.team-a.example/abc123 on a branded domain
+func registerRootShortLinks(router *mux.Router, urlHandler *handlers.URLHandler) {
+        router.HandleFunc("/{slug}", urlHandler.RootShortLinks(urlHandler.RedirectShortURL)).Methods(http.MethodGet)
+        router.HandleFunc("/{slug}", urlHandler.RootShortLinks(urlHandler.UnlockShortURL)).Methods(http.MethodPost)
+        router.HandleFunc("/{slug}/{rest:.+}", urlHandler.RootShortLinks(urlHandler.RedirectShortURL)).Methods(http.MethodGet)
+        router.HandleFunc("/{slug}/{rest:.+}", urlHandler.RootShortLinks(urlHandler.UnlockShortURL)).Methods(http.MethodPost)
+}
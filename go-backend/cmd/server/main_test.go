@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"shortlink/internal/database"
+	"shortlink/internal/handlers"
+	"shortlink/internal/models"
+	"shortlink/internal/policy"
+	"shortlink/pkg/urlnorm"
+	"shortlink/pkg/utils"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParsePublicBaseURL(t *testing.T) {
+	tests := []struct {
+		raw     string
+		baseURL string
+		host    string
+		wantErr bool
+	}{
+		{"", "", "", false},
+		{"https://sho.rt", "https://sho.rt", "sho.rt", false},
+		{"https://sho.rt/", "https://sho.rt", "sho.rt", false},
+		{"http://localhost:8080", "http://localhost:8080", "localhost:8080", false},
+		{"https://example.com/s/", "https://example.com/s", "example.com", false},
+		{"sho.rt", "", "", true},
+		{"ftp://sho.rt", "", "", true},
+		{"https://", "", "", true},
+		{"https://sho rt", "", "", true},
+	}
+
+	for _, tt := range tests {
+		baseURL, host, err := parsePublicBaseURL(tt.raw)
+		if baseURL != tt.baseURL || host != tt.host || (err != nil) != tt.wantErr {
+			t.Errorf("parsePublicBaseURL(%q) = %q, %q, %v, want %q, %q, error %v", tt.raw, baseURL, host, err, tt.baseURL, tt.host, tt.wantErr)
+		}
+	}
+}
+
+func TestRootShortLinks(t *testing.T) {
+	ctx := context.Background()
+	repo := database.NewMemoryRepository()
+	slugs, err := utils.NewSlugGenerators(utils.SlugConfig{Strategy: utils.SlugStrategyRandom, Length: 6, Reserved: utils.DefaultReservedSlugs}, nil)
+	if err != nil {
+		t.Fatalf("NewSlugGenerators: %v", err)
+	}
+	engine, err := policy.New(policy.Config{SelfLinks: policy.SelfLinksReject})
+	if err != nil {
+		t.Fatalf("policy.New: %v", err)
+	}
+	urlHandler := handlers.NewURLHandler(repo, handlers.NewDomains(repo), slugs, urlnorm.New(urlnorm.DefaultOptions()), engine, handlers.AvailabilityConfig{}, handlers.LinkAccessConfig{}, handlers.RedirectConfig{}, "https://sho.rt")
+
+	// "Admin" predates the reserved slugs, so it is stored but can't be served at the root
+	userID := primitive.NewObjectID()
+	for slug, destination := range map[string]string{"docs": "https://example.com/docs", "Admin": "https://example.com/admin"} {
+		if _, err := repo.CreateShortURL(ctx, models.ShortURL{UserID: userID, Slug: slug, OriginalURL: destination, Active: true}); err != nil {
+			t.Fatalf("CreateShortURL: %v", err)
+		}
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}).Methods(http.MethodGet)
+	router.HandleFunc("/api/r/{slug}", urlHandler.RedirectShortURL).Methods(http.MethodGet)
+	registerRootShortLinks(router, urlHandler)
+
+	tests := []struct {
+		method   string
+		path     string
+		status   int
+		location string
+	}{
+		{http.MethodGet, "/docs", http.StatusTemporaryRedirect, "https://example.com/docs"},
+		{http.MethodGet, "/missing", http.StatusNotFound, ""},
+		{http.MethodGet, "/docs/more", http.StatusNotFound, ""},
+		{http.MethodGet, "/health", http.StatusOK, ""},
+		{http.MethodGet, "/Admin", http.StatusNotFound, ""},
+		{http.MethodGet, "/ADMIN", http.StatusNotFound, ""},
+		{http.MethodGet, "/Admin/more", http.StatusNotFound, ""},
+		{http.MethodPost, "/Admin", http.StatusNotFound, ""},
+		{http.MethodGet, "/api/r/Admin", http.StatusTemporaryRedirect, "https://example.com/admin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(tt.method, "https://sho.rt"+tt.path, nil))
+			if w.Code != tt.status || w.Header().Get("Location") != tt.location {
+				t.Fatalf("%s %s = %d %q, want %d %q", tt.method, tt.path, w.Code, w.Header().Get("Location"), tt.status, tt.location)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package auth
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// contextKey is the type used for values stored in the request context
+type contextKey string
+
+// userIDKey is the context key holding the authenticated user's ID
+const userIDKey contextKey = "userID"
+
+// WithUserID returns a copy of ctx carrying the authenticated user's ID
+func WithUserID(ctx context.Context, userID primitive.ObjectID) context.Context {
+	return context.WithValue(ctx, userIDKey, userID)
+}
+
+// UserIDFromContext returns the authenticated user's ID, if any
+func UserIDFromContext(ctx context.Context) (primitive.ObjectID, bool) {
+	userID, ok := ctx.Value(userIDKey).(primitive.ObjectID)
+	return userID, ok
+}
@@ -0,0 +1,360 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"shortlink/internal/database"
+	"shortlink/internal/models"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// whoAmI reports the user ID the middleware put in the request context, or "anonymous"
+var whoAmI = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	userID, ok := UserIDFromContext(r.Context())
+	if !ok {
+		w.Write([]byte("anonymous"))
+		return
+	}
+	w.Write([]byte(userID.Hex()))
+})
+
+// createSession stores a session for userID that expires at expiresAt and returns its token
+func createSession(t *testing.T, repo database.Store, userID primitive.ObjectID, expiresAt time.Time) string {
+	t.Helper()
+
+	token, err := GenerateToken()
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	if _, err := repo.CreateSession(context.Background(), models.Session{UserID: userID, TokenHash: HashToken(token), ExpiresAt: expiresAt}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	return token
+}
+
+func TestAuthenticateSession(t *testing.T) {
+	repo := database.NewMemoryRepository()
+	userID := primitive.NewObjectID()
+	token := createSession(t, repo, userID, time.Now().Add(SessionDuration))
+	expired := createSession(t, repo, userID, time.Now().Add(-time.Minute))
+	handler := NewMiddleware(repo).Authenticate(whoAmI)
+
+	tests := []struct {
+		name   string
+		header string
+		cookie string
+		want   string
+	}{
+		{"no credentials", "", "", "anonymous"},
+		{"bearer token", "Bearer " + token, "", userID.Hex()},
+		{"lowercase scheme", "bearer  " + token + " ", "", userID.Hex()},
+		{"session cookie", "", token, userID.Hex()},
+		{"header before cookie", "Bearer " + token, "not-a-session", userID.Hex()},
+		{"other scheme falls back to the cookie", "Basic dXNlcjpwYXNz", token, userID.Hex()},
+		{"unknown token", "Bearer not-a-session", "", "anonymous"},
+		{"unknown cookie", "", "not-a-session", "anonymous"},
+		{"expired session", "Bearer " + expired, "", "anonymous"},
+		{"token hash instead of token", "Bearer " + HashToken(token), "", "anonymous"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/urls", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: SessionCookieName, Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != http.StatusOK || w.Body.String() != tt.want {
+				t.Fatalf("Authenticate = %d %q, want 200 %q", w.Code, w.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticateDeletedSession(t *testing.T) {
+	repo := database.NewMemoryRepository()
+	userID := primitive.NewObjectID()
+	token := createSession(t, repo, userID, time.Now().Add(SessionDuration))
+	handler := NewMiddleware(repo).Authenticate(whoAmI)
+
+	if err := repo.DeleteSession(context.Background(), HashToken(token)); err != nil {
+		t.Fatalf("DeleteSession: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/urls", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Body.String() != "anonymous" {
+		t.Fatalf("Authenticate after logout = %q, want anonymous", w.Body.String())
+	}
+}
+
+func TestSessionCookie(t *testing.T) {
+	expiresAt := time.Now().Add(SessionDuration)
+
+	for _, secure := range []bool{false, true} {
+		r := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+		if secure {
+			r.TLS = &tls.ConnectionState{}
+		}
+
+		w := httptest.NewRecorder()
+		SetSessionCookie(w, r, "token", expiresAt)
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 {
+			t.Fatalf("SetSessionCookie set %d cookies, want 1", len(cookies))
+		}
+		cookie := cookies[0]
+		if cookie.Name != SessionCookieName || cookie.Value != "token" || !cookie.HttpOnly || cookie.Secure != secure || cookie.SameSite != http.SameSiteLaxMode || cookie.Path != "/" {
+			t.Fatalf("SetSessionCookie over TLS %v = %+v", secure, cookie)
+		}
+
+		w = httptest.NewRecorder()
+		ClearSessionCookie(w, r)
+		cookies = w.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Name != SessionCookieName || cookies[0].Value != "" || cookies[0].MaxAge >= 0 {
+			t.Fatalf("ClearSessionCookie = %+v, want an expired session cookie", cookies)
+		}
+	}
+}
+
+func TestPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	if hash == "correct horse" {
+		t.Fatalf("HashPassword returned the password")
+	}
+	if !CheckPassword(hash, "correct horse") {
+		t.Fatalf("CheckPassword rejected the right password")
+	}
+	for _, wrong := range []string{"", "correct horse ", "Correct horse", hash} {
+		if CheckPassword(hash, wrong) {
+			t.Fatalf("CheckPassword accepted %q", wrong)
+		}
+	}
+	if CheckPassword("not a hash", "correct horse") {
+		t.Fatalf("CheckPassword accepted an invalid hash")
+	}
+
+	if _, err := HashPassword(strings.Repeat("a", MaxPasswordLength)); err != nil {
+		t.Fatalf("HashPassword of %d bytes: %v", MaxPasswordLength, err)
+	}
+	if DummyPasswordHash() == "" || DummyPasswordHash() != DummyPasswordHash() {
+		t.Fatalf("DummyPasswordHash = %q, want one stable hash", DummyPasswordHash())
+	}
+	if CheckPassword(DummyPasswordHash(), "correct horse") {
+		t.Fatalf("CheckPassword accepted a password for the dummy hash")
+	}
+}
+
+func TestGenerateToken(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		token, err := GenerateToken()
+		if err != nil {
+			t.Fatalf("GenerateToken: %v", err)
+		}
+		if len(token) != 43 || seen[token] || IsAPIKey(token) {
+			t.Fatalf("GenerateToken = %q", token)
+		}
+		seen[token] = true
+	}
+
+	if HashToken("a") == HashToken("b") || HashToken("a") != HashToken("a") || len(HashToken("a")) != 64 {
+		t.Fatalf("HashToken isn't a stable SHA-256 hex digest")
+	}
+}
+
+// createAPIKey issues an API key with scopes to userID and returns the key and its record
+func createAPIKey(t *testing.T, repo database.Store, userID primitive.ObjectID, scopes []string) (string, *models.APIKey) {
+	t.Helper()
+
+	key, prefix, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("GenerateAPIKey: %v", err)
+	}
+	apiKey, err := repo.CreateAPIKey(context.Background(), models.APIKey{UserID: userID, Name: "ci", Prefix: prefix, KeyHash: HashToken(key), Scopes: scopes})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	return key, apiKey
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	ctx := context.Background()
+	repo := database.NewMemoryRepository()
+	userID := primitive.NewObjectID()
+	key, apiKey := createAPIKey(t, repo, userID, []string{ScopeRead})
+	revoked, revokedKey := createAPIKey(t, repo, userID, AllScopes)
+	if err := repo.RevokeAPIKey(ctx, revokedKey.ID, userID); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+
+	var scopes []string
+	var restricted bool
+	handler := NewMiddleware(repo).Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scopes, restricted = ScopesFromContext(r.Context())
+		whoAmI(w, r)
+	}))
+
+	tests := []struct {
+		name   string
+		header string
+		cookie string
+		status int
+		want   string
+	}{
+		{"bearer key", "Bearer " + key, "", http.StatusOK, userID.Hex()},
+		{"key in the session cookie", "", key, http.StatusOK, userID.Hex()},
+		{"unknown key", "Bearer " + APIKeyPrefix + "unknown", "", http.StatusUnauthorized, ""},
+		{"revoked key", "Bearer " + revoked, "", http.StatusUnauthorized, ""},
+		{"key without its prefix", "Bearer " + key[len(APIKeyPrefix):], "", http.StatusOK, "anonymous"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scopes, restricted = nil, false
+			r := httptest.NewRequest(http.MethodPost, "/api/urls", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: SessionCookieName, Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("Authenticate = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			if w.Body.String() != tt.want {
+				t.Fatalf("Authenticate = %q, want %q", w.Body.String(), tt.want)
+			}
+			if wantRestricted := tt.want != "anonymous"; restricted != wantRestricted || (restricted && (len(scopes) != 1 || scopes[0] != ScopeRead)) {
+				t.Fatalf("scopes = %q, %v, want the key's scopes", scopes, restricted)
+			}
+		})
+	}
+
+	keys, err := repo.GetAPIKeysByUser(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetAPIKeysByUser: %v", err)
+	}
+	for _, k := range keys {
+		switch k.ID {
+		case apiKey.ID:
+			if k.LastUsedAt == nil {
+				t.Fatalf("LastUsedAt wasn't recorded for a key that was used")
+			}
+		case revokedKey.ID:
+			if k.LastUsedAt != nil {
+				t.Fatalf("LastUsedAt was recorded for a revoked key")
+			}
+		}
+	}
+}
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, prefix, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("GenerateAPIKey: %v", err)
+	}
+	if !IsAPIKey(key) || len(prefix) != apiKeyDisplayLength || key[:len(prefix)] != prefix {
+		t.Fatalf("GenerateAPIKey = %q, %q", key, prefix)
+	}
+
+	other, _, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("GenerateAPIKey: %v", err)
+	}
+	if other == key {
+		t.Fatalf("GenerateAPIKey returned %q twice", key)
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	ctx := context.Background()
+	repo := database.NewMemoryRepository()
+	admin, err := repo.CreateUser(ctx, models.User{Username: "admin", Role: models.RoleAdmin})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	user, err := repo.CreateUser(ctx, models.User{Username: "user"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	handler := NewMiddleware(repo).RequireAdmin(whoAmI)
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		status int
+	}{
+		{"anonymous", ctx, http.StatusUnauthorized},
+		{"user", WithUserID(ctx, user.ID), http.StatusForbidden},
+		{"unknown user", WithUserID(ctx, primitive.NewObjectID()), http.StatusForbidden},
+		{"admin", WithUserID(ctx, admin.ID), http.StatusOK},
+		{"admin's read-scoped API key", WithScopes(WithUserID(ctx, admin.ID), []string{ScopeRead}), http.StatusForbidden},
+		{"admin's API key with every scope", WithScopes(WithUserID(ctx, admin.ID), AllScopes), http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(http.MethodGet, "/api/admin/stats", nil).WithContext(tt.ctx))
+			if w.Code != tt.status {
+				t.Fatalf("RequireAdmin = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestRequireAdminRejectsAPIKeys(t *testing.T) {
+	repo := database.NewMemoryRepository()
+	admin, err := repo.CreateUser(context.Background(), models.User{Username: "admin", Role: models.RoleAdmin})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	key, _ := createAPIKey(t, repo, admin.ID, []string{ScopeRead})
+	session := createSession(t, repo, admin.ID, time.Now().Add(time.Hour))
+	middleware := NewMiddleware(repo)
+	handler := middleware.Authenticate(middleware.RequireAdmin(whoAmI))
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"session", session, http.StatusOK},
+		{"read-scoped API key", key, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/admin/policy/reload", nil)
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("RequireAdmin = %d %s, want %d", w.Code, w.Body, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MaxPasswordLength is the longest password, in bytes, that bcrypt can hash
+const MaxPasswordLength = 72
+
+// HashPassword returns the bcrypt hash of a plaintext password
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether password matches the stored bcrypt hash
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// DummyPasswordHash returns a bcrypt hash to check passwords against when an
+// account doesn't exist. It takes as long as checking a real account, so
+// response times don't reveal which usernames are registered.
+var DummyPasswordHash = sync.OnceValue(func() string {
+	// Hashing can only fail for passwords longer than MaxPasswordLength
+	hash, _ := HashPassword("not a real password")
+	return hash
+})
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+)
+
+// API key scopes
+const (
+	ScopeRead      = "read"
+	ScopeCreate    = "create"
+	ScopeUpdate    = "update"
+	ScopeDelete    = "delete"
+	ScopeAnalytics = "analytics"
+)
+
+// AllScopes lists every scope an API key may be granted
+var AllScopes = []string{ScopeRead, ScopeCreate, ScopeUpdate, ScopeDelete, ScopeAnalytics}
+
+// DefaultScopes are granted to API keys issued without an explicit scope list
+var DefaultScopes = []string{ScopeRead, ScopeCreate}
+
+// scopesKey is the context key holding the scopes of the API key used for the request
+const scopesKey contextKey = "scopes"
+
+// IsValidScope reports whether scope is a known API key scope
+func IsValidScope(scope string) bool {
+	for _, s := range AllScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// WithScopes returns a copy of ctx restricted to the given API key scopes
+func WithScopes(ctx context.Context, scopes []string) context.Context {
+	return context.WithValue(ctx, scopesKey, scopes)
+}
+
+// ScopesFromContext returns the scopes the request is restricted to.
+// The boolean is false for session-authenticated requests, which are unrestricted.
+func ScopesFromContext(ctx context.Context) ([]string, bool) {
+	scopes, ok := ctx.Value(scopesKey).([]string)
+	return scopes, ok
+}
+
+// HasScope reports whether the request may perform actions requiring scope
+func HasScope(ctx context.Context, scope string) bool {
+	scopes, restricted := ScopesFromContext(ctx)
+	if !restricted {
+		return true
+	}
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireScope rejects API key requests whose key lacks scope.
+// Session and unauthenticated requests are passed through to the handler.
+func RequireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !HasScope(r.Context(), scope) {
+			http.Error(w, "API key is missing the \""+scope+"\" scope", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsValidScope(t *testing.T) {
+	for _, scope := range AllScopes {
+		if !IsValidScope(scope) {
+			t.Errorf("IsValidScope(%q) = false", scope)
+		}
+	}
+	for _, scope := range []string{"", "admin", "READ", " read", "*"} {
+		if IsValidScope(scope) {
+			t.Errorf("IsValidScope(%q) = true", scope)
+		}
+	}
+	for _, scope := range DefaultScopes {
+		if !IsValidScope(scope) {
+			t.Errorf("default scope %q isn't valid", scope)
+		}
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		scope string
+		want  bool
+	}{
+		{"session", context.Background(), ScopeDelete, true},
+		{"granted", WithScopes(context.Background(), []string{ScopeRead, ScopeCreate}), ScopeCreate, true},
+		{"not granted", WithScopes(context.Background(), []string{ScopeRead, ScopeCreate}), ScopeDelete, false},
+		{"no scopes", WithScopes(context.Background(), []string{}), ScopeRead, false},
+		{"nil scopes", WithScopes(context.Background(), nil), ScopeRead, false},
+	}
+
+	for _, tt := range tests {
+		if got := HasScope(tt.ctx, tt.scope); got != tt.want {
+			t.Errorf("%s: HasScope(%q) = %v, want %v", tt.name, tt.scope, got, tt.want)
+		}
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	handler := RequireScope(ScopeAnalytics, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		status int
+	}{
+		{"anonymous", context.Background(), http.StatusNoContent},
+		{"key with the scope", WithScopes(context.Background(), []string{ScopeRead, ScopeAnalytics}), http.StatusNoContent},
+		{"key without the scope", WithScopes(context.Background(), []string{ScopeRead}), http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(http.MethodGet, "/api/analytics", nil).WithContext(tt.ctx))
+			if w.Code != tt.status {
+				t.Fatalf("RequireScope = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// tokenBytes is the amount of randomness in a generated token
+const tokenBytes = 32
+
+// GenerateToken creates a random URL-safe token
+func GenerateToken() (string, error) {
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hex-encoded SHA-256 hash of a token.
+// Only hashes are stored, so a leaked database does not leak live credentials.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyPrefix marks bearer tokens that are API keys rather than session tokens
+const APIKeyPrefix = "slk_"
+
+// apiKeyDisplayLength is how much of a key is kept in clear text to identify it in listings
+const apiKeyDisplayLength = len(APIKeyPrefix) + 8
+
+// GenerateAPIKey creates a new API key and returns it with its display prefix
+func GenerateAPIKey() (key string, prefix string, err error) {
+	token, err := GenerateToken()
+	if err != nil {
+		return "", "", err
+	}
+	key = APIKeyPrefix + token
+	return key, key[:apiKeyDisplayLength], nil
+}
+
+// IsAPIKey reports whether a bearer token looks like an API key
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
@@ -0,0 +1,196 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Storage backend names accepted by STORAGE_BACKEND
+const (
+	BackendMongo    = "mongo"
+	BackendMemory   = "memory"
+	BackendBolt     = "bolt"
+	BackendPostgres = "postgres"
+)
+
+// Config selects and configures the storage backend
+type Config struct {
+	// Backend is the name of the storage backend to open
+	Backend string
+
+	// AllowMemoryFallback lets the server start with the in-memory backend
+	// when the configured backend cannot be reached. Intended for development only.
+	AllowMemoryFallback bool
+
+	MongoURI      string
+	MongoDatabase string
+
+	// BoltPath is the database file used by the bolt backend
+	BoltPath string
+
+	// PostgresURL is the connection string used by the postgres backend
+	PostgresURL string
+
+	// TrashRetention is how long deleted links stay in the trash before they
+	// are purged. Zero keeps them forever.
+	TrashRetention time.Duration
+
+	// ExpiredRetention is how long links are kept after they expire before
+	// they are purged. Zero keeps them forever.
+	ExpiredRetention time.Duration
+}
+
+// ConfigFromEnv reads the storage configuration from environment variables
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Backend:        strings.ToLower(strings.TrimSpace(os.Getenv("STORAGE_BACKEND"))),
+		MongoURI:       os.Getenv("MONGODB_URI"),
+		MongoDatabase:  os.Getenv("MONGODB_DATABASE"),
+		BoltPath:       os.Getenv("BOLT_PATH"),
+		PostgresURL:    os.Getenv("DATABASE_URL"),
+		TrashRetention: 30 * 24 * time.Hour,
+	}
+
+	if cfg.Backend == "" {
+		cfg.Backend = BackendMongo
+	}
+	if cfg.MongoURI == "" {
+		cfg.MongoURI = "mongodb://localhost:27017"
+	}
+	if cfg.MongoDatabase == "" {
+		cfg.MongoDatabase = "shortlink"
+	}
+	if cfg.BoltPath == "" {
+		cfg.BoltPath = "shortlink.db"
+	}
+
+	if fallback, err := strconv.ParseBool(os.Getenv("STORAGE_ALLOW_MEMORY_FALLBACK")); err == nil {
+		cfg.AllowMemoryFallback = fallback
+	}
+	if retention, err := time.ParseDuration(os.Getenv("TRASH_RETENTION")); err == nil {
+		cfg.TrashRetention = retention
+	}
+	if retention, err := time.ParseDuration(os.Getenv("EXPIRED_RETENTION")); err == nil {
+		cfg.ExpiredRetention = retention
+	}
+
+	return cfg
+}
+
+// Backend is an opened storage backend
+type Backend struct {
+	// Name is the backend actually in use
+	Name string
+
+	// Fallback is true when Name differs from the configured backend
+	// because AllowMemoryFallback kicked in
+	Fallback bool
+
+	Store Store
+
+	ping  func(ctx context.Context) error
+	close func(ctx context.Context) error
+}
+
+// errUnknownBackend is returned by open when cfg.Backend isn't a known backend
+var errUnknownBackend = errors.New("unknown storage backend")
+
+// Open connects to the configured storage backend.
+// It fails if the backend cannot be reached, unless the memory fallback is enabled.
+// An unknown backend is a configuration mistake and always fails.
+func Open(ctx context.Context, cfg Config) (*Backend, error) {
+	backend, err := open(ctx, cfg)
+	if err == nil {
+		return backend, nil
+	}
+
+	if !cfg.AllowMemoryFallback || cfg.Backend == BackendMemory || errors.Is(err, errUnknownBackend) {
+		return nil, err
+	}
+
+	log.Printf("WARNING: %v", err)
+	log.Println("WARNING: falling back to the in-memory backend; all data will be lost on restart")
+
+	backend = openMemory()
+	backend.Fallback = true
+	return backend, nil
+}
+
+// open connects to cfg.Backend without any fallback
+func open(ctx context.Context, cfg Config) (*Backend, error) {
+	switch cfg.Backend {
+	case BackendMongo:
+		db, err := ConnectMongo(ctx, cfg.MongoURI, cfg.MongoDatabase)
+		if err != nil {
+			return nil, fmt.Errorf("connecting to MongoDB: %w", err)
+		}
+		if err := db.EnsureIndexes(ctx); err != nil {
+			db.Disconnect(ctx)
+			return nil, err
+		}
+		return &Backend{
+			Name:  BackendMongo,
+			Store: NewMongoRepository(db),
+			ping:  db.Ping,
+			close: db.Disconnect,
+		}, nil
+	case BackendBolt:
+		db, err := OpenBolt(cfg.BoltPath)
+		if err != nil {
+			return nil, fmt.Errorf("opening bolt database %s: %w", cfg.BoltPath, err)
+		}
+		return &Backend{
+			Name:  BackendBolt,
+			Store: NewBoltRepository(db),
+			ping:  func(ctx context.Context) error { return nil },
+			close: func(ctx context.Context) error { return db.Close() },
+		}, nil
+	case BackendPostgres:
+		if cfg.PostgresURL == "" {
+			return nil, errors.New("DATABASE_URL must be set for the postgres backend")
+		}
+		pool, err := OpenPostgres(ctx, cfg.PostgresURL)
+		if err != nil {
+			return nil, fmt.Errorf("connecting to PostgreSQL: %w", err)
+		}
+		return &Backend{
+			Name:  BackendPostgres,
+			Store: NewPostgresRepository(pool),
+			ping:  pool.Ping,
+			close: func(ctx context.Context) error {
+				pool.Close()
+				return nil
+			},
+		}, nil
+	case BackendMemory:
+		return openMemory(), nil
+	default:
+		return nil, fmt.Errorf("%w %q", errUnknownBackend, cfg.Backend)
+	}
+}
+
+// openMemory returns a fresh in-memory backend
+func openMemory() *Backend {
+	return &Backend{
+		Name:  BackendMemory,
+		Store: NewMemoryRepository(),
+		ping:  func(ctx context.Context) error { return nil },
+		close: func(ctx context.Context) error { return nil },
+	}
+}
+
+// Ping checks that the backend is reachable
+func (b *Backend) Ping(ctx context.Context) error {
+	return b.ping(ctx)
+}
+
+// Close releases the backend's connections
+func (b *Backend) Close(ctx context.Context) error {
+	return b.close(ctx)
+}
@@ -0,0 +1,48 @@
+package database_test
+
+import (
+	"context"
+	"path/filepath"
+	"shortlink/internal/database"
+	"testing"
+)
+
+func TestOpenMemoryFallback(t *testing.T) {
+	// A bolt file in a directory that doesn't exist can't be opened
+	unreachable := filepath.Join(t.TempDir(), "missing", "shortlink.db")
+
+	tests := []struct {
+		name     string
+		cfg      database.Config
+		wantErr  bool
+		backend  string
+		fallback bool
+	}{
+		{"memory", database.Config{Backend: database.BackendMemory}, false, database.BackendMemory, false},
+		{"unreachable", database.Config{Backend: database.BackendBolt, BoltPath: unreachable}, true, "", false},
+		{"unreachable with fallback", database.Config{Backend: database.BackendBolt, BoltPath: unreachable, AllowMemoryFallback: true}, false, database.BackendMemory, true},
+		{"unknown", database.Config{Backend: "mangodb"}, true, "", false},
+		{"unknown with fallback", database.Config{Backend: "mangodb", AllowMemoryFallback: true}, true, "", false},
+		{"empty with fallback", database.Config{AllowMemoryFallback: true}, true, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend, err := database.Open(context.Background(), tt.cfg)
+			if tt.wantErr {
+				if err == nil {
+					backend.Close(context.Background())
+					t.Fatalf("Open = %s backend, want an error", backend.Name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			defer backend.Close(context.Background())
+			if backend.Name != tt.backend || backend.Fallback != tt.fallback {
+				t.Fatalf("Open = %s backend, fallback %v, want %s, fallback %v", backend.Name, backend.Fallback, tt.backend, tt.fallback)
+			}
+		})
+	}
+}
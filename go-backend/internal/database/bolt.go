@@ -0,0 +1,198 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Buckets used by the embedded bbolt backend
+var (
+	boltMetaBucket               = []byte("meta")
+	boltShortURLBucket           = []byte(ShortURLCollection)
+	boltShortURLSlugBucket       = []byte("shortUrlSlugs")
+	boltShortURLUserBucket       = []byte("shortUrlsByUser")
+	boltClickEventBucket         = []byte(ClickEventCollection)
+	boltClickEventShortURLIndex  = []byte("clickEventsByShortUrl")
+	boltUserBucket               = []byte(UserCollection)
+	boltUsernameBucket           = []byte("usernames")
+	boltSessionBucket            = []byte(SessionCollection)
+	boltAPIKeyBucket             = []byte(APIKeyCollection)
+	boltAPIKeyHashBucket         = []byte("apiKeyHashes")
+	boltSequenceBucket           = []byte(SequenceCollection)
+	boltShortURLDestinationIndex = []byte("shortUrlsByDestination")
+	boltShortURLRevisionBucket   = []byte(ShortURLRevisionCollection)
+	boltShortURLTrashIndex       = []byte("shortUrlsByDeletedAt")
+	boltDomainBucket             = []byte(DomainCollection)
+	boltDomainHostBucket         = []byte("domainHosts")
+)
+
+// boltSchemaVersionKey holds the number of applied migrations in the meta bucket
+var boltSchemaVersionKey = []byte("schemaVersion")
+
+// boltMigrations upgrade the bucket layout one version at a time.
+// Append new migrations to the end; never edit or reorder applied ones.
+var boltMigrations = []func(tx *bbolt.Tx) error{
+	// 1: initial layout
+	func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{
+			boltShortURLBucket,
+			boltShortURLSlugBucket,
+			boltShortURLUserBucket,
+			boltClickEventBucket,
+			boltClickEventShortURLIndex,
+			boltUserBucket,
+			boltUsernameBucket,
+			boltSessionBucket,
+			boltAPIKeyBucket,
+			boltAPIKeyHashBucket,
+		} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+
+	// 2: named sequences
+	func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltSequenceBucket)
+		return err
+	},
+
+	// 3: (userId, normalizedUrl) index for deduplication
+	func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltShortURLDestinationIndex)
+		return err
+	},
+
+	// 4: revision history, keyed by short URL ID and version
+	func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltShortURLRevisionBucket)
+		return err
+	},
+
+	// 5: trashed short URLs, keyed by deletion time
+	func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltShortURLTrashIndex)
+		return err
+	},
+
+	// 6: branded domains, and their hosts. Slugs on the default domain keep
+	// their keys, so the slug bucket needs no change.
+	func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{boltDomainBucket, boltDomainHostBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// OpenBolt opens (creating if needed) the bbolt database file at path and
+// applies any pending schema migrations
+func OpenBolt(path string) (*bbolt.DB, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrateBolt(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// migrateBolt applies the migrations newer than the stored schema version
+func migrateBolt(db *bbolt.DB) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(boltMetaBucket)
+		if err != nil {
+			return err
+		}
+
+		version := uint64(0)
+		if raw := meta.Get(boltSchemaVersionKey); raw != nil {
+			version = binary.BigEndian.Uint64(raw)
+		}
+		if version > uint64(len(boltMigrations)) {
+			return fmt.Errorf("database schema version %d is newer than this server supports (%d)", version, len(boltMigrations))
+		}
+
+		for ; version < uint64(len(boltMigrations)); version++ {
+			if err := boltMigrations[version](tx); err != nil {
+				return fmt.Errorf("applying migration %d: %w", version+1, err)
+			}
+		}
+
+		raw := make([]byte, 8)
+		binary.BigEndian.PutUint64(raw, version)
+		return meta.Put(boltSchemaVersionKey, raw)
+	})
+}
+
+// boltPut stores v as a BSON document under key
+func boltPut(bucket *bbolt.Bucket, key []byte, v interface{}) error {
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, data)
+}
+
+// boltGet decodes the BSON document stored under key into v.
+// It reports false if there is no such key.
+func boltGet(bucket *bbolt.Bucket, key []byte, v interface{}) (bool, error) {
+	data := bucket.Get(key)
+	if data == nil {
+		return false, nil
+	}
+	return true, boltDecode(data, v)
+}
+
+// boltDecode decodes a stored BSON document into v
+func boltDecode(data []byte, v interface{}) error {
+	return bson.Unmarshal(data, v)
+}
+
+// boltSlugKey is the shortUrlSlugs key for slug on domain. Links on the
+// default domain are keyed by the bare slug; the others are prefixed with
+// their host and a slash, which neither slugs nor hosts can contain.
+func boltSlugKey(domain, slug string) []byte {
+	if domain == "" {
+		return []byte(slug)
+	}
+	return []byte(domain + "/" + slug)
+}
+
+// boltDestinationPrefix is the shortUrlsByDestination key prefix for a user's links to
+// normalizedURL. The URL is hashed so that every prefix has the same length.
+func boltDestinationPrefix(userID primitive.ObjectID, normalizedURL string) []byte {
+	sum := sha256.Sum256([]byte(normalizedURL))
+	return boltIndexKey(userID[:], sum[:])
+}
+
+// boltTrashKey is the shortUrlsByDeletedAt key for a trashed short URL.
+// The deletion time comes first, big-endian, so keys sort oldest first.
+func boltTrashKey(deletedAt time.Time, id primitive.ObjectID) []byte {
+	raw := make([]byte, 8)
+	binary.BigEndian.PutUint64(raw, uint64(deletedAt.UnixMilli()))
+	return boltIndexKey(raw, id[:])
+}
+
+// boltIndexKey joins the parts of a composite index key
+func boltIndexKey(parts ...[]byte) []byte {
+	var key []byte
+	for _, part := range parts {
+		key = append(key, part...)
+	}
+	return key
+}
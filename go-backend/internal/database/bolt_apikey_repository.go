@@ -0,0 +1,121 @@
+package database
+
+import (
+	"context"
+	"shortlink/internal/models"
+	"sort"
+	"time"
+
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CreateAPIKey stores a newly issued API key
+func (r *BoltRepository) CreateAPIKey(ctx context.Context, apiKey models.APIKey) (*models.APIKey, error) {
+	// Generate new ID if not set
+	if apiKey.ID.IsZero() {
+		apiKey.ID = primitive.NewObjectID()
+	}
+	apiKey.CreatedAt = time.Now().Truncate(time.Millisecond)
+
+	err := r.db.Update(func(tx *bbolt.Tx) error {
+		if err := boltPut(tx.Bucket(boltAPIKeyBucket), apiKey.ID[:], apiKey); err != nil {
+			return err
+		}
+		return tx.Bucket(boltAPIKeyHashBucket).Put([]byte(apiKey.KeyHash), apiKey.ID[:])
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiKey, nil
+}
+
+// GetAPIKeyByHash retrieves an unrevoked API key by the hash of its secret
+func (r *BoltRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	var apiKey *models.APIKey
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		id := tx.Bucket(boltAPIKeyHashBucket).Get([]byte(keyHash))
+		if id == nil {
+			return nil
+		}
+
+		var err error
+		apiKey, err = boltGetAPIKey(tx, id)
+		return err
+	})
+	if err != nil || apiKey == nil || apiKey.RevokedAt != nil {
+		return nil, err
+	}
+
+	return apiKey, nil
+}
+
+// GetAPIKeysByUser retrieves all API keys issued to a user, including revoked ones
+func (r *BoltRepository) GetAPIKeysByUser(ctx context.Context, userID primitive.ObjectID) ([]models.APIKey, error) {
+	apiKeys := make([]models.APIKey, 0)
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltAPIKeyBucket).ForEach(func(_, data []byte) error {
+			var apiKey models.APIKey
+			if err := boltDecode(data, &apiKey); err != nil {
+				return err
+			}
+			if apiKey.UserID == userID {
+				apiKeys = append(apiKeys, apiKey)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Sort by creation date, newest first
+	sort.Slice(apiKeys, func(i, j int) bool {
+		return apiKeys[i].CreatedAt.After(apiKeys[j].CreatedAt)
+	})
+
+	return apiKeys, nil
+}
+
+// RevokeAPIKey marks a user's API key as revoked.
+// It returns ErrNotFound if the key does not exist, belongs to another user or is already revoked.
+func (r *BoltRepository) RevokeAPIKey(ctx context.Context, id, userID primitive.ObjectID) error {
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		apiKey, err := boltGetAPIKey(tx, id[:])
+		if err != nil {
+			return err
+		}
+		if apiKey == nil || apiKey.UserID != userID || apiKey.RevokedAt != nil {
+			return ErrNotFound
+		}
+
+		now := time.Now()
+		apiKey.RevokedAt = &now
+		return boltPut(tx.Bucket(boltAPIKeyBucket), id[:], apiKey)
+	})
+}
+
+// TouchAPIKey records that an API key was just used
+func (r *BoltRepository) TouchAPIKey(ctx context.Context, id primitive.ObjectID) error {
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		apiKey, err := boltGetAPIKey(tx, id[:])
+		if err != nil || apiKey == nil {
+			return err
+		}
+
+		now := time.Now()
+		apiKey.LastUsedAt = &now
+		return boltPut(tx.Bucket(boltAPIKeyBucket), id[:], apiKey)
+	})
+}
+
+// boltGetAPIKey loads an API key by raw ID, returning nil if it does not exist
+func boltGetAPIKey(tx *bbolt.Tx, id []byte) (*models.APIKey, error) {
+	var apiKey models.APIKey
+	found, err := boltGet(tx.Bucket(boltAPIKeyBucket), id, &apiKey)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &apiKey, nil
+}
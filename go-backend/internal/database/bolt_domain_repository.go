@@ -0,0 +1,162 @@
+package database
+
+import (
+	"context"
+	"shortlink/internal/models"
+	"sort"
+	"time"
+
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CreateDomain registers a branded domain
+func (r *BoltRepository) CreateDomain(ctx context.Context, domain models.Domain) (*models.Domain, error) {
+	// Generate new ID if not set
+	if domain.ID.IsZero() {
+		domain.ID = primitive.NewObjectID()
+	}
+	domain.CreatedAt = time.Now().Truncate(time.Millisecond)
+	if domain.UserIDs == nil {
+		domain.UserIDs = []primitive.ObjectID{}
+	}
+
+	err := r.db.Update(func(tx *bbolt.Tx) error {
+		hosts := tx.Bucket(boltDomainHostBucket)
+		if hosts.Get([]byte(domain.Host)) != nil {
+			return ErrDomainTaken
+		}
+
+		if err := boltPut(tx.Bucket(boltDomainBucket), domain.ID[:], domain); err != nil {
+			return err
+		}
+		return hosts.Put([]byte(domain.Host), domain.ID[:])
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain, nil
+}
+
+// GetDomain retrieves a domain by ID
+func (r *BoltRepository) GetDomain(ctx context.Context, id primitive.ObjectID) (*models.Domain, error) {
+	var domain *models.Domain
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		domain, err = boltGetDomain(tx, id[:])
+		return err
+	})
+	return domain, err
+}
+
+// GetDomainByHost retrieves a domain by host
+func (r *BoltRepository) GetDomainByHost(ctx context.Context, host string) (*models.Domain, error) {
+	var domain *models.Domain
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		id := tx.Bucket(boltDomainHostBucket).Get([]byte(host))
+		if id == nil {
+			return nil
+		}
+
+		var err error
+		domain, err = boltGetDomain(tx, id)
+		return err
+	})
+	return domain, err
+}
+
+// GetDomains retrieves every registered domain
+func (r *BoltRepository) GetDomains(ctx context.Context) ([]models.Domain, error) {
+	return r.listDomains(func(models.Domain) bool { return true })
+}
+
+// GetDomainsByUser retrieves the domains userID has been granted
+func (r *BoltRepository) GetDomainsByUser(ctx context.Context, userID primitive.ObjectID) ([]models.Domain, error) {
+	return r.listDomains(func(domain models.Domain) bool {
+		return hasUser(domain.UserIDs, userID)
+	})
+}
+
+// GrantDomain lets userID create links on a domain
+func (r *BoltRepository) GrantDomain(ctx context.Context, id, userID primitive.ObjectID) (*models.Domain, error) {
+	return r.updateDomainGrants(id, func(userIDs []primitive.ObjectID) []primitive.ObjectID {
+		if hasUser(userIDs, userID) {
+			return userIDs
+		}
+		return append(userIDs, userID)
+	})
+}
+
+// RevokeDomain stops userID creating links on a domain. Links already on the
+// domain are left alone.
+func (r *BoltRepository) RevokeDomain(ctx context.Context, id, userID primitive.ObjectID) (*models.Domain, error) {
+	return r.updateDomainGrants(id, func(userIDs []primitive.ObjectID) []primitive.ObjectID {
+		kept := make([]primitive.ObjectID, 0, len(userIDs))
+		for _, granted := range userIDs {
+			if granted != userID {
+				kept = append(kept, granted)
+			}
+		}
+		return kept
+	})
+}
+
+// updateDomainGrants replaces the grants of a domain with fn applied to them
+func (r *BoltRepository) updateDomainGrants(id primitive.ObjectID, fn func([]primitive.ObjectID) []primitive.ObjectID) (*models.Domain, error) {
+	var domain *models.Domain
+	err := r.db.Update(func(tx *bbolt.Tx) error {
+		var err error
+		domain, err = boltGetDomain(tx, id[:])
+		if err != nil {
+			return err
+		}
+		if domain == nil {
+			return ErrNotFound
+		}
+
+		domain.UserIDs = fn(domain.UserIDs)
+		return boltPut(tx.Bucket(boltDomainBucket), id[:], domain)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return domain, nil
+}
+
+// listDomains returns the domains matching fn, sorted by host
+func (r *BoltRepository) listDomains(fn func(models.Domain) bool) ([]models.Domain, error) {
+	domains := make([]models.Domain, 0)
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltDomainBucket).ForEach(func(_, data []byte) error {
+			var domain models.Domain
+			if err := boltDecode(data, &domain); err != nil {
+				return err
+			}
+			if fn(domain) {
+				domains = append(domains, domain)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(domains, func(i, j int) bool {
+		return domains[i].Host < domains[j].Host
+	})
+
+	return domains, nil
+}
+
+// boltGetDomain loads a domain by raw ID, returning nil if it does not exist
+func boltGetDomain(tx *bbolt.Tx, id []byte) (*models.Domain, error) {
+	var domain models.Domain
+	found, err := boltGet(tx.Bucket(boltDomainBucket), id, &domain)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &domain, nil
+}
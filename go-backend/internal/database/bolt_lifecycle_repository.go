@@ -0,0 +1,106 @@
+package database
+
+import (
+	"context"
+	"shortlink/internal/models"
+	"time"
+
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ActivateScheduledShortURLs activates the short URLs whose activation time has passed
+func (r *BoltRepository) ActivateScheduledShortURLs(ctx context.Context, now time.Time) ([]models.ShortURL, error) {
+	return r.updateShortURLs(func(shortURL *models.ShortURL) bool {
+		if shortURL.DeletedAt != nil || shortURL.ActivateAt == nil || shortURL.ActivateAt.After(now) {
+			return false
+		}
+		shortURL.Active = true
+		shortURL.ActivateAt = nil
+		return true
+	})
+}
+
+// ExpireShortURLs deactivates the active short URLs whose expiry time has passed
+func (r *BoltRepository) ExpireShortURLs(ctx context.Context, now time.Time) ([]models.ShortURL, error) {
+	return r.updateShortURLs(func(shortURL *models.ShortURL) bool {
+		if shortURL.DeletedAt != nil || !shortURL.Active || shortURL.ExpiresAt == nil || shortURL.ExpiresAt.After(now) {
+			return false
+		}
+		shortURL.Active = false
+		return true
+	})
+}
+
+// PurgeExpiredShortURLs permanently removes the short URLs that expired before
+// expiredBefore, along with their click events and history
+func (r *BoltRepository) PurgeExpiredShortURLs(ctx context.Context, expiredBefore time.Time) (int, error) {
+	purged := 0
+	err := r.db.Update(func(tx *bbolt.Tx) error {
+		// Collect the IDs first; purging while iterating skips entries
+		var expired []primitive.ObjectID
+		err := tx.Bucket(boltShortURLBucket).ForEach(func(key, data []byte) error {
+			var shortURL models.ShortURL
+			if err := boltDecode(data, &shortURL); err != nil {
+				return err
+			}
+			if shortURL.ExpiresAt != nil && shortURL.ExpiresAt.Before(expiredBefore) {
+				expired = append(expired, shortURL.ID)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, id := range expired {
+			if err := boltPurgeShortURL(tx, id); err != nil {
+				return err
+			}
+		}
+		purged = len(expired)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
+
+// updateShortURLs applies fn to every short URL in one transaction, saving and
+// returning those it changed with their version incremented
+func (r *BoltRepository) updateShortURLs(fn func(*models.ShortURL) bool) ([]models.ShortURL, error) {
+	changed := make([]models.ShortURL, 0)
+	err := r.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(boltShortURLBucket)
+
+		err := bucket.ForEach(func(_, data []byte) error {
+			var shortURL models.ShortURL
+			if err := boltDecode(data, &shortURL); err != nil {
+				return err
+			}
+			if fn(&shortURL) {
+				shortURL.Version++
+				changed = append(changed, shortURL)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// Write back after iterating; modifying a bucket during ForEach is not allowed
+		for i := range changed {
+			if err := boltPut(bucket, changed[i].ID[:], changed[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return changed, nil
+}
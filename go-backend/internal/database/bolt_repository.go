@@ -0,0 +1,561 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"shortlink/internal/models"
+	"sort"
+	"time"
+
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// BoltRepository is an embedded, file-backed implementation of Store using bbolt
+type BoltRepository struct {
+	db *bbolt.DB
+}
+
+// NewBoltRepository creates a repository backed by an open bbolt database
+func NewBoltRepository(db *bbolt.DB) *BoltRepository {
+	return &BoltRepository{
+		db: db,
+	}
+}
+
+// GetShortURL retrieves a short URL by ID
+func (r *BoltRepository) GetShortURL(ctx context.Context, id primitive.ObjectID) (*models.ShortURL, error) {
+	var shortURL *models.ShortURL
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		shortURL, err = boltGetShortURL(tx, id)
+		return err
+	})
+	return shortURL, err
+}
+
+// GetShortURLBySlug retrieves a short URL by its domain and slug
+func (r *BoltRepository) GetShortURLBySlug(ctx context.Context, domain, slug string) (*models.ShortURL, error) {
+	var shortURL *models.ShortURL
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		id := tx.Bucket(boltShortURLSlugBucket).Get(boltSlugKey(domain, slug))
+		if id == nil {
+			return nil
+		}
+
+		var err error
+		shortURL, err = boltGetShortURL(tx, primitive.ObjectID(id))
+		if err == nil && shortURL == nil {
+			return errors.New("inconsistent state: slug exists but short URL not found")
+		}
+		return err
+	})
+	return shortURL, err
+}
+
+// GetAllShortURLs retrieves all short URLs for a specific user, leaving out the trash
+func (r *BoltRepository) GetAllShortURLs(ctx context.Context, userID primitive.ObjectID) ([]models.ShortURL, error) {
+	shortURLs := make([]models.ShortURL, 0)
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		return boltEachUserShortURL(tx, userID, func(shortURL models.ShortURL) error {
+			if shortURL.DeletedAt == nil {
+				shortURLs = append(shortURLs, shortURL)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Sort by creation date, newest first
+	sort.Slice(shortURLs, func(i, j int) bool {
+		return shortURLs[i].CreatedAt.After(shortURLs[j].CreatedAt)
+	})
+
+	return shortURLs, nil
+}
+
+// GetActiveShortURLByNormalizedURL retrieves the newest active, unexpired short URL
+// owned by userID on domain that points at normalizedURL
+func (r *BoltRepository) GetActiveShortURLByNormalizedURL(ctx context.Context, userID primitive.ObjectID, domain, normalizedURL string) (*models.ShortURL, error) {
+	now := time.Now()
+	var newest *models.ShortURL
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		cursor := tx.Bucket(boltShortURLDestinationIndex).Cursor()
+		prefix := boltDestinationPrefix(userID, normalizedURL)
+
+		for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Next() {
+			shortURL, err := boltGetShortURL(tx, primitive.ObjectID(key[len(prefix):]))
+			if err != nil {
+				return err
+			}
+			if shortURL == nil || shortURL.Domain != domain || !shortURL.Active || shortURL.DeletedAt != nil || (shortURL.ExpiresAt != nil && !shortURL.ExpiresAt.After(now)) {
+				continue
+			}
+			if newest == nil || shortURL.CreatedAt.After(newest.CreatedAt) {
+				newest = shortURL
+			}
+		}
+		return nil
+	})
+	return newest, err
+}
+
+// CreateShortURL creates a new short URL
+func (r *BoltRepository) CreateShortURL(ctx context.Context, shortURL models.ShortURL) (*models.ShortURL, error) {
+	// Generate new ID if not set
+	if shortURL.ID.IsZero() {
+		shortURL.ID = primitive.NewObjectID()
+	}
+
+	// Set defaults
+	shortURL.CreatedAt = time.Now().Truncate(time.Millisecond)
+	shortURL.Clicks = 0
+	shortURL.Version = 1
+	shortURL.Active = shortURL.ActivateAt == nil
+
+	err := r.db.Update(func(tx *bbolt.Tx) error {
+		slugs := tx.Bucket(boltShortURLSlugBucket)
+		slugKey := boltSlugKey(shortURL.Domain, shortURL.Slug)
+		if slugs.Get(slugKey) != nil {
+			return ErrSlugTaken
+		}
+
+		if err := boltPut(tx.Bucket(boltShortURLBucket), shortURL.ID[:], shortURL); err != nil {
+			return err
+		}
+		if err := slugs.Put(slugKey, shortURL.ID[:]); err != nil {
+			return err
+		}
+		if shortURL.NormalizedURL != "" {
+			key := boltIndexKey(boltDestinationPrefix(shortURL.UserID, shortURL.NormalizedURL), shortURL.ID[:])
+			if err := tx.Bucket(boltShortURLDestinationIndex).Put(key, nil); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(boltShortURLUserBucket).Put(boltIndexKey(shortURL.UserID[:], shortURL.ID[:]), nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &shortURL, nil
+}
+
+// UpdateShortURL replaces the editable fields of a short URL owned by shortURL.UserID
+func (r *BoltRepository) UpdateShortURL(ctx context.Context, shortURL models.ShortURL, version int) (*models.ShortURL, error) {
+	var updated *models.ShortURL
+	err := r.db.Update(func(tx *bbolt.Tx) error {
+		existing, err := boltGetShortURL(tx, shortURL.ID)
+		if err != nil {
+			return err
+		}
+		if existing == nil || existing.UserID != shortURL.UserID || existing.DeletedAt != nil {
+			return ErrNotFound
+		}
+		if existing.Version != version {
+			return ErrVersionConflict
+		}
+		id := existing.ID
+
+		// Move the slug mapping if the slug changed
+		if shortURL.Slug != existing.Slug {
+			slugs := tx.Bucket(boltShortURLSlugBucket)
+			if slugs.Get(boltSlugKey(existing.Domain, shortURL.Slug)) != nil {
+				return ErrSlugTaken
+			}
+			if err := slugs.Delete(boltSlugKey(existing.Domain, existing.Slug)); err != nil {
+				return err
+			}
+			if err := slugs.Put(boltSlugKey(existing.Domain, shortURL.Slug), id[:]); err != nil {
+				return err
+			}
+		}
+
+		// Move the destination index entry if the destination changed
+		if shortURL.NormalizedURL != existing.NormalizedURL {
+			destinations := tx.Bucket(boltShortURLDestinationIndex)
+			if existing.NormalizedURL != "" {
+				if err := destinations.Delete(boltIndexKey(boltDestinationPrefix(existing.UserID, existing.NormalizedURL), id[:])); err != nil {
+					return err
+				}
+			}
+			if shortURL.NormalizedURL != "" {
+				if err := destinations.Put(boltIndexKey(boltDestinationPrefix(existing.UserID, shortURL.NormalizedURL), id[:]), nil); err != nil {
+					return err
+				}
+			}
+		}
+
+		existing.OriginalURL = shortURL.OriginalURL
+		existing.NormalizedURL = shortURL.NormalizedURL
+		existing.Slug = shortURL.Slug
+		existing.Active = shortURL.Active
+		existing.ExpiresAt = shortURL.ExpiresAt
+		existing.ActivateAt = shortURL.ActivateAt
+		existing.Schedule = shortURL.Schedule
+		existing.FallbackURL = shortURL.FallbackURL
+		existing.MaxClicks = shortURL.MaxClicks
+		existing.PasswordHash = shortURL.PasswordHash
+		existing.RedirectType = shortURL.RedirectType
+		existing.QueryPassthrough = shortURL.QueryPassthrough
+		existing.Wildcard = shortURL.Wildcard
+		existing.Version++
+		updated = existing
+		return boltPut(tx.Bucket(boltShortURLBucket), id[:], existing)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// UpdateShortURLClicks increments the click count for a short URL
+func (r *BoltRepository) UpdateShortURLClicks(ctx context.Context, id primitive.ObjectID) (*models.ShortURL, error) {
+	var shortURL *models.ShortURL
+	err := r.db.Update(func(tx *bbolt.Tx) error {
+		var err error
+		shortURL, err = boltGetShortURL(tx, id)
+		if err != nil {
+			return err
+		}
+		if shortURL == nil {
+			return ErrNotFound
+		}
+		if shortURL.MaxClicks > 0 && shortURL.Clicks >= shortURL.MaxClicks {
+			return ErrClickLimitReached
+		}
+
+		shortURL.Clicks++
+		if shortURL.Clicks == shortURL.MaxClicks {
+			// The last click deactivates the link
+			shortURL.Active = false
+			shortURL.ActivateAt = nil
+			shortURL.Version++
+		}
+		return boltPut(tx.Bucket(boltShortURLBucket), id[:], shortURL)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return shortURL, nil
+}
+
+// DeleteShortURL moves a short URL to the trash if it belongs to the given user.
+// Its slug mapping is kept, so the slug stays reserved until it is purged.
+func (r *BoltRepository) DeleteShortURL(ctx context.Context, id primitive.ObjectID, userID primitive.ObjectID) error {
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		shortURL, err := boltGetShortURL(tx, id)
+		if err != nil {
+			return err
+		}
+		if shortURL == nil || shortURL.UserID != userID || shortURL.DeletedAt != nil {
+			return ErrNotFound
+		}
+
+		// Stored times have millisecond precision, so the index key can be rebuilt from the record
+		now := time.Now().Truncate(time.Millisecond)
+		shortURL.DeletedAt = &now
+		if err := tx.Bucket(boltShortURLTrashIndex).Put(boltTrashKey(now, id), nil); err != nil {
+			return err
+		}
+		return boltPut(tx.Bucket(boltShortURLBucket), id[:], shortURL)
+	})
+}
+
+// GetDeletedShortURLs retrieves the short URLs in a user's trash, most recently deleted first
+func (r *BoltRepository) GetDeletedShortURLs(ctx context.Context, userID primitive.ObjectID) ([]models.ShortURL, error) {
+	shortURLs := make([]models.ShortURL, 0)
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		return boltEachUserShortURL(tx, userID, func(shortURL models.ShortURL) error {
+			if shortURL.DeletedAt != nil {
+				shortURLs = append(shortURLs, shortURL)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(shortURLs, func(i, j int) bool {
+		return shortURLs[i].DeletedAt.After(*shortURLs[j].DeletedAt)
+	})
+
+	return shortURLs, nil
+}
+
+// RestoreShortURL takes a short URL owned by userID back out of the trash
+func (r *BoltRepository) RestoreShortURL(ctx context.Context, id primitive.ObjectID, userID primitive.ObjectID) (*models.ShortURL, error) {
+	var shortURL *models.ShortURL
+	err := r.db.Update(func(tx *bbolt.Tx) error {
+		var err error
+		shortURL, err = boltGetShortURL(tx, id)
+		if err != nil {
+			return err
+		}
+		if shortURL == nil || shortURL.UserID != userID || shortURL.DeletedAt == nil {
+			return ErrNotFound
+		}
+
+		if err := tx.Bucket(boltShortURLTrashIndex).Delete(boltTrashKey(*shortURL.DeletedAt, id)); err != nil {
+			return err
+		}
+		shortURL.DeletedAt = nil
+		return boltPut(tx.Bucket(boltShortURLBucket), id[:], shortURL)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return shortURL, nil
+}
+
+// PurgeDeletedShortURLs permanently removes the short URLs that were moved to
+// the trash before deletedBefore, along with their click events and history
+func (r *BoltRepository) PurgeDeletedShortURLs(ctx context.Context, deletedBefore time.Time) (int, error) {
+	purged := 0
+	err := r.db.Update(func(tx *bbolt.Tx) error {
+		cutoff := boltTrashKey(deletedBefore, primitive.NilObjectID)
+		cursor := tx.Bucket(boltShortURLTrashIndex).Cursor()
+
+		// The trash index is ordered by deletion time, so stop at the cutoff
+		for key, _ := cursor.First(); key != nil && bytes.Compare(key, cutoff) < 0; key, _ = cursor.First() {
+			id := primitive.ObjectID(key[8:])
+			if err := cursor.Delete(); err != nil {
+				return err
+			}
+			if err := boltPurgeShortURL(tx, id); err != nil {
+				return err
+			}
+			purged++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
+
+// boltPurgeShortURL removes a short URL with its index entries, click events and history
+func boltPurgeShortURL(tx *bbolt.Tx, id primitive.ObjectID) error {
+	shortURL, err := boltGetShortURL(tx, id)
+	if err != nil || shortURL == nil {
+		return err
+	}
+
+	if err := tx.Bucket(boltShortURLSlugBucket).Delete(boltSlugKey(shortURL.Domain, shortURL.Slug)); err != nil {
+		return err
+	}
+	if err := tx.Bucket(boltShortURLUserBucket).Delete(boltIndexKey(shortURL.UserID[:], id[:])); err != nil {
+		return err
+	}
+	if shortURL.NormalizedURL != "" {
+		key := boltIndexKey(boltDestinationPrefix(shortURL.UserID, shortURL.NormalizedURL), id[:])
+		if err := tx.Bucket(boltShortURLDestinationIndex).Delete(key); err != nil {
+			return err
+		}
+	}
+	if shortURL.DeletedAt != nil {
+		if err := tx.Bucket(boltShortURLTrashIndex).Delete(boltTrashKey(*shortURL.DeletedAt, id)); err != nil {
+			return err
+		}
+	}
+
+	// Remove the click events through the per-link index
+	events := tx.Bucket(boltClickEventBucket)
+	cursor := tx.Bucket(boltClickEventShortURLIndex).Cursor()
+	prefix := id[:]
+	for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Seek(prefix) {
+		if err := events.Delete(key[len(prefix):]); err != nil {
+			return err
+		}
+		if err := cursor.Delete(); err != nil {
+			return err
+		}
+	}
+
+	if err := boltDeleteRevisions(tx, id); err != nil {
+		return err
+	}
+	return tx.Bucket(boltShortURLBucket).Delete(id[:])
+}
+
+// CreateClickEvent creates a new click event
+func (r *BoltRepository) CreateClickEvent(ctx context.Context, clickEvent models.ClickEvent) (*models.ClickEvent, error) {
+	// Generate new ID if not set
+	if clickEvent.ID.IsZero() {
+		clickEvent.ID = primitive.NewObjectID()
+	}
+
+	// Set creation time
+	clickEvent.CreatedAt = time.Now().Truncate(time.Millisecond)
+
+	err := r.db.Update(func(tx *bbolt.Tx) error {
+		if err := boltPut(tx.Bucket(boltClickEventBucket), clickEvent.ID[:], clickEvent); err != nil {
+			return err
+		}
+		return tx.Bucket(boltClickEventShortURLIndex).Put(boltIndexKey(clickEvent.ShortURLID[:], clickEvent.ID[:]), nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &clickEvent, nil
+}
+
+// GetClickEventsByShortURLID retrieves click events for a specific short URL
+func (r *BoltRepository) GetClickEventsByShortURLID(ctx context.Context, shortURLID primitive.ObjectID) ([]models.ClickEvent, error) {
+	clickEvents := make([]models.ClickEvent, 0)
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		return boltEachShortURLClick(tx, shortURLID, func(clickEvent models.ClickEvent) error {
+			clickEvents = append(clickEvents, clickEvent)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Sort by creation date, newest first
+	sort.Slice(clickEvents, func(i, j int) bool {
+		return clickEvents[i].CreatedAt.After(clickEvents[j].CreatedAt)
+	})
+
+	return clickEvents, nil
+}
+
+// GetClickStats retrieves aggregated analytics data for the links owned by userID.
+// Passing primitive.NilObjectID aggregates over every user's links.
+func (r *BoltRepository) GetClickStats(ctx context.Context, userID primitive.ObjectID) (*models.StatsResponse, error) {
+	stats := &models.StatsResponse{
+		ReferrerStats: make(map[string]int),
+	}
+	now := time.Now()
+
+	countClick := func(clickEvent models.ClickEvent) error {
+		stats.TotalClicks++
+
+		// Count device stats
+		switch clickEvent.Device {
+		case "mobile":
+			stats.DeviceStats.Mobile++
+		case "desktop":
+			stats.DeviceStats.Desktop++
+		case "tablet":
+			stats.DeviceStats.Tablet++
+		}
+
+		// Count referrer stats
+		referer := clickEvent.Referer
+		if referer == "" {
+			referer = "direct"
+		}
+		stats.ReferrerStats[referer]++
+		return nil
+	}
+
+	countLink := func(shortURL models.ShortURL) {
+		if shortURL.DeletedAt != nil {
+			return
+		}
+		stats.TotalLinks++
+		if shortURL.Active && (shortURL.ExpiresAt == nil || shortURL.ExpiresAt.After(now)) {
+			stats.ActiveLinks++
+		}
+	}
+
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		if userID.IsZero() {
+			err := tx.Bucket(boltShortURLBucket).ForEach(func(_, data []byte) error {
+				var shortURL models.ShortURL
+				if err := boltDecode(data, &shortURL); err != nil {
+					return err
+				}
+				countLink(shortURL)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			return tx.Bucket(boltClickEventBucket).ForEach(func(_, data []byte) error {
+				var clickEvent models.ClickEvent
+				if err := boltDecode(data, &clickEvent); err != nil {
+					return err
+				}
+				return countClick(clickEvent)
+			})
+		}
+
+		return boltEachUserShortURL(tx, userID, func(shortURL models.ShortURL) error {
+			countLink(shortURL)
+			return boltEachShortURLClick(tx, shortURL.ID, countClick)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// boltGetShortURL loads a short URL, returning nil if it does not exist
+func boltGetShortURL(tx *bbolt.Tx, id primitive.ObjectID) (*models.ShortURL, error) {
+	var shortURL models.ShortURL
+	found, err := boltGet(tx.Bucket(boltShortURLBucket), id[:], &shortURL)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &shortURL, nil
+}
+
+// boltEachUserShortURL calls fn for every short URL owned by userID
+func boltEachUserShortURL(tx *bbolt.Tx, userID primitive.ObjectID, fn func(models.ShortURL) error) error {
+	cursor := tx.Bucket(boltShortURLUserBucket).Cursor()
+	prefix := userID[:]
+
+	for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Next() {
+		shortURL, err := boltGetShortURL(tx, primitive.ObjectID(key[len(prefix):]))
+		if err != nil {
+			return err
+		}
+		if shortURL == nil {
+			continue
+		}
+		if err := fn(*shortURL); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// boltEachShortURLClick calls fn for every click event recorded for shortURLID
+func boltEachShortURLClick(tx *bbolt.Tx, shortURLID primitive.ObjectID, fn func(models.ClickEvent) error) error {
+	events := tx.Bucket(boltClickEventBucket)
+	cursor := tx.Bucket(boltClickEventShortURLIndex).Cursor()
+	prefix := shortURLID[:]
+
+	for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Next() {
+		var clickEvent models.ClickEvent
+		found, err := boltGet(events, key[len(prefix):], &clickEvent)
+		if err != nil {
+			return err
+		}
+		if !found {
+			continue
+		}
+		if err := fn(clickEvent); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"shortlink/internal/models"
+	"time"
+
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CreateShortURLRevision appends a revision to a short URL's history
+func (r *BoltRepository) CreateShortURLRevision(ctx context.Context, revision models.ShortURLRevision) (*models.ShortURLRevision, error) {
+	// Generate new ID if not set
+	if revision.ID.IsZero() {
+		revision.ID = primitive.NewObjectID()
+	}
+
+	// Set creation time
+	revision.CreatedAt = time.Now().Truncate(time.Millisecond)
+
+	err := r.db.Update(func(tx *bbolt.Tx) error {
+		revisions := tx.Bucket(boltShortURLRevisionBucket)
+		key := boltRevisionKey(revision.ShortURLID, revision.Version)
+		if revisions.Get(key) != nil {
+			return ErrVersionConflict
+		}
+		return boltPut(revisions, key, revision)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &revision, nil
+}
+
+// GetShortURLRevisions retrieves a short URL's history, newest first
+func (r *BoltRepository) GetShortURLRevisions(ctx context.Context, shortURLID primitive.ObjectID) ([]models.ShortURLRevision, error) {
+	revisions := make([]models.ShortURLRevision, 0)
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		cursor := tx.Bucket(boltShortURLRevisionBucket).Cursor()
+		prefix := shortURLID[:]
+
+		// Keys sort by version, so walk them backwards from the end of the prefix
+		key, data := cursor.Seek(boltRevisionKey(shortURLID, -1))
+		if key == nil {
+			key, data = cursor.Last()
+		} else {
+			key, data = cursor.Prev()
+		}
+		for ; key != nil && bytes.HasPrefix(key, prefix); key, data = cursor.Prev() {
+			var revision models.ShortURLRevision
+			if err := boltDecode(data, &revision); err != nil {
+				return err
+			}
+			revisions = append(revisions, revision)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// GetShortURLRevision retrieves one version of a short URL
+func (r *BoltRepository) GetShortURLRevision(ctx context.Context, shortURLID primitive.ObjectID, version int) (*models.ShortURLRevision, error) {
+	var revision *models.ShortURLRevision
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		var found models.ShortURLRevision
+		ok, err := boltGet(tx.Bucket(boltShortURLRevisionBucket), boltRevisionKey(shortURLID, version), &found)
+		if ok {
+			revision = &found
+		}
+		return err
+	})
+	return revision, err
+}
+
+// boltRevisionKey is the revision bucket key for a version of a short URL.
+// Versions are stored big-endian so keys sort by version; -1 sorts after every version.
+func boltRevisionKey(shortURLID primitive.ObjectID, version int) []byte {
+	raw := make([]byte, 8)
+	binary.BigEndian.PutUint64(raw, uint64(version))
+	return boltIndexKey(shortURLID[:], raw)
+}
+
+// boltDeleteRevisions removes a short URL's history
+func boltDeleteRevisions(tx *bbolt.Tx, shortURLID primitive.ObjectID) error {
+	cursor := tx.Bucket(boltShortURLRevisionBucket).Cursor()
+	prefix := shortURLID[:]
+
+	for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Seek(prefix) {
+		if err := cursor.Delete(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,29 @@
+package database
+
+import (
+	"context"
+	"encoding/binary"
+
+	"go.etcd.io/bbolt"
+)
+
+// NextSequence increments and returns the named counter
+func (r *BoltRepository) NextSequence(ctx context.Context, name string) (int64, error) {
+	var value uint64
+	err := r.db.Update(func(tx *bbolt.Tx) error {
+		sequences := tx.Bucket(boltSequenceBucket)
+		if raw := sequences.Get([]byte(name)); raw != nil {
+			value = binary.BigEndian.Uint64(raw)
+		}
+		value++
+
+		raw := make([]byte, 8)
+		binary.BigEndian.PutUint64(raw, value)
+		return sequences.Put([]byte(name), raw)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(value), nil
+}
@@ -0,0 +1,179 @@
+package database
+
+import (
+	"context"
+	"shortlink/internal/models"
+	"time"
+
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CreateUser creates a new user account
+func (r *BoltRepository) CreateUser(ctx context.Context, user models.User) (*models.User, error) {
+	// Generate new ID if not set
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	user.CreatedAt = time.Now().Truncate(time.Millisecond)
+
+	err := r.db.Update(func(tx *bbolt.Tx) error {
+		// Reject duplicate usernames
+		usernames := tx.Bucket(boltUsernameBucket)
+		if usernames.Get([]byte(user.Username)) != nil {
+			return ErrUsernameTaken
+		}
+
+		if err := boltPut(tx.Bucket(boltUserBucket), user.ID[:], user); err != nil {
+			return err
+		}
+		return usernames.Put([]byte(user.Username), user.ID[:])
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// GetUserByID retrieves a user by ID
+func (r *BoltRepository) GetUserByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	var user *models.User
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		user, err = boltGetUser(tx, id[:])
+		return err
+	})
+	return user, err
+}
+
+// GetUserByUsername retrieves a user by username
+func (r *BoltRepository) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	var user *models.User
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		id := tx.Bucket(boltUsernameBucket).Get([]byte(username))
+		if id == nil {
+			return nil
+		}
+
+		var err error
+		user, err = boltGetUser(tx, id)
+		return err
+	})
+	return user, err
+}
+
+// SetUserRole changes the role of the user with username
+func (r *BoltRepository) SetUserRole(ctx context.Context, username, role string) (*models.User, error) {
+	var user *models.User
+	err := r.db.Update(func(tx *bbolt.Tx) error {
+		id := tx.Bucket(boltUsernameBucket).Get([]byte(username))
+		if id == nil {
+			return ErrNotFound
+		}
+
+		var err error
+		user, err = boltGetUser(tx, id)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return ErrNotFound
+		}
+		user.Role = role
+		return boltPut(tx.Bucket(boltUserBucket), id, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// CreateSession stores a new login session
+func (r *BoltRepository) CreateSession(ctx context.Context, session models.Session) (*models.Session, error) {
+	// Generate new ID if not set
+	if session.ID.IsZero() {
+		session.ID = primitive.NewObjectID()
+	}
+	session.CreatedAt = time.Now().Truncate(time.Millisecond)
+
+	err := r.db.Update(func(tx *bbolt.Tx) error {
+		return boltPut(tx.Bucket(boltSessionBucket), []byte(session.TokenHash), session)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// GetSessionByTokenHash retrieves an unexpired session by the hash of its token
+func (r *BoltRepository) GetSessionByTokenHash(ctx context.Context, tokenHash string) (*models.Session, error) {
+	var session models.Session
+	var found bool
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		found, err = boltGet(tx.Bucket(boltSessionBucket), []byte(tokenHash), &session)
+		return err
+	})
+	if err != nil || !found || !session.ExpiresAt.After(time.Now()) {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// DeleteSession removes the session identified by the hash of its token
+func (r *BoltRepository) DeleteSession(ctx context.Context, tokenHash string) error {
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltSessionBucket).Delete([]byte(tokenHash))
+	})
+}
+
+// DeleteExpiredSessions removes the sessions that expired by now
+func (r *BoltRepository) DeleteExpiredSessions(ctx context.Context, now time.Time) (int, error) {
+	deleted := 0
+	err := r.db.Update(func(tx *bbolt.Tx) error {
+		sessions := tx.Bucket(boltSessionBucket)
+
+		// Collect the keys first; deleting while iterating skips entries
+		var expired [][]byte
+		err := sessions.ForEach(func(key, data []byte) error {
+			var session models.Session
+			if err := boltDecode(data, &session); err != nil {
+				return err
+			}
+			if !session.ExpiresAt.After(now) {
+				expired = append(expired, append([]byte(nil), key...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, key := range expired {
+			if err := sessions.Delete(key); err != nil {
+				return err
+			}
+		}
+		deleted = len(expired)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted, nil
+}
+
+// boltGetUser loads a user by raw ID, returning nil if it does not exist
+func boltGetUser(tx *bbolt.Tx, id []byte) (*models.User, error) {
+	var user models.User
+	found, err := boltGet(tx.Bucket(boltUserBucket), id, &user)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -0,0 +1,106 @@
+package database_test
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"shortlink/internal/database"
+	"shortlink/internal/database/storetest"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMemoryRepositoryConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) database.Store {
+		return database.NewMemoryRepository()
+	})
+}
+
+func TestBoltRepositoryConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) database.Store {
+		db, err := database.OpenBolt(filepath.Join(t.TempDir(), "shortlink.db"))
+		if err != nil {
+			t.Fatalf("OpenBolt: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		return database.NewBoltRepository(db)
+	})
+}
+
+// TestMongoRepositoryConformance runs against a live server when MONGODB_TEST_URI is set.
+// Every subtest gets its own throwaway database.
+func TestMongoRepositoryConformance(t *testing.T) {
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI not set")
+	}
+
+	storetest.Run(t, func(t *testing.T) database.Store {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		db, err := database.ConnectMongo(ctx, uri, "shortlink_test_"+primitive.NewObjectID().Hex())
+		if err != nil {
+			t.Fatalf("ConnectMongo: %v", err)
+		}
+		if err := db.EnsureIndexes(ctx); err != nil {
+			t.Fatalf("EnsureIndexes: %v", err)
+		}
+		t.Cleanup(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			db.GetCollection(database.ShortURLCollection).Database().Drop(ctx)
+			db.Disconnect(ctx)
+		})
+
+		return database.NewMongoRepository(db)
+	})
+}
+
+// TestPostgresRepositoryConformance runs against a live server when POSTGRES_TEST_URL is set.
+// Every subtest gets its own throwaway schema.
+func TestPostgresRepositoryConformance(t *testing.T) {
+	rawURL := os.Getenv("POSTGRES_TEST_URL")
+	if rawURL == "" {
+		t.Skip("POSTGRES_TEST_URL not set")
+	}
+
+	storetest.Run(t, func(t *testing.T) database.Store {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		admin, err := pgxpool.New(ctx, rawURL)
+		if err != nil {
+			t.Fatalf("connecting to PostgreSQL: %v", err)
+		}
+		schema := "shortlink_test_" + primitive.NewObjectID().Hex()
+		if _, err := admin.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+			t.Fatalf("creating schema: %v", err)
+		}
+
+		testURL, err := url.Parse(rawURL)
+		if err != nil {
+			t.Fatalf("parsing POSTGRES_TEST_URL: %v", err)
+		}
+		query := testURL.Query()
+		query.Set("search_path", schema)
+		testURL.RawQuery = query.Encode()
+
+		pool, err := database.OpenPostgres(ctx, testURL.String())
+		if err != nil {
+			t.Fatalf("OpenPostgres: %v", err)
+		}
+		t.Cleanup(func() {
+			pool.Close()
+			admin.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE")
+			admin.Close()
+		})
+
+		return database.NewPostgresRepository(pool)
+	})
+}
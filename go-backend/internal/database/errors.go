@@ -0,0 +1,23 @@
+package database
+
+import "errors"
+
+var (
+	// ErrNotFound is returned when a record to modify does not exist or is not visible to the caller
+	ErrNotFound = errors.New("not found")
+
+	// ErrSlugTaken is returned when creating a short URL whose slug is already in use
+	ErrSlugTaken = errors.New("slug already taken")
+
+	// ErrVersionConflict is returned when updating a record that was changed since it was read
+	ErrVersionConflict = errors.New("version conflict")
+
+	// ErrClickLimitReached is returned when counting a click on a short URL that has used up its MaxClicks
+	ErrClickLimitReached = errors.New("click limit reached")
+
+	// ErrDomainTaken is returned when registering a domain host that already exists
+	ErrDomainTaken = errors.New("domain already registered")
+
+	// ErrUsernameTaken is returned when registering a username that already exists
+	ErrUsernameTaken = errors.New("username already taken")
+)
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+	"shortlink/internal/models"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CreateAPIKey stores a newly issued API key
+func (r *MemoryRepository) CreateAPIKey(ctx context.Context, apiKey models.APIKey) (*models.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Generate new ID if not set
+	if apiKey.ID.IsZero() {
+		apiKey.ID = primitive.NewObjectID()
+	}
+
+	apiKey.CreatedAt = time.Now()
+	r.apiKeys[apiKey.ID] = apiKey
+
+	return &apiKey, nil
+}
+
+// GetAPIKeyByHash retrieves an unrevoked API key by the hash of its secret
+func (r *MemoryRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, apiKey := range r.apiKeys {
+		if apiKey.KeyHash == keyHash && apiKey.RevokedAt == nil {
+			return &apiKey, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// GetAPIKeysByUser retrieves all API keys issued to a user, including revoked ones
+func (r *MemoryRepository) GetAPIKeysByUser(ctx context.Context, userID primitive.ObjectID) ([]models.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	apiKeys := make([]models.APIKey, 0)
+	for _, apiKey := range r.apiKeys {
+		if apiKey.UserID == userID {
+			apiKeys = append(apiKeys, apiKey)
+		}
+	}
+
+	// Sort by creation date, newest first
+	sort.Slice(apiKeys, func(i, j int) bool {
+		return apiKeys[i].CreatedAt.After(apiKeys[j].CreatedAt)
+	})
+
+	return apiKeys, nil
+}
+
+// RevokeAPIKey marks a user's API key as revoked.
+// It returns ErrNotFound if the key does not exist, belongs to another user or is already revoked.
+func (r *MemoryRepository) RevokeAPIKey(ctx context.Context, id, userID primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	apiKey, ok := r.apiKeys[id]
+	if !ok || apiKey.UserID != userID || apiKey.RevokedAt != nil {
+		return ErrNotFound
+	}
+
+	now := time.Now()
+	apiKey.RevokedAt = &now
+	r.apiKeys[id] = apiKey
+
+	return nil
+}
+
+// TouchAPIKey records that an API key was just used
+func (r *MemoryRepository) TouchAPIKey(ctx context.Context, id primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	apiKey, ok := r.apiKeys[id]
+	if !ok {
+		return nil
+	}
+
+	now := time.Now()
+	apiKey.LastUsedAt = &now
+	r.apiKeys[id] = apiKey
+
+	return nil
+}
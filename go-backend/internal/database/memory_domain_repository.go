@@ -0,0 +1,149 @@
+package database
+
+import (
+	"context"
+	"shortlink/internal/models"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CreateDomain registers a branded domain
+func (r *MemoryRepository) CreateDomain(ctx context.Context, domain models.Domain) (*models.Domain, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Reject hosts that are already registered
+	for _, existing := range r.domains {
+		if existing.Host == domain.Host {
+			return nil, ErrDomainTaken
+		}
+	}
+
+	// Generate new ID if not set
+	if domain.ID.IsZero() {
+		domain.ID = primitive.NewObjectID()
+	}
+
+	domain.CreatedAt = time.Now()
+	domain.UserIDs = append([]primitive.ObjectID{}, domain.UserIDs...)
+	r.domains[domain.ID] = domain
+
+	return copyDomain(domain), nil
+}
+
+// GetDomain retrieves a domain by ID
+func (r *MemoryRepository) GetDomain(ctx context.Context, id primitive.ObjectID) (*models.Domain, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	domain, ok := r.domains[id]
+	if !ok {
+		return nil, nil
+	}
+
+	return copyDomain(domain), nil
+}
+
+// GetDomainByHost retrieves a domain by host
+func (r *MemoryRepository) GetDomainByHost(ctx context.Context, host string) (*models.Domain, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, domain := range r.domains {
+		if domain.Host == host {
+			return copyDomain(domain), nil
+		}
+	}
+
+	return nil, nil
+}
+
+// GetDomains retrieves every registered domain
+func (r *MemoryRepository) GetDomains(ctx context.Context) ([]models.Domain, error) {
+	return r.listDomains(func(models.Domain) bool { return true }), nil
+}
+
+// GetDomainsByUser retrieves the domains userID has been granted
+func (r *MemoryRepository) GetDomainsByUser(ctx context.Context, userID primitive.ObjectID) ([]models.Domain, error) {
+	return r.listDomains(func(domain models.Domain) bool {
+		return hasUser(domain.UserIDs, userID)
+	}), nil
+}
+
+// GrantDomain lets userID create links on a domain
+func (r *MemoryRepository) GrantDomain(ctx context.Context, id, userID primitive.ObjectID) (*models.Domain, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	domain, ok := r.domains[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	if !hasUser(domain.UserIDs, userID) {
+		domain.UserIDs = append(append([]primitive.ObjectID{}, domain.UserIDs...), userID)
+		r.domains[id] = domain
+	}
+
+	return copyDomain(domain), nil
+}
+
+// RevokeDomain stops userID creating links on a domain. Links already on the
+// domain are left alone.
+func (r *MemoryRepository) RevokeDomain(ctx context.Context, id, userID primitive.ObjectID) (*models.Domain, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	domain, ok := r.domains[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	userIDs := make([]primitive.ObjectID, 0, len(domain.UserIDs))
+	for _, granted := range domain.UserIDs {
+		if granted != userID {
+			userIDs = append(userIDs, granted)
+		}
+	}
+	domain.UserIDs = userIDs
+	r.domains[id] = domain
+
+	return copyDomain(domain), nil
+}
+
+// listDomains returns copies of the domains matching fn, sorted by host
+func (r *MemoryRepository) listDomains(fn func(models.Domain) bool) []models.Domain {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	domains := make([]models.Domain, 0)
+	for _, domain := range r.domains {
+		if fn(domain) {
+			domains = append(domains, *copyDomain(domain))
+		}
+	}
+
+	sort.Slice(domains, func(i, j int) bool {
+		return domains[i].Host < domains[j].Host
+	})
+
+	return domains
+}
+
+// copyDomain returns a copy of domain that doesn't share its grants
+func copyDomain(domain models.Domain) *models.Domain {
+	domain.UserIDs = append([]primitive.ObjectID{}, domain.UserIDs...)
+	return &domain
+}
+
+// hasUser reports whether userID is one of userIDs
+func hasUser(userIDs []primitive.ObjectID, userID primitive.ObjectID) bool {
+	for _, id := range userIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+	"shortlink/internal/models"
+	"time"
+)
+
+// ActivateScheduledShortURLs activates the short URLs whose activation time has passed
+func (r *MemoryRepository) ActivateScheduledShortURLs(ctx context.Context, now time.Time) ([]models.ShortURL, error) {
+	return r.updateShortURLs(func(shortURL *models.ShortURL) bool {
+		if shortURL.ActivateAt == nil || shortURL.ActivateAt.After(now) {
+			return false
+		}
+		shortURL.Active = true
+		shortURL.ActivateAt = nil
+		return true
+	}), nil
+}
+
+// ExpireShortURLs deactivates the active short URLs whose expiry time has passed
+func (r *MemoryRepository) ExpireShortURLs(ctx context.Context, now time.Time) ([]models.ShortURL, error) {
+	return r.updateShortURLs(func(shortURL *models.ShortURL) bool {
+		if !shortURL.Active || shortURL.ExpiresAt == nil || shortURL.ExpiresAt.After(now) {
+			return false
+		}
+		shortURL.Active = false
+		return true
+	}), nil
+}
+
+// PurgeExpiredShortURLs permanently removes the short URLs that expired before
+// expiredBefore, along with their click events and history
+func (r *MemoryRepository) PurgeExpiredShortURLs(ctx context.Context, expiredBefore time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.purgeShortURLs(func(shortURL models.ShortURL) bool {
+		return shortURL.ExpiresAt != nil && shortURL.ExpiresAt.Before(expiredBefore)
+	}), nil
+}
+
+// updateShortURLs applies fn to every short URL outside the trash, saving and
+// returning those it changed with their version incremented
+func (r *MemoryRepository) updateShortURLs(fn func(*models.ShortURL) bool) []models.ShortURL {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	changed := make([]models.ShortURL, 0)
+	for id, shortURL := range r.shortURLs {
+		if shortURL.DeletedAt != nil || !fn(&shortURL) {
+			continue
+		}
+		shortURL.Version++
+		r.shortURLs[id] = shortURL
+		changed = append(changed, shortURL)
+	}
+
+	return changed
+}
@@ -4,29 +4,48 @@ import (
 	"context"
 	"errors"
 	"shortlink/internal/models"
+	"sort"
 	"sync"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// MemoryRepository is an in-memory implementation of the repository for development
+// MemoryRepository is an in-memory implementation of Store for development
 type MemoryRepository struct {
-	shortURLs      map[primitive.ObjectID]models.ShortURL
-	shortURLsBySlug map[string]primitive.ObjectID
-	clickEvents    map[primitive.ObjectID]models.ClickEvent
-	mu             sync.RWMutex
-	shortURLCount  int
+	shortURLs       map[primitive.ObjectID]models.ShortURL
+	shortURLsBySlug map[domainSlug]primitive.ObjectID
+	clickEvents     map[primitive.ObjectID]models.ClickEvent
+	users           map[primitive.ObjectID]models.User
+	sessions        map[string]models.Session
+	apiKeys         map[primitive.ObjectID]models.APIKey
+	sequences       map[string]int64
+	revisions       map[primitive.ObjectID][]models.ShortURLRevision
+	domains         map[primitive.ObjectID]models.Domain
+	mu              sync.RWMutex
+	shortURLCount   int
 	clickEventCount int
 }
 
+// domainSlug keys the slug index; slugs are unique per domain
+type domainSlug struct {
+	domain string
+	slug   string
+}
+
 // NewMemoryRepository creates a new in-memory repository
 func NewMemoryRepository() *MemoryRepository {
 	return &MemoryRepository{
-		shortURLs:      make(map[primitive.ObjectID]models.ShortURL),
-		shortURLsBySlug: make(map[string]primitive.ObjectID),
-		clickEvents:    make(map[primitive.ObjectID]models.ClickEvent),
-		shortURLCount:  0,
+		shortURLs:       make(map[primitive.ObjectID]models.ShortURL),
+		shortURLsBySlug: make(map[domainSlug]primitive.ObjectID),
+		clickEvents:     make(map[primitive.ObjectID]models.ClickEvent),
+		users:           make(map[primitive.ObjectID]models.User),
+		sessions:        make(map[string]models.Session),
+		apiKeys:         make(map[primitive.ObjectID]models.APIKey),
+		sequences:       make(map[string]int64),
+		revisions:       make(map[primitive.ObjectID][]models.ShortURLRevision),
+		domains:         make(map[primitive.ObjectID]models.Domain),
+		shortURLCount:   0,
 		clickEventCount: 0,
 	}
 }
@@ -35,126 +54,280 @@ func NewMemoryRepository() *MemoryRepository {
 func (r *MemoryRepository) GetShortURL(ctx context.Context, id primitive.ObjectID) (*models.ShortURL, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	
+
 	shortURL, ok := r.shortURLs[id]
 	if !ok {
 		return nil, nil
 	}
-	
+
 	return &shortURL, nil
 }
 
-// GetShortURLBySlug retrieves a short URL by slug
-func (r *MemoryRepository) GetShortURLBySlug(ctx context.Context, slug string) (*models.ShortURL, error) {
+// GetShortURLBySlug retrieves a short URL by its domain and slug
+func (r *MemoryRepository) GetShortURLBySlug(ctx context.Context, domain, slug string) (*models.ShortURL, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	
-	id, ok := r.shortURLsBySlug[slug]
+
+	id, ok := r.shortURLsBySlug[domainSlug{domain, slug}]
 	if !ok {
 		return nil, nil
 	}
-	
+
 	shortURL, ok := r.shortURLs[id]
 	if !ok {
 		return nil, errors.New("inconsistent state: slug exists but short URL not found")
 	}
-	
+
 	return &shortURL, nil
 }
 
+// GetActiveShortURLByNormalizedURL retrieves the newest active, unexpired short URL
+// owned by userID on domain that points at normalizedURL
+func (r *MemoryRepository) GetActiveShortURLByNormalizedURL(ctx context.Context, userID primitive.ObjectID, domain, normalizedURL string) (*models.ShortURL, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	var newest *models.ShortURL
+	for _, shortURL := range r.shortURLs {
+		if shortURL.UserID != userID || shortURL.Domain != domain || shortURL.NormalizedURL != normalizedURL || !shortURL.Active || shortURL.DeletedAt != nil {
+			continue
+		}
+		if shortURL.ExpiresAt != nil && !shortURL.ExpiresAt.After(now) {
+			continue
+		}
+		if newest == nil || shortURL.CreatedAt.After(newest.CreatedAt) {
+			match := shortURL
+			newest = &match
+		}
+	}
+
+	return newest, nil
+}
+
 // CreateShortURL creates a new short URL
 func (r *MemoryRepository) CreateShortURL(ctx context.Context, shortURL models.ShortURL) (*models.ShortURL, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	
+
 	// Generate new ID if not set
 	if shortURL.ID.IsZero() {
 		shortURL.ID = primitive.NewObjectID()
 	}
-	
-	// Check if slug already exists
-	if _, ok := r.shortURLsBySlug[shortURL.Slug]; ok {
-		return nil, errors.New("slug already exists")
+
+	// Check if slug already exists on the domain
+	if _, ok := r.shortURLsBySlug[domainSlug{shortURL.Domain, shortURL.Slug}]; ok {
+		return nil, ErrSlugTaken
 	}
-	
+
 	// Set defaults
 	shortURL.CreatedAt = time.Now()
 	shortURL.Clicks = 0
-	shortURL.Active = true
-	
+	shortURL.Version = 1
+	shortURL.Active = shortURL.ActivateAt == nil
+
 	// Store the short URL
 	r.shortURLs[shortURL.ID] = shortURL
-	r.shortURLsBySlug[shortURL.Slug] = shortURL.ID
+	r.shortURLsBySlug[domainSlug{shortURL.Domain, shortURL.Slug}] = shortURL.ID
 	r.shortURLCount++
-	
+
 	return &shortURL, nil
 }
 
-// GetAllShortURLs retrieves all short URLs
-func (r *MemoryRepository) GetAllShortURLs(ctx context.Context) ([]models.ShortURL, error) {
+// GetAllShortURLs retrieves all short URLs for a specific user, leaving out the trash
+func (r *MemoryRepository) GetAllShortURLs(ctx context.Context, userID primitive.ObjectID) ([]models.ShortURL, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	
-	shortURLs := make([]models.ShortURL, 0, len(r.shortURLs))
+
+	shortURLs := make([]models.ShortURL, 0)
 	for _, shortURL := range r.shortURLs {
-		shortURLs = append(shortURLs, shortURL)
+		if shortURL.UserID == userID && shortURL.DeletedAt == nil {
+			shortURLs = append(shortURLs, shortURL)
+		}
 	}
-	
+
+	// Sort by creation date, newest first
+	sort.Slice(shortURLs, func(i, j int) bool {
+		return shortURLs[i].CreatedAt.After(shortURLs[j].CreatedAt)
+	})
+
 	return shortURLs, nil
 }
 
+// UpdateShortURL replaces the editable fields of a short URL owned by shortURL.UserID
+func (r *MemoryRepository) UpdateShortURL(ctx context.Context, shortURL models.ShortURL, version int) (*models.ShortURL, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.shortURLs[shortURL.ID]
+	if !ok || existing.UserID != shortURL.UserID || existing.DeletedAt != nil {
+		return nil, ErrNotFound
+	}
+	if existing.Version != version {
+		return nil, ErrVersionConflict
+	}
+
+	// Move the slug mapping if the slug changed
+	if shortURL.Slug != existing.Slug {
+		if _, ok := r.shortURLsBySlug[domainSlug{existing.Domain, shortURL.Slug}]; ok {
+			return nil, ErrSlugTaken
+		}
+		delete(r.shortURLsBySlug, domainSlug{existing.Domain, existing.Slug})
+		r.shortURLsBySlug[domainSlug{existing.Domain, shortURL.Slug}] = existing.ID
+	}
+
+	existing.OriginalURL = shortURL.OriginalURL
+	existing.NormalizedURL = shortURL.NormalizedURL
+	existing.Slug = shortURL.Slug
+	existing.Active = shortURL.Active
+	existing.ExpiresAt = shortURL.ExpiresAt
+	existing.ActivateAt = shortURL.ActivateAt
+	existing.Schedule = shortURL.Schedule
+	existing.FallbackURL = shortURL.FallbackURL
+	existing.MaxClicks = shortURL.MaxClicks
+	existing.PasswordHash = shortURL.PasswordHash
+	existing.RedirectType = shortURL.RedirectType
+	existing.QueryPassthrough = shortURL.QueryPassthrough
+	existing.Wildcard = shortURL.Wildcard
+	existing.Version++
+	r.shortURLs[existing.ID] = existing
+
+	return &existing, nil
+}
+
 // UpdateShortURLClicks increments the click count for a short URL
 func (r *MemoryRepository) UpdateShortURLClicks(ctx context.Context, id primitive.ObjectID) (*models.ShortURL, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	
+
 	shortURL, ok := r.shortURLs[id]
 	if !ok {
-		return nil, errors.New("short URL not found")
+		return nil, ErrNotFound
+	}
+	if shortURL.MaxClicks > 0 && shortURL.Clicks >= shortURL.MaxClicks {
+		return nil, ErrClickLimitReached
 	}
-	
+
 	shortURL.Clicks++
+	if shortURL.Clicks == shortURL.MaxClicks {
+		// The last click deactivates the link
+		shortURL.Active = false
+		shortURL.ActivateAt = nil
+		shortURL.Version++
+	}
 	r.shortURLs[id] = shortURL
-	
+
 	return &shortURL, nil
 }
 
-// DeleteShortURL deletes a short URL by ID
-func (r *MemoryRepository) DeleteShortURL(ctx context.Context, id primitive.ObjectID) error {
+// DeleteShortURL moves a short URL to the trash if it belongs to the given user.
+// Its slug stays reserved until it is purged.
+func (r *MemoryRepository) DeleteShortURL(ctx context.Context, id primitive.ObjectID, userID primitive.ObjectID) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	
+
 	shortURL, ok := r.shortURLs[id]
-	if !ok {
-		return errors.New("short URL not found")
-	}
-	
-	// Remove the slug mapping
-	delete(r.shortURLsBySlug, shortURL.Slug)
-	
-	// Remove the short URL
-	delete(r.shortURLs, id)
-	
+	if !ok || shortURL.UserID != userID || shortURL.DeletedAt != nil {
+		return ErrNotFound
+	}
+
+	now := time.Now()
+	shortURL.DeletedAt = &now
+	r.shortURLs[id] = shortURL
+
 	return nil
 }
 
+// GetDeletedShortURLs retrieves the short URLs in a user's trash, most recently deleted first
+func (r *MemoryRepository) GetDeletedShortURLs(ctx context.Context, userID primitive.ObjectID) ([]models.ShortURL, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	shortURLs := make([]models.ShortURL, 0)
+	for _, shortURL := range r.shortURLs {
+		if shortURL.UserID == userID && shortURL.DeletedAt != nil {
+			shortURLs = append(shortURLs, shortURL)
+		}
+	}
+
+	sort.Slice(shortURLs, func(i, j int) bool {
+		return shortURLs[i].DeletedAt.After(*shortURLs[j].DeletedAt)
+	})
+
+	return shortURLs, nil
+}
+
+// RestoreShortURL takes a short URL owned by userID back out of the trash
+func (r *MemoryRepository) RestoreShortURL(ctx context.Context, id primitive.ObjectID, userID primitive.ObjectID) (*models.ShortURL, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	shortURL, ok := r.shortURLs[id]
+	if !ok || shortURL.UserID != userID || shortURL.DeletedAt == nil {
+		return nil, ErrNotFound
+	}
+
+	shortURL.DeletedAt = nil
+	r.shortURLs[id] = shortURL
+
+	return &shortURL, nil
+}
+
+// PurgeDeletedShortURLs permanently removes the short URLs that were moved to
+// the trash before deletedBefore, along with their click events and history
+func (r *MemoryRepository) PurgeDeletedShortURLs(ctx context.Context, deletedBefore time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.purgeShortURLs(func(shortURL models.ShortURL) bool {
+		return shortURL.DeletedAt != nil && shortURL.DeletedAt.Before(deletedBefore)
+	}), nil
+}
+
+// purgeShortURLs removes the short URLs matching fn, with their click events and
+// history, and reports how many there were. The caller must hold the write lock.
+func (r *MemoryRepository) purgeShortURLs(fn func(models.ShortURL) bool) int {
+	purged := make(map[primitive.ObjectID]bool)
+	for id, shortURL := range r.shortURLs {
+		if !fn(shortURL) {
+			continue
+		}
+
+		delete(r.shortURLsBySlug, domainSlug{shortURL.Domain, shortURL.Slug})
+		delete(r.shortURLs, id)
+		delete(r.revisions, id)
+		purged[id] = true
+	}
+
+	// Remove the click events of purged links
+	if len(purged) > 0 {
+		for id, clickEvent := range r.clickEvents {
+			if purged[clickEvent.ShortURLID] {
+				delete(r.clickEvents, id)
+			}
+		}
+	}
+
+	return len(purged)
+}
+
 // CreateClickEvent creates a new click event
 func (r *MemoryRepository) CreateClickEvent(ctx context.Context, clickEvent models.ClickEvent) (*models.ClickEvent, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	
+
 	// Generate new ID if not set
 	if clickEvent.ID.IsZero() {
 		clickEvent.ID = primitive.NewObjectID()
 	}
-	
+
 	// Set creation time
 	clickEvent.CreatedAt = time.Now()
-	
+
 	// Store the click event
 	r.clickEvents[clickEvent.ID] = clickEvent
 	r.clickEventCount++
-	
+
 	return &clickEvent, nil
 }
 
@@ -162,23 +335,34 @@ func (r *MemoryRepository) CreateClickEvent(ctx context.Context, clickEvent mode
 func (r *MemoryRepository) GetClickEventsByShortURLID(ctx context.Context, shortURLID primitive.ObjectID) ([]models.ClickEvent, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	
-	var clickEvents []models.ClickEvent
-	
+
+	clickEvents := make([]models.ClickEvent, 0)
+
 	for _, clickEvent := range r.clickEvents {
 		if clickEvent.ShortURLID == shortURLID {
 			clickEvents = append(clickEvents, clickEvent)
 		}
 	}
-	
+
+	// Sort by creation date, newest first
+	sort.Slice(clickEvents, func(i, j int) bool {
+		return clickEvents[i].CreatedAt.After(clickEvents[j].CreatedAt)
+	})
+
 	return clickEvents, nil
 }
 
-// GetClickStats retrieves aggregated analytics data
-func (r *MemoryRepository) GetClickStats(ctx context.Context) (*models.StatsResponse, error) {
+// GetClickStats retrieves aggregated analytics data for the links owned by userID.
+// Passing primitive.NilObjectID aggregates over every user's links.
+func (r *MemoryRepository) GetClickStats(ctx context.Context, userID primitive.ObjectID) (*models.StatsResponse, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	
+
+	// Select the links the stats cover
+	ownsLink := func(shortURL models.ShortURL) bool {
+		return userID.IsZero() || shortURL.UserID == userID
+	}
+
 	// Count total clicks
 	totalClicks := 0
 	deviceStats := models.DeviceStats{
@@ -186,12 +370,17 @@ func (r *MemoryRepository) GetClickStats(ctx context.Context) (*models.StatsResp
 		Desktop: 0,
 		Tablet:  0,
 	}
-	
+
 	referrerStats := make(map[string]int)
-	
+
 	for _, clickEvent := range r.clickEvents {
+		if !userID.IsZero() {
+			if shortURL, ok := r.shortURLs[clickEvent.ShortURLID]; !ok || !ownsLink(shortURL) {
+				continue
+			}
+		}
 		totalClicks++
-		
+
 		// Count device stats
 		switch clickEvent.Device {
 		case "mobile":
@@ -201,36 +390,41 @@ func (r *MemoryRepository) GetClickStats(ctx context.Context) (*models.StatsResp
 		case "tablet":
 			deviceStats.Tablet++
 		}
-		
+
 		// Count referrer stats
 		referer := clickEvent.Referer
 		if referer == "" {
 			referer = "direct"
 		}
-		
+
 		referrerStats[referer]++
 	}
-	
+
 	// Count active links
+	totalLinks := 0
 	activeLinks := 0
 	now := time.Now()
-	
+
 	for _, shortURL := range r.shortURLs {
+		if !ownsLink(shortURL) || shortURL.DeletedAt != nil {
+			continue
+		}
+		totalLinks++
 		if shortURL.Active {
 			if shortURL.ExpiresAt == nil || shortURL.ExpiresAt.After(now) {
 				activeLinks++
 			}
 		}
 	}
-	
+
 	// Create the stats response
 	stats := &models.StatsResponse{
 		TotalClicks:   totalClicks,
-		TotalLinks:    len(r.shortURLs),
+		TotalLinks:    totalLinks,
 		ActiveLinks:   activeLinks,
 		DeviceStats:   deviceStats,
 		ReferrerStats: referrerStats,
 	}
-	
+
 	return stats, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"context"
+	"shortlink/internal/models"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CreateShortURLRevision appends a revision to a short URL's history
+func (r *MemoryRepository) CreateShortURLRevision(ctx context.Context, revision models.ShortURLRevision) (*models.ShortURLRevision, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.revisions[revision.ShortURLID] {
+		if existing.Version == revision.Version {
+			return nil, ErrVersionConflict
+		}
+	}
+
+	// Generate new ID if not set
+	if revision.ID.IsZero() {
+		revision.ID = primitive.NewObjectID()
+	}
+
+	// Set creation time
+	revision.CreatedAt = time.Now()
+
+	r.revisions[revision.ShortURLID] = append(r.revisions[revision.ShortURLID], revision)
+
+	return &revision, nil
+}
+
+// GetShortURLRevisions retrieves a short URL's history, newest first
+func (r *MemoryRepository) GetShortURLRevisions(ctx context.Context, shortURLID primitive.ObjectID) ([]models.ShortURLRevision, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	revisions := append(make([]models.ShortURLRevision, 0), r.revisions[shortURLID]...)
+
+	// Sort by version, newest first
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Version > revisions[j].Version
+	})
+
+	return revisions, nil
+}
+
+// GetShortURLRevision retrieves one version of a short URL
+func (r *MemoryRepository) GetShortURLRevision(ctx context.Context, shortURLID primitive.ObjectID, version int) (*models.ShortURLRevision, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, revision := range r.revisions[shortURLID] {
+		if revision.Version == version {
+			return &revision, nil
+		}
+	}
+
+	return nil, nil
+}
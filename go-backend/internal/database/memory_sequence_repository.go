@@ -0,0 +1,12 @@
+package database
+
+import "context"
+
+// NextSequence increments and returns the named counter
+func (r *MemoryRepository) NextSequence(ctx context.Context, name string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sequences[name]++
+	return r.sequences[name], nil
+}
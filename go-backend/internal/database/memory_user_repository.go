@@ -0,0 +1,130 @@
+package database
+
+import (
+	"context"
+	"shortlink/internal/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CreateUser creates a new user account
+func (r *MemoryRepository) CreateUser(ctx context.Context, user models.User) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Reject duplicate usernames
+	for _, existing := range r.users {
+		if existing.Username == user.Username {
+			return nil, ErrUsernameTaken
+		}
+	}
+
+	// Generate new ID if not set
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+
+	user.CreatedAt = time.Now()
+	r.users[user.ID] = user
+
+	return &user, nil
+}
+
+// GetUserByID retrieves a user by ID
+func (r *MemoryRepository) GetUserByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return nil, nil
+	}
+
+	return &user, nil
+}
+
+// GetUserByUsername retrieves a user by username
+func (r *MemoryRepository) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if user.Username == username {
+			return &user, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// SetUserRole changes the role of the user with username
+func (r *MemoryRepository) SetUserRole(ctx context.Context, username, role string) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, user := range r.users {
+		if user.Username == username {
+			user.Role = role
+			r.users[id] = user
+			return &user, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// CreateSession stores a new login session
+func (r *MemoryRepository) CreateSession(ctx context.Context, session models.Session) (*models.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Generate new ID if not set
+	if session.ID.IsZero() {
+		session.ID = primitive.NewObjectID()
+	}
+
+	session.CreatedAt = time.Now()
+	r.sessions[session.TokenHash] = session
+
+	return &session, nil
+}
+
+// GetSessionByTokenHash retrieves an unexpired session by the hash of its token
+func (r *MemoryRepository) GetSessionByTokenHash(ctx context.Context, tokenHash string) (*models.Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	session, ok := r.sessions[tokenHash]
+	if !ok || !session.ExpiresAt.After(time.Now()) {
+		return nil, nil
+	}
+
+	return &session, nil
+}
+
+// DeleteSession removes the session identified by the hash of its token
+func (r *MemoryRepository) DeleteSession(ctx context.Context, tokenHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.sessions, tokenHash)
+
+	return nil
+}
+
+// DeleteExpiredSessions removes the sessions that expired by now
+func (r *MemoryRepository) DeleteExpiredSessions(ctx context.Context, now time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deleted := 0
+	for tokenHash, session := range r.sessions {
+		if !session.ExpiresAt.After(now) {
+			delete(r.sessions, tokenHash)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
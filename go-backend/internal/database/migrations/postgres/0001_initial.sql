@@ -0,0 +1,27 @@
+-- Tables shared with the TypeScript server, as declared in shared/schema.ts.
+-- IF NOT EXISTS lets this run against a database already set up by drizzle-kit.
+
+CREATE TABLE IF NOT EXISTS users (
+    id serial PRIMARY KEY,
+    username text NOT NULL UNIQUE,
+    password text NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS short_urls (
+    id serial PRIMARY KEY,
+    original_url text NOT NULL,
+    slug text NOT NULL UNIQUE,
+    clicks integer NOT NULL DEFAULT 0,
+    active boolean NOT NULL DEFAULT true,
+    created_at timestamp NOT NULL DEFAULT now(),
+    expires_at timestamp
+);
+
+CREATE TABLE IF NOT EXISTS click_events (
+    id serial PRIMARY KEY,
+    short_url_id integer NOT NULL,
+    referrer text,
+    user_agent text,
+    timestamp timestamp NOT NULL DEFAULT now(),
+    device text
+);
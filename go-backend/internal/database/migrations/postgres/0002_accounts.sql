@@ -0,0 +1,31 @@
+-- Link ownership, roles, sessions and API keys used by the Go server.
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role text NOT NULL DEFAULT 'user';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS created_at timestamp NOT NULL DEFAULT now();
+
+ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS user_id integer REFERENCES users (id);
+CREATE INDEX IF NOT EXISTS short_urls_user_id_created_at_idx ON short_urls (user_id, created_at DESC);
+
+ALTER TABLE click_events ADD COLUMN IF NOT EXISTS ip_address text;
+CREATE INDEX IF NOT EXISTS click_events_short_url_id_timestamp_idx ON click_events (short_url_id, timestamp DESC);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id serial PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    token_hash text NOT NULL UNIQUE,
+    created_at timestamp NOT NULL DEFAULT now(),
+    expires_at timestamp NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id serial PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name text NOT NULL,
+    prefix text NOT NULL,
+    key_hash text NOT NULL UNIQUE,
+    scopes text[] NOT NULL DEFAULT '{}',
+    created_at timestamp NOT NULL DEFAULT now(),
+    last_used_at timestamp,
+    revoked_at timestamp
+);
+CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id);
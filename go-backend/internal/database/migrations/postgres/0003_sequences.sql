@@ -0,0 +1,6 @@
+-- Named counters used by the sequential slug generators.
+
+CREATE TABLE IF NOT EXISTS sequences (
+    name text PRIMARY KEY,
+    value bigint NOT NULL
+);
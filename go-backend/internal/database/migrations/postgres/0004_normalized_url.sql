@@ -0,0 +1,4 @@
+-- Normalized destination used to deduplicate a user's links.
+
+ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS normalized_url text;
+CREATE INDEX IF NOT EXISTS short_urls_user_id_normalized_url_idx ON short_urls (user_id, normalized_url);
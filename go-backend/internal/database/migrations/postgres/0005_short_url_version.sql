@@ -0,0 +1,3 @@
+-- Version counter for optimistic concurrency on link updates.
+
+ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 1;
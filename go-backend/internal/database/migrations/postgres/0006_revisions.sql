@@ -0,0 +1,30 @@
+-- Append-only link history, recording every editable field of each version,
+-- and the link version each click was served from.
+
+CREATE TABLE IF NOT EXISTS short_url_revisions (
+    id serial PRIMARY KEY,
+    short_url_id integer NOT NULL REFERENCES short_urls (id) ON DELETE CASCADE,
+    version integer NOT NULL,
+    action text NOT NULL,
+    changes text[] NOT NULL DEFAULT '{}',
+    rolled_back_to integer,
+    changed_by integer REFERENCES users (id),
+    original_url text NOT NULL,
+    normalized_url text,
+    slug text NOT NULL,
+    active boolean NOT NULL,
+    expires_at timestamp,
+    activate_at timestamp,
+    schedule jsonb,
+    fallback_url text,
+    max_clicks integer NOT NULL DEFAULT 0,
+    password_hash text,
+    redirect_type text,
+    query_passthrough text,
+    wildcard boolean NOT NULL DEFAULT false,
+    created_at timestamp NOT NULL DEFAULT now(),
+    UNIQUE (short_url_id, version)
+);
+
+ALTER TABLE click_events ADD COLUMN IF NOT EXISTS short_url_version integer;
+ALTER TABLE click_events ADD COLUMN IF NOT EXISTS destination text;
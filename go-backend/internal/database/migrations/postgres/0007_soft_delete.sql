@@ -0,0 +1,5 @@
+-- Deleted links are kept in the trash until they are purged.
+
+ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS deleted_at timestamp;
+
+CREATE INDEX IF NOT EXISTS short_urls_deleted_at_idx ON short_urls (deleted_at) WHERE deleted_at IS NOT NULL;
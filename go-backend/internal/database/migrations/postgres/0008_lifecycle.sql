@@ -0,0 +1,7 @@
+-- Scheduled activation, and indexes for the lifecycle worker's sweeps.
+
+ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS activate_at timestamp;
+
+CREATE INDEX IF NOT EXISTS short_urls_activate_at_idx ON short_urls (activate_at) WHERE activate_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS short_urls_expires_at_idx ON short_urls (expires_at) WHERE expires_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS sessions_expires_at_idx ON sessions (expires_at);
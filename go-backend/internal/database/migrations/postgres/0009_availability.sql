@@ -0,0 +1,4 @@
+-- Availability windows: recurring weekly windows and a fallback destination.
+
+ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS schedule jsonb;
+ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS fallback_url text;
@@ -0,0 +1,3 @@
+-- Click limits: a link stops redirecting once clicks reaches max_clicks. Zero means no limit.
+
+ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS max_clicks integer NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- Password-protected links: the bcrypt hash of the password visitors must enter.
+
+ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS password_hash text;
@@ -0,0 +1,23 @@
+-- Branded domains: each has its own slug namespace, so slugs become unique per
+-- domain. Links on the default domain have an empty domain.
+
+ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS domain text NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX IF NOT EXISTS short_urls_domain_slug_idx ON short_urls (domain, slug);
+
+-- The constraint is named by Postgres when created by 0001_initial.sql, and by
+-- drizzle-kit when created from shared/schema.ts
+ALTER TABLE short_urls DROP CONSTRAINT IF EXISTS short_urls_slug_key;
+ALTER TABLE short_urls DROP CONSTRAINT IF EXISTS short_urls_slug_unique;
+
+CREATE TABLE IF NOT EXISTS domains (
+    id serial PRIMARY KEY,
+    host text NOT NULL UNIQUE,
+    created_at timestamp NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS domain_grants (
+    domain_id integer NOT NULL REFERENCES domains (id) ON DELETE CASCADE,
+    user_id integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    PRIMARY KEY (domain_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS domain_grants_user_id_idx ON domain_grants (user_id);
@@ -0,0 +1,4 @@
+-- Per-link redirect types: a status code such as "301", or "interstitial" or "frame".
+-- NULL means the default temporary redirect.
+
+ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS redirect_type text;
@@ -0,0 +1,6 @@
+-- Query and path passthrough: whose value wins when the visitor's query string
+-- is merged into the destination ("link" or "request"; NULL forwards nothing),
+-- and whether the path after the slug is appended to the destination's path.
+
+ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS query_passthrough text;
+ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS wildcard boolean NOT NULL DEFAULT false;
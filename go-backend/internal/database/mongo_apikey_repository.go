@@ -0,0 +1,105 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"shortlink/internal/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CreateAPIKey stores a newly issued API key
+func (r *MongoRepository) CreateAPIKey(ctx context.Context, apiKey models.APIKey) (*models.APIKey, error) {
+	collection := r.db.GetCollection(APIKeyCollection)
+
+	// Set creation time
+	apiKey.CreatedAt = time.Now()
+
+	// Insert document
+	result, err := collection.InsertOne(ctx, apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set ID from inserted document
+	apiKey.ID = result.InsertedID.(primitive.ObjectID)
+
+	return &apiKey, nil
+}
+
+// GetAPIKeyByHash retrieves an unrevoked API key by the hash of its secret
+func (r *MongoRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	collection := r.db.GetCollection(APIKeyCollection)
+
+	filter := bson.M{
+		"keyHash":   keyHash,
+		"revokedAt": bson.M{"$exists": false},
+	}
+
+	var apiKey models.APIKey
+	err := collection.FindOne(ctx, filter).Decode(&apiKey)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &apiKey, nil
+}
+
+// GetAPIKeysByUser retrieves all API keys issued to a user, including revoked ones
+func (r *MongoRepository) GetAPIKeysByUser(ctx context.Context, userID primitive.ObjectID) ([]models.APIKey, error) {
+	collection := r.db.GetCollection(APIKeyCollection)
+
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "createdAt", Value: -1}}) // Sort by creation date, newest first
+
+	cursor, err := collection.Find(ctx, bson.M{"userId": userID}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	apiKeys := make([]models.APIKey, 0)
+	if err := cursor.All(ctx, &apiKeys); err != nil {
+		return nil, err
+	}
+
+	return apiKeys, nil
+}
+
+// RevokeAPIKey marks a user's API key as revoked.
+// It returns ErrNotFound if the key does not exist, belongs to another user or is already revoked.
+func (r *MongoRepository) RevokeAPIKey(ctx context.Context, id, userID primitive.ObjectID) error {
+	collection := r.db.GetCollection(APIKeyCollection)
+
+	filter := bson.M{
+		"_id":       id,
+		"userId":    userID,
+		"revokedAt": bson.M{"$exists": false},
+	}
+	update := bson.M{"$set": bson.M{"revokedAt": time.Now()}}
+
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// TouchAPIKey records that an API key was just used
+func (r *MongoRepository) TouchAPIKey(ctx context.Context, id primitive.ObjectID) error {
+	collection := r.db.GetCollection(APIKeyCollection)
+
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"lastUsedAt": time.Now()}})
+	return err
+}
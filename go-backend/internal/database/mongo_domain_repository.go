@@ -0,0 +1,129 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"shortlink/internal/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CreateDomain registers a branded domain
+func (r *MongoRepository) CreateDomain(ctx context.Context, domain models.Domain) (*models.Domain, error) {
+	collection := r.db.GetCollection(DomainCollection)
+
+	// Set creation time
+	domain.CreatedAt = time.Now()
+	if domain.UserIDs == nil {
+		domain.UserIDs = []primitive.ObjectID{}
+	}
+
+	// Insert document; the unique index on host rejects duplicates atomically
+	result, err := collection.InsertOne(ctx, domain)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrDomainTaken
+		}
+		return nil, err
+	}
+
+	// Set ID from inserted document
+	domain.ID = result.InsertedID.(primitive.ObjectID)
+
+	return &domain, nil
+}
+
+// GetDomain retrieves a domain by ID
+func (r *MongoRepository) GetDomain(ctx context.Context, id primitive.ObjectID) (*models.Domain, error) {
+	return r.findDomain(ctx, bson.M{"_id": id})
+}
+
+// GetDomainByHost retrieves a domain by host
+func (r *MongoRepository) GetDomainByHost(ctx context.Context, host string) (*models.Domain, error) {
+	return r.findDomain(ctx, bson.M{"host": host})
+}
+
+// GetDomains retrieves every registered domain
+func (r *MongoRepository) GetDomains(ctx context.Context) ([]models.Domain, error) {
+	return r.findDomains(ctx, bson.M{})
+}
+
+// GetDomainsByUser retrieves the domains userID has been granted
+func (r *MongoRepository) GetDomainsByUser(ctx context.Context, userID primitive.ObjectID) ([]models.Domain, error) {
+	return r.findDomains(ctx, bson.M{"userIds": userID})
+}
+
+// GrantDomain lets userID create links on a domain
+func (r *MongoRepository) GrantDomain(ctx context.Context, id, userID primitive.ObjectID) (*models.Domain, error) {
+	return r.updateDomain(ctx, id, bson.M{"$addToSet": bson.M{"userIds": userID}})
+}
+
+// RevokeDomain stops userID creating links on a domain. Links already on the
+// domain are left alone.
+func (r *MongoRepository) RevokeDomain(ctx context.Context, id, userID primitive.ObjectID) (*models.Domain, error) {
+	return r.updateDomain(ctx, id, bson.M{"$pull": bson.M{"userIds": userID}})
+}
+
+// findDomain retrieves the domain matching filter, or nil if there is none
+func (r *MongoRepository) findDomain(ctx context.Context, filter bson.M) (*models.Domain, error) {
+	collection := r.db.GetCollection(DomainCollection)
+
+	var domain models.Domain
+	err := collection.FindOne(ctx, filter).Decode(&domain)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &domain, nil
+}
+
+// findDomains retrieves the domains matching filter, sorted by host
+func (r *MongoRepository) findDomains(ctx context.Context, filter bson.M) ([]models.Domain, error) {
+	collection := r.db.GetCollection(DomainCollection)
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "host", Value: 1}})
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	domains := make([]models.Domain, 0)
+	if err := cursor.All(ctx, &domains); err != nil {
+		return nil, err
+	}
+
+	return domains, nil
+}
+
+// updateDomain applies update to a domain and returns the result
+func (r *MongoRepository) updateDomain(ctx context.Context, id primitive.ObjectID, update bson.M) (*models.Domain, error) {
+	collection := r.db.GetCollection(DomainCollection)
+
+	var domain models.Domain
+	err := collection.FindOneAndUpdate(ctx, bson.M{"_id": id}, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&domain)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &domain, nil
+}
+
+// mongoDomain is the filter value that matches links on domain. Links on the
+// default domain are stored without the field, which matches null.
+func mongoDomain(domain string) interface{} {
+	if domain == "" {
+		return nil
+	}
+	return domain
+}
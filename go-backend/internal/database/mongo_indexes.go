@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoIndexes lists the indexes each collection needs.
+// Unique indexes back the ErrSlugTaken, ErrDomainTaken and ErrUsernameTaken guarantees,
+// and the TTL index on sessions lets MongoDB remove expired logins itself.
+// Links get no TTL index on expiresAt: expired links are kept, deactivated
+// with a revision, until EXPIRED_RETENTION passes, and the lifecycle worker
+// purges them then. A TTL index would delete them the moment they expire.
+var mongoIndexes = map[string][]mongo.IndexModel{
+	ShortURLCollection: {
+		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "slug", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "normalizedUrl", Value: 1}}},
+		{Keys: bson.D{{Key: "deletedAt", Value: 1}}, Options: options.Index().SetSparse(true)},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetSparse(true)},
+		{Keys: bson.D{{Key: "activateAt", Value: 1}}, Options: options.Index().SetSparse(true)},
+	},
+	ClickEventCollection: {
+		{Keys: bson.D{{Key: "shortUrlId", Value: 1}, {Key: "createdAt", Value: -1}}},
+	},
+	ShortURLRevisionCollection: {
+		{Keys: bson.D{{Key: "shortUrlId", Value: 1}, {Key: "version", Value: -1}}, Options: options.Index().SetUnique(true)},
+	},
+	UserCollection: {
+		{Keys: bson.D{{Key: "username", Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+	SessionCollection: {
+		{Keys: bson.D{{Key: "tokenHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	},
+	APIKeyCollection: {
+		{Keys: bson.D{{Key: "keyHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "userId", Value: 1}}},
+	},
+	DomainCollection: {
+		{Keys: bson.D{{Key: "host", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "userIds", Value: 1}}},
+	},
+}
+
+// EnsureIndexes creates any missing indexes. Creating an index that already
+// exists is a no-op, so this is safe to run on every startup.
+func (c *DBClient) EnsureIndexes(ctx context.Context) error {
+	for collection, indexes := range mongoIndexes {
+		if _, err := c.GetCollection(collection).Indexes().CreateMany(ctx, indexes); err != nil {
+			return fmt.Errorf("creating indexes on %s: %w", collection, err)
+		}
+	}
+	return nil
+}
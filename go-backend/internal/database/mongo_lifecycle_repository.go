@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"shortlink/internal/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ActivateScheduledShortURLs activates the short URLs whose activation time has passed
+func (r *MongoRepository) ActivateScheduledShortURLs(ctx context.Context, now time.Time) ([]models.ShortURL, error) {
+	filter := bson.M{"activateAt": bson.M{"$lte": now}, "deletedAt": nil}
+	update := bson.M{
+		"$set":   bson.M{"active": true},
+		"$unset": bson.M{"activateAt": ""},
+		"$inc":   bson.M{"version": 1},
+	}
+	return r.updateShortURLs(ctx, filter, update)
+}
+
+// ExpireShortURLs deactivates the active short URLs whose expiry time has passed
+func (r *MongoRepository) ExpireShortURLs(ctx context.Context, now time.Time) ([]models.ShortURL, error) {
+	filter := bson.M{"active": true, "expiresAt": bson.M{"$lte": now}, "deletedAt": nil}
+	update := bson.M{
+		"$set": bson.M{"active": false},
+		"$inc": bson.M{"version": 1},
+	}
+	return r.updateShortURLs(ctx, filter, update)
+}
+
+// PurgeExpiredShortURLs permanently removes the short URLs that expired before
+// expiredBefore, along with their click events and history
+func (r *MongoRepository) PurgeExpiredShortURLs(ctx context.Context, expiredBefore time.Time) (int, error) {
+	return r.purgeShortURLs(ctx, bson.M{"expiresAt": bson.M{"$lt": expiredBefore}})
+}
+
+// updateShortURLs applies update to the short URLs matching filter one at a
+// time, so that each change is atomic and the changed documents can be
+// returned. filter must stop matching a document once update is applied.
+func (r *MongoRepository) updateShortURLs(ctx context.Context, filter, update bson.M) ([]models.ShortURL, error) {
+	collection := r.db.GetCollection(ShortURLCollection)
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	changed := make([]models.ShortURL, 0)
+	for {
+		var shortURL models.ShortURL
+		err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&shortURL)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return changed, nil
+		}
+		if err != nil {
+			return changed, err
+		}
+		changed = append(changed, shortURL)
+	}
+}
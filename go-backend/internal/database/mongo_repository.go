@@ -0,0 +1,518 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"shortlink/internal/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoRepository is the MongoDB implementation of Store
+type MongoRepository struct {
+	db *DBClient
+}
+
+// NewMongoRepository creates a repository backed by the given MongoDB client
+func NewMongoRepository(db *DBClient) *MongoRepository {
+	return &MongoRepository{
+		db: db,
+	}
+}
+
+// GetShortURL retrieves a short URL by ID
+func (r *MongoRepository) GetShortURL(ctx context.Context, id primitive.ObjectID) (*models.ShortURL, error) {
+	collection := r.db.GetCollection(ShortURLCollection)
+
+	var shortURL models.ShortURL
+	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&shortURL)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &shortURL, nil
+}
+
+// GetShortURLBySlug retrieves a short URL by its domain and slug
+func (r *MongoRepository) GetShortURLBySlug(ctx context.Context, domain, slug string) (*models.ShortURL, error) {
+	collection := r.db.GetCollection(ShortURLCollection)
+
+	var shortURL models.ShortURL
+	err := collection.FindOne(ctx, bson.M{"domain": mongoDomain(domain), "slug": slug}).Decode(&shortURL)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &shortURL, nil
+}
+
+// GetAllShortURLs retrieves all short URLs for a specific user, leaving out the trash
+func (r *MongoRepository) GetAllShortURLs(ctx context.Context, userID primitive.ObjectID) ([]models.ShortURL, error) {
+	collection := r.db.GetCollection(ShortURLCollection)
+
+	// Find all documents for this user
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "createdAt", Value: -1}}) // Sort by creation date, newest first
+
+	cursor, err := collection.Find(ctx, bson.M{"userId": userID, "deletedAt": nil}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	// Decode the documents
+	shortURLs := make([]models.ShortURL, 0)
+	if err := cursor.All(ctx, &shortURLs); err != nil {
+		return nil, err
+	}
+
+	return shortURLs, nil
+}
+
+// GetActiveShortURLByNormalizedURL retrieves the newest active, unexpired short URL
+// owned by userID on domain that points at normalizedURL
+func (r *MongoRepository) GetActiveShortURLByNormalizedURL(ctx context.Context, userID primitive.ObjectID, domain, normalizedURL string) (*models.ShortURL, error) {
+	collection := r.db.GetCollection(ShortURLCollection)
+
+	filter := bson.M{
+		"userId":        userID,
+		"domain":        mongoDomain(domain),
+		"normalizedUrl": normalizedURL,
+		"active":        true,
+		"deletedAt":     nil,
+		"$or": bson.A{
+			bson.M{"expiresAt": nil},
+			bson.M{"expiresAt": bson.M{"$gt": time.Now()}},
+		},
+	}
+	findOptions := options.FindOne().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+
+	var shortURL models.ShortURL
+	err := collection.FindOne(ctx, filter, findOptions).Decode(&shortURL)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &shortURL, nil
+}
+
+// CreateShortURL creates a new short URL
+func (r *MongoRepository) CreateShortURL(ctx context.Context, shortURL models.ShortURL) (*models.ShortURL, error) {
+	collection := r.db.GetCollection(ShortURLCollection)
+
+	// Set creation time
+	shortURL.CreatedAt = time.Now()
+	shortURL.Clicks = 0
+	shortURL.Version = 1
+	shortURL.Active = shortURL.ActivateAt == nil
+
+	// Insert document; the unique index on (domain, slug) rejects duplicates atomically
+	result, err := collection.InsertOne(ctx, shortURL)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrSlugTaken
+		}
+		return nil, err
+	}
+
+	// Set ID from inserted document
+	shortURL.ID = result.InsertedID.(primitive.ObjectID)
+
+	return &shortURL, nil
+}
+
+// UpdateShortURL replaces the editable fields of a short URL owned by shortURL.UserID
+func (r *MongoRepository) UpdateShortURL(ctx context.Context, shortURL models.ShortURL, version int) (*models.ShortURL, error) {
+	collection := r.db.GetCollection(ShortURLCollection)
+
+	// Links created before versioning have no version field, which counts as 0
+	filter := bson.M{"_id": shortURL.ID, "userId": shortURL.UserID, "deletedAt": nil, "version": version}
+	if version == 0 {
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"originalUrl":      shortURL.OriginalURL,
+			"normalizedUrl":    shortURL.NormalizedURL,
+			"slug":             shortURL.Slug,
+			"active":           shortURL.Active,
+			"expiresAt":        shortURL.ExpiresAt,
+			"activateAt":       shortURL.ActivateAt,
+			"schedule":         shortURL.Schedule,
+			"fallbackUrl":      shortURL.FallbackURL,
+			"maxClicks":        shortURL.MaxClicks,
+			"passwordHash":     shortURL.PasswordHash,
+			"redirectType":     shortURL.RedirectType,
+			"queryPassthrough": shortURL.QueryPassthrough,
+			"wildcard":         shortURL.Wildcard,
+		},
+		"$inc": bson.M{"version": 1},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var updated models.ShortURL
+	err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&updated)
+	if err == nil {
+		return &updated, nil
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrSlugTaken
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	// Work out whether the link is missing or was changed by someone else
+	count, err := collection.CountDocuments(ctx, bson.M{"_id": shortURL.ID, "userId": shortURL.UserID, "deletedAt": nil})
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, ErrNotFound
+	}
+	return nil, ErrVersionConflict
+}
+
+// UpdateShortURLClicks increments the click count for a short URL
+func (r *MongoRepository) UpdateShortURLClicks(ctx context.Context, id primitive.ObjectID) (*models.ShortURL, error) {
+	collection := r.db.GetCollection(ShortURLCollection)
+
+	// Update the click count, unless the link has used up its clicks. The limit is
+	// part of the filter, so concurrent clicks can't push the count past it.
+	filter := bson.M{
+		"_id": id,
+		"$or": bson.A{
+			bson.M{"maxClicks": bson.M{"$not": bson.M{"$gt": 0}}},
+			bson.M{"$expr": bson.M{"$lt": bson.A{"$clicks", "$maxClicks"}}},
+		},
+	}
+	// The last click deactivates the link, as a new version
+	lastClick := bson.M{"$eq": bson.A{bson.M{"$add": bson.A{"$clicks", 1}}, "$maxClicks"}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"clicks":     bson.M{"$add": bson.A{"$clicks", 1}},
+			"active":     bson.M{"$cond": bson.A{lastClick, false, "$active"}},
+			"activateAt": bson.M{"$cond": bson.A{lastClick, "$$REMOVE", "$activateAt"}},
+			"version":    bson.M{"$cond": bson.A{lastClick, bson.M{"$add": bson.A{"$version", 1}}, "$version"}},
+		}}},
+	}
+
+	after := options.After // Return the updated document
+	updateOptions := options.FindOneAndUpdateOptions{
+		ReturnDocument: &after,
+	}
+
+	var shortURL models.ShortURL
+	err := collection.FindOneAndUpdate(ctx, filter, update, &updateOptions).Decode(&shortURL)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+		// Tell a missing link from one at its limit
+		count, err := collection.CountDocuments(ctx, bson.M{"_id": id})
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, ErrClickLimitReached
+		}
+		return nil, ErrNotFound
+	}
+
+	return &shortURL, nil
+}
+
+// DeleteShortURL moves a short URL to the trash if it belongs to the given user.
+// It returns ErrNotFound if there is no such short URL owned by userID.
+func (r *MongoRepository) DeleteShortURL(ctx context.Context, id primitive.ObjectID, userID primitive.ObjectID) error {
+	collection := r.db.GetCollection(ShortURLCollection)
+
+	// Mark the document, matching on the owner so other users' links are untouched.
+	// The document stays, so the unique index keeps its slug reserved.
+	filter := bson.M{"_id": id, "userId": userID, "deletedAt": nil}
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"deletedAt": time.Now()}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetDeletedShortURLs retrieves the short URLs in a user's trash, most recently deleted first
+func (r *MongoRepository) GetDeletedShortURLs(ctx context.Context, userID primitive.ObjectID) ([]models.ShortURL, error) {
+	collection := r.db.GetCollection(ShortURLCollection)
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "deletedAt", Value: -1}})
+	cursor, err := collection.Find(ctx, bson.M{"userId": userID, "deletedAt": bson.M{"$ne": nil}}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	// Decode the documents
+	shortURLs := make([]models.ShortURL, 0)
+	if err := cursor.All(ctx, &shortURLs); err != nil {
+		return nil, err
+	}
+
+	return shortURLs, nil
+}
+
+// RestoreShortURL takes a short URL owned by userID back out of the trash
+func (r *MongoRepository) RestoreShortURL(ctx context.Context, id primitive.ObjectID, userID primitive.ObjectID) (*models.ShortURL, error) {
+	collection := r.db.GetCollection(ShortURLCollection)
+
+	filter := bson.M{"_id": id, "userId": userID, "deletedAt": bson.M{"$ne": nil}}
+	update := bson.M{"$unset": bson.M{"deletedAt": ""}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var shortURL models.ShortURL
+	err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&shortURL)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &shortURL, nil
+}
+
+// PurgeDeletedShortURLs permanently removes the short URLs that were moved to
+// the trash before deletedBefore, along with their click events and history
+func (r *MongoRepository) PurgeDeletedShortURLs(ctx context.Context, deletedBefore time.Time) (int, error) {
+	return r.purgeShortURLs(ctx, bson.M{"deletedAt": bson.M{"$lt": deletedBefore}})
+}
+
+// purgeShortURLs removes the short URLs matching filter, with their click
+// events and history, and reports how many there were
+func (r *MongoRepository) purgeShortURLs(ctx context.Context, filter bson.M) (int, error) {
+	collection := r.db.GetCollection(ShortURLCollection)
+
+	ids, err := collection.Distinct(ctx, "_id", filter)
+	if err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	// Remove dependent documents first, so an interrupted purge is simply retried
+	byLink := bson.M{"shortUrlId": bson.M{"$in": ids}}
+	if _, err := r.db.GetCollection(ClickEventCollection).DeleteMany(ctx, byLink); err != nil {
+		return 0, err
+	}
+	if _, err := r.db.GetCollection(ShortURLRevisionCollection).DeleteMany(ctx, byLink); err != nil {
+		return 0, err
+	}
+
+	filter["_id"] = bson.M{"$in": ids}
+	result, err := collection.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(result.DeletedCount), nil
+}
+
+// CreateClickEvent creates a new click event
+func (r *MongoRepository) CreateClickEvent(ctx context.Context, clickEvent models.ClickEvent) (*models.ClickEvent, error) {
+	collection := r.db.GetCollection(ClickEventCollection)
+
+	// Set creation time
+	clickEvent.CreatedAt = time.Now()
+
+	// Insert document
+	result, err := collection.InsertOne(ctx, clickEvent)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set ID from inserted document
+	clickEvent.ID = result.InsertedID.(primitive.ObjectID)
+
+	return &clickEvent, nil
+}
+
+// GetClickEventsByShortURLID retrieves click events for a specific short URL
+func (r *MongoRepository) GetClickEventsByShortURLID(ctx context.Context, shortURLID primitive.ObjectID) ([]models.ClickEvent, error) {
+	collection := r.db.GetCollection(ClickEventCollection)
+
+	// Find documents for this short URL
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "createdAt", Value: -1}}) // Sort by creation date, newest first
+
+	cursor, err := collection.Find(ctx, bson.M{"shortUrlId": shortURLID}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	// Decode the documents
+	clickEvents := make([]models.ClickEvent, 0)
+	if err := cursor.All(ctx, &clickEvents); err != nil {
+		return nil, err
+	}
+
+	return clickEvents, nil
+}
+
+// GetClickStats retrieves aggregated analytics data for the links owned by userID.
+// Passing primitive.NilObjectID aggregates over every user's links.
+func (r *MongoRepository) GetClickStats(ctx context.Context, userID primitive.ObjectID) (*models.StatsResponse, error) {
+	// Get collections
+	shortURLColl := r.db.GetCollection(ShortURLCollection)
+	clickEventColl := r.db.GetCollection(ClickEventCollection)
+
+	// Scope the link and click queries to the user's links
+	linkFilter := bson.M{}
+	clickFilter := bson.M{}
+	if !userID.IsZero() {
+		linkFilter["userId"] = userID
+
+		linkIDs, err := shortURLColl.Distinct(ctx, "_id", linkFilter)
+		if err != nil {
+			return nil, err
+		}
+		clickFilter["shortUrlId"] = bson.M{"$in": linkIDs}
+	}
+
+	// Get total clicks count
+	totalClicks, err := clickEventColl.CountDocuments(ctx, clickFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get total links count, leaving out the trash
+	linkFilter["deletedAt"] = nil
+	totalLinks, err := shortURLColl.CountDocuments(ctx, linkFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get active links count (not expired and active = true)
+	now := time.Now()
+	activeLinksFilter := bson.M{
+		"active": true,
+		"$or": []bson.M{
+			{"expiresAt": nil},
+			{"expiresAt": bson.M{"$gt": now}},
+		},
+	}
+	for key, value := range linkFilter {
+		activeLinksFilter[key] = value
+	}
+	activeLinks, err := shortURLColl.CountDocuments(ctx, activeLinksFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get device stats
+	deviceStatsFilter := []bson.M{
+		{"$match": clickFilter},
+		{
+			"$group": bson.M{
+				"_id":   "$device",
+				"count": bson.M{"$sum": 1},
+			},
+		},
+	}
+
+	deviceStatsCursor, err := clickEventColl.Aggregate(ctx, deviceStatsFilter)
+	if err != nil {
+		return nil, err
+	}
+	defer deviceStatsCursor.Close(ctx)
+
+	// Process device stats results
+	deviceStats := models.DeviceStats{
+		Mobile:  0,
+		Desktop: 0,
+		Tablet:  0,
+	}
+
+	var deviceResults []struct {
+		ID    string `bson:"_id"`
+		Count int    `bson:"count"`
+	}
+
+	if err := deviceStatsCursor.All(ctx, &deviceResults); err != nil {
+		return nil, err
+	}
+
+	for _, result := range deviceResults {
+		switch result.ID {
+		case "mobile":
+			deviceStats.Mobile = result.Count
+		case "desktop":
+			deviceStats.Desktop = result.Count
+		case "tablet":
+			deviceStats.Tablet = result.Count
+		}
+	}
+
+	// Get referrer stats
+	referrerStatsFilter := []bson.M{
+		{"$match": clickFilter},
+		{
+			"$group": bson.M{
+				"_id":   "$referer",
+				"count": bson.M{"$sum": 1},
+			},
+		},
+	}
+
+	referrerStatsCursor, err := clickEventColl.Aggregate(ctx, referrerStatsFilter)
+	if err != nil {
+		return nil, err
+	}
+	defer referrerStatsCursor.Close(ctx)
+
+	// Process referrer stats results
+	referrerStats := make(map[string]int)
+
+	var referrerResults []struct {
+		ID    string `bson:"_id"`
+		Count int    `bson:"count"`
+	}
+
+	if err := referrerStatsCursor.All(ctx, &referrerResults); err != nil {
+		return nil, err
+	}
+
+	for _, result := range referrerResults {
+		referrerId := result.ID
+		if referrerId == "" {
+			referrerId = "direct"
+		}
+		referrerStats[referrerId] = result.Count
+	}
+
+	// Create and return the stats response
+	stats := &models.StatsResponse{
+		TotalClicks:   int(totalClicks),
+		TotalLinks:    int(totalLinks),
+		ActiveLinks:   int(activeLinks),
+		DeviceStats:   deviceStats,
+		ReferrerStats: referrerStats,
+	}
+
+	return stats, nil
+}
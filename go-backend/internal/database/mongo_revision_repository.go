@@ -0,0 +1,71 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"shortlink/internal/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CreateShortURLRevision appends a revision to a short URL's history
+func (r *MongoRepository) CreateShortURLRevision(ctx context.Context, revision models.ShortURLRevision) (*models.ShortURLRevision, error) {
+	collection := r.db.GetCollection(ShortURLRevisionCollection)
+
+	// Set creation time
+	revision.CreatedAt = time.Now()
+
+	// Insert document; the unique index on (shortUrlId, version) keeps history append-only
+	result, err := collection.InsertOne(ctx, revision)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrVersionConflict
+		}
+		return nil, err
+	}
+
+	// Set ID from inserted document
+	revision.ID = result.InsertedID.(primitive.ObjectID)
+
+	return &revision, nil
+}
+
+// GetShortURLRevisions retrieves a short URL's history, newest first
+func (r *MongoRepository) GetShortURLRevisions(ctx context.Context, shortURLID primitive.ObjectID) ([]models.ShortURLRevision, error) {
+	collection := r.db.GetCollection(ShortURLRevisionCollection)
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "version", Value: -1}})
+	cursor, err := collection.Find(ctx, bson.M{"shortUrlId": shortURLID}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	// Decode the documents
+	revisions := make([]models.ShortURLRevision, 0)
+	if err := cursor.All(ctx, &revisions); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// GetShortURLRevision retrieves one version of a short URL
+func (r *MongoRepository) GetShortURLRevision(ctx context.Context, shortURLID primitive.ObjectID, version int) (*models.ShortURLRevision, error) {
+	collection := r.db.GetCollection(ShortURLRevisionCollection)
+
+	var revision models.ShortURLRevision
+	err := collection.FindOne(ctx, bson.M{"shortUrlId": shortURLID, "version": version}).Decode(&revision)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &revision, nil
+}
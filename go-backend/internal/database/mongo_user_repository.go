@@ -0,0 +1,152 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"shortlink/internal/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CreateUser creates a new user account
+func (r *MongoRepository) CreateUser(ctx context.Context, user models.User) (*models.User, error) {
+	collection := r.db.GetCollection(UserCollection)
+
+	// Reject duplicate usernames
+	existing, err := r.GetUserByUsername(ctx, user.Username)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrUsernameTaken
+	}
+
+	// Set creation time
+	user.CreatedAt = time.Now()
+
+	// Insert document
+	result, err := collection.InsertOne(ctx, user)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrUsernameTaken
+		}
+		return nil, err
+	}
+
+	// Set ID from inserted document
+	user.ID = result.InsertedID.(primitive.ObjectID)
+
+	return &user, nil
+}
+
+// GetUserByID retrieves a user by ID
+func (r *MongoRepository) GetUserByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	return r.findUser(ctx, bson.M{"_id": id})
+}
+
+// GetUserByUsername retrieves a user by username
+func (r *MongoRepository) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	return r.findUser(ctx, bson.M{"username": username})
+}
+
+// SetUserRole changes the role of the user with username
+func (r *MongoRepository) SetUserRole(ctx context.Context, username, role string) (*models.User, error) {
+	collection := r.db.GetCollection(UserCollection)
+
+	var user models.User
+	err := collection.FindOneAndUpdate(ctx,
+		bson.M{"username": username},
+		bson.M{"$set": bson.M{"role": role}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// findUser returns the first user matching filter, or nil if there is none
+func (r *MongoRepository) findUser(ctx context.Context, filter bson.M) (*models.User, error) {
+	collection := r.db.GetCollection(UserCollection)
+
+	var user models.User
+	err := collection.FindOne(ctx, filter).Decode(&user)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// CreateSession stores a new login session
+func (r *MongoRepository) CreateSession(ctx context.Context, session models.Session) (*models.Session, error) {
+	collection := r.db.GetCollection(SessionCollection)
+
+	// Set creation time
+	session.CreatedAt = time.Now()
+
+	// Insert document
+	result, err := collection.InsertOne(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set ID from inserted document
+	session.ID = result.InsertedID.(primitive.ObjectID)
+
+	return &session, nil
+}
+
+// GetSessionByTokenHash retrieves an unexpired session by the hash of its token
+func (r *MongoRepository) GetSessionByTokenHash(ctx context.Context, tokenHash string) (*models.Session, error) {
+	collection := r.db.GetCollection(SessionCollection)
+
+	filter := bson.M{
+		"tokenHash": tokenHash,
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}
+
+	var session models.Session
+	err := collection.FindOne(ctx, filter).Decode(&session)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// DeleteSession removes the session identified by the hash of its token
+func (r *MongoRepository) DeleteSession(ctx context.Context, tokenHash string) error {
+	collection := r.db.GetCollection(SessionCollection)
+
+	_, err := collection.DeleteOne(ctx, bson.M{"tokenHash": tokenHash})
+	return err
+}
+
+// DeleteExpiredSessions removes the sessions that expired by now. MongoDB also
+// removes them on its own through the TTL index on expiresAt; this catches
+// any the TTL monitor hasn't reached yet.
+func (r *MongoRepository) DeleteExpiredSessions(ctx context.Context, now time.Time) (int, error) {
+	collection := r.db.GetCollection(SessionCollection)
+
+	result, err := collection.DeleteMany(ctx, bson.M{"expiresAt": bson.M{"$lte": now}})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(result.DeletedCount), nil
+}
@@ -2,8 +2,6 @@ package database
 
 import (
         "context"
-        "log"
-        "os"
         "time"
 
         "go.mongodb.org/mongo-driver/mongo"
@@ -20,61 +18,35 @@ type DBClient struct {
 const (
         ShortURLCollection = "shortUrls"
         ClickEventCollection = "clickEvents"
+        UserCollection = "users"
+        SessionCollection = "sessions"
+        APIKeyCollection = "apiKeys"
+        SequenceCollection = "sequences"
+        ShortURLRevisionCollection = "shortUrlRevisions"
+        DomainCollection = "domains"
 )
 
-// NewDBClient creates a new MongoDB client
-func NewDBClient() *DBClient {
-        // Get connection string from environment variable
-        mongoURI := os.Getenv("MONGODB_URI")
-        if mongoURI == "" {
-                mongoURI = "mongodb://localhost:27017"
-                log.Println("Warning: MONGODB_URI not set, using default:", mongoURI)
-        }
-
-        log.Println("Attempting to connect to MongoDB...")
-
-        // Set client options with shorter timeout and direct connection
+// ConnectMongo connects to MongoDB at uri, verifies the connection with a ping
+// and returns a client for the named database
+func ConnectMongo(ctx context.Context, uri string, dbName string) (*DBClient, error) {
         clientOptions := options.Client().
-                ApplyURI(mongoURI).
-                SetServerSelectionTimeout(5 * time.Second).
-                SetDirect(true)
-
-        // Connect to MongoDB
-        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-        defer cancel()
+                ApplyURI(uri).
+                SetServerSelectionTimeout(5 * time.Second)
 
         client, err := mongo.Connect(ctx, clientOptions)
         if err != nil {
-                log.Printf("Failed to connect to MongoDB: %v", err)
-                // Simulate a client for development
-                log.Println("Using simulated MongoDB client for development")
-                client = &mongo.Client{}
-        } else {
-                // Check the connection
-                err = client.Ping(ctx, nil)
-                if err != nil {
-                        log.Printf("Failed to ping MongoDB: %v", err)
-                        log.Println("Using simulated MongoDB client for development")
-                        client = &mongo.Client{}
-                } else {
-                        log.Println("Connected to MongoDB successfully")
-                }
+                return nil, err
         }
 
-        // Get database name from environment or use default
-        dbName := os.Getenv("MONGODB_DATABASE")
-        if dbName == "" {
-                dbName = "shortlink"
-                log.Println("Warning: MONGODB_DATABASE not set, using default:", dbName)
+        if err := client.Ping(ctx, nil); err != nil {
+                client.Disconnect(ctx)
+                return nil, err
         }
 
-        // Initialize the database
-        db := client.Database(dbName)
-
         return &DBClient{
                 client: client,
-                db:     db,
-        }
+                db:     client.Database(dbName),
+        }, nil
 }
 
 // GetCollection returns a MongoDB collection
@@ -85,4 +57,8 @@ func (c *DBClient) GetCollection(collectionName string) *mongo.Collection {
 // Disconnect closes the MongoDB connection
 func (c *DBClient) Disconnect(ctx context.Context) error {
         return c.client.Disconnect(ctx)
-}
\ No newline at end of file
+}
+// Ping checks that the MongoDB server is reachable
+func (c *DBClient) Ping(ctx context.Context) error {
+        return c.client.Ping(ctx, nil)
+}
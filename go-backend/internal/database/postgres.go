@@ -0,0 +1,173 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//go:embed migrations/postgres/*.sql
+var postgresMigrations embed.FS
+
+// postgresMigrationLock is the advisory lock key held while migrating,
+// so that several servers starting at once don't race each other
+const postgresMigrationLock = 7366741
+
+// OpenPostgres connects to PostgreSQL at url, verifies the connection and
+// applies any pending schema migrations
+func OpenPostgres(ctx context.Context, url string) (*pgxpool.Pool, error) {
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	if err := migratePostgres(ctx, pool); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	return pool, nil
+}
+
+// migratePostgres applies the embedded migrations that have not been recorded
+// in schema_migrations yet, each in its own transaction
+func migratePostgres(ctx context.Context, pool *pgxpool.Pool) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", postgresMigrationLock); err != nil {
+		return err
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", postgresMigrationLock)
+
+	_, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version integer PRIMARY KEY,
+		applied_at timestamp NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return err
+	}
+
+	var current int
+	if err := conn.QueryRow(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return err
+	}
+
+	files, err := fs.Glob(postgresMigrations, "migrations/postgres/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		name := path.Base(file)
+		version, err := strconv.Atoi(strings.SplitN(name, "_", 2)[0])
+		if err != nil {
+			return fmt.Errorf("migration %s: file name must start with a version number", name)
+		}
+		if version <= current {
+			continue
+		}
+
+		script, err := postgresMigrations.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		err = pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, string(script)); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("applying migration %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// Postgres rows use serial integer keys, shared with the TypeScript server.
+// They are exposed through the API as ObjectIDs whose first four bytes are zero
+// and whose last eight bytes hold the key, so the rest of the server can keep
+// treating every ID as a primitive.ObjectID.
+
+// objectIDFromPG converts a serial key to its ObjectID form
+func objectIDFromPG(id int64) primitive.ObjectID {
+	var oid primitive.ObjectID
+	binary.BigEndian.PutUint64(oid[4:], uint64(id))
+	return oid
+}
+
+// pgIDFromObjectID converts an ObjectID back to a serial key.
+// It reports false for ObjectIDs that were not issued by the Postgres backend.
+func pgIDFromObjectID(oid primitive.ObjectID) (int64, bool) {
+	if binary.BigEndian.Uint32(oid[:4]) != 0 {
+		return 0, false
+	}
+	id := int64(binary.BigEndian.Uint64(oid[4:]))
+	return id, id > 0
+}
+
+// pgNullableID converts an optional serial key to its ObjectID form
+func pgNullableID(id *int64) primitive.ObjectID {
+	if id == nil {
+		return primitive.NilObjectID
+	}
+	return objectIDFromPG(*id)
+}
+
+// pgUserRef converts a user ObjectID for storage in a nullable user_id column
+func pgUserRef(userID primitive.ObjectID) (*int64, error) {
+	if userID.IsZero() {
+		return nil, nil
+	}
+	id, ok := pgIDFromObjectID(userID)
+	if !ok {
+		return nil, fmt.Errorf("user ID %s was not issued by the postgres backend", userID.Hex())
+	}
+	return &id, nil
+}
+
+// pgTime normalizes a time for the timestamp (without time zone) columns, which are kept in UTC
+func pgTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
+
+// pgNullableTime normalizes an optional time for a timestamp column
+func pgNullableTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := pgTime(*t)
+	return &utc
+}
+
+// isPGUniqueViolation reports whether err is a unique constraint violation
+func isPGUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
@@ -0,0 +1,138 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"shortlink/internal/models"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// apiKeyColumns is the column list scanned by scanAPIKey
+const apiKeyColumns = "id, user_id, name, prefix, key_hash, scopes, created_at, last_used_at, revoked_at"
+
+// CreateAPIKey stores a newly issued API key
+func (r *PostgresRepository) CreateAPIKey(ctx context.Context, apiKey models.APIKey) (*models.APIKey, error) {
+	userID, ok := pgIDFromObjectID(apiKey.UserID)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	// Set creation time
+	apiKey.CreatedAt = pgTime(time.Now())
+	if apiKey.Scopes == nil {
+		apiKey.Scopes = []string{}
+	}
+
+	var id int64
+	err := r.pool.QueryRow(ctx, `
+		INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id`,
+		userID, apiKey.Name, apiKey.Prefix, apiKey.KeyHash, apiKey.Scopes, apiKey.CreatedAt,
+	).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set ID from inserted row
+	apiKey.ID = objectIDFromPG(id)
+
+	return &apiKey, nil
+}
+
+// GetAPIKeyByHash retrieves an unrevoked API key by the hash of its secret
+func (r *PostgresRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	row := r.pool.QueryRow(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL", keyHash)
+
+	apiKey, err := scanAPIKey(row)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return apiKey, nil
+}
+
+// GetAPIKeysByUser retrieves all API keys issued to a user, including revoked ones
+func (r *PostgresRepository) GetAPIKeysByUser(ctx context.Context, userID primitive.ObjectID) ([]models.APIKey, error) {
+	apiKeys := make([]models.APIKey, 0)
+
+	pgUserID, ok := pgIDFromObjectID(userID)
+	if !ok {
+		return apiKeys, nil
+	}
+
+	rows, err := r.pool.Query(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC", pgUserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		apiKey, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		apiKeys = append(apiKeys, *apiKey)
+	}
+
+	return apiKeys, rows.Err()
+}
+
+// RevokeAPIKey marks a user's API key as revoked.
+// It returns ErrNotFound if the key does not exist, belongs to another user or is already revoked.
+func (r *PostgresRepository) RevokeAPIKey(ctx context.Context, id, userID primitive.ObjectID) error {
+	pgID, ok := pgIDFromObjectID(id)
+	if !ok {
+		return ErrNotFound
+	}
+	pgUserID, ok := pgIDFromObjectID(userID)
+	if !ok {
+		return ErrNotFound
+	}
+
+	tag, err := r.pool.Exec(ctx,
+		"UPDATE api_keys SET revoked_at = $3 WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL",
+		pgID, pgUserID, pgTime(time.Now()),
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// TouchAPIKey records that an API key was just used
+func (r *PostgresRepository) TouchAPIKey(ctx context.Context, id primitive.ObjectID) error {
+	pgID, ok := pgIDFromObjectID(id)
+	if !ok {
+		return nil
+	}
+
+	_, err := r.pool.Exec(ctx, "UPDATE api_keys SET last_used_at = $2 WHERE id = $1", pgID, pgTime(time.Now()))
+	return err
+}
+
+// scanAPIKey scans a row selected with apiKeyColumns
+func scanAPIKey(row pgx.Row) (*models.APIKey, error) {
+	var apiKey models.APIKey
+	var id, userID int64
+
+	err := row.Scan(&id, &userID, &apiKey.Name, &apiKey.Prefix, &apiKey.KeyHash, &apiKey.Scopes, &apiKey.CreatedAt, &apiKey.LastUsedAt, &apiKey.RevokedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	apiKey.ID = objectIDFromPG(id)
+	apiKey.UserID = objectIDFromPG(userID)
+
+	return &apiKey, nil
+}
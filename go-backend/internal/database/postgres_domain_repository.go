@@ -0,0 +1,178 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"shortlink/internal/models"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// domainSelect selects domains with their grants for scanDomain; callers add
+// the WHERE clause and end with domainGroupBy
+const domainSelect = `
+	SELECT d.id, d.host, d.created_at,
+		COALESCE(array_agg(g.user_id::bigint ORDER BY g.user_id) FILTER (WHERE g.user_id IS NOT NULL), '{}')
+	FROM domains d
+	LEFT JOIN domain_grants g ON g.domain_id = d.id`
+
+// domainGroupBy ends a domainSelect query
+const domainGroupBy = " GROUP BY d.id ORDER BY d.host"
+
+// CreateDomain registers a branded domain
+func (r *PostgresRepository) CreateDomain(ctx context.Context, domain models.Domain) (*models.Domain, error) {
+	// Set creation time
+	domain.CreatedAt = pgTime(time.Now())
+
+	var id int64
+	err := r.pool.QueryRow(ctx, "INSERT INTO domains (host, created_at) VALUES ($1, $2) RETURNING id", domain.Host, domain.CreatedAt).Scan(&id)
+	if err != nil {
+		if isPGUniqueViolation(err) {
+			return nil, ErrDomainTaken
+		}
+		return nil, err
+	}
+	domain.ID = objectIDFromPG(id)
+
+	// Grants are added one at a time afterwards
+	for _, userID := range domain.UserIDs {
+		if _, err := r.GrantDomain(ctx, domain.ID, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	return r.GetDomain(ctx, domain.ID)
+}
+
+// GetDomain retrieves a domain by ID
+func (r *PostgresRepository) GetDomain(ctx context.Context, id primitive.ObjectID) (*models.Domain, error) {
+	pgID, ok := pgIDFromObjectID(id)
+	if !ok {
+		return nil, nil
+	}
+
+	return scanOptionalDomain(r.pool.QueryRow(ctx, domainSelect+" WHERE d.id = $1"+domainGroupBy, pgID))
+}
+
+// GetDomainByHost retrieves a domain by host
+func (r *PostgresRepository) GetDomainByHost(ctx context.Context, host string) (*models.Domain, error) {
+	return scanOptionalDomain(r.pool.QueryRow(ctx, domainSelect+" WHERE d.host = $1"+domainGroupBy, host))
+}
+
+// GetDomains retrieves every registered domain
+func (r *PostgresRepository) GetDomains(ctx context.Context) ([]models.Domain, error) {
+	return r.queryDomains(ctx, domainSelect+domainGroupBy)
+}
+
+// GetDomainsByUser retrieves the domains userID has been granted
+func (r *PostgresRepository) GetDomainsByUser(ctx context.Context, userID primitive.ObjectID) ([]models.Domain, error) {
+	pgUserID, ok := pgIDFromObjectID(userID)
+	if !ok {
+		return make([]models.Domain, 0), nil
+	}
+
+	return r.queryDomains(ctx, domainSelect+" WHERE d.id IN (SELECT domain_id FROM domain_grants WHERE user_id = $1)"+domainGroupBy, pgUserID)
+}
+
+// GrantDomain lets userID create links on a domain
+func (r *PostgresRepository) GrantDomain(ctx context.Context, id, userID primitive.ObjectID) (*models.Domain, error) {
+	pgID, ok := pgIDFromObjectID(id)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	pgUserID, ok := pgIDFromObjectID(userID)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	_, err := r.pool.Exec(ctx, `
+		INSERT INTO domain_grants (domain_id, user_id)
+		SELECT id, $2 FROM domains WHERE id = $1
+		ON CONFLICT DO NOTHING`,
+		pgID, pgUserID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.getGrantedDomain(ctx, id)
+}
+
+// RevokeDomain stops userID creating links on a domain. Links already on the
+// domain are left alone.
+func (r *PostgresRepository) RevokeDomain(ctx context.Context, id, userID primitive.ObjectID) (*models.Domain, error) {
+	pgID, ok := pgIDFromObjectID(id)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	if pgUserID, ok := pgIDFromObjectID(userID); ok {
+		if _, err := r.pool.Exec(ctx, "DELETE FROM domain_grants WHERE domain_id = $1 AND user_id = $2", pgID, pgUserID); err != nil {
+			return nil, err
+		}
+	}
+
+	return r.getGrantedDomain(ctx, id)
+}
+
+// getGrantedDomain returns a domain after its grants changed, or ErrNotFound if it does not exist
+func (r *PostgresRepository) getGrantedDomain(ctx context.Context, id primitive.ObjectID) (*models.Domain, error) {
+	domain, err := r.GetDomain(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if domain == nil {
+		return nil, ErrNotFound
+	}
+	return domain, nil
+}
+
+// queryDomains runs a domainSelect query and collects the rows
+func (r *PostgresRepository) queryDomains(ctx context.Context, query string, args ...interface{}) ([]models.Domain, error) {
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	domains := make([]models.Domain, 0)
+	for rows.Next() {
+		domain, err := scanDomain(rows)
+		if err != nil {
+			return nil, err
+		}
+		domains = append(domains, *domain)
+	}
+
+	return domains, rows.Err()
+}
+
+// scanDomain scans a row selected with domainSelect
+func scanDomain(row pgx.Row) (*models.Domain, error) {
+	var domain models.Domain
+	var id int64
+	var userIDs []int64
+
+	if err := row.Scan(&id, &domain.Host, &domain.CreatedAt, &userIDs); err != nil {
+		return nil, err
+	}
+
+	domain.ID = objectIDFromPG(id)
+	domain.UserIDs = make([]primitive.ObjectID, 0, len(userIDs))
+	for _, userID := range userIDs {
+		domain.UserIDs = append(domain.UserIDs, objectIDFromPG(userID))
+	}
+
+	return &domain, nil
+}
+
+// scanOptionalDomain scans a single domain row, returning nil if there is none
+func scanOptionalDomain(row pgx.Row) (*models.Domain, error) {
+	domain, err := scanDomain(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return domain, err
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"context"
+	"shortlink/internal/models"
+	"time"
+)
+
+// ActivateScheduledShortURLs activates the short URLs whose activation time has passed
+func (r *PostgresRepository) ActivateScheduledShortURLs(ctx context.Context, now time.Time) ([]models.ShortURL, error) {
+	return r.updateShortURLs(ctx, `
+		UPDATE short_urls
+		SET active = true, activate_at = NULL, version = version + 1
+		WHERE activate_at <= $1 AND deleted_at IS NULL
+		RETURNING `+shortURLColumns,
+		pgTime(now),
+	)
+}
+
+// ExpireShortURLs deactivates the active short URLs whose expiry time has passed
+func (r *PostgresRepository) ExpireShortURLs(ctx context.Context, now time.Time) ([]models.ShortURL, error) {
+	return r.updateShortURLs(ctx, `
+		UPDATE short_urls
+		SET active = false, version = version + 1
+		WHERE active AND expires_at <= $1 AND deleted_at IS NULL
+		RETURNING `+shortURLColumns,
+		pgTime(now),
+	)
+}
+
+// PurgeExpiredShortURLs permanently removes the short URLs that expired before
+// expiredBefore, along with their click events and history
+func (r *PostgresRepository) PurgeExpiredShortURLs(ctx context.Context, expiredBefore time.Time) (int, error) {
+	return r.purgeShortURLs(ctx, "expires_at < $1", pgTime(expiredBefore))
+}
+
+// updateShortURLs runs an UPDATE ... RETURNING shortURLColumns and collects the changed rows
+func (r *PostgresRepository) updateShortURLs(ctx context.Context, query string, args ...interface{}) ([]models.ShortURL, error) {
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changed := make([]models.ShortURL, 0)
+	for rows.Next() {
+		shortURL, err := scanShortURL(rows)
+		if err != nil {
+			return nil, err
+		}
+		changed = append(changed, *shortURL)
+	}
+
+	return changed, rows.Err()
+}
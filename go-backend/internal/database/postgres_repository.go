@@ -0,0 +1,503 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"shortlink/internal/models"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// shortURLColumns is the column list scanned by scanShortURL
+const shortURLColumns = "id, user_id, domain, original_url, normalized_url, slug, clicks, active, created_at, expires_at, version, deleted_at, activate_at, schedule, fallback_url, max_clicks, password_hash, redirect_type, query_passthrough, wildcard"
+
+// clickEventColumns is the column list scanned by scanClickEvent
+const clickEventColumns = "id, short_url_id, short_url_version, destination, ip_address, user_agent, referrer, timestamp, device"
+
+// PostgresRepository is the PostgreSQL implementation of Store.
+// It uses the table layout declared in shared/schema.ts.
+type PostgresRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresRepository creates a repository backed by the given connection pool
+func NewPostgresRepository(pool *pgxpool.Pool) *PostgresRepository {
+	return &PostgresRepository{
+		pool: pool,
+	}
+}
+
+// GetShortURL retrieves a short URL by ID
+func (r *PostgresRepository) GetShortURL(ctx context.Context, id primitive.ObjectID) (*models.ShortURL, error) {
+	pgID, ok := pgIDFromObjectID(id)
+	if !ok {
+		return nil, nil
+	}
+
+	row := r.pool.QueryRow(ctx, "SELECT "+shortURLColumns+" FROM short_urls WHERE id = $1", pgID)
+	return scanOptionalShortURL(row)
+}
+
+// GetShortURLBySlug retrieves a short URL by its domain and slug
+func (r *PostgresRepository) GetShortURLBySlug(ctx context.Context, domain, slug string) (*models.ShortURL, error) {
+	row := r.pool.QueryRow(ctx, "SELECT "+shortURLColumns+" FROM short_urls WHERE domain = $1 AND slug = $2", domain, slug)
+	return scanOptionalShortURL(row)
+}
+
+// GetAllShortURLs retrieves all short URLs for a specific user, leaving out the trash
+func (r *PostgresRepository) GetAllShortURLs(ctx context.Context, userID primitive.ObjectID) ([]models.ShortURL, error) {
+	shortURLs := make([]models.ShortURL, 0)
+
+	pgUserID, ok := pgIDFromObjectID(userID)
+	if !ok {
+		return shortURLs, nil
+	}
+
+	rows, err := r.pool.Query(ctx, "SELECT "+shortURLColumns+" FROM short_urls WHERE user_id = $1 AND deleted_at IS NULL ORDER BY created_at DESC", pgUserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		shortURL, err := scanShortURL(rows)
+		if err != nil {
+			return nil, err
+		}
+		shortURLs = append(shortURLs, *shortURL)
+	}
+
+	return shortURLs, rows.Err()
+}
+
+// GetActiveShortURLByNormalizedURL retrieves the newest active, unexpired short URL
+// owned by userID on domain that points at normalizedURL
+func (r *PostgresRepository) GetActiveShortURLByNormalizedURL(ctx context.Context, userID primitive.ObjectID, domain, normalizedURL string) (*models.ShortURL, error) {
+	pgUserID, ok := pgIDFromObjectID(userID)
+	if !ok {
+		return nil, nil
+	}
+
+	row := r.pool.QueryRow(ctx, `
+		SELECT `+shortURLColumns+`
+		FROM short_urls
+		WHERE user_id = $1 AND normalized_url = $2 AND domain = $3 AND deleted_at IS NULL
+		  AND active AND (expires_at IS NULL OR expires_at > $4)
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1`,
+		pgUserID, normalizedURL, domain, pgTime(time.Now()),
+	)
+	return scanOptionalShortURL(row)
+}
+
+// CreateShortURL creates a new short URL
+func (r *PostgresRepository) CreateShortURL(ctx context.Context, shortURL models.ShortURL) (*models.ShortURL, error) {
+	userRef, err := pgUserRef(shortURL.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set defaults
+	shortURL.CreatedAt = pgTime(time.Now())
+	shortURL.Clicks = 0
+	shortURL.Version = 1
+	shortURL.Active = shortURL.ActivateAt == nil
+	shortURL.ExpiresAt = pgNullableTime(shortURL.ExpiresAt)
+	shortURL.ActivateAt = pgNullableTime(shortURL.ActivateAt)
+
+	var id int64
+	err = r.pool.QueryRow(ctx, `
+		INSERT INTO short_urls (user_id, original_url, normalized_url, slug, clicks, active, created_at, expires_at, version, activate_at, schedule, fallback_url, max_clicks, password_hash, domain, redirect_type, query_passthrough, wildcard)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8, $9, $10, $11, NULLIF($12, ''), $13, NULLIF($14, ''), $15, NULLIF($16, ''), NULLIF($17, ''), $18)
+		RETURNING id`,
+		userRef, shortURL.OriginalURL, shortURL.NormalizedURL, shortURL.Slug, shortURL.Clicks, shortURL.Active, shortURL.CreatedAt, shortURL.ExpiresAt, shortURL.Version, shortURL.ActivateAt,
+		shortURL.Schedule, shortURL.FallbackURL, shortURL.MaxClicks, shortURL.PasswordHash, shortURL.Domain, shortURL.RedirectType, shortURL.QueryPassthrough, shortURL.Wildcard,
+	).Scan(&id)
+	if err != nil {
+		if isPGUniqueViolation(err) {
+			return nil, ErrSlugTaken
+		}
+		return nil, err
+	}
+
+	// Set ID from inserted row
+	shortURL.ID = objectIDFromPG(id)
+
+	return &shortURL, nil
+}
+
+// UpdateShortURL replaces the editable fields of a short URL owned by shortURL.UserID
+func (r *PostgresRepository) UpdateShortURL(ctx context.Context, shortURL models.ShortURL, version int) (*models.ShortURL, error) {
+	pgID, ok := pgIDFromObjectID(shortURL.ID)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	pgUserID, ok := pgIDFromObjectID(shortURL.UserID)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	row := r.pool.QueryRow(ctx, `
+		UPDATE short_urls
+		SET original_url = $4, normalized_url = NULLIF($5, ''), slug = $6, active = $7, expires_at = $8, activate_at = $9,
+			schedule = $10, fallback_url = NULLIF($11, ''), max_clicks = $12,
+			password_hash = NULLIF($13, ''), redirect_type = NULLIF($14, ''),
+			query_passthrough = NULLIF($15, ''), wildcard = $16, version = version + 1
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL AND version = $3
+		RETURNING `+shortURLColumns,
+		pgID, pgUserID, version,
+		shortURL.OriginalURL, shortURL.NormalizedURL, shortURL.Slug, shortURL.Active, pgNullableTime(shortURL.ExpiresAt), pgNullableTime(shortURL.ActivateAt),
+		shortURL.Schedule, shortURL.FallbackURL, shortURL.MaxClicks, shortURL.PasswordHash, shortURL.RedirectType,
+		shortURL.QueryPassthrough, shortURL.Wildcard,
+	)
+	updated, err := scanOptionalShortURL(row)
+	if err != nil {
+		if isPGUniqueViolation(err) {
+			return nil, ErrSlugTaken
+		}
+		return nil, err
+	}
+	if updated != nil {
+		return updated, nil
+	}
+
+	// Work out whether the link is missing or was changed by someone else
+	var exists bool
+	err = r.pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM short_urls WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)", pgID, pgUserID).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return nil, ErrVersionConflict
+}
+
+// UpdateShortURLClicks increments the click count for a short URL
+func (r *PostgresRepository) UpdateShortURLClicks(ctx context.Context, id primitive.ObjectID) (*models.ShortURL, error) {
+	pgID, ok := pgIDFromObjectID(id)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	// The limit is checked in the same statement, so concurrent clicks can't push
+	// the count past it, and the last click deactivates the link
+	row := r.pool.QueryRow(ctx, `
+		UPDATE short_urls
+		SET clicks = clicks + 1,
+			active = CASE WHEN clicks + 1 = max_clicks THEN false ELSE active END,
+			activate_at = CASE WHEN clicks + 1 = max_clicks THEN NULL ELSE activate_at END,
+			version = CASE WHEN clicks + 1 = max_clicks THEN version + 1 ELSE version END
+		WHERE id = $1 AND (max_clicks = 0 OR clicks < max_clicks)
+		RETURNING `+shortURLColumns, pgID)
+	shortURL, err := scanOptionalShortURL(row)
+	if err != nil {
+		return nil, err
+	}
+	if shortURL == nil {
+		// Tell a missing link from one at its limit
+		var exists bool
+		if err := r.pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM short_urls WHERE id = $1)", pgID).Scan(&exists); err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, ErrClickLimitReached
+		}
+		return nil, ErrNotFound
+	}
+
+	return shortURL, nil
+}
+
+// DeleteShortURL moves a short URL to the trash if it belongs to the given user.
+// The row stays, so the unique constraint keeps its slug reserved.
+func (r *PostgresRepository) DeleteShortURL(ctx context.Context, id primitive.ObjectID, userID primitive.ObjectID) error {
+	pgID, ok := pgIDFromObjectID(id)
+	if !ok {
+		return ErrNotFound
+	}
+	pgUserID, ok := pgIDFromObjectID(userID)
+	if !ok {
+		return ErrNotFound
+	}
+
+	tag, err := r.pool.Exec(ctx, "UPDATE short_urls SET deleted_at = $3 WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL", pgID, pgUserID, pgTime(time.Now()))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetDeletedShortURLs retrieves the short URLs in a user's trash, most recently deleted first
+func (r *PostgresRepository) GetDeletedShortURLs(ctx context.Context, userID primitive.ObjectID) ([]models.ShortURL, error) {
+	shortURLs := make([]models.ShortURL, 0)
+
+	pgUserID, ok := pgIDFromObjectID(userID)
+	if !ok {
+		return shortURLs, nil
+	}
+
+	rows, err := r.pool.Query(ctx, "SELECT "+shortURLColumns+" FROM short_urls WHERE user_id = $1 AND deleted_at IS NOT NULL ORDER BY deleted_at DESC, id DESC", pgUserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		shortURL, err := scanShortURL(rows)
+		if err != nil {
+			return nil, err
+		}
+		shortURLs = append(shortURLs, *shortURL)
+	}
+
+	return shortURLs, rows.Err()
+}
+
+// RestoreShortURL takes a short URL owned by userID back out of the trash
+func (r *PostgresRepository) RestoreShortURL(ctx context.Context, id primitive.ObjectID, userID primitive.ObjectID) (*models.ShortURL, error) {
+	pgID, ok := pgIDFromObjectID(id)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	pgUserID, ok := pgIDFromObjectID(userID)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	row := r.pool.QueryRow(ctx, "UPDATE short_urls SET deleted_at = NULL WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL RETURNING "+shortURLColumns, pgID, pgUserID)
+	shortURL, err := scanOptionalShortURL(row)
+	if err != nil {
+		return nil, err
+	}
+	if shortURL == nil {
+		return nil, ErrNotFound
+	}
+
+	return shortURL, nil
+}
+
+// PurgeDeletedShortURLs permanently removes the short URLs that were moved to
+// the trash before deletedBefore, along with their click events and history.
+// Revisions go with their link through ON DELETE CASCADE.
+func (r *PostgresRepository) PurgeDeletedShortURLs(ctx context.Context, deletedBefore time.Time) (int, error) {
+	return r.purgeShortURLs(ctx, "deleted_at < $1", pgTime(deletedBefore))
+}
+
+// purgeShortURLs removes the short URLs matching the SQL condition where, with
+// their click events and history, and reports how many there were
+func (r *PostgresRepository) purgeShortURLs(ctx context.Context, where string, args ...interface{}) (int, error) {
+	var purged int
+	err := r.pool.QueryRow(ctx, `
+		WITH purged AS (
+			DELETE FROM short_urls WHERE `+where+` RETURNING id
+		), purged_clicks AS (
+			DELETE FROM click_events WHERE short_url_id IN (SELECT id FROM purged)
+		)
+		SELECT count(*) FROM purged`,
+		args...,
+	).Scan(&purged)
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
+
+// CreateClickEvent creates a new click event
+func (r *PostgresRepository) CreateClickEvent(ctx context.Context, clickEvent models.ClickEvent) (*models.ClickEvent, error) {
+	shortURLID, ok := pgIDFromObjectID(clickEvent.ShortURLID)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	// Set creation time
+	clickEvent.CreatedAt = pgTime(time.Now())
+
+	var id int64
+	err := r.pool.QueryRow(ctx, `
+		INSERT INTO click_events (short_url_id, short_url_version, destination, ip_address, user_agent, referrer, timestamp, device)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id`,
+		shortURLID, clickEvent.ShortURLVersion, clickEvent.Destination, clickEvent.IPAddress, clickEvent.UserAgent, clickEvent.Referer, clickEvent.CreatedAt, clickEvent.Device,
+	).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set ID from inserted row
+	clickEvent.ID = objectIDFromPG(id)
+
+	return &clickEvent, nil
+}
+
+// GetClickEventsByShortURLID retrieves click events for a specific short URL
+func (r *PostgresRepository) GetClickEventsByShortURLID(ctx context.Context, shortURLID primitive.ObjectID) ([]models.ClickEvent, error) {
+	clickEvents := make([]models.ClickEvent, 0)
+
+	pgShortURLID, ok := pgIDFromObjectID(shortURLID)
+	if !ok {
+		return clickEvents, nil
+	}
+
+	rows, err := r.pool.Query(ctx, "SELECT "+clickEventColumns+" FROM click_events WHERE short_url_id = $1 ORDER BY timestamp DESC, id DESC", pgShortURLID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		clickEvent, err := scanClickEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		clickEvents = append(clickEvents, *clickEvent)
+	}
+
+	return clickEvents, rows.Err()
+}
+
+// GetClickStats retrieves aggregated analytics data for the links owned by userID.
+// Passing primitive.NilObjectID aggregates over every user's links.
+func (r *PostgresRepository) GetClickStats(ctx context.Context, userID primitive.ObjectID) (*models.StatsResponse, error) {
+	stats := &models.StatsResponse{
+		ReferrerStats: make(map[string]int),
+	}
+
+	// A NULL owner filter selects every link
+	var owner *int64
+	if !userID.IsZero() {
+		pgUserID, ok := pgIDFromObjectID(userID)
+		if !ok {
+			return stats, nil
+		}
+		owner = &pgUserID
+	}
+
+	// Get total and active links count
+	err := r.pool.QueryRow(ctx, `
+		SELECT count(*),
+		       count(*) FILTER (WHERE active AND (expires_at IS NULL OR expires_at > $2))
+		FROM short_urls
+		WHERE ($1::integer IS NULL OR user_id = $1) AND deleted_at IS NULL`,
+		owner, pgTime(time.Now()),
+	).Scan(&stats.TotalLinks, &stats.ActiveLinks)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get total clicks and per-device and per-referrer counts in one pass
+	rows, err := r.pool.Query(ctx, `
+		SELECT COALESCE(ce.device, ''), COALESCE(ce.referrer, ''), count(*)
+		FROM click_events ce
+		WHERE $1::integer IS NULL
+		   OR ce.short_url_id IN (SELECT id FROM short_urls WHERE user_id = $1)
+		GROUP BY 1, 2`,
+		owner,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var device, referer string
+		var count int
+		if err := rows.Scan(&device, &referer, &count); err != nil {
+			return nil, err
+		}
+
+		stats.TotalClicks += count
+
+		switch device {
+		case "mobile":
+			stats.DeviceStats.Mobile += count
+		case "desktop":
+			stats.DeviceStats.Desktop += count
+		case "tablet":
+			stats.DeviceStats.Tablet += count
+		}
+
+		if referer == "" {
+			referer = "direct"
+		}
+		stats.ReferrerStats[referer] += count
+	}
+
+	return stats, rows.Err()
+}
+
+// scanShortURL scans a row selected with shortURLColumns
+func scanShortURL(row pgx.Row) (*models.ShortURL, error) {
+	var shortURL models.ShortURL
+	var id int64
+	var userID *int64
+	var normalizedURL, fallbackURL, passwordHash, redirectType, queryPassthrough *string
+
+	err := row.Scan(&id, &userID, &shortURL.Domain, &shortURL.OriginalURL, &normalizedURL, &shortURL.Slug, &shortURL.Clicks, &shortURL.Active, &shortURL.CreatedAt, &shortURL.ExpiresAt, &shortURL.Version, &shortURL.DeletedAt, &shortURL.ActivateAt,
+		&shortURL.Schedule, &fallbackURL, &shortURL.MaxClicks, &passwordHash, &redirectType,
+		&queryPassthrough, &shortURL.Wildcard)
+	if err != nil {
+		return nil, err
+	}
+
+	shortURL.ID = objectIDFromPG(id)
+	shortURL.UserID = pgNullableID(userID)
+	shortURL.NormalizedURL = pgString(normalizedURL)
+	shortURL.FallbackURL = pgString(fallbackURL)
+	shortURL.PasswordHash = pgString(passwordHash)
+	shortURL.RedirectType = pgString(redirectType)
+	shortURL.QueryPassthrough = pgString(queryPassthrough)
+
+	return &shortURL, nil
+}
+
+// scanOptionalShortURL scans a single short URL row, returning nil if there is none
+func scanOptionalShortURL(row pgx.Row) (*models.ShortURL, error) {
+	shortURL, err := scanShortURL(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return shortURL, err
+}
+
+// scanClickEvent scans a row selected with clickEventColumns
+func scanClickEvent(row pgx.Row) (*models.ClickEvent, error) {
+	var clickEvent models.ClickEvent
+	var id, shortURLID int64
+	var shortURLVersion *int
+	var destination, ipAddress, userAgent, referer, device *string
+
+	err := row.Scan(&id, &shortURLID, &shortURLVersion, &destination, &ipAddress, &userAgent, &referer, &clickEvent.CreatedAt, &device)
+	if err != nil {
+		return nil, err
+	}
+
+	clickEvent.ID = objectIDFromPG(id)
+	clickEvent.ShortURLID = objectIDFromPG(shortURLID)
+	if shortURLVersion != nil {
+		clickEvent.ShortURLVersion = *shortURLVersion
+	}
+	clickEvent.Destination = pgString(destination)
+	clickEvent.IPAddress = pgString(ipAddress)
+	clickEvent.UserAgent = pgString(userAgent)
+	clickEvent.Referer = pgString(referer)
+	clickEvent.Device = pgString(device)
+
+	return &clickEvent, nil
+}
+
+// pgString returns the value of a nullable text column, or "" for NULL
+func pgString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
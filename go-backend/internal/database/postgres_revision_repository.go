@@ -0,0 +1,131 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"shortlink/internal/models"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// revisionColumns is the column list scanned by scanRevision
+const revisionColumns = "id, short_url_id, version, action, changes, rolled_back_to, changed_by, original_url, normalized_url, slug, active, expires_at, created_at, activate_at, schedule, fallback_url, max_clicks, password_hash, redirect_type, query_passthrough, wildcard"
+
+// CreateShortURLRevision appends a revision to a short URL's history
+func (r *PostgresRepository) CreateShortURLRevision(ctx context.Context, revision models.ShortURLRevision) (*models.ShortURLRevision, error) {
+	shortURLID, ok := pgIDFromObjectID(revision.ShortURLID)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	changedBy, err := pgUserRef(revision.ChangedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set creation time
+	revision.CreatedAt = pgTime(time.Now())
+	revision.ExpiresAt = pgNullableTime(revision.ExpiresAt)
+	revision.ActivateAt = pgNullableTime(revision.ActivateAt)
+	if revision.Changes == nil {
+		revision.Changes = []string{}
+	}
+	var rolledBackTo *int
+	if revision.RolledBackTo != 0 {
+		rolledBackTo = &revision.RolledBackTo
+	}
+
+	var id int64
+	err = r.pool.QueryRow(ctx, `
+		INSERT INTO short_url_revisions (short_url_id, version, action, changes, rolled_back_to, changed_by, original_url, normalized_url, slug, active, expires_at, created_at,
+			activate_at, schedule, fallback_url, max_clicks, password_hash, redirect_type, query_passthrough, wildcard)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), $9, $10, $11, $12, $13, $14, NULLIF($15, ''), $16, NULLIF($17, ''), NULLIF($18, ''), NULLIF($19, ''), $20)
+		RETURNING id`,
+		shortURLID, revision.Version, revision.Action, revision.Changes, rolledBackTo, changedBy,
+		revision.OriginalURL, revision.NormalizedURL, revision.Slug, revision.Active, revision.ExpiresAt, revision.CreatedAt,
+		revision.ActivateAt, revision.Schedule, revision.FallbackURL, revision.MaxClicks, revision.PasswordHash, revision.RedirectType, revision.QueryPassthrough, revision.Wildcard,
+	).Scan(&id)
+	if err != nil {
+		if isPGUniqueViolation(err) {
+			return nil, ErrVersionConflict
+		}
+		return nil, err
+	}
+
+	// Set ID from inserted row
+	revision.ID = objectIDFromPG(id)
+
+	return &revision, nil
+}
+
+// GetShortURLRevisions retrieves a short URL's history, newest first
+func (r *PostgresRepository) GetShortURLRevisions(ctx context.Context, shortURLID primitive.ObjectID) ([]models.ShortURLRevision, error) {
+	revisions := make([]models.ShortURLRevision, 0)
+
+	pgShortURLID, ok := pgIDFromObjectID(shortURLID)
+	if !ok {
+		return revisions, nil
+	}
+
+	rows, err := r.pool.Query(ctx, "SELECT "+revisionColumns+" FROM short_url_revisions WHERE short_url_id = $1 ORDER BY version DESC", pgShortURLID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, *revision)
+	}
+
+	return revisions, rows.Err()
+}
+
+// GetShortURLRevision retrieves one version of a short URL
+func (r *PostgresRepository) GetShortURLRevision(ctx context.Context, shortURLID primitive.ObjectID, version int) (*models.ShortURLRevision, error) {
+	pgShortURLID, ok := pgIDFromObjectID(shortURLID)
+	if !ok {
+		return nil, nil
+	}
+
+	row := r.pool.QueryRow(ctx, "SELECT "+revisionColumns+" FROM short_url_revisions WHERE short_url_id = $1 AND version = $2", pgShortURLID, version)
+	revision, err := scanRevision(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return revision, err
+}
+
+// scanRevision scans a row selected with revisionColumns
+func scanRevision(row pgx.Row) (*models.ShortURLRevision, error) {
+	var revision models.ShortURLRevision
+	var id, shortURLID int64
+	var changedBy *int64
+	var rolledBackTo *int
+	var normalizedURL, fallbackURL, passwordHash, redirectType, queryPassthrough *string
+
+	err := row.Scan(&id, &shortURLID, &revision.Version, &revision.Action, &revision.Changes, &rolledBackTo, &changedBy,
+		&revision.OriginalURL, &normalizedURL, &revision.Slug, &revision.Active, &revision.ExpiresAt, &revision.CreatedAt,
+		&revision.ActivateAt, &revision.Schedule, &fallbackURL, &revision.MaxClicks, &passwordHash, &redirectType, &queryPassthrough, &revision.Wildcard)
+	if err != nil {
+		return nil, err
+	}
+
+	revision.ID = objectIDFromPG(id)
+	revision.ShortURLID = objectIDFromPG(shortURLID)
+	revision.ChangedBy = pgNullableID(changedBy)
+	revision.NormalizedURL = pgString(normalizedURL)
+	revision.FallbackURL = pgString(fallbackURL)
+	revision.PasswordHash = pgString(passwordHash)
+	revision.RedirectType = pgString(redirectType)
+	revision.QueryPassthrough = pgString(queryPassthrough)
+	if rolledBackTo != nil {
+		revision.RolledBackTo = *rolledBackTo
+	}
+
+	return &revision, nil
+}
@@ -0,0 +1,15 @@
+package database
+
+import "context"
+
+// NextSequence increments and returns the named counter, creating it on first use
+func (r *PostgresRepository) NextSequence(ctx context.Context, name string) (int64, error) {
+	var value int64
+	err := r.pool.QueryRow(ctx, `
+		INSERT INTO sequences (name, value) VALUES ($1, 1)
+		ON CONFLICT (name) DO UPDATE SET value = sequences.value + 1
+		RETURNING value`,
+		name,
+	).Scan(&value)
+	return value, err
+}
@@ -0,0 +1,153 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"shortlink/internal/models"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// userColumns is the column list scanned by scanUser
+const userColumns = "id, username, password, role, created_at"
+
+// CreateUser creates a new user account
+func (r *PostgresRepository) CreateUser(ctx context.Context, user models.User) (*models.User, error) {
+	// Set creation time
+	user.CreatedAt = pgTime(time.Now())
+
+	var id int64
+	err := r.pool.QueryRow(ctx, `
+		INSERT INTO users (username, password, role, created_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`,
+		user.Username, user.PasswordHash, user.Role, user.CreatedAt,
+	).Scan(&id)
+	if err != nil {
+		if isPGUniqueViolation(err) {
+			return nil, ErrUsernameTaken
+		}
+		return nil, err
+	}
+
+	// Set ID from inserted row
+	user.ID = objectIDFromPG(id)
+
+	return &user, nil
+}
+
+// GetUserByID retrieves a user by ID
+func (r *PostgresRepository) GetUserByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	pgID, ok := pgIDFromObjectID(id)
+	if !ok {
+		return nil, nil
+	}
+
+	return scanOptionalUser(r.pool.QueryRow(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1", pgID))
+}
+
+// GetUserByUsername retrieves a user by username
+func (r *PostgresRepository) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	return scanOptionalUser(r.pool.QueryRow(ctx, "SELECT "+userColumns+" FROM users WHERE username = $1", username))
+}
+
+// SetUserRole changes the role of the user with username
+func (r *PostgresRepository) SetUserRole(ctx context.Context, username, role string) (*models.User, error) {
+	user, err := scanOptionalUser(r.pool.QueryRow(ctx, "UPDATE users SET role = $2 WHERE username = $1 RETURNING "+userColumns, username, role))
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrNotFound
+	}
+
+	return user, nil
+}
+
+// CreateSession stores a new login session
+func (r *PostgresRepository) CreateSession(ctx context.Context, session models.Session) (*models.Session, error) {
+	userID, ok := pgIDFromObjectID(session.UserID)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	// Set creation time
+	session.CreatedAt = pgTime(time.Now())
+	session.ExpiresAt = pgTime(session.ExpiresAt)
+
+	var id int64
+	err := r.pool.QueryRow(ctx, `
+		INSERT INTO sessions (user_id, token_hash, created_at, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`,
+		userID, session.TokenHash, session.CreatedAt, session.ExpiresAt,
+	).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set ID from inserted row
+	session.ID = objectIDFromPG(id)
+
+	return &session, nil
+}
+
+// GetSessionByTokenHash retrieves an unexpired session by the hash of its token
+func (r *PostgresRepository) GetSessionByTokenHash(ctx context.Context, tokenHash string) (*models.Session, error) {
+	var session models.Session
+	var id, userID int64
+
+	err := r.pool.QueryRow(ctx, `
+		SELECT id, user_id, token_hash, created_at, expires_at
+		FROM sessions
+		WHERE token_hash = $1 AND expires_at > $2`,
+		tokenHash, pgTime(time.Now()),
+	).Scan(&id, &userID, &session.TokenHash, &session.CreatedAt, &session.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	session.ID = objectIDFromPG(id)
+	session.UserID = objectIDFromPG(userID)
+
+	return &session, nil
+}
+
+// DeleteSession removes the session identified by the hash of its token
+func (r *PostgresRepository) DeleteSession(ctx context.Context, tokenHash string) error {
+	_, err := r.pool.Exec(ctx, "DELETE FROM sessions WHERE token_hash = $1", tokenHash)
+	return err
+}
+
+// DeleteExpiredSessions removes the sessions that expired by now
+func (r *PostgresRepository) DeleteExpiredSessions(ctx context.Context, now time.Time) (int, error) {
+	tag, err := r.pool.Exec(ctx, "DELETE FROM sessions WHERE expires_at <= $1", pgTime(now))
+	if err != nil {
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+// scanOptionalUser scans a row selected with userColumns, returning nil if there is none
+func scanOptionalUser(row pgx.Row) (*models.User, error) {
+	var user models.User
+	var id int64
+
+	err := row.Scan(&id, &user.Username, &user.PasswordHash, &user.Role, &user.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	user.ID = objectIDFromPG(id)
+
+	return &user, nil
+}
@@ -1,350 +1,126 @@
 package database
 
 import (
-        "context"
-        "errors"
-        "log"
-        "shortlink/internal/models"
-        "time"
+	"context"
+	"shortlink/internal/models"
+	"time"
 
-        "go.mongodb.org/mongo-driver/bson"
-        "go.mongodb.org/mongo-driver/bson/primitive"
-        "go.mongodb.org/mongo-driver/mongo"
-        "go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// Repository handles database operations
-type Repository struct {
-        db            *DBClient
-        memoryRepo    *MemoryRepository
-        useMemoryRepo bool
+// URLStore persists short URLs and their click events.
+//
+// Lookups that find nothing return a nil record and a nil error. Mutations of
+// a record that does not exist, or is not owned by the given user, return ErrNotFound.
+//
+// Slugs are unique per domain: each branded domain has its own namespace, and
+// links with an empty Domain share the default one. A link's domain is fixed
+// when it is created. CreateShortURL and UpdateShortURL return ErrSlugTaken if
+// the slug is already in use on the link's domain.
+//
+// Short URLs carry a version that starts at 1 and is incremented by every
+// UpdateShortURL. UpdateShortURL only applies if the stored version still
+// equals the given one, and returns ErrVersionConflict otherwise.
+//
+// UpdateShortURLClicks counts a click atomically. A link with MaxClicks set
+// stops counting at that limit; further calls return ErrClickLimitReached.
+// The call that takes the last click also deactivates the link, clears its
+// ActivateAt and increments its version.
+//
+// Revisions are append-only: CreateShortURLRevision returns ErrVersionConflict
+// if the link already has a revision with that version. GetShortURLRevisions
+// lists the newest first.
+//
+// DeleteShortURL moves a link to the trash by setting DeletedAt. Trashed links
+// keep their slug, and are still returned by GetShortURL and GetShortURLBySlug,
+// but are left out of GetAllShortURLs, GetActiveShortURLByNormalizedURL and the
+// link counts of GetClickStats; UpdateShortURL treats them as missing.
+// PurgeDeletedShortURLs removes them for good, with their click events and revisions.
+//
+// The lifecycle methods apply scheduled state changes in bulk. CreateShortURL
+// stores links with an ActivateAt inactive. ActivateScheduledShortURLs activates
+// links whose ActivateAt has passed and clears it; ExpireShortURLs deactivates
+// active links whose ExpiresAt has passed. Both increment the version of each
+// link they change and return the changed links. PurgeExpiredShortURLs removes
+// links that expired before the given time, like PurgeDeletedShortURLs.
+type URLStore interface {
+	GetShortURL(ctx context.Context, id primitive.ObjectID) (*models.ShortURL, error)
+	GetShortURLBySlug(ctx context.Context, domain, slug string) (*models.ShortURL, error)
+	GetAllShortURLs(ctx context.Context, userID primitive.ObjectID) ([]models.ShortURL, error)
+	GetActiveShortURLByNormalizedURL(ctx context.Context, userID primitive.ObjectID, domain, normalizedURL string) (*models.ShortURL, error)
+	CreateShortURL(ctx context.Context, shortURL models.ShortURL) (*models.ShortURL, error)
+	UpdateShortURL(ctx context.Context, shortURL models.ShortURL, version int) (*models.ShortURL, error)
+	UpdateShortURLClicks(ctx context.Context, id primitive.ObjectID) (*models.ShortURL, error)
+	DeleteShortURL(ctx context.Context, id primitive.ObjectID, userID primitive.ObjectID) error
+	GetDeletedShortURLs(ctx context.Context, userID primitive.ObjectID) ([]models.ShortURL, error)
+	RestoreShortURL(ctx context.Context, id primitive.ObjectID, userID primitive.ObjectID) (*models.ShortURL, error)
+	PurgeDeletedShortURLs(ctx context.Context, deletedBefore time.Time) (int, error)
+	ActivateScheduledShortURLs(ctx context.Context, now time.Time) ([]models.ShortURL, error)
+	ExpireShortURLs(ctx context.Context, now time.Time) ([]models.ShortURL, error)
+	PurgeExpiredShortURLs(ctx context.Context, expiredBefore time.Time) (int, error)
+	CreateClickEvent(ctx context.Context, clickEvent models.ClickEvent) (*models.ClickEvent, error)
+	GetClickEventsByShortURLID(ctx context.Context, shortURLID primitive.ObjectID) ([]models.ClickEvent, error)
+	GetClickStats(ctx context.Context, userID primitive.ObjectID) (*models.StatsResponse, error)
+	CreateShortURLRevision(ctx context.Context, revision models.ShortURLRevision) (*models.ShortURLRevision, error)
+	GetShortURLRevisions(ctx context.Context, shortURLID primitive.ObjectID) ([]models.ShortURLRevision, error)
+	GetShortURLRevision(ctx context.Context, shortURLID primitive.ObjectID, version int) (*models.ShortURLRevision, error)
 }
 
-// NewRepository creates a new repository instance
-func NewRepository(db *DBClient) *Repository {
-        // Check if we can ping MongoDB
-        ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-        defer cancel()
-        
-        useMemoryRepo := false
-        err := db.client.Ping(ctx, nil)
-        if err != nil {
-                log.Printf("Unable to ping MongoDB: %v", err)
-                log.Println("Using in-memory repository for development")
-                useMemoryRepo = true
-        }
-        
-        return &Repository{
-                db:            db,
-                memoryRepo:    NewMemoryRepository(),
-                useMemoryRepo: useMemoryRepo,
-        }
+// UserStore persists user accounts and their login sessions
+type UserStore interface {
+	CreateUser(ctx context.Context, user models.User) (*models.User, error)
+	GetUserByID(ctx context.Context, id primitive.ObjectID) (*models.User, error)
+	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
+	SetUserRole(ctx context.Context, username, role string) (*models.User, error)
+	CreateSession(ctx context.Context, session models.Session) (*models.Session, error)
+	GetSessionByTokenHash(ctx context.Context, tokenHash string) (*models.Session, error)
+	DeleteSession(ctx context.Context, tokenHash string) error
+	DeleteExpiredSessions(ctx context.Context, now time.Time) (int, error)
 }
 
-// GetShortURL retrieves a short URL by ID
-func (r *Repository) GetShortURL(ctx context.Context, id primitive.ObjectID) (*models.ShortURL, error) {
-        if r.useMemoryRepo {
-                return r.memoryRepo.GetShortURL(ctx, id)
-        }
-        
-        collection := r.db.GetCollection(ShortURLCollection)
-        
-        var shortURL models.ShortURL
-        err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&shortURL)
-        if err != nil {
-                if errors.Is(err, mongo.ErrNoDocuments) {
-                        return nil, nil
-                }
-                return nil, err
-        }
-        
-        return &shortURL, nil
+// APIKeyStore persists API keys
+type APIKeyStore interface {
+	CreateAPIKey(ctx context.Context, apiKey models.APIKey) (*models.APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error)
+	GetAPIKeysByUser(ctx context.Context, userID primitive.ObjectID) ([]models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id, userID primitive.ObjectID) error
+	TouchAPIKey(ctx context.Context, id primitive.ObjectID) error
 }
 
-// GetShortURLBySlug retrieves a short URL by slug
-func (r *Repository) GetShortURLBySlug(ctx context.Context, slug string) (*models.ShortURL, error) {
-        if r.useMemoryRepo {
-                return r.memoryRepo.GetShortURLBySlug(ctx, slug)
-        }
-        
-        collection := r.db.GetCollection(ShortURLCollection)
-        
-        var shortURL models.ShortURL
-        err := collection.FindOne(ctx, bson.M{"slug": slug}).Decode(&shortURL)
-        if err != nil {
-                if errors.Is(err, mongo.ErrNoDocuments) {
-                        return nil, nil
-                }
-                return nil, err
-        }
-        
-        return &shortURL, nil
+// DomainStore persists branded domains and the users granted them.
+// CreateDomain returns ErrDomainTaken if the host is already registered.
+// GrantDomain and RevokeDomain return the updated domain, do nothing if the
+// user already has or lacks the grant, and return ErrNotFound if the domain
+// does not exist. GetDomains and GetDomainsByUser list domains by host.
+type DomainStore interface {
+	CreateDomain(ctx context.Context, domain models.Domain) (*models.Domain, error)
+	GetDomain(ctx context.Context, id primitive.ObjectID) (*models.Domain, error)
+	GetDomainByHost(ctx context.Context, host string) (*models.Domain, error)
+	GetDomains(ctx context.Context) ([]models.Domain, error)
+	GetDomainsByUser(ctx context.Context, userID primitive.ObjectID) ([]models.Domain, error)
+	GrantDomain(ctx context.Context, id, userID primitive.ObjectID) (*models.Domain, error)
+	RevokeDomain(ctx context.Context, id, userID primitive.ObjectID) (*models.Domain, error)
 }
 
-// GetAllShortURLs retrieves all short URLs for a specific user
-func (r *Repository) GetAllShortURLs(ctx context.Context, userID primitive.ObjectID) ([]models.ShortURL, error) {
-        if r.useMemoryRepo {
-                return r.memoryRepo.GetAllShortURLs(ctx, userID)
-        }
-        
-        collection := r.db.GetCollection(ShortURLCollection)
-        
-        // Find all documents for this user
-        findOptions := options.Find()
-        findOptions.SetSort(bson.D{{"createdAt", -1}}) // Sort by creation date, newest first
-        
-        cursor, err := collection.Find(ctx, bson.M{"userId": userID}, findOptions)
-        if err != nil {
-                return nil, err
-        }
-        defer cursor.Close(ctx)
-        
-        // Decode the documents
-        var shortURLs []models.ShortURL
-        if err := cursor.All(ctx, &shortURLs); err != nil {
-                return nil, err
-        }
-        
-        return shortURLs, nil
+// SequenceStore hands out monotonically increasing numbers from named counters.
+// The first value returned for a name is 1.
+type SequenceStore interface {
+	NextSequence(ctx context.Context, name string) (int64, error)
 }
 
-// CreateShortURL creates a new short URL
-func (r *Repository) CreateShortURL(ctx context.Context, shortURL models.ShortURL) (*models.ShortURL, error) {
-        if r.useMemoryRepo {
-                return r.memoryRepo.CreateShortURL(ctx, shortURL)
-        }
-        
-        collection := r.db.GetCollection(ShortURLCollection)
-        
-        // Set creation time
-        shortURL.CreatedAt = time.Now()
-        shortURL.Clicks = 0
-        shortURL.Active = true
-        
-        // Insert document
-        result, err := collection.InsertOne(ctx, shortURL)
-        if err != nil {
-                return nil, err
-        }
-        
-        // Set ID from inserted document
-        shortURL.ID = result.InsertedID.(primitive.ObjectID)
-        
-        return &shortURL, nil
+// Store is the full storage surface implemented by every backend
+type Store interface {
+	URLStore
+	UserStore
+	APIKeyStore
+	DomainStore
+	SequenceStore
 }
 
-// UpdateShortURLClicks increments the click count for a short URL
-func (r *Repository) UpdateShortURLClicks(ctx context.Context, id primitive.ObjectID) (*models.ShortURL, error) {
-        if r.useMemoryRepo {
-                return r.memoryRepo.UpdateShortURLClicks(ctx, id)
-        }
-        
-        collection := r.db.GetCollection(ShortURLCollection)
-        
-        // Update the click count
-        filter := bson.M{"_id": id}
-        update := bson.M{"$inc": bson.M{"clicks": 1}}
-        
-        after := options.After // Return the updated document
-        updateOptions := options.FindOneAndUpdateOptions{
-                ReturnDocument: &after,
-        }
-        
-        var shortURL models.ShortURL
-        err := collection.FindOneAndUpdate(ctx, filter, update, &updateOptions).Decode(&shortURL)
-        if err != nil {
-                return nil, err
-        }
-        
-        return &shortURL, nil
-}
-
-// DeleteShortURL deletes a short URL by ID
-func (r *Repository) DeleteShortURL(ctx context.Context, id primitive.ObjectID) error {
-        if r.useMemoryRepo {
-                return r.memoryRepo.DeleteShortURL(ctx, id)
-        }
-        
-        collection := r.db.GetCollection(ShortURLCollection)
-        
-        // Delete the document
-        _, err := collection.DeleteOne(ctx, bson.M{"_id": id})
-        return err
-}
-
-// CreateClickEvent creates a new click event
-func (r *Repository) CreateClickEvent(ctx context.Context, clickEvent models.ClickEvent) (*models.ClickEvent, error) {
-        if r.useMemoryRepo {
-                return r.memoryRepo.CreateClickEvent(ctx, clickEvent)
-        }
-        
-        collection := r.db.GetCollection(ClickEventCollection)
-        
-        // Set creation time
-        clickEvent.CreatedAt = time.Now()
-        
-        // Insert document
-        result, err := collection.InsertOne(ctx, clickEvent)
-        if err != nil {
-                return nil, err
-        }
-        
-        // Set ID from inserted document
-        clickEvent.ID = result.InsertedID.(primitive.ObjectID)
-        
-        return &clickEvent, nil
-}
-
-// GetClickEventsByShortURLID retrieves click events for a specific short URL
-func (r *Repository) GetClickEventsByShortURLID(ctx context.Context, shortURLID primitive.ObjectID) ([]models.ClickEvent, error) {
-        if r.useMemoryRepo {
-                return r.memoryRepo.GetClickEventsByShortURLID(ctx, shortURLID)
-        }
-        
-        collection := r.db.GetCollection(ClickEventCollection)
-        
-        // Find documents for this short URL
-        findOptions := options.Find()
-        findOptions.SetSort(bson.D{{"createdAt", -1}}) // Sort by creation date, newest first
-        
-        cursor, err := collection.Find(ctx, bson.M{"shortUrlId": shortURLID}, findOptions)
-        if err != nil {
-                return nil, err
-        }
-        defer cursor.Close(ctx)
-        
-        // Decode the documents
-        var clickEvents []models.ClickEvent
-        if err := cursor.All(ctx, &clickEvents); err != nil {
-                return nil, err
-        }
-        
-        return clickEvents, nil
-}
-
-// GetClickStats retrieves aggregated analytics data
-func (r *Repository) GetClickStats(ctx context.Context) (*models.StatsResponse, error) {
-        if r.useMemoryRepo {
-                return r.memoryRepo.GetClickStats(ctx)
-        }
-        
-        // Get collections
-        shortURLColl := r.db.GetCollection(ShortURLCollection)
-        clickEventColl := r.db.GetCollection(ClickEventCollection)
-        
-        // Get total clicks count
-        totalClicks, err := clickEventColl.CountDocuments(ctx, bson.M{})
-        if err != nil {
-                return nil, err
-        }
-        
-        // Get total links count
-        totalLinks, err := shortURLColl.CountDocuments(ctx, bson.M{})
-        if err != nil {
-                return nil, err
-        }
-        
-        // Get active links count (not expired and active = true)
-        now := time.Now()
-        activeLinksFilter := bson.M{
-                "active": true,
-                "$or": []bson.M{
-                        {"expiresAt": bson.M{"$exists": false}},
-                        {"expiresAt": bson.M{"$gt": now}},
-                },
-        }
-        activeLinks, err := shortURLColl.CountDocuments(ctx, activeLinksFilter)
-        if err != nil {
-                return nil, err
-        }
-        
-        // Get device stats
-        deviceStatsFilter := []bson.M{
-                {
-                        "$group": bson.M{
-                                "_id": "$device",
-                                "count": bson.M{"$sum": 1},
-                        },
-                },
-        }
-        
-        deviceStatsCursor, err := clickEventColl.Aggregate(ctx, deviceStatsFilter)
-        if err != nil {
-                return nil, err
-        }
-        defer deviceStatsCursor.Close(ctx)
-        
-        // Process device stats results
-        deviceStats := models.DeviceStats{
-                Mobile:  0,
-                Desktop: 0,
-                Tablet:  0,
-        }
-        
-        var deviceResults []struct {
-                ID    string `bson:"_id"`
-                Count int    `bson:"count"`
-        }
-        
-        if err := deviceStatsCursor.All(ctx, &deviceResults); err != nil {
-                return nil, err
-        }
-        
-        for _, result := range deviceResults {
-                switch result.ID {
-                case "mobile":
-                        deviceStats.Mobile = result.Count
-                case "desktop":
-                        deviceStats.Desktop = result.Count
-                case "tablet":
-                        deviceStats.Tablet = result.Count
-                }
-        }
-        
-        // Get referrer stats
-        referrerStatsFilter := []bson.M{
-                {
-                        "$group": bson.M{
-                                "_id": "$referer",
-                                "count": bson.M{"$sum": 1},
-                        },
-                },
-        }
-        
-        referrerStatsCursor, err := clickEventColl.Aggregate(ctx, referrerStatsFilter)
-        if err != nil {
-                return nil, err
-        }
-        defer referrerStatsCursor.Close(ctx)
-        
-        // Process referrer stats results
-        referrerStats := make(map[string]int)
-        
-        var referrerResults []struct {
-                ID    string `bson:"_id"`
-                Count int    `bson:"count"`
-        }
-        
-        if err := referrerStatsCursor.All(ctx, &referrerResults); err != nil {
-                return nil, err
-        }
-        
-        for _, result := range referrerResults {
-                referrerId := result.ID
-                if referrerId == "" {
-                        referrerId = "direct"
-                }
-                referrerStats[referrerId] = result.Count
-        }
-        
-        // Create and return the stats response
-        stats := &models.StatsResponse{
-                TotalClicks:   int(totalClicks),
-                TotalLinks:    int(totalLinks),
-                ActiveLinks:   int(activeLinks),
-                DeviceStats:   deviceStats,
-                ReferrerStats: referrerStats,
-        }
-        
-        return stats, nil
-}
\ No newline at end of file
+// Ensure every backend implements the full storage surface
+var (
+	_ Store = (*MongoRepository)(nil)
+	_ Store = (*MemoryRepository)(nil)
+	_ Store = (*BoltRepository)(nil)
+	_ Store = (*PostgresRepository)(nil)
+)
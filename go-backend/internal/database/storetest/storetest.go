@@ -0,0 +1,1155 @@
+// Package storetest provides a conformance suite that every database.Store
+// implementation must pass, so that storage backends cannot drift apart.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"shortlink/internal/database"
+	"shortlink/internal/models"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Factory returns an empty store for a single subtest
+type Factory func(t *testing.T) database.Store
+
+// Run runs the conformance suite against the stores returned by newStore
+func Run(t *testing.T, newStore Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, store database.Store)
+	}{
+		{"CreateAndGetShortURL", testCreateAndGetShortURL},
+		{"GetAllShortURLs", testGetAllShortURLs},
+		{"GetActiveShortURLByNormalizedURL", testGetActiveShortURLByNormalizedURL},
+		{"DomainSlugs", testDomainSlugs},
+		{"UpdateShortURL", testUpdateShortURL},
+		{"UpdateShortURLClicks", testUpdateShortURLClicks},
+		{"DeleteShortURL", testDeleteShortURL},
+		{"RestoreShortURL", testRestoreShortURL},
+		{"PurgeDeletedShortURLs", testPurgeDeletedShortURLs},
+		{"ActivateScheduledShortURLs", testActivateScheduledShortURLs},
+		{"ExpireShortURLs", testExpireShortURLs},
+		{"PurgeExpiredShortURLs", testPurgeExpiredShortURLs},
+		{"Revisions", testRevisions},
+		{"ClickEvents", testClickEvents},
+		{"ClickStats", testClickStats},
+		{"ClickStatsAfterUpdate", testClickStatsAfterUpdate},
+		{"Users", testUsers},
+		{"Sessions", testSessions},
+		{"APIKeys", testAPIKeys},
+		{"Domains", testDomains},
+		{"Sequences", testSequences},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+// pause separates records that are ordered by creation time.
+// Some backends only store timestamps with millisecond precision.
+func pause() {
+	time.Sleep(5 * time.Millisecond)
+}
+
+// mustCreateUser registers a user so that tests use owner IDs the store itself issued
+func mustCreateUser(t *testing.T, store database.Store, username string) primitive.ObjectID {
+	t.Helper()
+
+	user, err := store.CreateUser(context.Background(), models.User{
+		Username:     username,
+		PasswordHash: "hash",
+		Role:         models.RoleUser,
+	})
+	if err != nil {
+		t.Fatalf("CreateUser(%q): %v", username, err)
+	}
+	return user.ID
+}
+
+func mustCreateShortURL(t *testing.T, store database.Store, userID primitive.ObjectID, slug string) *models.ShortURL {
+	t.Helper()
+
+	created, err := store.CreateShortURL(context.Background(), models.ShortURL{
+		UserID:      userID,
+		OriginalURL: "https://example.com/" + slug,
+		Slug:        slug,
+	})
+	if err != nil {
+		t.Fatalf("CreateShortURL(%q): %v", slug, err)
+	}
+	return created
+}
+
+func testCreateAndGetShortURL(t *testing.T, store database.Store) {
+	ctx := context.Background()
+	userID := mustCreateUser(t, store, "alice")
+
+	created := mustCreateShortURL(t, store, userID, "abc123")
+	if created.ID.IsZero() {
+		t.Fatal("created short URL has no ID")
+	}
+	if !created.Active || created.Clicks != 0 || created.CreatedAt.IsZero() {
+		t.Fatalf("created short URL has wrong defaults: %+v", created)
+	}
+
+	byID, err := store.GetShortURL(ctx, created.ID)
+	if err != nil || byID == nil {
+		t.Fatalf("GetShortURL = %v, %v; want record", byID, err)
+	}
+	if byID.Slug != "abc123" || byID.UserID != userID || byID.OriginalURL != created.OriginalURL {
+		t.Fatalf("GetShortURL returned %+v", byID)
+	}
+
+	bySlug, err := store.GetShortURLBySlug(ctx, "", "abc123")
+	if err != nil || bySlug == nil || bySlug.ID != created.ID {
+		t.Fatalf("GetShortURLBySlug = %v, %v; want ID %s", bySlug, err, created.ID.Hex())
+	}
+
+	missing, err := store.GetShortURL(ctx, primitive.NewObjectID())
+	if err != nil || missing != nil {
+		t.Fatalf("GetShortURL(unknown) = %v, %v; want nil, nil", missing, err)
+	}
+
+	missing, err = store.GetShortURLBySlug(ctx, "", "nope")
+	if err != nil || missing != nil {
+		t.Fatalf("GetShortURLBySlug(unknown) = %v, %v; want nil, nil", missing, err)
+	}
+
+	_, err = store.CreateShortURL(ctx, models.ShortURL{UserID: userID, OriginalURL: "https://example.org", Slug: "abc123"})
+	if !errors.Is(err, database.ErrSlugTaken) {
+		t.Fatalf("CreateShortURL(duplicate slug) error = %v, want ErrSlugTaken", err)
+	}
+}
+
+func testGetAllShortURLs(t *testing.T, store database.Store) {
+	ctx := context.Background()
+	alice := mustCreateUser(t, store, "alice")
+	bob := mustCreateUser(t, store, "bob")
+
+	mustCreateShortURL(t, store, alice, "first")
+	pause()
+	mustCreateShortURL(t, store, bob, "other")
+	pause()
+	mustCreateShortURL(t, store, alice, "second")
+
+	shortURLs, err := store.GetAllShortURLs(ctx, alice)
+	if err != nil {
+		t.Fatalf("GetAllShortURLs: %v", err)
+	}
+	if len(shortURLs) != 2 {
+		t.Fatalf("GetAllShortURLs returned %d links, want 2", len(shortURLs))
+	}
+	if shortURLs[0].Slug != "second" || shortURLs[1].Slug != "first" {
+		t.Fatalf("GetAllShortURLs order = %s, %s; want newest first", shortURLs[0].Slug, shortURLs[1].Slug)
+	}
+
+	none, err := store.GetAllShortURLs(ctx, mustCreateUser(t, store, "carol"))
+	if err != nil || none == nil || len(none) != 0 {
+		t.Fatalf("GetAllShortURLs(user without links) = %v, %v; want empty non-nil slice", none, err)
+	}
+}
+
+func testGetActiveShortURLByNormalizedURL(t *testing.T, store database.Store) {
+	ctx := context.Background()
+	owner := mustCreateUser(t, store, "alice")
+	other := mustCreateUser(t, store, "bob")
+	const destination = "https://example.com/"
+
+	create := func(userID primitive.ObjectID, slug string, expiresAt *time.Time) *models.ShortURL {
+		t.Helper()
+		created, err := store.CreateShortURL(ctx, models.ShortURL{
+			UserID:        userID,
+			OriginalURL:   "https://EXAMPLE.com",
+			NormalizedURL: destination,
+			Slug:          slug,
+			ExpiresAt:     expiresAt,
+		})
+		if err != nil {
+			t.Fatalf("CreateShortURL(%q): %v", slug, err)
+		}
+		pause()
+		return created
+	}
+
+	expired := time.Now().Add(-time.Hour)
+	older := create(owner, "older", nil)
+	newer := create(owner, "newer", nil)
+	create(owner, "expired", &expired)
+	create(other, "others", nil)
+
+	found, err := store.GetActiveShortURLByNormalizedURL(ctx, owner, "", destination)
+	if err != nil || found == nil || found.ID != newer.ID {
+		t.Fatalf("GetActiveShortURLByNormalizedURL = %+v, %v; want %q", found, err, newer.Slug)
+	}
+	if found.NormalizedURL != destination {
+		t.Fatalf("NormalizedURL = %q, want %q", found.NormalizedURL, destination)
+	}
+
+	if err := store.DeleteShortURL(ctx, newer.ID, owner); err != nil {
+		t.Fatalf("DeleteShortURL: %v", err)
+	}
+	found, err = store.GetActiveShortURLByNormalizedURL(ctx, owner, "", destination)
+	if err != nil || found == nil || found.ID != older.ID {
+		t.Fatalf("GetActiveShortURLByNormalizedURL after delete = %+v, %v; want %q", found, err, older.Slug)
+	}
+
+	found, err = store.GetActiveShortURLByNormalizedURL(ctx, owner, "", "https://example.org/")
+	if err != nil || found != nil {
+		t.Fatalf("GetActiveShortURLByNormalizedURL(unknown) = %+v, %v; want nil, nil", found, err)
+	}
+}
+
+func testDomainSlugs(t *testing.T, store database.Store) {
+	ctx := context.Background()
+	owner := mustCreateUser(t, store, "alice")
+	const brand = "go.team-a.example"
+	const destination = "https://example.com/"
+
+	create := func(domain, slug string) (*models.ShortURL, error) {
+		return store.CreateShortURL(ctx, models.ShortURL{
+			UserID:        owner,
+			Domain:        domain,
+			OriginalURL:   destination,
+			NormalizedURL: destination,
+			Slug:          slug,
+		})
+	}
+
+	onDefault, err := create("", "abc")
+	if err != nil {
+		t.Fatalf("CreateShortURL(default domain): %v", err)
+	}
+	pause()
+	onBrand, err := create(brand, "abc")
+	if err != nil {
+		t.Fatalf("CreateShortURL(same slug on %s): %v", brand, err)
+	}
+	if onBrand.Domain != brand {
+		t.Fatalf("Domain = %q, want %q", onBrand.Domain, brand)
+	}
+	if _, err := create(brand, "abc"); !errors.Is(err, database.ErrSlugTaken) {
+		t.Fatalf("CreateShortURL(duplicate slug on %s) error = %v, want ErrSlugTaken", brand, err)
+	}
+
+	found, err := store.GetShortURLBySlug(ctx, "", "abc")
+	if err != nil || found == nil || found.ID != onDefault.ID {
+		t.Fatalf("GetShortURLBySlug(default domain) = %+v, %v; want %s", found, err, onDefault.ID.Hex())
+	}
+	found, err = store.GetShortURLBySlug(ctx, brand, "abc")
+	if err != nil || found == nil || found.ID != onBrand.ID || found.Domain != brand {
+		t.Fatalf("GetShortURLBySlug(%s) = %+v, %v; want %s", brand, found, err, onBrand.ID.Hex())
+	}
+	found, err = store.GetShortURLBySlug(ctx, "t.brand.example", "abc")
+	if err != nil || found != nil {
+		t.Fatalf("GetShortURLBySlug(other domain) = %+v, %v; want nil, nil", found, err)
+	}
+
+	// Deduplication only looks at links on the same domain
+	found, err = store.GetActiveShortURLByNormalizedURL(ctx, owner, brand, destination)
+	if err != nil || found == nil || found.ID != onBrand.ID {
+		t.Fatalf("GetActiveShortURLByNormalizedURL(%s) = %+v, %v; want %s", brand, found, err, onBrand.ID.Hex())
+	}
+	found, err = store.GetActiveShortURLByNormalizedURL(ctx, owner, "", destination)
+	if err != nil || found == nil || found.ID != onDefault.ID {
+		t.Fatalf("GetActiveShortURLByNormalizedURL(default domain) = %+v, %v; want %s", found, err, onDefault.ID.Hex())
+	}
+
+	// Renaming checks the slug against the link's own domain
+	if _, err := create(brand, "taken"); err != nil {
+		t.Fatalf("CreateShortURL: %v", err)
+	}
+	update := *onDefault
+	update.Slug = "taken"
+	updated, err := store.UpdateShortURL(ctx, update, onDefault.Version)
+	if err != nil {
+		t.Fatalf("UpdateShortURL(slug taken on another domain): %v", err)
+	}
+	if updated.Domain != "" {
+		t.Fatalf("UpdateShortURL moved the link to domain %q", updated.Domain)
+	}
+	update = *onBrand
+	update.Slug = "taken"
+	if _, err := store.UpdateShortURL(ctx, update, onBrand.Version); !errors.Is(err, database.ErrSlugTaken) {
+		t.Fatalf("UpdateShortURL(slug taken on the same domain) error = %v, want ErrSlugTaken", err)
+	}
+	if found, _ := store.GetShortURLBySlug(ctx, "", "abc"); found != nil {
+		t.Fatal("old slug still resolves after renaming")
+	}
+
+	// Purging frees the slug on its domain only
+	if err := store.DeleteShortURL(ctx, onBrand.ID, owner); err != nil {
+		t.Fatalf("DeleteShortURL: %v", err)
+	}
+	if _, err := store.PurgeDeletedShortURLs(ctx, time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("PurgeDeletedShortURLs: %v", err)
+	}
+	if _, err := create(brand, "abc"); err != nil {
+		t.Fatalf("CreateShortURL(purged slug on %s): %v", brand, err)
+	}
+}
+
+func testUpdateShortURL(t *testing.T, store database.Store) {
+	ctx := context.Background()
+	owner := mustCreateUser(t, store, "alice")
+	created := mustCreateShortURL(t, store, owner, "before")
+	mustCreateShortURL(t, store, owner, "taken")
+	if created.Version != 1 {
+		t.Fatalf("new short URL has Version %d, want 1", created.Version)
+	}
+
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Millisecond)
+	change := *created
+	change.OriginalURL = "https://example.org/after"
+	change.NormalizedURL = "https://example.org/after"
+	change.Slug = "after"
+	change.Active = false
+	change.ExpiresAt = &expiresAt
+	change.ActivateAt = &expiresAt
+	change.Schedule = &models.Schedule{
+		TimeZone: "Europe/Berlin",
+		Windows:  []models.ScheduleWindow{{Days: []string{"mon", "fri"}, Start: "09:00", End: "17:00"}},
+	}
+	change.FallbackURL = "https://example.org/closed"
+	change.PasswordHash = "hash"
+	change.RedirectType = models.RedirectFrame
+	change.QueryPassthrough = models.QueryPassthroughRequest
+	change.Wildcard = true
+
+	updated, err := store.UpdateShortURL(ctx, change, created.Version)
+	if err != nil {
+		t.Fatalf("UpdateShortURL: %v", err)
+	}
+	if updated.Version != 2 || updated.Slug != "after" || updated.Active || updated.OriginalURL != change.OriginalURL {
+		t.Fatalf("UpdateShortURL = %+v", updated)
+	}
+	if updated.ExpiresAt == nil || !updated.ExpiresAt.Equal(expiresAt) {
+		t.Fatalf("ExpiresAt = %v, want %v", updated.ExpiresAt, expiresAt)
+	}
+	if updated.ActivateAt == nil || !updated.ActivateAt.Equal(expiresAt) {
+		t.Fatalf("ActivateAt = %v, want %v", updated.ActivateAt, expiresAt)
+	}
+	if !reflect.DeepEqual(updated.Schedule, change.Schedule) || updated.FallbackURL != change.FallbackURL {
+		t.Fatalf("Schedule, FallbackURL = %+v, %q, want %+v, %q", updated.Schedule, updated.FallbackURL, change.Schedule, change.FallbackURL)
+	}
+	if updated.PasswordHash != "hash" {
+		t.Fatalf("PasswordHash = %q, want %q", updated.PasswordHash, "hash")
+	}
+	if updated.RedirectType != models.RedirectFrame {
+		t.Fatalf("RedirectType = %q, want %q", updated.RedirectType, models.RedirectFrame)
+	}
+	if updated.QueryPassthrough != models.QueryPassthroughRequest || !updated.Wildcard {
+		t.Fatalf("QueryPassthrough, Wildcard = %q, %v, want %q, true", updated.QueryPassthrough, updated.Wildcard, models.QueryPassthroughRequest)
+	}
+	if found, _ := store.GetShortURL(ctx, created.ID); found == nil || !reflect.DeepEqual(found.Schedule, change.Schedule) {
+		t.Fatalf("GetShortURL after update = %+v", found)
+	}
+
+	// The slug moves with the update
+	if found, _ := store.GetShortURLBySlug(ctx, "", "after"); found == nil || found.ID != created.ID {
+		t.Fatalf("GetShortURLBySlug(after) = %+v", found)
+	}
+	if found, _ := store.GetShortURLBySlug(ctx, "", "before"); found != nil {
+		t.Fatalf("old slug still resolves to %+v", found)
+	}
+
+	// Stale versions, clashing slugs and other users are rejected
+	if _, err := store.UpdateShortURL(ctx, change, created.Version); !errors.Is(err, database.ErrVersionConflict) {
+		t.Fatalf("UpdateShortURL(stale version) error = %v, want ErrVersionConflict", err)
+	}
+	change.Slug = "taken"
+	if _, err := store.UpdateShortURL(ctx, change, updated.Version); !errors.Is(err, database.ErrSlugTaken) {
+		t.Fatalf("UpdateShortURL(taken slug) error = %v, want ErrSlugTaken", err)
+	}
+	change.Slug = "after"
+	change.UserID = mustCreateUser(t, store, "mallory")
+	if _, err := store.UpdateShortURL(ctx, change, updated.Version); !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("UpdateShortURL(other user) error = %v, want ErrNotFound", err)
+	}
+
+	// Clearing the expiry and availability limits
+	change.UserID = owner
+	change.ExpiresAt = nil
+	change.ActivateAt = nil
+	change.Schedule = nil
+	change.FallbackURL = ""
+	change.PasswordHash = ""
+	change.RedirectType = ""
+	change.QueryPassthrough = ""
+	change.Wildcard = false
+	updated, err = store.UpdateShortURL(ctx, change, updated.Version)
+	if err != nil || updated.ExpiresAt != nil || updated.Version != 3 {
+		t.Fatalf("UpdateShortURL(clear expiry) = %+v, %v", updated, err)
+	}
+	if updated.ActivateAt != nil || updated.Schedule != nil || updated.FallbackURL != "" || updated.PasswordHash != "" || updated.RedirectType != "" || updated.QueryPassthrough != "" || updated.Wildcard {
+		t.Fatalf("UpdateShortURL(clear availability) = %+v", updated)
+	}
+}
+
+func testUpdateShortURLClicks(t *testing.T, store database.Store) {
+	ctx := context.Background()
+	created := mustCreateShortURL(t, store, mustCreateUser(t, store, "alice"), "clicky")
+
+	for want := 1; want <= 2; want++ {
+		updated, err := store.UpdateShortURLClicks(ctx, created.ID)
+		if err != nil {
+			t.Fatalf("UpdateShortURLClicks: %v", err)
+		}
+		if updated.Clicks != want {
+			t.Fatalf("Clicks = %d, want %d", updated.Clicks, want)
+		}
+	}
+
+	if _, err := store.UpdateShortURLClicks(ctx, primitive.NewObjectID()); !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("UpdateShortURLClicks(unknown) error = %v, want ErrNotFound", err)
+	}
+
+	// Concurrent clicks on a limited link never go past the limit
+	limited, err := store.CreateShortURL(ctx, models.ShortURL{
+		UserID:      created.UserID,
+		OriginalURL: "https://example.com/limited",
+		Slug:        "limited",
+		MaxClicks:   3,
+	})
+	if err != nil {
+		t.Fatalf("CreateShortURL(limited): %v", err)
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := store.UpdateShortURLClicks(ctx, limited.ID)
+			results <- err
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	counted := 0
+	for err := range results {
+		switch {
+		case err == nil:
+			counted++
+		case !errors.Is(err, database.ErrClickLimitReached):
+			t.Fatalf("UpdateShortURLClicks(limited) error = %v, want ErrClickLimitReached", err)
+		}
+	}
+	got, _ := store.GetShortURL(ctx, limited.ID)
+	if counted != 3 || got == nil || got.Clicks != 3 || got.MaxClicks != 3 {
+		t.Fatalf("%d clicks counted, stored %+v; want 3", counted, got)
+	}
+
+	// The last click deactivated the link as a new version
+	if got.Active || got.Version != limited.Version+1 {
+		t.Fatalf("after the last click Active, Version = %v, %d; want false, %d", got.Active, got.Version, limited.Version+1)
+	}
+
+	// Raising the limit makes room for more clicks
+	change := *got
+	change.MaxClicks = 4
+	change.Active = true
+	if _, err := store.UpdateShortURL(ctx, change, got.Version); err != nil {
+		t.Fatalf("UpdateShortURL(raise limit): %v", err)
+	}
+	if updated, err := store.UpdateShortURLClicks(ctx, limited.ID); err != nil || updated.Clicks != 4 || updated.Active {
+		t.Fatalf("UpdateShortURLClicks(raised limit) = %+v, %v", updated, err)
+	}
+
+	// A scheduled link that runs out of clicks isn't activated later
+	activateAt := time.Now().Add(-time.Minute).UTC().Truncate(time.Millisecond)
+	scheduled, err := store.CreateShortURL(ctx, models.ShortURL{
+		UserID:      created.UserID,
+		OriginalURL: "https://example.com/scheduled",
+		Slug:        "scheduled",
+		MaxClicks:   1,
+		ActivateAt:  &activateAt,
+	})
+	if err != nil {
+		t.Fatalf("CreateShortURL(scheduled): %v", err)
+	}
+	if updated, err := store.UpdateShortURLClicks(ctx, scheduled.ID); err != nil || updated.Active || updated.ActivateAt != nil {
+		t.Fatalf("UpdateShortURLClicks(scheduled) = %+v, %v", updated, err)
+	}
+}
+
+func testDeleteShortURL(t *testing.T, store database.Store) {
+	ctx := context.Background()
+	owner := mustCreateUser(t, store, "alice")
+	created := mustCreateShortURL(t, store, owner, "doomed")
+
+	if err := store.DeleteShortURL(ctx, created.ID, mustCreateUser(t, store, "mallory")); !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("DeleteShortURL(other user) error = %v, want ErrNotFound", err)
+	}
+	if got, _ := store.GetShortURL(ctx, created.ID); got == nil {
+		t.Fatal("DeleteShortURL by another user removed the link")
+	}
+
+	if err := store.DeleteShortURL(ctx, created.ID, owner); err != nil {
+		t.Fatalf("DeleteShortURL: %v", err)
+	}
+
+	// The link moves to the trash and keeps its slug
+	got, err := store.GetShortURL(ctx, created.ID)
+	if err != nil || got == nil || got.DeletedAt == nil {
+		t.Fatalf("GetShortURL after DeleteShortURL = %+v, %v; want the link with DeletedAt set", got, err)
+	}
+	if got, _ := store.GetShortURLBySlug(ctx, "", "doomed"); got == nil || got.DeletedAt == nil {
+		t.Fatalf("GetShortURLBySlug after DeleteShortURL = %+v; want the trashed link", got)
+	}
+	if _, err := store.CreateShortURL(ctx, models.ShortURL{UserID: owner, OriginalURL: "https://example.com/", Slug: "doomed"}); !errors.Is(err, database.ErrSlugTaken) {
+		t.Fatalf("CreateShortURL(trashed slug) error = %v, want ErrSlugTaken", err)
+	}
+
+	// It drops out of listings, deduplication and updates
+	if all, _ := store.GetAllShortURLs(ctx, owner); len(all) != 0 {
+		t.Fatalf("GetAllShortURLs after DeleteShortURL = %+v; want none", all)
+	}
+	if found, _ := store.GetActiveShortURLByNormalizedURL(ctx, owner, "", created.NormalizedURL); found != nil {
+		t.Fatalf("GetActiveShortURLByNormalizedURL found trashed link %+v", found)
+	}
+	if _, err := store.UpdateShortURL(ctx, *got, got.Version); !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("UpdateShortURL(trashed) error = %v, want ErrNotFound", err)
+	}
+	if stats, _ := store.GetClickStats(ctx, owner); stats == nil || stats.TotalLinks != 0 {
+		t.Fatalf("GetClickStats after DeleteShortURL = %+v; want no links", stats)
+	}
+
+	trash, err := store.GetDeletedShortURLs(ctx, owner)
+	if err != nil || len(trash) != 1 || trash[0].ID != created.ID {
+		t.Fatalf("GetDeletedShortURLs = %+v, %v; want the deleted link", trash, err)
+	}
+
+	if err := store.DeleteShortURL(ctx, created.ID, owner); !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("second DeleteShortURL error = %v, want ErrNotFound", err)
+	}
+}
+
+func testRestoreShortURL(t *testing.T, store database.Store) {
+	ctx := context.Background()
+	owner := mustCreateUser(t, store, "alice")
+	created := mustCreateShortURL(t, store, owner, "phoenix")
+
+	if _, err := store.RestoreShortURL(ctx, created.ID, owner); !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("RestoreShortURL(not trashed) error = %v, want ErrNotFound", err)
+	}
+	if err := store.DeleteShortURL(ctx, created.ID, owner); err != nil {
+		t.Fatalf("DeleteShortURL: %v", err)
+	}
+	if _, err := store.RestoreShortURL(ctx, created.ID, mustCreateUser(t, store, "mallory")); !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("RestoreShortURL(other user) error = %v, want ErrNotFound", err)
+	}
+
+	restored, err := store.RestoreShortURL(ctx, created.ID, owner)
+	if err != nil {
+		t.Fatalf("RestoreShortURL: %v", err)
+	}
+	if restored.DeletedAt != nil || restored.Slug != "phoenix" || restored.Version != created.Version {
+		t.Fatalf("RestoreShortURL = %+v", restored)
+	}
+	if all, _ := store.GetAllShortURLs(ctx, owner); len(all) != 1 {
+		t.Fatalf("GetAllShortURLs after RestoreShortURL = %+v; want the link back", all)
+	}
+	if trash, _ := store.GetDeletedShortURLs(ctx, owner); len(trash) != 0 {
+		t.Fatalf("GetDeletedShortURLs after RestoreShortURL = %+v; want none", trash)
+	}
+
+	// A restored link can be trashed again
+	if err := store.DeleteShortURL(ctx, created.ID, owner); err != nil {
+		t.Fatalf("DeleteShortURL after restore: %v", err)
+	}
+}
+
+func testPurgeDeletedShortURLs(t *testing.T, store database.Store) {
+	ctx := context.Background()
+	owner := mustCreateUser(t, store, "alice")
+	old := mustCreateShortURL(t, store, owner, "old")
+	recent := mustCreateShortURL(t, store, owner, "recent")
+	kept := mustCreateShortURL(t, store, owner, "kept")
+
+	for _, shortURL := range []*models.ShortURL{old, recent, kept} {
+		if _, err := store.CreateClickEvent(ctx, models.ClickEvent{ShortURLID: shortURL.ID, Device: "desktop"}); err != nil {
+			t.Fatalf("CreateClickEvent: %v", err)
+		}
+		if _, err := store.CreateShortURLRevision(ctx, models.ShortURLRevision{ShortURLID: shortURL.ID, Version: 1, Action: models.RevisionCreate, Slug: shortURL.Slug}); err != nil {
+			t.Fatalf("CreateShortURLRevision: %v", err)
+		}
+	}
+
+	if err := store.DeleteShortURL(ctx, old.ID, owner); err != nil {
+		t.Fatalf("DeleteShortURL: %v", err)
+	}
+	pause()
+	cutoff := time.Now()
+	pause()
+	if err := store.DeleteShortURL(ctx, recent.ID, owner); err != nil {
+		t.Fatalf("DeleteShortURL: %v", err)
+	}
+
+	purged, err := store.PurgeDeletedShortURLs(ctx, cutoff)
+	if err != nil || purged != 1 {
+		t.Fatalf("PurgeDeletedShortURLs = %d, %v; want 1", purged, err)
+	}
+
+	// The purged link is gone along with its clicks and history, and its slug is free
+	if got, _ := store.GetShortURL(ctx, old.ID); got != nil {
+		t.Fatalf("purged link still present: %+v", got)
+	}
+	if events, _ := store.GetClickEventsByShortURLID(ctx, old.ID); len(events) != 0 {
+		t.Fatalf("purged link still has click events: %+v", events)
+	}
+	if revisions, _ := store.GetShortURLRevisions(ctx, old.ID); len(revisions) != 0 {
+		t.Fatalf("purged link still has revisions: %+v", revisions)
+	}
+	mustCreateShortURL(t, store, owner, "old")
+
+	// Links deleted after the cutoff, and links not deleted at all, are untouched
+	for _, shortURL := range []*models.ShortURL{recent, kept} {
+		if got, _ := store.GetShortURL(ctx, shortURL.ID); got == nil {
+			t.Fatalf("%s was purged", shortURL.Slug)
+		}
+		if events, _ := store.GetClickEventsByShortURLID(ctx, shortURL.ID); len(events) != 1 {
+			t.Fatalf("%s lost its click events: %+v", shortURL.Slug, events)
+		}
+		if revisions, _ := store.GetShortURLRevisions(ctx, shortURL.ID); len(revisions) != 1 {
+			t.Fatalf("%s lost its revisions: %+v", shortURL.Slug, revisions)
+		}
+	}
+
+	if purged, err := store.PurgeDeletedShortURLs(ctx, cutoff); err != nil || purged != 0 {
+		t.Fatalf("second PurgeDeletedShortURLs = %d, %v; want 0", purged, err)
+	}
+}
+
+func testRevisions(t *testing.T, store database.Store) {
+	ctx := context.Background()
+	owner := mustCreateUser(t, store, "alice")
+	created := mustCreateShortURL(t, store, owner, "history")
+
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Millisecond)
+	for version := 1; version <= 3; version++ {
+		revision, err := store.CreateShortURLRevision(ctx, models.ShortURLRevision{
+			ShortURLID:   created.ID,
+			Version:      version,
+			Action:       models.RevisionUpdate,
+			Changes:      []string{"originalUrl"},
+			RolledBackTo: version - 1,
+			ChangedBy:    owner,
+			OriginalURL:  fmt.Sprintf("https://example.com/v%d", version),
+			Slug:         "history",
+			Active:       true,
+			ExpiresAt:    &expiresAt,
+			ActivateAt:   &expiresAt,
+			Schedule: &models.Schedule{
+				TimeZone: "Europe/Berlin",
+				Windows:  []models.ScheduleWindow{{Days: []string{"mon"}, Start: "09:00", End: "17:00"}},
+			},
+			FallbackURL:      "https://example.com/closed",
+			MaxClicks:        version,
+			PasswordHash:     "hash",
+			RedirectType:     models.RedirectPermanent,
+			QueryPassthrough: models.QueryPassthroughLink,
+			Wildcard:         true,
+		})
+		if err != nil {
+			t.Fatalf("CreateShortURLRevision(%d): %v", version, err)
+		}
+		if revision.ID.IsZero() || revision.CreatedAt.IsZero() {
+			t.Fatalf("revision missing ID or timestamp: %+v", revision)
+		}
+	}
+
+	// Versions are append-only
+	if _, err := store.CreateShortURLRevision(ctx, models.ShortURLRevision{
+		ShortURLID: created.ID,
+		Version:    2,
+		Action:     models.RevisionUpdate,
+		Slug:       "history",
+	}); !errors.Is(err, database.ErrVersionConflict) {
+		t.Fatalf("CreateShortURLRevision(duplicate version) error = %v, want ErrVersionConflict", err)
+	}
+
+	revisions, err := store.GetShortURLRevisions(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("GetShortURLRevisions: %v", err)
+	}
+	if len(revisions) != 3 || revisions[0].Version != 3 || revisions[2].Version != 1 {
+		t.Fatalf("GetShortURLRevisions = %+v; want 3 revisions newest first", revisions)
+	}
+
+	revision, err := store.GetShortURLRevision(ctx, created.ID, 2)
+	if err != nil || revision == nil {
+		t.Fatalf("GetShortURLRevision(2) = %v, %v", revision, err)
+	}
+	if revision.OriginalURL != "https://example.com/v2" || revision.RolledBackTo != 1 || revision.ChangedBy != owner ||
+		len(revision.Changes) != 1 || revision.Changes[0] != "originalUrl" {
+		t.Fatalf("GetShortURLRevision(2) = %+v", revision)
+	}
+	if revision.ExpiresAt == nil || !revision.ExpiresAt.Equal(expiresAt) {
+		t.Fatalf("ExpiresAt = %v, want %v", revision.ExpiresAt, expiresAt)
+	}
+	if revision.ActivateAt == nil || !revision.ActivateAt.Equal(expiresAt) {
+		t.Fatalf("ActivateAt = %v, want %v", revision.ActivateAt, expiresAt)
+	}
+	if revision.Schedule == nil || revision.Schedule.TimeZone != "Europe/Berlin" || len(revision.Schedule.Windows) != 1 ||
+		revision.FallbackURL != "https://example.com/closed" || revision.MaxClicks != 2 || revision.PasswordHash != "hash" ||
+		revision.RedirectType != models.RedirectPermanent || revision.QueryPassthrough != models.QueryPassthroughLink || !revision.Wildcard {
+		t.Fatalf("GetShortURLRevision(2) settings = %+v", revision)
+	}
+	if missing, err := store.GetShortURLRevision(ctx, created.ID, 9); err != nil || missing != nil {
+		t.Fatalf("GetShortURLRevision(unknown version) = %v, %v; want nil, nil", missing, err)
+	}
+
+	none, err := store.GetShortURLRevisions(ctx, primitive.NewObjectID())
+	if err != nil || none == nil || len(none) != 0 {
+		t.Fatalf("GetShortURLRevisions(unknown) = %v, %v; want empty non-nil slice", none, err)
+	}
+}
+
+func testActivateScheduledShortURLs(t *testing.T, store database.Store) {
+	ctx := context.Background()
+	owner := mustCreateUser(t, store, "alice")
+
+	activateAt := time.Now().Add(time.Hour).UTC().Truncate(time.Millisecond)
+	scheduled, err := store.CreateShortURL(ctx, models.ShortURL{
+		UserID:      owner,
+		OriginalURL: "https://example.com/launch",
+		Slug:        "launch",
+		ActivateAt:  &activateAt,
+	})
+	if err != nil {
+		t.Fatalf("CreateShortURL: %v", err)
+	}
+	if scheduled.Active || scheduled.ActivateAt == nil || !scheduled.ActivateAt.Equal(activateAt) {
+		t.Fatalf("scheduled short URL = %+v; want inactive until %v", scheduled, activateAt)
+	}
+	mustCreateShortURL(t, store, owner, "live")
+
+	// Nothing is due yet
+	changed, err := store.ActivateScheduledShortURLs(ctx, time.Now())
+	if err != nil || len(changed) != 0 {
+		t.Fatalf("ActivateScheduledShortURLs(early) = %+v, %v; want none", changed, err)
+	}
+
+	changed, err = store.ActivateScheduledShortURLs(ctx, activateAt.Add(time.Second))
+	if err != nil {
+		t.Fatalf("ActivateScheduledShortURLs: %v", err)
+	}
+	if len(changed) != 1 || changed[0].ID != scheduled.ID || !changed[0].Active || changed[0].ActivateAt != nil || changed[0].Version != 2 {
+		t.Fatalf("ActivateScheduledShortURLs = %+v; want the scheduled link activated at version 2", changed)
+	}
+	if got, _ := store.GetShortURL(ctx, scheduled.ID); got == nil || !got.Active || got.ActivateAt != nil {
+		t.Fatalf("GetShortURL after activation = %+v", got)
+	}
+
+	// Activation happens once
+	if changed, _ := store.ActivateScheduledShortURLs(ctx, activateAt.Add(time.Second)); len(changed) != 0 {
+		t.Fatalf("second ActivateScheduledShortURLs = %+v; want none", changed)
+	}
+}
+
+func testExpireShortURLs(t *testing.T, store database.Store) {
+	ctx := context.Background()
+	owner := mustCreateUser(t, store, "alice")
+
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Millisecond)
+	expiring, err := store.CreateShortURL(ctx, models.ShortURL{
+		UserID:      owner,
+		OriginalURL: "https://example.com/sale",
+		Slug:        "sale",
+		ExpiresAt:   &expiresAt,
+	})
+	if err != nil {
+		t.Fatalf("CreateShortURL: %v", err)
+	}
+	mustCreateShortURL(t, store, owner, "forever")
+
+	// Trashed links are left alone
+	trashed, err := store.CreateShortURL(ctx, models.ShortURL{
+		UserID:      owner,
+		OriginalURL: "https://example.com/trashed",
+		Slug:        "trashed",
+		ExpiresAt:   &expiresAt,
+	})
+	if err != nil {
+		t.Fatalf("CreateShortURL: %v", err)
+	}
+	if err := store.DeleteShortURL(ctx, trashed.ID, owner); err != nil {
+		t.Fatalf("DeleteShortURL: %v", err)
+	}
+
+	if changed, err := store.ExpireShortURLs(ctx, time.Now()); err != nil || len(changed) != 0 {
+		t.Fatalf("ExpireShortURLs(early) = %+v, %v; want none", changed, err)
+	}
+
+	changed, err := store.ExpireShortURLs(ctx, expiresAt.Add(time.Second))
+	if err != nil {
+		t.Fatalf("ExpireShortURLs: %v", err)
+	}
+	if len(changed) != 1 || changed[0].ID != expiring.ID || changed[0].Active || changed[0].Version != 2 {
+		t.Fatalf("ExpireShortURLs = %+v; want the expiring link deactivated at version 2", changed)
+	}
+	if changed, _ := store.ExpireShortURLs(ctx, expiresAt.Add(time.Second)); len(changed) != 0 {
+		t.Fatalf("second ExpireShortURLs = %+v; want none", changed)
+	}
+}
+
+func testPurgeExpiredShortURLs(t *testing.T, store database.Store) {
+	ctx := context.Background()
+	owner := mustCreateUser(t, store, "alice")
+
+	longAgo := time.Now().Add(-48 * time.Hour)
+	recently := time.Now().Add(-time.Hour)
+	old, err := store.CreateShortURL(ctx, models.ShortURL{UserID: owner, OriginalURL: "https://example.com/old", Slug: "old", ExpiresAt: &longAgo})
+	if err != nil {
+		t.Fatalf("CreateShortURL: %v", err)
+	}
+	recent, err := store.CreateShortURL(ctx, models.ShortURL{UserID: owner, OriginalURL: "https://example.com/recent", Slug: "recent", ExpiresAt: &recently})
+	if err != nil {
+		t.Fatalf("CreateShortURL: %v", err)
+	}
+	kept := mustCreateShortURL(t, store, owner, "kept")
+
+	for _, shortURL := range []*models.ShortURL{old, recent, kept} {
+		if _, err := store.CreateClickEvent(ctx, models.ClickEvent{ShortURLID: shortURL.ID, Device: "desktop"}); err != nil {
+			t.Fatalf("CreateClickEvent: %v", err)
+		}
+	}
+
+	purged, err := store.PurgeExpiredShortURLs(ctx, time.Now().Add(-24*time.Hour))
+	if err != nil || purged != 1 {
+		t.Fatalf("PurgeExpiredShortURLs = %d, %v; want 1", purged, err)
+	}
+	if got, _ := store.GetShortURL(ctx, old.ID); got != nil {
+		t.Fatalf("purged link still present: %+v", got)
+	}
+	if events, _ := store.GetClickEventsByShortURLID(ctx, old.ID); len(events) != 0 {
+		t.Fatalf("purged link still has click events: %+v", events)
+	}
+	for _, shortURL := range []*models.ShortURL{recent, kept} {
+		if got, _ := store.GetShortURL(ctx, shortURL.ID); got == nil {
+			t.Fatalf("%s was purged", shortURL.Slug)
+		}
+	}
+}
+
+func testClickEvents(t *testing.T, store database.Store) {
+	ctx := context.Background()
+	created := mustCreateShortURL(t, store, mustCreateUser(t, store, "alice"), "tracked")
+
+	for _, device := range []string{"desktop", "mobile"} {
+		event, err := store.CreateClickEvent(ctx, models.ClickEvent{
+			ShortURLID:      created.ID,
+			ShortURLVersion: created.Version,
+			Destination:     created.OriginalURL,
+			Device:          device,
+		})
+		if err != nil {
+			t.Fatalf("CreateClickEvent: %v", err)
+		}
+		if event.ID.IsZero() || event.CreatedAt.IsZero() {
+			t.Fatalf("click event missing ID or timestamp: %+v", event)
+		}
+		pause()
+	}
+
+	events, err := store.GetClickEventsByShortURLID(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("GetClickEventsByShortURLID: %v", err)
+	}
+	if len(events) != 2 || events[0].Device != "mobile" || events[1].Device != "desktop" {
+		t.Fatalf("GetClickEventsByShortURLID = %+v; want 2 events newest first", events)
+	}
+	if events[0].ShortURLVersion != created.Version || events[0].Destination != created.OriginalURL {
+		t.Fatalf("click event lost its link version or destination: %+v", events[0])
+	}
+
+	none, err := store.GetClickEventsByShortURLID(ctx, primitive.NewObjectID())
+	if err != nil || none == nil || len(none) != 0 {
+		t.Fatalf("GetClickEventsByShortURLID(unknown) = %v, %v; want empty non-nil slice", none, err)
+	}
+}
+
+func testClickStats(t *testing.T, store database.Store) {
+	ctx := context.Background()
+	alice := mustCreateUser(t, store, "alice")
+	bob := mustCreateUser(t, store, "bob")
+
+	aliceURL := mustCreateShortURL(t, store, alice, "alice")
+	bobURL := mustCreateShortURL(t, store, bob, "bob")
+
+	clicks := []models.ClickEvent{
+		{ShortURLID: aliceURL.ID, Device: "mobile", Referer: "https://news.example"},
+		{ShortURLID: aliceURL.ID, Device: "desktop", Referer: ""},
+		{ShortURLID: bobURL.ID, Device: "tablet", Referer: "https://news.example"},
+	}
+	for _, click := range clicks {
+		if _, err := store.CreateClickEvent(ctx, click); err != nil {
+			t.Fatalf("CreateClickEvent: %v", err)
+		}
+	}
+
+	stats, err := store.GetClickStats(ctx, alice)
+	if err != nil {
+		t.Fatalf("GetClickStats(alice): %v", err)
+	}
+	if stats.TotalClicks != 2 || stats.TotalLinks != 1 || stats.ActiveLinks != 1 {
+		t.Fatalf("GetClickStats(alice) = %+v", stats)
+	}
+	if stats.DeviceStats != (models.DeviceStats{Mobile: 1, Desktop: 1}) {
+		t.Fatalf("GetClickStats(alice) devices = %+v", stats.DeviceStats)
+	}
+	if stats.ReferrerStats["https://news.example"] != 1 || stats.ReferrerStats["direct"] != 1 {
+		t.Fatalf("GetClickStats(alice) referrers = %v", stats.ReferrerStats)
+	}
+
+	global, err := store.GetClickStats(ctx, primitive.NilObjectID)
+	if err != nil {
+		t.Fatalf("GetClickStats(global): %v", err)
+	}
+	if global.TotalClicks != 3 || global.TotalLinks != 2 || global.DeviceStats.Tablet != 1 {
+		t.Fatalf("GetClickStats(global) = %+v", global)
+	}
+}
+
+func testClickStatsAfterUpdate(t *testing.T, store database.Store) {
+	ctx := context.Background()
+	userID := mustCreateUser(t, store, "alice")
+	created := mustCreateShortURL(t, store, userID, "abc123")
+
+	change := *created
+	change.OriginalURL = "https://example.com/changed"
+	change.ExpiresAt = nil
+	if _, err := store.UpdateShortURL(ctx, change, created.Version); err != nil {
+		t.Fatalf("UpdateShortURL: %v", err)
+	}
+
+	stats, err := store.GetClickStats(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetClickStats: %v", err)
+	}
+	if stats.TotalLinks != 1 || stats.ActiveLinks != 1 {
+		t.Fatalf("GetClickStats after update = %+v, want 1 active link", stats)
+	}
+}
+
+func testUsers(t *testing.T, store database.Store) {
+	ctx := context.Background()
+
+	user, err := store.CreateUser(ctx, models.User{Username: "alice", PasswordHash: "hash", Role: models.RoleUser})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if user.ID.IsZero() || user.CreatedAt.IsZero() {
+		t.Fatalf("created user missing ID or timestamp: %+v", user)
+	}
+
+	if _, err := store.CreateUser(ctx, models.User{Username: "alice", PasswordHash: "other"}); !errors.Is(err, database.ErrUsernameTaken) {
+		t.Fatalf("duplicate CreateUser error = %v, want ErrUsernameTaken", err)
+	}
+
+	byID, err := store.GetUserByID(ctx, user.ID)
+	if err != nil || byID == nil || byID.Username != "alice" || byID.PasswordHash != "hash" {
+		t.Fatalf("GetUserByID = %+v, %v", byID, err)
+	}
+
+	byName, err := store.GetUserByUsername(ctx, "alice")
+	if err != nil || byName == nil || byName.ID != user.ID {
+		t.Fatalf("GetUserByUsername = %+v, %v", byName, err)
+	}
+
+	missing, err := store.GetUserByUsername(ctx, "bob")
+	if err != nil || missing != nil {
+		t.Fatalf("GetUserByUsername(unknown) = %v, %v; want nil, nil", missing, err)
+	}
+
+	promoted, err := store.SetUserRole(ctx, "alice", models.RoleAdmin)
+	if err != nil || promoted == nil || promoted.ID != user.ID || promoted.Role != models.RoleAdmin || promoted.PasswordHash != "hash" {
+		t.Fatalf("SetUserRole = %+v, %v", promoted, err)
+	}
+	if byID, _ := store.GetUserByID(ctx, user.ID); byID == nil || byID.Role != models.RoleAdmin {
+		t.Fatalf("GetUserByID after SetUserRole = %+v, want the admin role", byID)
+	}
+	if _, err := store.SetUserRole(ctx, "bob", models.RoleAdmin); !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("SetUserRole(unknown) error = %v, want ErrNotFound", err)
+	}
+}
+
+func testSessions(t *testing.T, store database.Store) {
+	ctx := context.Background()
+	userID := mustCreateUser(t, store, "alice")
+
+	_, err := store.CreateSession(ctx, models.Session{UserID: userID, TokenHash: "live", ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	_, err = store.CreateSession(ctx, models.Session{UserID: userID, TokenHash: "stale", ExpiresAt: time.Now().Add(-time.Hour)})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	session, err := store.GetSessionByTokenHash(ctx, "live")
+	if err != nil || session == nil || session.UserID != userID {
+		t.Fatalf("GetSessionByTokenHash(live) = %+v, %v", session, err)
+	}
+
+	if session, _ := store.GetSessionByTokenHash(ctx, "stale"); session != nil {
+		t.Fatal("expired session was returned")
+	}
+
+	if deleted, err := store.DeleteExpiredSessions(ctx, time.Now()); err != nil || deleted != 1 {
+		t.Fatalf("DeleteExpiredSessions = %d, %v; want 1", deleted, err)
+	}
+	if session, _ := store.GetSessionByTokenHash(ctx, "live"); session == nil {
+		t.Fatal("DeleteExpiredSessions removed a live session")
+	}
+
+	if err := store.DeleteSession(ctx, "live"); err != nil {
+		t.Fatalf("DeleteSession: %v", err)
+	}
+	if session, _ := store.GetSessionByTokenHash(ctx, "live"); session != nil {
+		t.Fatal("session still present after DeleteSession")
+	}
+}
+
+func testAPIKeys(t *testing.T, store database.Store) {
+	ctx := context.Background()
+	owner := mustCreateUser(t, store, "alice")
+
+	apiKey, err := store.CreateAPIKey(ctx, models.APIKey{
+		UserID:  owner,
+		Name:    "ci",
+		Prefix:  "slk_abcd",
+		KeyHash: "keyhash",
+		Scopes:  []string{"read", "create"},
+	})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+
+	found, err := store.GetAPIKeyByHash(ctx, "keyhash")
+	if err != nil || found == nil || found.ID != apiKey.ID || len(found.Scopes) != 2 {
+		t.Fatalf("GetAPIKeyByHash = %+v, %v", found, err)
+	}
+	if found.LastUsedAt != nil {
+		t.Fatal("new API key already has LastUsedAt")
+	}
+
+	if err := store.TouchAPIKey(ctx, apiKey.ID); err != nil {
+		t.Fatalf("TouchAPIKey: %v", err)
+	}
+	if found, _ := store.GetAPIKeyByHash(ctx, "keyhash"); found == nil || found.LastUsedAt == nil {
+		t.Fatal("TouchAPIKey did not record LastUsedAt")
+	}
+
+	if err := store.RevokeAPIKey(ctx, apiKey.ID, mustCreateUser(t, store, "mallory")); !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("RevokeAPIKey(other user) error = %v, want ErrNotFound", err)
+	}
+	if err := store.RevokeAPIKey(ctx, apiKey.ID, owner); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+	if found, _ := store.GetAPIKeyByHash(ctx, "keyhash"); found != nil {
+		t.Fatal("revoked API key is still returned by GetAPIKeyByHash")
+	}
+
+	keys, err := store.GetAPIKeysByUser(ctx, owner)
+	if err != nil || len(keys) != 1 || keys[0].RevokedAt == nil {
+		t.Fatalf("GetAPIKeysByUser = %+v, %v; want one revoked key", keys, err)
+	}
+}
+
+func testDomains(t *testing.T, store database.Store) {
+	ctx := context.Background()
+	alice := mustCreateUser(t, store, "alice")
+	bob := mustCreateUser(t, store, "bob")
+
+	teamA, err := store.CreateDomain(ctx, models.Domain{Host: "go.team-a.example"})
+	if err != nil {
+		t.Fatalf("CreateDomain: %v", err)
+	}
+	if teamA.ID.IsZero() || teamA.CreatedAt.IsZero() || len(teamA.UserIDs) != 0 {
+		t.Fatalf("created domain has wrong defaults: %+v", teamA)
+	}
+	if _, err := store.CreateDomain(ctx, models.Domain{Host: "go.team-a.example"}); !errors.Is(err, database.ErrDomainTaken) {
+		t.Fatalf("CreateDomain(duplicate host) error = %v, want ErrDomainTaken", err)
+	}
+	if _, err := store.CreateDomain(ctx, models.Domain{Host: "t.brand.example"}); err != nil {
+		t.Fatalf("CreateDomain: %v", err)
+	}
+
+	found, err := store.GetDomainByHost(ctx, "go.team-a.example")
+	if err != nil || found == nil || found.ID != teamA.ID {
+		t.Fatalf("GetDomainByHost = %+v, %v; want %s", found, err, teamA.ID.Hex())
+	}
+	if found, err := store.GetDomainByHost(ctx, "unknown.example"); err != nil || found != nil {
+		t.Fatalf("GetDomainByHost(unknown) = %+v, %v; want nil, nil", found, err)
+	}
+	if found, err := store.GetDomain(ctx, primitive.NewObjectID()); err != nil || found != nil {
+		t.Fatalf("GetDomain(unknown) = %+v, %v; want nil, nil", found, err)
+	}
+
+	domains, err := store.GetDomains(ctx)
+	if err != nil || len(domains) != 2 || domains[0].Host != "go.team-a.example" || domains[1].Host != "t.brand.example" {
+		t.Fatalf("GetDomains = %+v, %v; want both domains by host", domains, err)
+	}
+
+	// Granting is idempotent
+	for i := 0; i < 2; i++ {
+		granted, err := store.GrantDomain(ctx, teamA.ID, alice)
+		if err != nil || len(granted.UserIDs) != 1 || granted.UserIDs[0] != alice {
+			t.Fatalf("GrantDomain = %+v, %v; want alice granted once", granted, err)
+		}
+	}
+	if _, err := store.GrantDomain(ctx, primitive.NewObjectID(), alice); !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("GrantDomain(unknown domain) error = %v, want ErrNotFound", err)
+	}
+
+	mine, err := store.GetDomainsByUser(ctx, alice)
+	if err != nil || len(mine) != 1 || mine[0].ID != teamA.ID {
+		t.Fatalf("GetDomainsByUser(alice) = %+v, %v; want %s", mine, err, teamA.Host)
+	}
+	none, err := store.GetDomainsByUser(ctx, bob)
+	if err != nil || none == nil || len(none) != 0 {
+		t.Fatalf("GetDomainsByUser(bob) = %+v, %v; want empty non-nil slice", none, err)
+	}
+
+	revoked, err := store.RevokeDomain(ctx, teamA.ID, alice)
+	if err != nil || len(revoked.UserIDs) != 0 {
+		t.Fatalf("RevokeDomain = %+v, %v; want no grants", revoked, err)
+	}
+	if _, err := store.RevokeDomain(ctx, teamA.ID, alice); err != nil {
+		t.Fatalf("RevokeDomain(not granted): %v", err)
+	}
+	if _, err := store.RevokeDomain(ctx, primitive.NewObjectID(), alice); !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("RevokeDomain(unknown domain) error = %v, want ErrNotFound", err)
+	}
+	if mine, _ := store.GetDomainsByUser(ctx, alice); len(mine) != 0 {
+		t.Fatalf("GetDomainsByUser after revoking = %+v, want none", mine)
+	}
+}
+
+func testSequences(t *testing.T, store database.Store) {
+	ctx := context.Background()
+
+	for want := int64(1); want <= 3; want++ {
+		got, err := store.NextSequence(ctx, "slugs")
+		if err != nil || got != want {
+			t.Fatalf("NextSequence(slugs) = %d, %v; want %d", got, err, want)
+		}
+	}
+
+	if got, err := store.NextSequence(ctx, "other"); err != nil || got != 1 {
+		t.Fatalf("NextSequence(other) = %d, %v; want 1", got, err)
+	}
+}
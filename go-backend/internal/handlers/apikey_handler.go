@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"shortlink/internal/auth"
+	"shortlink/internal/database"
+	"shortlink/internal/models"
+	"shortlink/pkg/utils"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// APIKeyHandler handles API key management endpoints
+type APIKeyHandler struct {
+	repo database.APIKeyStore
+}
+
+// NewAPIKeyHandler creates a new API key handler
+func NewAPIKeyHandler(repo database.APIKeyStore) *APIKeyHandler {
+	return &APIKeyHandler{
+		repo: repo,
+	}
+}
+
+// CreateAPIKey issues a new API key for the current user.
+// The plaintext key is only returned in this response.
+func (h *APIKeyHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	// Parse the request body
+	var req models.APIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the request
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "Key name is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Scopes) == 0 {
+		req.Scopes = auth.DefaultScopes
+	}
+	for _, scope := range req.Scopes {
+		if !auth.IsValidScope(scope) {
+			http.Error(w, "Unknown scope: "+scope, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Generate the key
+	key, prefix, err := auth.GenerateAPIKey()
+	if err != nil {
+		utils.LogError("Failed to generate API key", err)
+		http.Error(w, "Error creating API key", http.StatusInternalServerError)
+		return
+	}
+
+	apiKey, err := h.repo.CreateAPIKey(r.Context(), models.APIKey{
+		UserID:  userID,
+		Name:    req.Name,
+		Prefix:  prefix,
+		KeyHash: auth.HashToken(key),
+		Scopes:  req.Scopes,
+	})
+	if err != nil {
+		http.Error(w, "Error creating API key", http.StatusInternalServerError)
+		return
+	}
+
+	// Return the created key
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.APIKeyResponse{APIKey: *apiKey, Key: key})
+}
+
+// GetAPIKeys lists the current user's API keys
+func (h *APIKeyHandler) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	apiKeys, err := h.repo.GetAPIKeysByUser(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Error retrieving API keys", http.StatusInternalServerError)
+		return
+	}
+
+	// Return the keys
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(apiKeys)
+}
+
+// RevokeAPIKey revokes one of the current user's API keys
+func (h *APIKeyHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	// Convert string ID to ObjectID
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+
+	err = h.repo.RevokeAPIKey(r.Context(), id, userID)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			http.Error(w, "API key not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error revoking API key", http.StatusInternalServerError)
+		return
+	}
+
+	// Return success message
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "API key revoked successfully"})
+}
+
+// sessionUser returns the user ID of a session-authenticated request.
+// API keys cannot manage other API keys, so key-authenticated requests are rejected.
+func (h *APIKeyHandler) sessionUser(w http.ResponseWriter, r *http.Request) (primitive.ObjectID, bool) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return primitive.NilObjectID, false
+	}
+	if _, restricted := auth.ScopesFromContext(r.Context()); restricted {
+		http.Error(w, "API keys cannot be managed with an API key", http.StatusForbidden)
+		return primitive.NilObjectID, false
+	}
+	return userID, true
+}
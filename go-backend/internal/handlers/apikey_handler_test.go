@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"shortlink/internal/auth"
+	"shortlink/internal/database"
+	"shortlink/internal/models"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCreateAPIKey(t *testing.T) {
+	userID := primitive.NewObjectID()
+	session := auth.WithUserID(context.Background(), userID)
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		body   string
+		status int
+		scopes []string
+	}{
+		{"default scopes", session, `{"name":"ci"}`, http.StatusCreated, auth.DefaultScopes},
+		{"chosen scopes", session, `{"name":"ci","scopes":["read","analytics"]}`, http.StatusCreated, []string{auth.ScopeRead, auth.ScopeAnalytics}},
+		{"unknown scope", session, `{"name":"ci","scopes":["read","admin"]}`, http.StatusBadRequest, nil},
+		{"no name", session, `{"name":"  "}`, http.StatusBadRequest, nil},
+		{"anonymous", context.Background(), `{"name":"ci"}`, http.StatusUnauthorized, nil},
+		{"with an API key", auth.WithScopes(session, auth.AllScopes), `{"name":"ci"}`, http.StatusForbidden, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := database.NewMemoryRepository()
+			h := NewAPIKeyHandler(repo)
+			w := httptest.NewRecorder()
+			h.CreateAPIKey(w, httptest.NewRequest(http.MethodPost, "/api/keys", strings.NewReader(tt.body)).WithContext(tt.ctx))
+
+			if w.Code != tt.status {
+				t.Fatalf("CreateAPIKey = %d %s, want %d", w.Code, w.Body, tt.status)
+			}
+			if tt.status != http.StatusCreated {
+				return
+			}
+
+			var response models.APIKeyResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("decoding the response: %v", err)
+			}
+			if !auth.IsAPIKey(response.Key) || !strings.HasPrefix(response.Key, response.Prefix) || strings.Join(response.Scopes, ",") != strings.Join(tt.scopes, ",") {
+				t.Fatalf("CreateAPIKey = %+v, want a key with scopes %q", response, tt.scopes)
+			}
+
+			// Only the hash is kept
+			stored, err := repo.GetAPIKeyByHash(context.Background(), auth.HashToken(response.Key))
+			if err != nil || stored == nil || stored.UserID != userID {
+				t.Fatalf("GetAPIKeyByHash = %+v, %v, want the new key", stored, err)
+			}
+			if stored.KeyHash == response.Key {
+				t.Fatalf("the key was stored in clear text")
+			}
+		})
+	}
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	ctx := context.Background()
+	repo := database.NewMemoryRepository()
+	h := NewAPIKeyHandler(repo)
+	owner, other := primitive.NewObjectID(), primitive.NewObjectID()
+	apiKey, err := repo.CreateAPIKey(ctx, models.APIKey{UserID: owner, Name: "ci", KeyHash: "revoke-test-hash", Scopes: auth.DefaultScopes})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+
+	revoke := func(ctx context.Context, id string) int {
+		r := httptest.NewRequest(http.MethodDelete, "/api/keys/"+id, nil).WithContext(ctx)
+		r = mux.SetURLVars(r, map[string]string{"id": id})
+		w := httptest.NewRecorder()
+		h.RevokeAPIKey(w, r)
+		return w.Code
+	}
+
+	if status := revoke(auth.WithUserID(ctx, other), apiKey.ID.Hex()); status != http.StatusNotFound {
+		t.Fatalf("revoking another user's key = %d, want %d", status, http.StatusNotFound)
+	}
+	if status := revoke(auth.WithScopes(auth.WithUserID(ctx, owner), auth.AllScopes), apiKey.ID.Hex()); status != http.StatusForbidden {
+		t.Fatalf("revoking with an API key = %d, want %d", status, http.StatusForbidden)
+	}
+	if status := revoke(auth.WithUserID(ctx, owner), "not-an-id"); status != http.StatusBadRequest {
+		t.Fatalf("revoking an invalid ID = %d, want %d", status, http.StatusBadRequest)
+	}
+	if status := revoke(auth.WithUserID(ctx, owner), apiKey.ID.Hex()); status != http.StatusOK {
+		t.Fatalf("revoking the key = %d, want %d", status, http.StatusOK)
+	}
+	if stored, _ := repo.GetAPIKeyByHash(ctx, "revoke-test-hash"); stored != nil {
+		t.Fatalf("GetAPIKeyByHash found the key after it was revoked")
+	}
+	if status := revoke(auth.WithUserID(ctx, owner), apiKey.ID.Hex()); status != http.StatusNotFound {
+		t.Fatalf("revoking the key again = %d, want %d", status, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"shortlink/internal/auth"
+	"shortlink/internal/database"
+	"shortlink/internal/models"
+	"shortlink/pkg/utils"
+	"strings"
+	"time"
+)
+
+// Credential length limits, matching the client-side validation
+const (
+	minUsernameLength = 3
+	maxUsernameLength = 50
+	minPasswordLength = 6
+)
+
+// AuthHandler handles user registration and login endpoints
+type AuthHandler struct {
+	repo database.UserStore
+}
+
+// NewAuthHandler creates a new auth handler
+func NewAuthHandler(repo database.UserStore) *AuthHandler {
+	return &AuthHandler{
+		repo: repo,
+	}
+}
+
+// Register creates a new user account and logs it in
+func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
+	// Parse the request body
+	var req models.AuthRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the request
+	req.Username = strings.TrimSpace(req.Username)
+	if len(req.Username) < minUsernameLength || len(req.Username) > maxUsernameLength {
+		http.Error(w, "Username must be between 3 and 50 characters", http.StatusBadRequest)
+		return
+	}
+	if len(req.Password) < minPasswordLength {
+		http.Error(w, "Password must be at least 6 characters", http.StatusBadRequest)
+		return
+	}
+	if len(req.Password) > auth.MaxPasswordLength {
+		http.Error(w, "Password must be at most 72 bytes", http.StatusBadRequest)
+		return
+	}
+
+	// Hash the password
+	passwordHash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		utils.LogError("Failed to hash password", err)
+		http.Error(w, "Error creating user", http.StatusInternalServerError)
+		return
+	}
+
+	// Save the user; registering never grants more than the user role
+	user, err := h.repo.CreateUser(r.Context(), models.User{
+		Username:     req.Username,
+		PasswordHash: passwordHash,
+		Role:         models.RoleUser,
+	})
+	if err != nil {
+		if errors.Is(err, database.ErrUsernameTaken) {
+			http.Error(w, "Username already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Error creating user", http.StatusInternalServerError)
+		return
+	}
+
+	if !h.startSession(w, r, user) {
+		return
+	}
+
+	// Return the created user
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(user)
+}
+
+// Login verifies a username and password and starts a session
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	// Parse the request body
+	var req models.AuthRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Look up the user
+	user, err := h.repo.GetUserByUsername(r.Context(), strings.TrimSpace(req.Username))
+	if err != nil {
+		http.Error(w, "Error retrieving user", http.StatusInternalServerError)
+		return
+	}
+
+	// Use the same response, taking the same time, for unknown users and wrong passwords
+	passwordHash := auth.DummyPasswordHash()
+	if user != nil {
+		passwordHash = user.PasswordHash
+	}
+	if !auth.CheckPassword(passwordHash, req.Password) || user == nil {
+		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		return
+	}
+
+	if !h.startSession(w, r, user) {
+		return
+	}
+
+	// Return the logged-in user
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// Logout ends the current session
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	if token := auth.TokenFromRequest(r); token != "" {
+		if err := h.repo.DeleteSession(r.Context(), auth.HashToken(token)); err != nil {
+			http.Error(w, "Error ending session", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	auth.ClearSessionCookie(w, r)
+
+	// Return success message
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out successfully"})
+}
+
+// CurrentUser returns the authenticated user
+func (h *AuthHandler) CurrentUser(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := h.repo.GetUserByID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Error retrieving user", http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Return the user
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// startSession creates a session for user and sets its cookie.
+// It writes an error response and returns false on failure.
+func (h *AuthHandler) startSession(w http.ResponseWriter, r *http.Request, user *models.User) bool {
+	token, err := auth.GenerateToken()
+	if err != nil {
+		utils.LogError("Failed to generate session token", err)
+		http.Error(w, "Error creating session", http.StatusInternalServerError)
+		return false
+	}
+
+	session := models.Session{
+		UserID:    user.ID,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: time.Now().Add(auth.SessionDuration),
+	}
+	if _, err := h.repo.CreateSession(r.Context(), session); err != nil {
+		http.Error(w, "Error creating session", http.StatusInternalServerError)
+		return false
+	}
+
+	auth.SetSessionCookie(w, r, token, session.ExpiresAt)
+	return true
+}
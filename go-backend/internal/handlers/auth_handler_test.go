@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"shortlink/internal/auth"
+	"shortlink/internal/database"
+	"shortlink/internal/models"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// postJSON calls handler with body, as userID unless it is nil, and with the given cookies
+func postJSON(handler http.HandlerFunc, body string, userID primitive.ObjectID, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/api/auth", strings.NewReader(body))
+	if !userID.IsZero() {
+		r = r.WithContext(auth.WithUserID(r.Context(), userID))
+	}
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+// sessionCookie returns the session cookie set on w, or nil
+func sessionCookie(w *httptest.ResponseRecorder) *http.Cookie {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == auth.SessionCookieName {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func TestRegisterValidation(t *testing.T) {
+	h := NewAuthHandler(database.NewMemoryRepository())
+	if w := postJSON(h.Register, `{"username":"taken","password":"password123"}`, primitive.NilObjectID); w.Code != http.StatusCreated {
+		t.Fatalf("Register = %d %s", w.Code, w.Body)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"invalid body", `{"username":`, http.StatusBadRequest},
+		{"short username", `{"username":"ab","password":"password123"}`, http.StatusBadRequest},
+		{"username of spaces", `{"username":"    ","password":"password123"}`, http.StatusBadRequest},
+		{"long username", `{"username":"` + strings.Repeat("a", maxUsernameLength+1) + `","password":"password123"}`, http.StatusBadRequest},
+		{"short password", `{"username":"newuser","password":"12345"}`, http.StatusBadRequest},
+		{"long password", `{"username":"newuser","password":"` + strings.Repeat("a", auth.MaxPasswordLength+1) + `"}`, http.StatusBadRequest},
+		{"long multibyte password", `{"username":"newuser","password":"` + strings.Repeat("é", auth.MaxPasswordLength/2+1) + `"}`, http.StatusBadRequest},
+		{"taken username", `{"username":"taken","password":"password123"}`, http.StatusConflict},
+		{"taken username with spaces", `{"username":" taken ","password":"password123"}`, http.StatusConflict},
+	}
+
+	longest := `{"username":"longest","password":"` + strings.Repeat("a", auth.MaxPasswordLength) + `"}`
+	if w := postJSON(h.Register, longest, primitive.NilObjectID); w.Code != http.StatusCreated {
+		t.Fatalf("Register with a %d-byte password = %d %s", auth.MaxPasswordLength, w.Code, w.Body)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postJSON(h.Register, tt.body, primitive.NilObjectID)
+			if w.Code != tt.status {
+				t.Fatalf("Register = %d %s, want %d", w.Code, w.Body, tt.status)
+			}
+			if sessionCookie(w) != nil {
+				t.Fatalf("Register set a session cookie for a rejected account")
+			}
+		})
+	}
+}
+
+func TestRegisterLoginLogout(t *testing.T) {
+	repo := database.NewMemoryRepository()
+	h := NewAuthHandler(repo)
+	middleware := auth.NewMiddleware(repo)
+
+	w := postJSON(h.Register, `{"username":"alice","password":"password123"}`, primitive.NilObjectID)
+	if w.Code != http.StatusCreated || sessionCookie(w) == nil {
+		t.Fatalf("Register = %d %s, want 201 with a session cookie", w.Code, w.Body)
+	}
+	var user models.User
+	if err := json.NewDecoder(w.Body).Decode(&user); err != nil || user.Username != "alice" || user.ID.IsZero() || user.Role != models.RoleUser {
+		t.Fatalf("Register returned %+v, %v", user, err)
+	}
+	if strings.Contains(w.Body.String(), "password") {
+		t.Fatalf("Register response %s includes the password hash", w.Body)
+	}
+
+	// The cookie from registering resolves to the new user
+	currentUser := middleware.Authenticate(http.HandlerFunc(h.CurrentUser))
+	r := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+	r.AddCookie(sessionCookie(w))
+	me := httptest.NewRecorder()
+	currentUser.ServeHTTP(me, r)
+	if me.Code != http.StatusOK || !strings.Contains(me.Body.String(), user.ID.Hex()) {
+		t.Fatalf("CurrentUser = %d %s, want alice", me.Code, me.Body)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"right password", `{"username":"alice","password":"password123"}`, http.StatusOK},
+		{"username with spaces", `{"username":" alice ","password":"password123"}`, http.StatusOK},
+		{"wrong password", `{"username":"alice","password":"password124"}`, http.StatusUnauthorized},
+		{"unknown user", `{"username":"mallory","password":"password123"}`, http.StatusUnauthorized},
+		{"invalid body", `{`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postJSON(h.Login, tt.body, primitive.NilObjectID)
+			if w.Code != tt.status || (sessionCookie(w) != nil) != (tt.status == http.StatusOK) {
+				t.Fatalf("Login = %d %s, want %d", w.Code, w.Body, tt.status)
+			}
+		})
+	}
+
+	// Logging out ends the session and clears the cookie
+	login := postJSON(h.Login, `{"username":"alice","password":"password123"}`, primitive.NilObjectID)
+	logout := postJSON(h.Logout, "", primitive.NilObjectID, sessionCookie(login))
+	if logout.Code != http.StatusOK || sessionCookie(logout) == nil || sessionCookie(logout).MaxAge >= 0 {
+		t.Fatalf("Logout = %d, cookie %+v, want the cookie cleared", logout.Code, sessionCookie(logout))
+	}
+	r = httptest.NewRequest(http.MethodGet, "/api/me", nil)
+	r.AddCookie(sessionCookie(login))
+	me = httptest.NewRecorder()
+	currentUser.ServeHTTP(me, r)
+	if me.Code != http.StatusUnauthorized {
+		t.Fatalf("CurrentUser after logout = %d, want %d", me.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"shortlink/internal/models"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxScheduleWindows bounds how many windows a single schedule may have
+const maxScheduleWindows = 50
+
+// weekdays maps the accepted day names to the names stored in schedules
+var weekdays = map[string]string{
+	"sun": "sun", "sunday": "sun",
+	"mon": "mon", "monday": "mon",
+	"tue": "tue", "tuesday": "tue",
+	"wed": "wed", "wednesday": "wed",
+	"thu": "thu", "thursday": "thu",
+	"fri": "fri", "friday": "fri",
+	"sat": "sat", "saturday": "sat",
+}
+
+// weekdayNames are the stored day names, indexed by time.Weekday
+var weekdayNames = [...]string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// AvailabilityConfig holds the responses served when a link can't be followed
+// and has no fallback URL
+type AvailabilityConfig struct {
+	// UnavailableStatus and UnavailableMessage are served outside the link's availability window
+	UnavailableStatus  int
+	UnavailableMessage string
+
+	// ExhaustedStatus and ExhaustedMessage are served once the link has used up its clicks
+	ExhaustedStatus  int
+	ExhaustedMessage string
+}
+
+// AvailabilityConfigFromEnv reads the responses from environment variables
+func AvailabilityConfigFromEnv() AvailabilityConfig {
+	cfg := AvailabilityConfig{
+		UnavailableStatus:  http.StatusForbidden,
+		UnavailableMessage: "This link is not available right now",
+		ExhaustedStatus:    http.StatusGone,
+		ExhaustedMessage:   "This link has reached its click limit",
+	}
+
+	if status, err := strconv.Atoi(os.Getenv("LINK_UNAVAILABLE_STATUS")); err == nil && status >= 400 && status <= 599 {
+		cfg.UnavailableStatus = status
+	}
+	if message := os.Getenv("LINK_UNAVAILABLE_MESSAGE"); message != "" {
+		cfg.UnavailableMessage = message
+	}
+	if status, err := strconv.Atoi(os.Getenv("LINK_EXHAUSTED_STATUS")); err == nil && status >= 400 && status <= 599 {
+		cfg.ExhaustedStatus = status
+	}
+	if message := os.Getenv("LINK_EXHAUSTED_MESSAGE"); message != "" {
+		cfg.ExhaustedMessage = message
+	}
+
+	return cfg
+}
+
+// available reports whether shortURL is inside its availability window at t:
+// it has reached its activation time, and its schedule, if any, is open
+func available(shortURL *models.ShortURL, t time.Time) bool {
+	if shortURL.ActivateAt != nil && t.Before(*shortURL.ActivateAt) {
+		return false
+	}
+	if shortURL.Schedule == nil {
+		return true
+	}
+	return scheduleOpen(shortURL.Schedule, t)
+}
+
+// scheduleOpen reports whether t falls in one of the schedule's windows
+func scheduleOpen(schedule *models.Schedule, t time.Time) bool {
+	location, err := loadLocation(schedule.TimeZone)
+	if err != nil {
+		// Zones are checked on save, so this only happens if one is withdrawn
+		return false
+	}
+
+	local := t.In(location)
+	minute := local.Hour()*60 + local.Minute()
+	today := weekdayNames[local.Weekday()]
+	yesterday := weekdayNames[(local.Weekday()+6)%7]
+
+	for _, window := range schedule.Windows {
+		start, err := parseClock(window.Start)
+		if err != nil {
+			continue
+		}
+		end, err := parseClock(window.End)
+		if err != nil {
+			continue
+		}
+
+		if start < end {
+			if onDay(window.Days, today) && minute >= start && minute < end {
+				return true
+			}
+			continue
+		}
+
+		// Overnight windows finish on the day after they start
+		if onDay(window.Days, today) && minute >= start {
+			return true
+		}
+		if onDay(window.Days, yesterday) && minute < end {
+			return true
+		}
+	}
+	return false
+}
+
+// onDay reports whether day is one of days; no days means every day
+func onDay(days []string, day string) bool {
+	if len(days) == 0 {
+		return true
+	}
+	for _, d := range days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeSchedule checks schedule and returns it with day names in their
+// stored form. A schedule without windows is returned as nil, meaning none.
+// The error messages are safe to show to API clients.
+func normalizeSchedule(schedule *models.Schedule) (*models.Schedule, error) {
+	if schedule == nil || len(schedule.Windows) == 0 {
+		return nil, nil
+	}
+	if len(schedule.Windows) > maxScheduleWindows {
+		return nil, fmt.Errorf("a schedule can have at most %d windows", maxScheduleWindows)
+	}
+
+	timeZone := strings.TrimSpace(schedule.TimeZone)
+	if _, err := loadLocation(timeZone); err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", schedule.TimeZone)
+	}
+
+	normalized := &models.Schedule{
+		TimeZone: timeZone,
+		Windows:  make([]models.ScheduleWindow, 0, len(schedule.Windows)),
+	}
+	for _, window := range schedule.Windows {
+		start, err := parseClock(window.Start)
+		if err != nil || start == 24*60 {
+			return nil, fmt.Errorf("invalid window start %q; use HH:MM", window.Start)
+		}
+		end, err := parseClock(window.End)
+		if err != nil {
+			return nil, fmt.Errorf("invalid window end %q; use HH:MM", window.End)
+		}
+		if start == end {
+			// Such a window could mean all day or not at all; 00:00 to 24:00 says the former
+			return nil, fmt.Errorf("window starts and ends at %s; use 00:00 to 24:00 for a whole day", window.Start)
+		}
+
+		var days []string
+		for _, day := range window.Days {
+			name, ok := weekdays[strings.ToLower(strings.TrimSpace(day))]
+			if !ok {
+				return nil, fmt.Errorf("invalid day %q; use mon to sun", day)
+			}
+			days = append(days, name)
+		}
+
+		normalized.Windows = append(normalized.Windows, models.ScheduleWindow{
+			Days:  days,
+			Start: window.Start,
+			End:   window.End,
+		})
+	}
+
+	return normalized, nil
+}
+
+// parseClock parses an "HH:MM" time of day into minutes after midnight.
+// "24:00" is accepted so that windows can run to the end of the day.
+func parseClock(value string) (int, error) {
+	hours, minutes, ok := strings.Cut(value, ":")
+	if !ok || len(hours) != 2 || len(minutes) != 2 {
+		return 0, errors.New("invalid time of day")
+	}
+	h, err := strconv.Atoi(hours)
+	if err != nil {
+		return 0, err
+	}
+	m, err := strconv.Atoi(minutes)
+	if err != nil {
+		return 0, err
+	}
+	if h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, errors.New("invalid time of day")
+	}
+	return h*60 + m, nil
+}
+
+// locations caches time zones by name, as loading one reads the zone database
+var locations sync.Map
+
+// loadLocation is time.LoadLocation with a cache
+func loadLocation(name string) (*time.Location, error) {
+	if location, ok := locations.Load(name); ok {
+		return location.(*time.Location), nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, location)
+	return location, nil
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"shortlink/internal/database"
+	"shortlink/internal/models"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestScheduleOpen(t *testing.T) {
+	// 2024-01-01 was a Monday
+	at := func(value string) time.Time {
+		t.Helper()
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatalf("time.Parse(%q): %v", value, err)
+		}
+		return parsed
+	}
+	weekdays := []models.ScheduleWindow{{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "17:00"}}
+	overnight := []models.ScheduleWindow{{Days: []string{"fri"}, Start: "22:00", End: "02:00"}}
+
+	tests := []struct {
+		name     string
+		schedule models.Schedule
+		t        time.Time
+		want     bool
+	}{
+		{"inside a window", models.Schedule{Windows: weekdays}, at("2024-01-01T12:00:00Z"), true},
+		{"at the start", models.Schedule{Windows: weekdays}, at("2024-01-01T09:00:00Z"), true},
+		{"at the end", models.Schedule{Windows: weekdays}, at("2024-01-01T17:00:00Z"), false},
+		{"before the start", models.Schedule{Windows: weekdays}, at("2024-01-01T08:59:59Z"), false},
+		{"on another day", models.Schedule{Windows: weekdays}, at("2024-01-06T12:00:00Z"), false},
+		{"every day", models.Schedule{Windows: []models.ScheduleWindow{{Start: "00:00", End: "24:00"}}}, at("2024-01-07T23:59:00Z"), true},
+		{"overnight before midnight", models.Schedule{Windows: overnight}, at("2024-01-05T23:00:00Z"), true},
+		{"overnight after midnight", models.Schedule{Windows: overnight}, at("2024-01-06T01:59:00Z"), true},
+		{"overnight on the wrong night", models.Schedule{Windows: overnight}, at("2024-01-07T01:00:00Z"), false},
+		{"overnight after the end", models.Schedule{Windows: overnight}, at("2024-01-06T02:00:00Z"), false},
+		{"second window", models.Schedule{Windows: append([]models.ScheduleWindow{{Start: "06:00", End: "07:00"}}, weekdays...)}, at("2024-01-06T06:30:00Z"), true},
+		{"no windows", models.Schedule{}, at("2024-01-01T12:00:00Z"), false},
+		{"time zone ahead of UTC", models.Schedule{TimeZone: "Asia/Tokyo", Windows: weekdays}, at("2024-01-01T01:00:00Z"), true},
+		{"time zone behind UTC", models.Schedule{TimeZone: "America/New_York", Windows: weekdays}, at("2024-01-01T12:00:00Z"), false},
+		{"time zone moves the day", models.Schedule{TimeZone: "America/New_York", Windows: weekdays}, at("2024-01-06T01:00:00Z"), false},
+		{"winter time", models.Schedule{TimeZone: "Europe/Berlin", Windows: weekdays}, at("2024-03-29T15:30:00Z"), true},
+		{"summer time", models.Schedule{TimeZone: "Europe/Berlin", Windows: weekdays}, at("2024-04-01T15:30:00Z"), false},
+		{"unknown time zone", models.Schedule{TimeZone: "Mars/Olympus", Windows: weekdays}, at("2024-01-01T12:00:00Z"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scheduleOpen(&tt.schedule, tt.t); got != tt.want {
+				t.Fatalf("scheduleOpen(%s) = %v, want %v", tt.t.Format(time.RFC3339), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAvailable(t *testing.T) {
+	now := time.Now()
+	later := now.Add(time.Hour)
+	closed := &models.Schedule{Windows: []models.ScheduleWindow{{Days: []string{weekdayNames[(now.UTC().Weekday()+3)%7]}, Start: "00:00", End: "24:00"}}}
+
+	tests := []struct {
+		name     string
+		shortURL models.ShortURL
+		want     bool
+	}{
+		{"no limits", models.ShortURL{}, true},
+		{"activated", models.ShortURL{ActivateAt: &now}, true},
+		{"waiting to activate", models.ShortURL{ActivateAt: &later}, false},
+		{"schedule closed", models.ShortURL{Schedule: closed}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := available(&tt.shortURL, now); got != tt.want {
+				t.Fatalf("available = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeSchedule(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule *models.Schedule
+		want     *models.Schedule
+		err      string
+	}{
+		{"none", nil, nil, ""},
+		{"no windows", &models.Schedule{TimeZone: "UTC"}, nil, ""},
+		{
+			"day names",
+			&models.Schedule{TimeZone: " Europe/Berlin ", Windows: []models.ScheduleWindow{{Days: []string{"Monday", " FRI "}, Start: "09:00", End: "17:30"}}},
+			&models.Schedule{TimeZone: "Europe/Berlin", Windows: []models.ScheduleWindow{{Days: []string{"mon", "fri"}, Start: "09:00", End: "17:30"}}},
+			"",
+		},
+		{
+			"whole day",
+			&models.Schedule{Windows: []models.ScheduleWindow{{Start: "00:00", End: "24:00"}}},
+			&models.Schedule{Windows: []models.ScheduleWindow{{Start: "00:00", End: "24:00"}}},
+			"",
+		},
+		{
+			"overnight",
+			&models.Schedule{Windows: []models.ScheduleWindow{{Start: "22:00", End: "02:00"}}},
+			&models.Schedule{Windows: []models.ScheduleWindow{{Start: "22:00", End: "02:00"}}},
+			"",
+		},
+		{"unknown time zone", &models.Schedule{TimeZone: "Mars/Olympus", Windows: []models.ScheduleWindow{{Start: "09:00", End: "17:00"}}}, nil, "unknown time zone"},
+		{"start of 24:00", &models.Schedule{Windows: []models.ScheduleWindow{{Start: "24:00", End: "02:00"}}}, nil, "invalid window start"},
+		{"start without minutes", &models.Schedule{Windows: []models.ScheduleWindow{{Start: "9", End: "17:00"}}}, nil, "invalid window start"},
+		{"end past midnight", &models.Schedule{Windows: []models.ScheduleWindow{{Start: "09:00", End: "24:01"}}}, nil, "invalid window end"},
+		{"minutes out of range", &models.Schedule{Windows: []models.ScheduleWindow{{Start: "09:00", End: "17:60"}}}, nil, "invalid window end"},
+		{"empty window", &models.Schedule{Windows: []models.ScheduleWindow{{Start: "09:00", End: "09:00"}}}, nil, "starts and ends at 09:00"},
+		{"unknown day", &models.Schedule{Windows: []models.ScheduleWindow{{Days: []string{"someday"}, Start: "09:00", End: "17:00"}}}, nil, "invalid day"},
+		{"too many windows", &models.Schedule{Windows: make([]models.ScheduleWindow, maxScheduleWindows+1)}, nil, "at most"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeSchedule(tt.schedule)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("normalizeSchedule error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("normalizeSchedule: %v", err)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && !sameSchedule(got, tt.want)) {
+				t.Fatalf("normalizeSchedule = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// sameSchedule reports whether a and b have the same time zone and windows
+func sameSchedule(a, b *models.Schedule) bool {
+	if a.TimeZone != b.TimeZone || len(a.Windows) != len(b.Windows) {
+		return false
+	}
+	for i := range a.Windows {
+		x, y := a.Windows[i], b.Windows[i]
+		if x.Start != y.Start || x.End != y.End || strings.Join(x.Days, ",") != strings.Join(y.Days, ",") {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRedirectOutsideAvailability(t *testing.T) {
+	later := time.Now().Add(time.Hour)
+	closed := &models.Schedule{Windows: []models.ScheduleWindow{{Days: []string{weekdayNames[(time.Now().UTC().Weekday()+3)%7]}, Start: "00:00", End: "24:00"}}}
+
+	tests := []struct {
+		name     string
+		shortURL models.ShortURL
+		status   int
+		location string
+	}{
+		{"open", models.ShortURL{}, http.StatusTemporaryRedirect, "https://example.com/"},
+		{"schedule closed with a fallback", models.ShortURL{Schedule: closed, FallbackURL: "https://example.com/closed"}, http.StatusTemporaryRedirect, "https://example.com/closed"},
+		{"schedule closed", models.ShortURL{Schedule: closed}, http.StatusForbidden, ""},
+		{"waiting to activate with a fallback", models.ShortURL{ActivateAt: &later, FallbackURL: "https://example.com/soon"}, http.StatusTemporaryRedirect, "https://example.com/soon"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := database.NewMemoryRepository()
+			h := newTestURLHandler(t, repo)
+			h.availability = AvailabilityConfig{UnavailableStatus: http.StatusForbidden, UnavailableMessage: "Not now"}
+
+			link := tt.shortURL
+			link.UserID = primitive.NewObjectID()
+			link.Slug = "window"
+			link.OriginalURL = "https://example.com/"
+			link.Active = true
+			if _, err := repo.CreateShortURL(context.Background(), link); err != nil {
+				t.Fatalf("CreateShortURL: %v", err)
+			}
+
+			w := serve(h.RedirectShortURL, http.MethodGet, "/window", "", primitive.NilObjectID, map[string]string{"slug": "window"})
+			if w.Code != tt.status || w.Header().Get("Location") != tt.location {
+				t.Fatalf("RedirectShortURL = %d to %q, want %d to %q", w.Code, w.Header().Get("Location"), tt.status, tt.location)
+			}
+		})
+	}
+}
+
+func TestStartsAtRejected(t *testing.T) {
+	repo := database.NewMemoryRepository()
+	h := newTestURLHandler(t, repo)
+	userID := primitive.NewObjectID()
+
+	body := `{"originalUrl":"https://example.com/","startsAt":"2030-01-01T00:00:00Z"}`
+	if w := serve(h.CreateShortURL, http.MethodPost, "/api/urls", body, userID, nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("CreateShortURL with startsAt = %d %s, want %d", w.Code, w.Body, http.StatusBadRequest)
+	}
+
+	link, err := repo.CreateShortURL(context.Background(), models.ShortURL{UserID: userID, Slug: "starts", OriginalURL: "https://example.com/", Active: true})
+	if err != nil {
+		t.Fatalf("CreateShortURL: %v", err)
+	}
+	if w := serve(h.UpdateShortURL, http.MethodPatch, "/api/urls/"+link.ID.Hex(), `{"startsAt":null}`, userID, map[string]string{"id": link.ID.Hex()}); w.Code != http.StatusBadRequest {
+		t.Fatalf("UpdateShortURL with startsAt = %d %s, want %d", w.Code, w.Body, http.StatusBadRequest)
+	}
+}
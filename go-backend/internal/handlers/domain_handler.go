@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"shortlink/internal/auth"
+	"shortlink/internal/database"
+	"shortlink/internal/models"
+	"shortlink/internal/policy"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/sync/singleflight"
+)
+
+// domainCacheTTL is how long the list of domains is cached. A domain
+// registered through another server instance is served here within this time.
+const domainCacheTTL = 30 * time.Second
+
+// domainHostPattern matches a lowercase host name with at least two labels
+var domainHostPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// Domains looks up the branded domains short links are served on. Redirects
+// resolve hosts from a cached list, so they don't each query the store; the
+// list is reloaded every domainCacheTTL and whenever this server changes it.
+// Concurrent reloads share one query, and no lock is held while it runs.
+type Domains struct {
+	repo    database.DomainStore
+	loading singleflight.Group
+
+	mu         sync.RWMutex
+	hosts      map[string]models.Domain
+	expires    time.Time
+	generation int
+}
+
+// NewDomains creates a domain lookup backed by repo
+func NewDomains(repo database.DomainStore) *Domains {
+	return &Domains{
+		repo: repo,
+	}
+}
+
+// lookup returns the branded domain for host, which may include a port, or
+// nil if host isn't one
+func (d *Domains) lookup(ctx context.Context, host string) (*models.Domain, error) {
+	d.mu.RLock()
+	hosts := d.hosts
+	if time.Now().After(d.expires) {
+		hosts = nil
+	}
+	d.mu.RUnlock()
+
+	if hosts == nil {
+		var err error
+		hosts, err = d.reload(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	domain, ok := hosts[policy.HostWithoutPort(host)]
+	if !ok {
+		return nil, nil
+	}
+	return &domain, nil
+}
+
+// reload reads the domains from the store and caches them, unless they were
+// invalidated while the query ran, in which case the next lookup reloads again
+func (d *Domains) reload(ctx context.Context) (map[string]models.Domain, error) {
+	d.mu.RLock()
+	generation := d.generation
+	d.mu.RUnlock()
+
+	loaded, err, _ := d.loading.Do(strconv.Itoa(generation), func() (interface{}, error) {
+		domains, err := d.repo.GetDomains(ctx)
+		if err != nil {
+			return nil, err
+		}
+		hosts := make(map[string]models.Domain, len(domains))
+		for _, domain := range domains {
+			hosts[domain.Host] = domain
+		}
+
+		d.mu.Lock()
+		if d.generation == generation {
+			d.hosts = hosts
+			d.expires = time.Now().Add(domainCacheTTL)
+		}
+		d.mu.Unlock()
+		return hosts, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return loaded.(map[string]models.Domain), nil
+}
+
+// grantedTo returns the branded domain for host if userID may create links on
+// it, and nil otherwise. It reads the store rather than the cache, so grants
+// and revocations apply at once.
+func (d *Domains) grantedTo(ctx context.Context, host string, userID primitive.ObjectID) (*models.Domain, error) {
+	domain, err := d.repo.GetDomainByHost(ctx, policy.HostWithoutPort(host))
+	if err != nil || domain == nil {
+		return nil, err
+	}
+	for _, granted := range domain.UserIDs {
+		if granted == userID {
+			return domain, nil
+		}
+	}
+	return nil, nil
+}
+
+// invalidate makes the next lookup reload the domains
+func (d *Domains) invalidate() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.hosts = nil
+	d.generation++
+}
+
+// DomainHandler handles branded domain endpoints
+type DomainHandler struct {
+	repo    database.Store
+	domains *Domains
+	policy  *policy.Engine
+}
+
+// NewDomainHandler creates a new domain handler. Hosts that policy treats as
+// the service's own can't be registered, as they serve the default domain.
+func NewDomainHandler(repo database.Store, domains *Domains, policy *policy.Engine) *DomainHandler {
+	return &DomainHandler{
+		repo:    repo,
+		domains: domains,
+		policy:  policy,
+	}
+}
+
+// GetDomains lists the domains the current user may create links on
+func (h *DomainHandler) GetDomains(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	domains, err := h.repo.GetDomainsByUser(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Error retrieving domains", http.StatusInternalServerError)
+		return
+	}
+
+	// Users don't get to see who else shares a domain
+	for i := range domains {
+		domains[i].UserIDs = nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(domains)
+}
+
+// GetAllDomains lists every branded domain with its grants.
+// The route must be guarded by an admin check.
+func (h *DomainHandler) GetAllDomains(w http.ResponseWriter, r *http.Request) {
+	domains, err := h.repo.GetDomains(r.Context())
+	if err != nil {
+		http.Error(w, "Error retrieving domains", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(domains)
+}
+
+// CreateDomain registers a branded domain. Its DNS must point at this service
+// for links on it to work. The route must be guarded by an admin check.
+func (h *DomainHandler) CreateDomain(w http.ResponseWriter, r *http.Request) {
+	// Parse the request body
+	var req models.DomainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the host
+	host := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(req.Host)), ".")
+	if len(host) > 253 || !domainHostPattern.MatchString(host) {
+		http.Error(w, "Invalid host. Use a host name such as go.example.com, without a scheme or port", http.StatusBadRequest)
+		return
+	}
+	if h.policy.ServiceHost(host) {
+		http.Error(w, "This host already serves the default domain", http.StatusConflict)
+		return
+	}
+
+	domain, err := h.repo.CreateDomain(r.Context(), models.Domain{Host: host})
+	if err != nil {
+		if errors.Is(err, database.ErrDomainTaken) {
+			http.Error(w, "Domain already registered", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Error creating domain", http.StatusInternalServerError)
+		return
+	}
+	h.domains.invalidate()
+
+	// Return the created domain
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(domain)
+}
+
+// GrantDomain lets a user, named in the request body, create links on a domain.
+// The route must be guarded by an admin check.
+func (h *DomainHandler) GrantDomain(w http.ResponseWriter, r *http.Request) {
+	// Get ID from URL parameters
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+
+	// Parse the request body
+	var req models.DomainGrantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Find the user to grant the domain to
+	user, err := h.repo.GetUserByUsername(r.Context(), strings.TrimSpace(req.Username))
+	if err != nil {
+		http.Error(w, "Error retrieving user", http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	domain, err := h.repo.GrantDomain(r.Context(), id, user.ID)
+	h.writeGrantResult(w, domain, err)
+}
+
+// RevokeDomain stops a user creating links on a domain. Links the user
+// already made there keep working. The route must be guarded by an admin check.
+func (h *DomainHandler) RevokeDomain(w http.ResponseWriter, r *http.Request) {
+	// Get IDs from URL parameters
+	vars := mux.Vars(r)
+	id, err := primitive.ObjectIDFromHex(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+	userID, err := primitive.ObjectIDFromHex(vars["userId"])
+	if err != nil {
+		http.Error(w, "Invalid user ID format", http.StatusBadRequest)
+		return
+	}
+
+	domain, err := h.repo.RevokeDomain(r.Context(), id, userID)
+	h.writeGrantResult(w, domain, err)
+}
+
+// writeGrantResult writes the domain after its grants changed, or the error
+func (h *DomainHandler) writeGrantResult(w http.ResponseWriter, domain *models.Domain, err error) {
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			http.Error(w, "Domain not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error updating domain", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(domain)
+}
@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"shortlink/internal/database"
+	"shortlink/internal/models"
+	"shortlink/internal/policy"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// newTestDomainHandler creates a domain handler for repo that treats sho.rt as the service's host
+func newTestDomainHandler(t *testing.T, repo database.Store, domains *Domains) *DomainHandler {
+	t.Helper()
+
+	engine, err := policy.New(policy.Config{SelfLinks: policy.SelfLinksReject, ServiceHosts: []string{"sho.rt"}})
+	if err != nil {
+		t.Fatalf("policy.New: %v", err)
+	}
+	return NewDomainHandler(repo, domains, engine)
+}
+
+// createDomain registers host through h and returns the domain
+func createDomain(t *testing.T, h *DomainHandler, host string) models.Domain {
+	t.Helper()
+
+	w := serve(h.CreateDomain, http.MethodPost, "/api/admin/domains", `{"host":"`+host+`"}`, primitive.NilObjectID, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("CreateDomain(%q) = %d %s", host, w.Code, w.Body)
+	}
+	var domain models.Domain
+	if err := json.NewDecoder(w.Body).Decode(&domain); err != nil {
+		t.Fatalf("decoding the created domain: %v", err)
+	}
+	return domain
+}
+
+func TestCreateDomain(t *testing.T) {
+	repo := database.NewMemoryRepository()
+	h := newTestDomainHandler(t, repo, NewDomains(repo))
+
+	domain := createDomain(t, h, " Go.Example.COM. ")
+	if domain.Host != "go.example.com" || domain.ID.IsZero() {
+		t.Fatalf("CreateDomain = %+v, want go.example.com", domain)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"invalid body", `{"host":`, http.StatusBadRequest},
+		{"empty host", `{"host":""}`, http.StatusBadRequest},
+		{"single label", `{"host":"localhost"}`, http.StatusBadRequest},
+		{"scheme", `{"host":"https://go.example.org"}`, http.StatusBadRequest},
+		{"port", `{"host":"go.example.org:8080"}`, http.StatusBadRequest},
+		{"path", `{"host":"go.example.org/x"}`, http.StatusBadRequest},
+		{"leading hyphen", `{"host":"-go.example.org"}`, http.StatusBadRequest},
+		{"too long", `{"host":"` + strings.Repeat("a.", 127) + `org"}`, http.StatusBadRequest},
+		{"service host", `{"host":"sho.rt"}`, http.StatusConflict},
+		{"service host in capitals", `{"host":"SHO.RT"}`, http.StatusConflict},
+		{"taken", `{"host":"go.example.com"}`, http.StatusConflict},
+		{"taken with other case", `{"host":"GO.example.com."}`, http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(h.CreateDomain, http.MethodPost, "/api/admin/domains", tt.body, primitive.NilObjectID, nil)
+			if w.Code != tt.status {
+				t.Fatalf("CreateDomain = %d %s, want %d", w.Code, w.Body, tt.status)
+			}
+		})
+	}
+}
+
+func TestDomainGrants(t *testing.T) {
+	ctx := context.Background()
+	repo := database.NewMemoryRepository()
+	urls := newTestURLHandler(t, repo)
+	h := newTestDomainHandler(t, repo, urls.domains)
+	alice, err := repo.CreateUser(ctx, models.User{Username: "alice"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	bob, err := repo.CreateUser(ctx, models.User{Username: "bob"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	domain := createDomain(t, h, "go.example.com")
+	id := domain.ID.Hex()
+
+	// createLink creates a link on host as userID and returns the status
+	createLink := func(userID primitive.ObjectID, host string) int {
+		w := serve(urls.CreateShortURL, http.MethodPost, "/api/urls", `{"originalUrl":"https://example.com/","domain":"`+host+`"}`, userID, nil)
+		return w.Code
+	}
+
+	if status := createLink(alice.ID, "go.example.com"); status != http.StatusForbidden {
+		t.Fatalf("CreateShortURL before the grant = %d, want %d", status, http.StatusForbidden)
+	}
+
+	grants := []struct {
+		name   string
+		vars   map[string]string
+		body   string
+		status int
+	}{
+		{"invalid ID", map[string]string{"id": "nope"}, `{"username":"alice"}`, http.StatusBadRequest},
+		{"invalid body", map[string]string{"id": id}, `{"username":`, http.StatusBadRequest},
+		{"unknown user", map[string]string{"id": id}, `{"username":"mallory"}`, http.StatusNotFound},
+		{"unknown domain", map[string]string{"id": primitive.NewObjectID().Hex()}, `{"username":"alice"}`, http.StatusNotFound},
+		{"alice", map[string]string{"id": id}, `{"username":" alice "}`, http.StatusOK},
+		{"alice again", map[string]string{"id": id}, `{"username":"alice"}`, http.StatusOK},
+	}
+	for _, tt := range grants {
+		t.Run("grant "+tt.name, func(t *testing.T) {
+			w := serve(h.GrantDomain, http.MethodPost, "/api/admin/domains/"+tt.vars["id"]+"/users", tt.body, primitive.NilObjectID, tt.vars)
+			if w.Code != tt.status {
+				t.Fatalf("GrantDomain = %d %s, want %d", w.Code, w.Body, tt.status)
+			}
+		})
+	}
+
+	// Alice sees the domain, without its other users; Bob doesn't see it
+	w := serve(h.GetDomains, http.MethodGet, "/api/domains", "", alice.ID, nil)
+	var listed []models.Domain
+	if err := json.NewDecoder(w.Body).Decode(&listed); err != nil || len(listed) != 1 || listed[0].Host != "go.example.com" || listed[0].UserIDs != nil {
+		t.Fatalf("GetDomains for alice = %s, want go.example.com without userIds", w.Body)
+	}
+	w = serve(h.GetDomains, http.MethodGet, "/api/domains", "", bob.ID, nil)
+	if err := json.NewDecoder(w.Body).Decode(&listed); err != nil || len(listed) != 0 {
+		t.Fatalf("GetDomains for bob = %s, want none", w.Body)
+	}
+	if w := serve(h.GetDomains, http.MethodGet, "/api/domains", "", primitive.NilObjectID, nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("GetDomains anonymously = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	w = serve(h.GetAllDomains, http.MethodGet, "/api/admin/domains", "", primitive.NilObjectID, nil)
+	if err := json.NewDecoder(w.Body).Decode(&listed); err != nil || len(listed) != 1 || len(listed[0].UserIDs) != 1 || listed[0].UserIDs[0] != alice.ID {
+		t.Fatalf("GetAllDomains = %s, want go.example.com granted to alice once", w.Body)
+	}
+
+	links := []struct {
+		name   string
+		userID primitive.ObjectID
+		host   string
+		status int
+	}{
+		{"granted", alice.ID, "go.example.com", http.StatusCreated},
+		{"granted, with a port", alice.ID, "GO.example.com:8443", http.StatusCreated},
+		{"not granted", bob.ID, "go.example.com", http.StatusForbidden},
+		{"unregistered", alice.ID, "go.example.org", http.StatusForbidden},
+	}
+	for _, tt := range links {
+		t.Run("link "+tt.name, func(t *testing.T) {
+			if status := createLink(tt.userID, tt.host); status != tt.status {
+				t.Fatalf("CreateShortURL on %s = %d, want %d", tt.host, status, tt.status)
+			}
+		})
+	}
+
+	revokes := []struct {
+		name   string
+		vars   map[string]string
+		status int
+	}{
+		{"invalid ID", map[string]string{"id": "nope", "userId": alice.ID.Hex()}, http.StatusBadRequest},
+		{"invalid user ID", map[string]string{"id": id, "userId": "nope"}, http.StatusBadRequest},
+		{"unknown domain", map[string]string{"id": primitive.NewObjectID().Hex(), "userId": alice.ID.Hex()}, http.StatusNotFound},
+		{"alice", map[string]string{"id": id, "userId": alice.ID.Hex()}, http.StatusOK},
+	}
+	for _, tt := range revokes {
+		t.Run("revoke "+tt.name, func(t *testing.T) {
+			w := serve(h.RevokeDomain, http.MethodDelete, "/api/admin/domains/"+tt.vars["id"]+"/users/"+tt.vars["userId"], "", primitive.NilObjectID, tt.vars)
+			if w.Code != tt.status {
+				t.Fatalf("RevokeDomain = %d %s, want %d", w.Code, w.Body, tt.status)
+			}
+		})
+	}
+
+	// Revoking applies at once, even though lookups are cached
+	if status := createLink(alice.ID, "go.example.com"); status != http.StatusForbidden {
+		t.Fatalf("CreateShortURL after the revocation = %d, want %d", status, http.StatusForbidden)
+	}
+}
+
+func TestRedirectOnDomain(t *testing.T) {
+	ctx := context.Background()
+	repo := database.NewMemoryRepository()
+	h := newTestURLHandler(t, repo)
+	domains := newTestDomainHandler(t, repo, h.domains)
+	userID := primitive.NewObjectID()
+
+	for _, link := range []models.ShortURL{
+		{UserID: userID, Slug: "docs", OriginalURL: "https://example.com/default", Active: true},
+		{UserID: userID, Domain: "go.example.com", Slug: "docs", OriginalURL: "https://example.com/branded", Active: true},
+		{UserID: userID, Domain: "go.example.com", Slug: "team", OriginalURL: "https://example.com/team", Active: true},
+	} {
+		if _, err := repo.CreateShortURL(ctx, link); err != nil {
+			t.Fatalf("CreateShortURL: %v", err)
+		}
+	}
+
+	// redirect requests slug on host and returns the response
+	redirect := func(host, slug string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "http://"+host+"/"+slug, nil)
+		r = mux.SetURLVars(r, map[string]string{"slug": slug})
+		w := httptest.NewRecorder()
+		h.RedirectShortURL(w, r)
+		return w
+	}
+
+	// Registering the domain replaces the cached list without it
+	if w := redirect("go.example.com", "team"); w.Code != http.StatusNotFound {
+		t.Fatalf("redirect before the domain is registered = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	createDomain(t, domains, "go.example.com")
+
+	tests := []struct {
+		name   string
+		host   string
+		slug   string
+		status int
+		want   string
+	}{
+		{"service host", "sho.rt", "docs", http.StatusTemporaryRedirect, "https://example.com/default"},
+		{"branded host", "go.example.com", "docs", http.StatusTemporaryRedirect, "https://example.com/branded"},
+		{"branded host with a port", "go.example.com:8080", "docs", http.StatusTemporaryRedirect, "https://example.com/branded"},
+		{"branded slug on the service host", "sho.rt", "team", http.StatusNotFound, ""},
+		{"branded slug", "go.example.com", "team", http.StatusTemporaryRedirect, "https://example.com/team"},
+		{"unregistered host", "go.example.org", "docs", http.StatusTemporaryRedirect, "https://example.com/default"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := redirect(tt.host, tt.slug)
+			if w.Code != tt.status || w.Header().Get("Location") != tt.want {
+				t.Fatalf("redirect to %s/%s = %d %q, want %d %q", tt.host, tt.slug, w.Code, w.Header().Get("Location"), tt.status, tt.want)
+			}
+		})
+	}
+}
+
+// countingDomainStore counts the domain list queries, and blocks each one
+// until release is closed
+type countingDomainStore struct {
+	database.DomainStore
+	loads   atomic.Int32
+	release chan struct{}
+}
+
+func (s *countingDomainStore) GetDomains(ctx context.Context) ([]models.Domain, error) {
+	s.loads.Add(1)
+	<-s.release
+	return s.DomainStore.GetDomains(ctx)
+}
+
+func TestDomainsLookup(t *testing.T) {
+	ctx := context.Background()
+	repo := database.NewMemoryRepository()
+	if _, err := repo.CreateDomain(ctx, models.Domain{Host: "go.example.com"}); err != nil {
+		t.Fatalf("CreateDomain: %v", err)
+	}
+	store := &countingDomainStore{DomainStore: repo, release: make(chan struct{})}
+	domains := NewDomains(store)
+
+	// Concurrent lookups share one query, and later ones use its result
+	var wg sync.WaitGroup
+	found := make([]*models.Domain, 10)
+	for i := range found {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			found[i], _ = domains.lookup(ctx, "go.example.com")
+		}(i)
+	}
+	waitForLoads(store, 1)
+	close(store.release)
+	wg.Wait()
+
+	for _, domain := range found {
+		if domain == nil || domain.Host != "go.example.com" {
+			t.Fatalf("lookup = %+v, want go.example.com", domain)
+		}
+	}
+	if loads := store.loads.Load(); loads != 1 {
+		t.Fatalf("concurrent lookups ran %d queries, want 1", loads)
+	}
+	if domain, err := domains.lookup(ctx, "go.example.com:443"); err != nil || domain == nil || store.loads.Load() != 1 {
+		t.Fatalf("cached lookup = %+v, %v after %d queries, want go.example.com from 1", domain, err, store.loads.Load())
+	}
+	if domain, err := domains.lookup(ctx, "sho.rt"); err != nil || domain != nil {
+		t.Fatalf("lookup(sho.rt) = %+v, %v, want nil", domain, err)
+	}
+}
+
+func TestDomainsInvalidateDuringLoad(t *testing.T) {
+	ctx := context.Background()
+	repo := database.NewMemoryRepository()
+	store := &countingDomainStore{DomainStore: repo, release: make(chan struct{})}
+	domains := NewDomains(store)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		domains.lookup(ctx, "go.example.com")
+	}()
+	waitForLoads(store, 1)
+
+	// Invalidating doesn't wait for the query, and its stale result isn't cached
+	domains.invalidate()
+	if _, err := repo.CreateDomain(ctx, models.Domain{Host: "go.example.com"}); err != nil {
+		t.Fatalf("CreateDomain: %v", err)
+	}
+	close(store.release)
+	<-done
+
+	domain, err := domains.lookup(ctx, "go.example.com")
+	if err != nil || domain == nil || domain.Host != "go.example.com" {
+		t.Fatalf("lookup after invalidating = %+v, %v, want go.example.com", domain, err)
+	}
+	if loads := store.loads.Load(); loads != 2 {
+		t.Fatalf("lookups ran %d queries, want 2", loads)
+	}
+}
+
+// waitForLoads waits until store has started n domain list queries
+func waitForLoads(store *countingDomainStore, n int32) {
+	for store.loads.Load() < n {
+		time.Sleep(time.Millisecond)
+	}
+}
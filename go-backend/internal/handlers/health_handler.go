@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"shortlink/internal/database"
+	"shortlink/internal/models"
+	"shortlink/pkg/utils"
+	"time"
+)
+
+// HealthHandler reports whether the service and its storage backend are up
+type HealthHandler struct {
+	backend *database.Backend
+}
+
+// NewHealthHandler creates a new health handler
+func NewHealthHandler(backend *database.Backend) *HealthHandler {
+	return &HealthHandler{
+		backend: backend,
+	}
+}
+
+// Health checks the storage backend and reports which one is in use
+func (h *HealthHandler) Health(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	resp := models.HealthResponse{
+		Status:   "ok",
+		Storage:  h.backend.Name,
+		Fallback: h.backend.Fallback,
+	}
+	status := http.StatusOK
+
+	if err := h.backend.Ping(ctx); err != nil {
+		// The error can name hosts and driver details, so it only goes to the log
+		utils.LogError("Health check failed", err)
+		resp.Status = "unavailable"
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
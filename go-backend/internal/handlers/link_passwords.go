@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"shortlink/internal/auth"
+	"shortlink/internal/models"
+	"shortlink/internal/ratelimit"
+	"shortlink/pkg/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Ways visitors can send a link password
+const (
+	// linkPasswordHeader carries the password for API clients
+	linkPasswordHeader = "X-Link-Password"
+
+	// linkPasswordParam is the query parameter and form field that carry the password
+	linkPasswordParam = "password"
+
+	// linkAccessCookiePrefix starts the name of the cookie that unlocks a link;
+	// the link's ID completes it
+	linkAccessCookiePrefix = "link_access_"
+)
+
+// maxLinkPasswordLength is the longest password bcrypt can hash
+const maxLinkPasswordLength = 72
+
+// LinkAccessConfig controls access to password-protected links
+type LinkAccessConfig struct {
+	// Secret signs the access cookies. If empty a random secret is used, so
+	// cookies stop working when the server restarts.
+	Secret []byte
+
+	// TTL is how long an access cookie stays valid
+	TTL time.Duration
+
+	// MaxFailuresPerLink and MaxFailuresPerIP limit wrong passwords in each
+	// FailureWindow, for a single link and for a single client address
+	MaxFailuresPerLink int
+	MaxFailuresPerIP   int
+	FailureWindow      time.Duration
+}
+
+// LinkAccessConfigFromEnv reads the link access configuration from environment variables
+func LinkAccessConfigFromEnv() LinkAccessConfig {
+	cfg := LinkAccessConfig{
+		Secret:             []byte(os.Getenv("LINK_ACCESS_SECRET")),
+		TTL:                15 * time.Minute,
+		MaxFailuresPerLink: 50,
+		MaxFailuresPerIP:   10,
+		FailureWindow:      15 * time.Minute,
+	}
+
+	if ttl, err := time.ParseDuration(os.Getenv("LINK_ACCESS_TTL")); err == nil && ttl > 0 {
+		cfg.TTL = ttl
+	}
+	if limit, err := strconv.Atoi(os.Getenv("LINK_PASSWORD_MAX_FAILURES_PER_LINK")); err == nil {
+		cfg.MaxFailuresPerLink = limit
+	}
+	if limit, err := strconv.Atoi(os.Getenv("LINK_PASSWORD_MAX_FAILURES_PER_IP")); err == nil {
+		cfg.MaxFailuresPerIP = limit
+	}
+	if window, err := time.ParseDuration(os.Getenv("LINK_PASSWORD_FAILURE_WINDOW")); err == nil && window > 0 {
+		cfg.FailureWindow = window
+	}
+
+	return cfg
+}
+
+// linkGate checks link passwords and issues the cookies that remember them
+type linkGate struct {
+	secret       []byte
+	ttl          time.Duration
+	linkFailures *ratelimit.Limiter
+	ipFailures   *ratelimit.Limiter
+}
+
+// newLinkGate creates a gate for cfg
+func newLinkGate(cfg LinkAccessConfig) *linkGate {
+	secret := cfg.Secret
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatalf("Error generating link access secret: %v", err)
+		}
+	}
+
+	return &linkGate{
+		secret:       secret,
+		ttl:          cfg.TTL,
+		linkFailures: ratelimit.New(cfg.MaxFailuresPerLink, cfg.FailureWindow),
+		ipFailures:   ratelimit.New(cfg.MaxFailuresPerIP, cfg.FailureWindow),
+	}
+}
+
+// passwordCheck is the outcome of checking a link password
+type passwordCheck int
+
+const (
+	passwordAccepted passwordCheck = iota
+	passwordRejected
+	passwordLimited
+)
+
+// check verifies password for shortURL on behalf of the client at ip. Once the
+// link or the client has failed too often it refuses to check at all, and
+// retryAfter says for how long. The attempt counts as a failure while the
+// password is checked, so concurrent guesses can't slip past the limits.
+func (g *linkGate) check(shortURL *models.ShortURL, ip, password string) (result passwordCheck, retryAfter time.Duration) {
+	linkAttempt, ok, wait := g.linkFailures.Reserve(shortURL.ID.Hex())
+	if !ok {
+		return passwordLimited, wait
+	}
+	ipAttempt, ok, wait := g.ipFailures.Reserve(ip)
+	if !ok {
+		g.linkFailures.Release(linkAttempt)
+		return passwordLimited, wait
+	}
+
+	if auth.CheckPassword(shortURL.PasswordHash, password) {
+		g.linkFailures.Release(linkAttempt)
+		g.ipFailures.Release(ipAttempt)
+		return passwordAccepted, 0
+	}
+
+	return passwordRejected, 0
+}
+
+// token signs access to shortURL until expires. The password hash is part of
+// the signature, so changing the password revokes every issued token.
+func (g *linkGate) token(shortURL *models.ShortURL, expires int64) string {
+	mac := hmac.New(sha256.New, g.secret)
+	fmt.Fprintf(mac, "%s|%s|%d", shortURL.ID.Hex(), shortURL.PasswordHash, expires)
+	return strconv.FormatInt(expires, 10) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// validToken reports whether token grants access to shortURL now
+func (g *linkGate) validToken(shortURL *models.ShortURL, token string) bool {
+	expiresField, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	expires, err := strconv.ParseInt(expiresField, 10, 64)
+	if err != nil || time.Now().Unix() >= expires {
+		return false
+	}
+	return hmac.Equal([]byte(token), []byte(g.token(shortURL, expires)))
+}
+
+// setAccessCookie remembers that the client entered the password for shortURL
+func (g *linkGate) setAccessCookie(w http.ResponseWriter, r *http.Request, shortURL *models.ShortURL) {
+	expires := time.Now().Add(g.ttl)
+	http.SetCookie(w, &http.Cookie{
+		Name:     linkAccessCookiePrefix + shortURL.ID.Hex(),
+		Value:    g.token(shortURL, expires.Unix()),
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// unlockShortURL reports whether the request may follow the password-protected
+// shortURL: it carries a valid access cookie, or the right password in the
+// X-Link-Password header or the password query parameter. Otherwise it writes
+// the password form, or an error if the password was wrong or too many were.
+func (h *URLHandler) unlockShortURL(w http.ResponseWriter, r *http.Request, shortURL *models.ShortURL) bool {
+	if cookie, err := r.Cookie(linkAccessCookiePrefix + shortURL.ID.Hex()); err == nil && h.gate.validToken(shortURL, cookie.Value) {
+		return true
+	}
+
+	password := r.Header.Get(linkPasswordHeader)
+	if password == "" {
+		password = r.URL.Query().Get(linkPasswordParam)
+	}
+	if password == "" {
+		writePasswordForm(w, r, http.StatusUnauthorized, "")
+		return false
+	}
+
+	result, retryAfter := h.gate.check(shortURL, clientIP(r), password)
+	switch result {
+	case passwordAccepted:
+		h.gate.setAccessCookie(w, r, shortURL)
+		return true
+	case passwordLimited:
+		writeTooManyAttempts(w, retryAfter)
+	default:
+		http.Error(w, "Incorrect password", http.StatusUnauthorized)
+	}
+	return false
+}
+
+// UnlockShortURL checks the password submitted with the form served for a
+// password-protected link. If it is right, the client gets an access cookie
+// and is sent back to the link.
+func (h *URLHandler) UnlockShortURL(w http.ResponseWriter, r *http.Request) {
+	// Get the short URL from the database
+	shortURL, err := h.getRequestedShortURL(r, mux.Vars(r)["slug"])
+	if err != nil {
+		http.Error(w, "Error retrieving short URL", http.StatusInternalServerError)
+		return
+	}
+	if shortURL == nil || shortURL.DeletedAt != nil {
+		http.Error(w, "Short URL not found", http.StatusNotFound)
+		return
+	}
+
+	// Links without a password have nothing to unlock
+	if shortURL.PasswordHash != "" {
+		result, retryAfter := h.gate.check(shortURL, clientIP(r), r.PostFormValue(linkPasswordParam))
+		switch result {
+		case passwordLimited:
+			writeTooManyAttempts(w, retryAfter)
+			return
+		case passwordRejected:
+			writePasswordForm(w, r, http.StatusUnauthorized, "Incorrect password")
+			return
+		}
+		h.gate.setAccessCookie(w, r, shortURL)
+	}
+
+	// Send the client back to the link, now as a GET
+	http.Redirect(w, r, r.URL.RequestURI(), http.StatusSeeOther)
+}
+
+// passwordForm is the page served for password-protected links
+var passwordForm = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Password required</title>
+</head>
+<body>
+<form method="post" action="{{.Action}}">
+<p>This link is password protected.</p>
+{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+<label>Password <input type="password" name="password" autocomplete="current-password" maxlength="72" required autofocus></label>
+<button type="submit">Continue</button>
+</form>
+</body>
+</html>
+`))
+
+// writePasswordForm serves the password form with status, showing message if there is one
+func writePasswordForm(w http.ResponseWriter, r *http.Request, status int, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	err := passwordForm.Execute(w, struct {
+		Action string
+		Error  string
+	}{r.URL.RequestURI(), message})
+	if err != nil {
+		utils.LogError("Failed to render password form", err)
+	}
+}
+
+// writeTooManyAttempts answers a client that has to wait retryAfter before trying another password
+func writeTooManyAttempts(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	http.Error(w, "Too many incorrect passwords; try again later", http.StatusTooManyRequests)
+}
+
+// validLinkPassword reports whether password can be used for a link
+func validLinkPassword(password string) bool {
+	return password != "" && len(password) <= maxLinkPasswordLength
+}
+
+// clientIP returns the address the request came from, without its port
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"shortlink/internal/auth"
+	"shortlink/internal/database"
+	"shortlink/internal/models"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// newLockedLink creates a handler checking link passwords with cfg, and a link on it with password
+func newLockedLink(t *testing.T, cfg LinkAccessConfig, password string) (*URLHandler, *database.MemoryRepository, *models.ShortURL) {
+	t.Helper()
+
+	repo := database.NewMemoryRepository()
+	h := newTestURLHandler(t, repo)
+	h.gate = newLinkGate(cfg)
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	link, err := repo.CreateShortURL(context.Background(), models.ShortURL{UserID: primitive.NewObjectID(), Slug: "secret", OriginalURL: "https://example.com/secret", Active: true, PasswordHash: hash})
+	if err != nil {
+		t.Fatalf("CreateShortURL: %v", err)
+	}
+	return h, repo, link
+}
+
+// visit follows the link at /secret from ip, sending password if it isn't empty, and cookies
+func visit(h *URLHandler, ip, password string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "http://sho.rt/secret", nil)
+	r.RemoteAddr = ip + ":50000"
+	if password != "" {
+		r.Header.Set(linkPasswordHeader, password)
+	}
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	r = mux.SetURLVars(r, map[string]string{"slug": "secret"})
+
+	w := httptest.NewRecorder()
+	h.RedirectShortURL(w, r)
+	return w
+}
+
+func TestLinkPasswordLockout(t *testing.T) {
+	h, _, _ := newLockedLink(t, LinkAccessConfig{TTL: time.Minute, MaxFailuresPerLink: 3, MaxFailuresPerIP: 2, FailureWindow: time.Minute}, "open sesame")
+
+	steps := []struct {
+		name     string
+		ip       string
+		password string
+		status   int
+	}{
+		{"no password", "192.0.2.1", "", http.StatusUnauthorized},
+		{"right password", "192.0.2.1", "open sesame", http.StatusTemporaryRedirect},
+		{"right password again", "192.0.2.1", "open sesame", http.StatusTemporaryRedirect},
+		{"first wrong password", "192.0.2.1", "guess 1", http.StatusUnauthorized},
+		{"second wrong password", "192.0.2.1", "guess 2", http.StatusUnauthorized},
+		{"client locked out", "192.0.2.1", "guess 3", http.StatusTooManyRequests},
+		{"right password from a locked out client", "192.0.2.1", "open sesame", http.StatusTooManyRequests},
+		{"other client", "192.0.2.2", "guess 4", http.StatusUnauthorized},
+		{"link locked out", "192.0.2.3", "guess 5", http.StatusTooManyRequests},
+		{"right password for a locked out link", "192.0.2.3", "open sesame", http.StatusTooManyRequests},
+	}
+
+	for _, step := range steps {
+		w := visit(h, step.ip, step.password)
+		if w.Code != step.status {
+			t.Fatalf("%s: redirect = %d %s, want %d", step.name, w.Code, w.Body, step.status)
+		}
+		if step.status == http.StatusTooManyRequests {
+			retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+			if err != nil || retryAfter < 1 || retryAfter > 60 {
+				t.Fatalf("%s: Retry-After = %q, want 1 to 60 seconds", step.name, w.Header().Get("Retry-After"))
+			}
+		}
+	}
+}
+
+func TestLinkPasswordConcurrentGuesses(t *testing.T) {
+	h, _, _ := newLockedLink(t, LinkAccessConfig{TTL: time.Minute, MaxFailuresPerLink: 3, FailureWindow: time.Minute}, "open sesame")
+
+	var wg sync.WaitGroup
+	codes := make([]int, 20)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = visit(h, "192.0.2.1", "guess "+strconv.Itoa(i)).Code
+		}(i)
+	}
+	wg.Wait()
+
+	checked := 0
+	for _, code := range codes {
+		if code == http.StatusUnauthorized {
+			checked++
+		} else if code != http.StatusTooManyRequests {
+			t.Fatalf("redirect = %d, want %d or %d", code, http.StatusUnauthorized, http.StatusTooManyRequests)
+		}
+	}
+	if checked != 3 {
+		t.Fatalf("%d concurrent guesses were checked, want 3", checked)
+	}
+}
+
+func TestLinkAccessCookie(t *testing.T) {
+	cfg := LinkAccessConfig{Secret: []byte("secret"), TTL: time.Minute}
+	h, repo, link := newLockedLink(t, cfg, "open sesame")
+
+	w := visit(h, "192.0.2.1", "open sesame")
+	var cookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == linkAccessCookiePrefix+link.ID.Hex() {
+			cookie = c
+		}
+	}
+	if w.Code != http.StatusTemporaryRedirect || cookie == nil || !cookie.HttpOnly {
+		t.Fatalf("redirect with the right password = %d, cookie %+v, want an access cookie", w.Code, cookie)
+	}
+
+	// withValue returns the access cookie with value in place of its own
+	withValue := func(value string) *http.Cookie {
+		return &http.Cookie{Name: cookie.Name, Value: value}
+	}
+	expires, signature, _ := strings.Cut(cookie.Value, ".")
+	other := *link
+	other.ID = primitive.NewObjectID()
+	otherSecret := newLinkGate(LinkAccessConfig{Secret: []byte("other secret"), TTL: time.Minute})
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+		status int
+	}{
+		{"issued cookie", cookie, http.StatusTemporaryRedirect},
+		{"empty", withValue(""), http.StatusUnauthorized},
+		{"no signature", withValue(expires), http.StatusUnauthorized},
+		{"changed signature", withValue(expires + "." + signature[1:] + "A"), http.StatusUnauthorized},
+		{"later expiry", withValue(strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10) + "." + signature), http.StatusUnauthorized},
+		{"expired", withValue(h.gate.token(link, time.Now().Add(-time.Second).Unix())), http.StatusUnauthorized},
+		{"another link's token", withValue(h.gate.token(&other, time.Now().Add(time.Minute).Unix())), http.StatusUnauthorized},
+		{"signed with another secret", withValue(otherSecret.token(link, time.Now().Add(time.Minute).Unix())), http.StatusUnauthorized},
+		{"another link's cookie name", &http.Cookie{Name: linkAccessCookiePrefix + other.ID.Hex(), Value: cookie.Value}, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := visit(h, "192.0.2.1", "", tt.cookie); w.Code != tt.status {
+				t.Fatalf("redirect = %d %s, want %d", w.Code, w.Body, tt.status)
+			}
+		})
+	}
+
+	// Changing the password revokes the cookies issued for the old one
+	hash, err := auth.HashPassword("new password")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	link.PasswordHash = hash
+	if _, err := repo.UpdateShortURL(context.Background(), *link, link.Version); err != nil {
+		t.Fatalf("UpdateShortURL: %v", err)
+	}
+	if w := visit(h, "192.0.2.1", "", cookie); w.Code != http.StatusUnauthorized {
+		t.Fatalf("redirect with a cookie for the old password = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
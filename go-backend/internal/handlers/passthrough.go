@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"shortlink/internal/models"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// validQueryPassthrough reports whether mode can be used as a link's query passthrough
+func validQueryPassthrough(mode string) bool {
+	return mode == "" || mode == models.QueryPassthroughLink || mode == models.QueryPassthroughRequest
+}
+
+// requestRest returns the path that followed the slug in the request, without
+// its leading slash, or "" if there was none. Only wildcard links accept one.
+func requestRest(r *http.Request) string {
+	return mux.Vars(r)["rest"]
+}
+
+// passThrough carries the parts of the request after the short link over to
+// destination: the rest of the path for wildcard links, unless appendPath is
+// false, and the query string for links that forward it. Only the
+// destination's path and query change, so it stays on the host that was
+// vetted when the link was saved.
+func passThrough(r *http.Request, shortURL *models.ShortURL, destination string, appendPath bool) string {
+	rest := ""
+	if appendPath {
+		rest = requestRest(r)
+	}
+	forwardQuery := shortURL.QueryPassthrough != "" && r.URL.RawQuery != ""
+	if (rest == "" || !shortURL.Wildcard) && !forwardQuery {
+		return destination
+	}
+
+	u, err := url.Parse(destination)
+	if err != nil {
+		return destination
+	}
+
+	if rest != "" && shortURL.Wildcard {
+		segments := strings.Split(rest, "/")
+		for i, segment := range segments {
+			segments[i] = url.PathEscape(segment)
+		}
+		rawPath := strings.TrimSuffix(u.EscapedPath(), "/") + "/" + strings.Join(segments, "/")
+		if path, err := url.PathUnescape(rawPath); err == nil {
+			u.Path, u.RawPath = path, rawPath
+		}
+	}
+
+	if forwardQuery {
+		// The link password is for this service, not the destination
+		var skip []string
+		if shortURL.PasswordHash != "" {
+			skip = append(skip, linkPasswordParam)
+		}
+		u.RawQuery = mergeQuery(u.RawQuery, r.URL.RawQuery, shortURL.QueryPassthrough == models.QueryPassthroughRequest, skip)
+	}
+
+	return u.String()
+}
+
+// queryParam is one key=value pair of a query string, kept as it was sent
+type queryParam struct {
+	key string
+	raw string
+
+	// valid is false if the pair isn't properly escaped
+	valid bool
+}
+
+// parseQueryParams splits a raw query string into its parameters, dropping empty ones
+func parseQueryParams(query string) []queryParam {
+	var params []queryParam
+	for _, raw := range strings.Split(query, "&") {
+		if raw == "" {
+			continue
+		}
+		rawKey, rawValue, _ := strings.Cut(raw, "=")
+		key, keyErr := url.QueryUnescape(rawKey)
+		_, valueErr := url.QueryUnescape(rawValue)
+		if keyErr != nil {
+			key = rawKey
+		}
+		params = append(params, queryParam{key: key, raw: raw, valid: keyErr == nil && valueErr == nil})
+	}
+	return params
+}
+
+// mergeQuery appends the parameters of requestQuery to linkQuery. When both
+// have a parameter, linkQuery's values are kept unless requestWins. Request
+// parameters keyed by skip, or not properly escaped, are dropped. Parameters
+// keep their order and escaping, so signed destination URLs survive untouched.
+func mergeQuery(linkQuery, requestQuery string, requestWins bool, skip []string) string {
+	linkParams := parseQueryParams(linkQuery)
+	linkKeys := make(map[string]bool, len(linkParams))
+	for _, param := range linkParams {
+		linkKeys[param.key] = true
+	}
+
+	var requestParams []queryParam
+	requestKeys := make(map[string]bool)
+	for _, param := range parseQueryParams(requestQuery) {
+		if param.valid && !slices.Contains(skip, param.key) {
+			requestParams = append(requestParams, param)
+			requestKeys[param.key] = true
+		}
+	}
+
+	merged := make([]string, 0, len(linkParams)+len(requestParams))
+	for _, param := range linkParams {
+		if !requestWins || !requestKeys[param.key] {
+			merged = append(merged, param.raw)
+		}
+	}
+	for _, param := range requestParams {
+		if requestWins || !linkKeys[param.key] {
+			merged = append(merged, param.raw)
+		}
+	}
+	return strings.Join(merged, "&")
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"shortlink/internal/models"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestMergeQuery(t *testing.T) {
+	tests := []struct {
+		name         string
+		linkQuery    string
+		requestQuery string
+		requestWins  bool
+		skip         []string
+		want         string
+	}{
+		{"no request query", "a=1&b=2", "", false, nil, "a=1&b=2"},
+		{"no link query", "", "a=1&b=2", false, nil, "a=1&b=2"},
+		{"appends new parameters", "a=1", "b=2&c=3", false, nil, "a=1&b=2&c=3"},
+		{"link wins", "a=1&b=2", "b=9&c=3", false, nil, "a=1&b=2&c=3"},
+		{"request wins", "a=1&b=2", "b=9&c=3", true, nil, "a=1&b=9&c=3"},
+		{"request wins over every link value", "a=1&a=2&b=2", "a=9", true, nil, "b=2&a=9"},
+		{"keeps repeated request values", "", "a=1&a=2", false, nil, "a=1&a=2"},
+		{"keeps escaping", "sig=abc%2Fdef%3D%3D", "utm_source=news+letter&q=a%20b", false, nil, "sig=abc%2Fdef%3D%3D&utm_source=news+letter&q=a%20b"},
+		{"keeps the order", "z=1&a=2", "y=3&b=4", false, nil, "z=1&a=2&y=3&b=4"},
+		{"compares unescaped keys", "utm%5Fsource=link", "utm_source=request", false, nil, "utm%5Fsource=link"},
+		{"keeps parameters without values", "a", "b&c=", false, nil, "a&b&c="},
+		{"drops empty parameters", "a=1&&", "&b=2&", false, nil, "a=1&b=2"},
+		{"drops badly escaped request parameters", "a=1", "b=%zz&c=3&%gg=4", false, nil, "a=1&c=3"},
+		{"keeps badly escaped link parameters", "a=%zz", "b=2", false, nil, "a=%zz&b=2"},
+		{"skips parameters", "a=1", "password=secret&b=2", false, []string{"password"}, "a=1&b=2"},
+		{"skips escaped parameters", "a=1", "pass%77ord=secret&b=2", true, []string{"password"}, "a=1&b=2"},
+		{"skips only request parameters", "password=link", "password=secret", true, []string{"password"}, "password=link"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeQuery(tt.linkQuery, tt.requestQuery, tt.requestWins, tt.skip); got != tt.want {
+				t.Fatalf("mergeQuery(%q, %q) = %q, want %q", tt.linkQuery, tt.requestQuery, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPassThrough(t *testing.T) {
+	tests := []struct {
+		name        string
+		shortURL    models.ShortURL
+		destination string
+		target      string
+		rest        string
+		appendPath  bool
+		want        string
+	}{
+		{
+			name:        "plain link",
+			shortURL:    models.ShortURL{},
+			destination: "https://example.com/a?x=1",
+			target:      "/s?y=2",
+			want:        "https://example.com/a?x=1",
+		},
+		{
+			name:        "wildcard path",
+			shortURL:    models.ShortURL{Wildcard: true},
+			destination: "https://example.com/docs/",
+			target:      "/s/guides/a%20b",
+			rest:        "guides/a b",
+			appendPath:  true,
+			want:        "https://example.com/docs/guides/a%20b",
+		},
+		{
+			name:        "wildcard path after a path without a slash",
+			shortURL:    models.ShortURL{Wildcard: true},
+			destination: "https://example.com/docs?v=1#top",
+			target:      "/s/x",
+			rest:        "x",
+			appendPath:  true,
+			want:        "https://example.com/docs/x?v=1#top",
+		},
+		{
+			name:        "wildcard path escapes its segments",
+			shortURL:    models.ShortURL{Wildcard: true},
+			destination: "https://example.com/a%2Fb",
+			target:      "/s/c%3Fd/%23e",
+			rest:        "c?d/#e",
+			appendPath:  true,
+			want:        "https://example.com/a%2Fb/c%3Fd/%23e",
+		},
+		{
+			name:        "wildcard path left to a template",
+			shortURL:    models.ShortURL{Wildcard: true},
+			destination: "https://example.com/docs/x",
+			target:      "/s/x",
+			rest:        "x",
+			appendPath:  false,
+			want:        "https://example.com/docs/x",
+		},
+		{
+			name:        "path on a link that isn't a wildcard",
+			shortURL:    models.ShortURL{},
+			destination: "https://example.com/docs",
+			target:      "/s/x",
+			rest:        "x",
+			appendPath:  true,
+			want:        "https://example.com/docs",
+		},
+		{
+			name:        "query with link values winning",
+			shortURL:    models.ShortURL{QueryPassthrough: models.QueryPassthroughLink},
+			destination: "https://example.com/?utm_source=link&sig=a%2Fb",
+			target:      "/s?utm_source=request&ref=mail",
+			want:        "https://example.com/?utm_source=link&sig=a%2Fb&ref=mail",
+		},
+		{
+			name:        "query with request values winning",
+			shortURL:    models.ShortURL{QueryPassthrough: models.QueryPassthroughRequest},
+			destination: "https://example.com/?utm_source=link&sig=a%2Fb",
+			target:      "/s?utm_source=request&ref=mail",
+			want:        "https://example.com/?sig=a%2Fb&utm_source=request&ref=mail",
+		},
+		{
+			name:        "query on a link with a password",
+			shortURL:    models.ShortURL{QueryPassthrough: models.QueryPassthroughLink, PasswordHash: "hash"},
+			destination: "https://example.com/",
+			target:      "/s?password=secret&ref=mail",
+			want:        "https://example.com/?ref=mail",
+		},
+		{
+			name:        "password on an open link",
+			shortURL:    models.ShortURL{QueryPassthrough: models.QueryPassthroughLink},
+			destination: "https://example.com/",
+			target:      "/s?password=secret",
+			want:        "https://example.com/?password=secret",
+		},
+		{
+			name:        "path and query",
+			shortURL:    models.ShortURL{Wildcard: true, QueryPassthrough: models.QueryPassthroughLink},
+			destination: "https://example.com/docs/?v=1",
+			target:      "/s/x/y?ref=mail",
+			rest:        "x/y",
+			appendPath:  true,
+			want:        "https://example.com/docs/x/y?v=1&ref=mail",
+		},
+		{
+			name:        "host stays the same",
+			shortURL:    models.ShortURL{Wildcard: true, QueryPassthrough: models.QueryPassthroughRequest},
+			destination: "https://example.com/",
+			target:      "/s/@evil.example?host=evil.example",
+			rest:        "@evil.example",
+			appendPath:  true,
+			want:        "https://example.com/@evil.example?host=evil.example",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			r = mux.SetURLVars(r, map[string]string{"slug": "s", "rest": tt.rest})
+
+			if got := passThrough(r, &tt.shortURL, tt.destination, tt.appendPath); got != tt.want {
+				t.Fatalf("passThrough = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"shortlink/internal/models"
+	"shortlink/internal/policy"
+)
+
+// PolicyHandler handles administration of the destination policy
+type PolicyHandler struct {
+	policy *policy.Engine
+}
+
+// NewPolicyHandler creates a new policy handler
+func NewPolicyHandler(policy *policy.Engine) *PolicyHandler {
+	return &PolicyHandler{
+		policy: policy,
+	}
+}
+
+// Reload re-reads the blocklist files without restarting the server
+func (h *PolicyHandler) Reload(w http.ResponseWriter, r *http.Request) {
+	if err := h.policy.Reload(); err != nil {
+		http.Error(w, "Error reloading blocklists: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.PolicyReloadResponse{
+		BlocklistSize: h.policy.BlocklistSize(),
+	})
+}
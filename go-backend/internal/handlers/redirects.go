@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"os"
+	"shortlink/internal/models"
+	"shortlink/pkg/utils"
+	"time"
+)
+
+// redirectTypes are the redirect types a link can be given, besides "" for the default
+var redirectTypes = []string{
+	models.RedirectMovedPermanently,
+	models.RedirectFound,
+	models.RedirectTemporary,
+	models.RedirectPermanent,
+	models.RedirectInterstitial,
+	models.RedirectFrame,
+}
+
+// redirectStatuses maps the status code redirect types to their status
+var redirectStatuses = map[string]int{
+	"":                              http.StatusTemporaryRedirect,
+	models.RedirectMovedPermanently: http.StatusMovedPermanently,
+	models.RedirectFound:            http.StatusFound,
+	models.RedirectTemporary:        http.StatusTemporaryRedirect,
+	models.RedirectPermanent:        http.StatusPermanentRedirect,
+}
+
+// noStore is the Cache-Control for responses that must reach the server on every visit
+const noStore = "no-store"
+
+// RedirectConfig controls how redirects are cached and paced
+type RedirectConfig struct {
+	// PermanentMaxAge is how long browsers and shared caches may keep a
+	// permanent redirect; 0 stops them keeping it at all
+	PermanentMaxAge time.Duration
+
+	// InterstitialDelay is how long the interstitial page waits before
+	// moving on to the destination
+	InterstitialDelay time.Duration
+
+	// CountryHeader is the request header, set by a CDN or proxy in front of
+	// the service, that destination templates read {country} from
+	CountryHeader string
+}
+
+// RedirectConfigFromEnv reads the redirect configuration from environment variables
+func RedirectConfigFromEnv() RedirectConfig {
+	cfg := RedirectConfig{
+		PermanentMaxAge:   24 * time.Hour,
+		InterstitialDelay: 3 * time.Second,
+		CountryHeader:     "CF-IPCountry",
+	}
+
+	if maxAge, err := time.ParseDuration(os.Getenv("PERMANENT_REDIRECT_MAX_AGE")); err == nil && maxAge >= 0 {
+		cfg.PermanentMaxAge = maxAge
+	}
+	if delay, err := time.ParseDuration(os.Getenv("INTERSTITIAL_DELAY")); err == nil && delay >= 0 {
+		cfg.InterstitialDelay = delay
+	}
+	if header := os.Getenv("COUNTRY_HEADER"); header != "" {
+		cfg.CountryHeader = header
+	}
+
+	return cfg
+}
+
+// validRedirectType reports whether redirectType can be used for a link
+func validRedirectType(redirectType string) bool {
+	if redirectType == "" {
+		return true
+	}
+	for _, known := range redirectTypes {
+		if redirectType == known {
+			return true
+		}
+	}
+	return false
+}
+
+// writeRedirect sends the visitor on to destination the way shortURL's
+// redirect type says. direct reports whether destination is the link's own,
+// rather than its fallback or where a chain of short links led.
+func (h *URLHandler) writeRedirect(w http.ResponseWriter, r *http.Request, shortURL *models.ShortURL, destination string, direct bool) {
+	switch shortURL.RedirectType {
+	case models.RedirectInterstitial:
+		h.writeRedirectPage(w, r, interstitialPage, shortURL, destination)
+	case models.RedirectFrame:
+		// Our banner page must not be framed in turn, or it could be used for clickjacking
+		w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+		h.writeRedirectPage(w, r, framePage, shortURL, destination)
+	default:
+		status, ok := redirectStatuses[shortURL.RedirectType]
+		if !ok {
+			status = http.StatusTemporaryRedirect
+		}
+		w.Header().Set("Cache-Control", h.redirectCacheControl(shortURL, direct, status))
+		http.Redirect(w, r, destination, status)
+	}
+}
+
+// redirectCacheControl returns the Cache-Control for a redirect of shortURL
+// with status. Permanent redirects may be cached, until the link expires at
+// the latest, as long as every visit would go to the same place: links with a
+// password, click limit, schedule or destination template, and visits that
+// weren't direct, are decided afresh each time. Temporary redirects are never
+// cached, so every click is counted.
+func (h *URLHandler) redirectCacheControl(shortURL *models.ShortURL, direct bool, status int) string {
+	if status != http.StatusMovedPermanently && status != http.StatusPermanentRedirect {
+		return noStore
+	}
+	if shortURL.PasswordHash != "" || shortURL.MaxClicks > 0 || shortURL.Schedule != nil || isDestinationTemplate(shortURL.OriginalURL) || !direct {
+		return noStore
+	}
+
+	maxAge := h.redirects.PermanentMaxAge
+	if shortURL.ExpiresAt != nil {
+		maxAge = min(maxAge, time.Until(*shortURL.ExpiresAt))
+	}
+	seconds := int64(math.Floor(maxAge.Seconds()))
+	if seconds <= 0 {
+		return noStore
+	}
+	return fmt.Sprintf("public, max-age=%d", seconds)
+}
+
+// writeRedirectPage serves page for shortURL, leading on to destination. The
+// page is served afresh on each visit, so every view is counted.
+func (h *URLHandler) writeRedirectPage(w http.ResponseWriter, r *http.Request, page *template.Template, shortURL *models.ShortURL, destination string) {
+	delay := int(math.Ceil(h.redirects.InterstitialDelay.Seconds()))
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", noStore)
+	w.WriteHeader(http.StatusOK)
+	err := page.Execute(w, struct {
+		ShortLink   string
+		Destination string
+		Refresh     string
+		Delay       int
+	}{h.shortLink(r, shortURL.Domain, shortURL.Slug), destination, fmt.Sprintf("%d;url=%s", delay, destination), delay})
+	if err != nil {
+		utils.LogError("Failed to render redirect page", err)
+	}
+}
+
+// interstitialPage is the page served for links with the interstitial redirect type
+var interstitialPage = template.Must(template.New("interstitial").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<meta http-equiv="refresh" content="{{.Refresh}}">
+<title>Redirecting…</title>
+</head>
+<body>
+<p>You are being taken to</p>
+<p><a href="{{.Destination}}">{{.Destination}}</a></p>
+<p>If nothing happens within {{.Delay}} seconds, follow the link above.</p>
+</body>
+</html>
+`))
+
+// framePage is the page served for links with the frame redirect type. The
+// sandbox keeps the framed site from navigating the visitor away on its own.
+var framePage = template.Must(template.New("frame").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{.ShortLink}}</title>
+<style>
+html, body { height: 100%; margin: 0; }
+body { display: flex; flex-direction: column; font-family: sans-serif; }
+header { display: flex; gap: 1em; align-items: center; padding: 0.5em 1em; border-bottom: 1px solid #ddd; font-size: 0.9em; }
+header .destination { flex: 1; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; color: #555; }
+iframe { flex: 1; width: 100%; border: 0; }
+</style>
+</head>
+<body>
+<header>
+<strong>{{.ShortLink}}</strong>
+<span class="destination">{{.Destination}}</span>
+<a href="{{.Destination}}" target="_top">Open directly</a>
+</header>
+<iframe src="{{.Destination}}" title="{{.Destination}}" sandbox="allow-forms allow-popups allow-same-origin allow-scripts allow-top-navigation-by-user-activation"></iframe>
+</body>
+</html>
+`))
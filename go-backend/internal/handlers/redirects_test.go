@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"shortlink/internal/models"
+	"testing"
+	"time"
+)
+
+func TestRedirectCacheControl(t *testing.T) {
+	h := &URLHandler{redirects: RedirectConfig{PermanentMaxAge: time.Hour}}
+	soon := time.Now().Add(10*time.Minute + 30*time.Second)
+	later := time.Now().Add(48 * time.Hour)
+	past := time.Now().Add(-time.Minute)
+
+	tests := []struct {
+		name     string
+		shortURL models.ShortURL
+		direct   bool
+		status   int
+		want     string
+	}{
+		{"moved permanently", models.ShortURL{OriginalURL: "https://example.com/"}, true, http.StatusMovedPermanently, "public, max-age=3600"},
+		{"permanent redirect", models.ShortURL{OriginalURL: "https://example.com/"}, true, http.StatusPermanentRedirect, "public, max-age=3600"},
+		{"found", models.ShortURL{OriginalURL: "https://example.com/"}, true, http.StatusFound, noStore},
+		{"temporary redirect", models.ShortURL{OriginalURL: "https://example.com/"}, true, http.StatusTemporaryRedirect, noStore},
+		{"expiry after the max age", models.ShortURL{OriginalURL: "https://example.com/", ExpiresAt: &later}, true, http.StatusMovedPermanently, "public, max-age=3600"},
+		{"expiry before the max age", models.ShortURL{OriginalURL: "https://example.com/", ExpiresAt: &soon}, true, http.StatusMovedPermanently, "public, max-age=630"},
+		{"already expired", models.ShortURL{OriginalURL: "https://example.com/", ExpiresAt: &past}, true, http.StatusMovedPermanently, noStore},
+		{"password", models.ShortURL{OriginalURL: "https://example.com/", PasswordHash: "hash"}, true, http.StatusMovedPermanently, noStore},
+		{"click limit", models.ShortURL{OriginalURL: "https://example.com/", MaxClicks: 10}, true, http.StatusMovedPermanently, noStore},
+		{"schedule", models.ShortURL{OriginalURL: "https://example.com/", Schedule: &models.Schedule{}}, true, http.StatusMovedPermanently, noStore},
+		{"destination template", models.ShortURL{OriginalURL: "https://example.com/?src={query.src}"}, true, http.StatusPermanentRedirect, noStore},
+		{"fallback or chain", models.ShortURL{OriginalURL: "https://example.com/"}, false, http.StatusMovedPermanently, noStore},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := h.redirectCacheControl(&tt.shortURL, tt.direct, tt.status)
+			// The time to expiry shrinks as the test runs, so allow it a second
+			if got != tt.want && !(tt.want == "public, max-age=630" && got == "public, max-age=629") {
+				t.Fatalf("redirectCacheControl = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedirectCacheControlWithoutMaxAge(t *testing.T) {
+	h := &URLHandler{redirects: RedirectConfig{PermanentMaxAge: 0}}
+	shortURL := &models.ShortURL{OriginalURL: "https://example.com/"}
+
+	if got := h.redirectCacheControl(shortURL, true, http.StatusMovedPermanently); got != noStore {
+		t.Fatalf("redirectCacheControl = %q, want %q", got, noStore)
+	}
+}
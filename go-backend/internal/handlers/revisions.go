@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"shortlink/internal/auth"
+	"shortlink/internal/database"
+	"shortlink/internal/models"
+	"shortlink/pkg/utils"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetShortURLRevisions lists the revision history of a short URL, newest first
+func (h *URLHandler) GetShortURLRevisions(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Get ID from URL parameters
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+
+	// Only the owner may see a link's history
+	shortURL, err := h.repo.GetShortURL(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Error retrieving short URL", http.StatusInternalServerError)
+		return
+	}
+	if shortURL == nil || shortURL.UserID != userID || shortURL.DeletedAt != nil {
+		http.Error(w, "Short URL not found", http.StatusNotFound)
+		return
+	}
+
+	revisions, err := h.repo.GetShortURLRevisions(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Error retrieving revisions", http.StatusInternalServerError)
+		return
+	}
+
+	// Return the revisions
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisions)
+}
+
+// RollbackShortURL restores a short URL to an earlier revision. The rollback is
+// saved as a new version, so the history itself is never rewritten. An If-Match
+// header is optional; when given it must name the current version. The link
+// keeps its current password unless restorePassword=true asks for the
+// revision's, which may be one the owner has since replaced.
+func (h *URLHandler) RollbackShortURL(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Get ID and target version from URL parameters
+	vars := mux.Vars(r)
+	id, err := primitive.ObjectIDFromHex(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+	target, err := strconv.Atoi(vars["version"])
+	if err != nil || target < 1 {
+		http.Error(w, "Invalid version", http.StatusBadRequest)
+		return
+	}
+	restorePassword := false
+	if value := r.URL.Query().Get("restorePassword"); value != "" {
+		restorePassword, err = strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, "Invalid restorePassword; use true or false", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Get the current state of the link
+	shortURL, err := h.repo.GetShortURL(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Error retrieving short URL", http.StatusInternalServerError)
+		return
+	}
+	if shortURL == nil || shortURL.UserID != userID || shortURL.DeletedAt != nil {
+		http.Error(w, "Short URL not found", http.StatusNotFound)
+		return
+	}
+
+	version := shortURL.Version
+	if requested, ok := requestVersion(r, nil, shortURL.Version); ok && requested != version {
+		http.Error(w, "Short URL has been modified since it was read", http.StatusPreconditionFailed)
+		return
+	}
+
+	// Find the revision to restore
+	revision, err := h.repo.GetShortURLRevision(r.Context(), id, target)
+	if err != nil {
+		http.Error(w, "Error retrieving revision", http.StatusInternalServerError)
+		return
+	}
+	if revision == nil {
+		http.Error(w, "Revision not found", http.StatusNotFound)
+		return
+	}
+
+	// The old destination and fallback must still pass today's checks
+	destination, ok := h.checkOriginalURL(w, r, revision.OriginalURL)
+	if !ok {
+		return
+	}
+	fallbackURL := ""
+	if revision.FallbackURL != "" {
+		fallback, ok := h.checkDestination(w, r, revision.FallbackURL)
+		if !ok {
+			return
+		}
+		fallbackURL = fallback.Original
+	}
+
+	before := *shortURL
+	shortURL.OriginalURL = destination.Original
+	shortURL.NormalizedURL = destination.Normalized
+	shortURL.Slug = revision.Slug
+	shortURL.Active = revision.Active
+	shortURL.ExpiresAt = revision.ExpiresAt
+	shortURL.ActivateAt = revision.ActivateAt
+	shortURL.Schedule = revision.Schedule
+	shortURL.FallbackURL = fallbackURL
+	shortURL.MaxClicks = revision.MaxClicks
+	if restorePassword {
+		shortURL.PasswordHash = revision.PasswordHash
+	}
+	shortURL.RedirectType = revision.RedirectType
+	shortURL.QueryPassthrough = revision.QueryPassthrough
+	shortURL.Wildcard = revision.Wildcard
+	if shortURL.ActivateAt != nil && !shortURL.ActivateAt.After(time.Now()) {
+		// The revision was waiting for a time that has since come
+		shortURL.ActivateAt = nil
+		shortURL.Active = true
+	}
+	if !h.checkSettings(w, &before, shortURL) {
+		return
+	}
+
+	// Save, unless someone else got there first
+	updatedURL, err := h.repo.UpdateShortURL(r.Context(), *shortURL, version)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrNotFound):
+			http.Error(w, "Short URL not found", http.StatusNotFound)
+		case errors.Is(err, database.ErrVersionConflict):
+			http.Error(w, "Short URL has been modified since it was read", http.StatusPreconditionFailed)
+		case errors.Is(err, database.ErrSlugTaken):
+			http.Error(w, "The revision's slug is now used by another link", http.StatusConflict)
+		default:
+			http.Error(w, "Error updating short URL", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	rollback := models.NewShortURLRevision(updatedURL, models.RevisionRollback, userID, changedFields(&before, updatedURL))
+	rollback.RolledBackTo = target
+	h.recordRevision(r.Context(), rollback)
+
+	// Return the updated URL
+	h.setShortLink(r, updatedURL)
+	setETag(w, updatedURL)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updatedURL)
+}
+
+// recordRevision appends revision to the history. The change it describes has
+// already been saved, so a failure is logged rather than reported to the client.
+func (h *URLHandler) recordRevision(ctx context.Context, revision models.ShortURLRevision) {
+	if _, err := h.repo.CreateShortURLRevision(ctx, revision); err != nil {
+		utils.LogError("Failed to record short URL revision", err)
+	}
+}
+
+// changedFields lists the JSON names of the fields that differ between before and after
+func changedFields(before, after *models.ShortURL) []string {
+	changes := []string{}
+	if before.OriginalURL != after.OriginalURL {
+		changes = append(changes, "originalUrl")
+	}
+	if before.Slug != after.Slug {
+		changes = append(changes, "slug")
+	}
+	if before.Active != after.Active {
+		changes = append(changes, "active")
+	}
+	if !equalTimes(before.ExpiresAt, after.ExpiresAt) {
+		changes = append(changes, "expiresAt")
+	}
+	if !equalTimes(before.ActivateAt, after.ActivateAt) {
+		changes = append(changes, "activateAt")
+	}
+	if !reflect.DeepEqual(before.Schedule, after.Schedule) {
+		changes = append(changes, "schedule")
+	}
+	if before.FallbackURL != after.FallbackURL {
+		changes = append(changes, "fallbackUrl")
+	}
+	if before.MaxClicks != after.MaxClicks {
+		changes = append(changes, "maxClicks")
+	}
+	if before.PasswordHash != after.PasswordHash {
+		changes = append(changes, "password")
+	}
+	if before.RedirectType != after.RedirectType {
+		changes = append(changes, "redirectType")
+	}
+	if before.QueryPassthrough != after.QueryPassthrough {
+		changes = append(changes, "queryPassthrough")
+	}
+	if before.Wildcard != after.Wildcard {
+		changes = append(changes, "wildcard")
+	}
+	return changes
+}
+
+// equalTimes reports whether two optional times are both unset or the same instant
+func equalTimes(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"shortlink/internal/auth"
+	"shortlink/internal/database"
+	"shortlink/internal/models"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// createLink creates a short URL through h as userID and returns it
+func createLink(t *testing.T, h *URLHandler, userID primitive.ObjectID, body string) models.ShortURL {
+	t.Helper()
+
+	w := serve(h.CreateShortURL, http.MethodPost, "/api/urls", body, userID, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("CreateShortURL = %d %s", w.Code, w.Body)
+	}
+	var link models.ShortURL
+	if err := json.NewDecoder(w.Body).Decode(&link); err != nil {
+		t.Fatalf("decoding the created link: %v", err)
+	}
+	return link
+}
+
+func TestRollbackPassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		status   int
+		password string
+	}{
+		{"keeps the current password", "", http.StatusOK, "new password"},
+		{"declines to restore the password", "?restorePassword=false", http.StatusOK, "new password"},
+		{"restores the password", "?restorePassword=true", http.StatusOK, "old password"},
+		{"invalid opt-in", "?restorePassword=please", http.StatusBadRequest, "new password"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := database.NewMemoryRepository()
+			h := newTestURLHandler(t, repo)
+			userID := primitive.NewObjectID()
+
+			link := createLink(t, h, userID, `{"originalUrl":"https://example.com/old","password":"old password"}`)
+			id := map[string]string{"id": link.ID.Hex()}
+			body := `{"originalUrl":"https://example.com/new","password":"new password"}`
+			if w := serve(h.UpdateShortURL, http.MethodPatch, "/api/urls/"+link.ID.Hex(), body, userID, id); w.Code != http.StatusOK {
+				t.Fatalf("UpdateShortURL = %d %s", w.Code, w.Body)
+			}
+
+			revision := map[string]string{"id": link.ID.Hex(), "version": "1"}
+			w := serve(h.RollbackShortURL, http.MethodPost, "/api/urls/"+link.ID.Hex()+"/revisions/1/rollback"+tt.query, "", userID, revision)
+			if w.Code != tt.status {
+				t.Fatalf("RollbackShortURL = %d %s, want %d", w.Code, w.Body, tt.status)
+			}
+
+			stored, err := repo.GetShortURL(context.Background(), link.ID)
+			if err != nil || stored == nil {
+				t.Fatalf("GetShortURL = %+v, %v", stored, err)
+			}
+			if !auth.CheckPassword(stored.PasswordHash, tt.password) {
+				t.Fatalf("after the rollback the link doesn't take %q", tt.password)
+			}
+			if tt.status == http.StatusOK && stored.OriginalURL != "https://example.com/old" {
+				t.Fatalf("rollback left the destination at %s", stored.OriginalURL)
+			}
+		})
+	}
+}
+
+func TestRollbackValidation(t *testing.T) {
+	ctx := context.Background()
+	soon, later := time.Now().Add(time.Hour), time.Now().Add(2*time.Hour)
+
+	tests := []struct {
+		name     string
+		revision models.ShortURLRevision
+		status   int
+	}{
+		{"valid revision", models.ShortURLRevision{Slug: "old-slug", Active: true}, http.StatusOK},
+		{"current slug, reserved since", models.ShortURLRevision{Slug: "admin", Active: true}, http.StatusOK},
+		{"reserved slug", models.ShortURLRevision{Slug: "dashboard", Active: true}, http.StatusBadRequest},
+		{"reserved slug in another case", models.ShortURLRevision{Slug: "Login", Active: true}, http.StatusBadRequest},
+		{"invalid slug", models.ShortURLRevision{Slug: "no spaces", Active: true}, http.StatusBadRequest},
+		{"activation after expiry", models.ShortURLRevision{Slug: "old-slug", ActivateAt: &later, ExpiresAt: &soon}, http.StatusBadRequest},
+		{"activation before expiry", models.ShortURLRevision{Slug: "old-slug", ActivateAt: &soon, ExpiresAt: &later}, http.StatusOK},
+		{"invalid redirect type", models.ShortURLRevision{Slug: "old-slug", Active: true, RedirectType: "303"}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := database.NewMemoryRepository()
+			h := newTestURLHandler(t, repo)
+			userID := primitive.NewObjectID()
+
+			// The link's slug was reserved after it was taken, which it may keep
+			link, err := repo.CreateShortURL(ctx, models.ShortURL{UserID: userID, Slug: "admin", OriginalURL: "https://example.com/new", Active: true})
+			if err != nil {
+				t.Fatalf("CreateShortURL: %v", err)
+			}
+			revision := tt.revision
+			revision.ShortURLID = link.ID
+			revision.Version = 7
+			revision.Action = models.RevisionUpdate
+			revision.OriginalURL = "https://example.com/old"
+			if _, err := repo.CreateShortURLRevision(ctx, revision); err != nil {
+				t.Fatalf("CreateShortURLRevision: %v", err)
+			}
+
+			vars := map[string]string{"id": link.ID.Hex(), "version": strconv.Itoa(revision.Version)}
+			w := serve(h.RollbackShortURL, http.MethodPost, "/api/urls/"+link.ID.Hex()+"/revisions/7/rollback", "", userID, vars)
+			if w.Code != tt.status {
+				t.Fatalf("RollbackShortURL = %d %s, want %d", w.Code, w.Body, tt.status)
+			}
+
+			stored, err := repo.GetShortURL(ctx, link.ID)
+			if err != nil || stored == nil {
+				t.Fatalf("GetShortURL = %+v, %v", stored, err)
+			}
+			if tt.status != http.StatusOK && (stored.Version != 1 || stored.Slug != "admin") {
+				t.Fatalf("rejected rollback changed the link to %+v", stored)
+			}
+			if tt.status == http.StatusOK && (stored.Version != 2 || stored.Slug != tt.revision.Slug) {
+				t.Fatalf("rollback saved %+v, want version 2 with slug %q", stored, tt.revision.Slug)
+			}
+		})
+	}
+}
+
+func TestUpdateReservedSlug(t *testing.T) {
+	repo := database.NewMemoryRepository()
+	h := newTestURLHandler(t, repo)
+	userID := primitive.NewObjectID()
+	link, err := repo.CreateShortURL(context.Background(), models.ShortURL{UserID: userID, Slug: "admin", OriginalURL: "https://example.com/", Active: true})
+	if err != nil {
+		t.Fatalf("CreateShortURL: %v", err)
+	}
+	id := map[string]string{"id": link.ID.Hex()}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"reserved slug", `{"slug":"api"}`, http.StatusBadRequest},
+		{"reserved slug in another case", `{"slug":"HEALTH"}`, http.StatusBadRequest},
+		{"slug reserved after it was taken", `{"slug":"admin","originalUrl":"https://example.com/new"}`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(h.UpdateShortURL, http.MethodPatch, "/api/urls/"+link.ID.Hex(), tt.body, userID, id); w.Code != tt.status {
+				t.Fatalf("UpdateShortURL = %d %s, want %d", w.Code, w.Body, tt.status)
+			}
+		})
+	}
+}
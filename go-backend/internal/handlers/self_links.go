@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"shortlink/internal/models"
+	"shortlink/internal/policy"
+	"shortlink/pkg/urlnorm"
+	"time"
+)
+
+// errRedirectLoop is returned when following self links leads back to a link already visited
+var errRedirectLoop = errors.New("redirect loop")
+
+// resolveSelfLinks checks whether a new link's destination points back at this
+// service. Depending on the policy it either rejects such destinations or
+// follows the chain of short links to the URL it finally leads to.
+// Rejections are returned as *policy.Violation.
+func (h *URLHandler) resolveSelfLinks(ctx context.Context, requestHost string, destination *urlnorm.Result) (*urlnorm.Result, error) {
+	for depth := 0; ; depth++ {
+		domain, slug, self, err := h.selfLink(ctx, destination.Normalized, requestHost)
+		if err != nil {
+			return nil, err
+		}
+		if !self {
+			return destination, nil
+		}
+		if slug == "" {
+			return nil, &policy.Violation{Reason: "destination points at this service"}
+		}
+		if !h.policy.ResolveSelfLinks() {
+			return nil, &policy.Violation{Reason: fmt.Sprintf("destination is the short link %q on this service", slug)}
+		}
+		if depth == h.policy.MaxChainDepth() {
+			return nil, &policy.Violation{Reason: fmt.Sprintf("destination is a chain of more than %d short links", h.policy.MaxChainDepth())}
+		}
+
+		target, err := h.repo.GetShortURLBySlug(ctx, domain, slug)
+		if err != nil {
+			return nil, err
+		}
+		if target == nil || target.DeletedAt != nil {
+			return nil, &policy.Violation{Reason: fmt.Sprintf("destination is the short link %q, which does not exist", slug)}
+		}
+
+		destination, err = h.normalizer.Normalize(target.OriginalURL)
+		if err != nil {
+			return nil, &policy.Violation{Reason: fmt.Sprintf("short link %q has an invalid destination", slug)}
+		}
+	}
+}
+
+// followSelfLinks returns the URL a redirect for shortURL should send the client
+// to. Destinations that are active short links on this service are followed
+// directly, so clients don't bounce through the service several times. Links
+// created before a host was configured as a service host can still form
+// cycles; those return errRedirectLoop.
+func (h *URLHandler) followSelfLinks(ctx context.Context, requestHost string, shortURL *models.ShortURL) (string, error) {
+	visited := map[string]bool{shortURL.Domain + "/" + shortURL.Slug: true}
+	destination := shortURL.OriginalURL
+
+	for depth := 0; ; depth++ {
+		domain, slug, self, err := h.selfLink(ctx, destination, requestHost)
+		if err != nil {
+			return "", err
+		}
+		if !self || slug == "" {
+			return destination, nil
+		}
+		if visited[domain+"/"+slug] || depth == h.policy.MaxChainDepth() {
+			return "", errRedirectLoop
+		}
+		visited[domain+"/"+slug] = true
+
+		// Let inactive, missing, click-limited or password-protected links answer for themselves
+		target, err := h.repo.GetShortURLBySlug(ctx, domain, slug)
+		if err != nil {
+			return "", err
+		}
+		if target == nil || target.DeletedAt != nil || !target.Active || (target.ExpiresAt != nil && target.ExpiresAt.Before(time.Now())) || !available(target, time.Now()) || target.MaxClicks > 0 || target.PasswordHash != "" {
+			return destination, nil
+		}
+
+		destination = target.OriginalURL
+	}
+}
+
+// selfLink reports whether rawURL points at this service: at a branded domain,
+// a configured service host or requestHost. If it is a short link, domain and
+// slug identify it, with domain empty for the default domain; otherwise slug
+// is empty.
+func (h *URLHandler) selfLink(ctx context.Context, rawURL, requestHost string) (domain, slug string, self bool, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", false, nil
+	}
+
+	branded, err := h.domains.lookup(ctx, u.Host)
+	if err != nil {
+		return "", "", false, err
+	}
+	if branded != nil {
+		slug, _ = policy.ShortLinkSlug(u.Path)
+		return branded.Host, slug, true, nil
+	}
+
+	slug, self = h.policy.SelfLink(rawURL, requestHost)
+	return "", slug, self, nil
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"shortlink/internal/database"
+	"shortlink/internal/models"
+	"shortlink/internal/policy"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// newSelfLinkHandler creates a handler for repo that handles self links with mode,
+// serves the default domain on sho.rt and links.example and has the branded domain go.example.com
+func newSelfLinkHandler(t *testing.T, repo *database.MemoryRepository, mode string) *URLHandler {
+	t.Helper()
+
+	engine, err := policy.New(policy.Config{ServiceHosts: []string{"links.example"}, SelfLinks: mode, MaxChainDepth: 2})
+	if err != nil {
+		t.Fatalf("policy.New: %v", err)
+	}
+	if _, err := repo.CreateDomain(context.Background(), models.Domain{Host: "go.example.com"}); err != nil {
+		t.Fatalf("CreateDomain: %v", err)
+	}
+
+	h := newTestURLHandler(t, repo)
+	h.policy = engine
+	return h
+}
+
+// mustCreateLinks stores links, owned by userID, on the default domain
+func mustCreateLinks(t *testing.T, repo *database.MemoryRepository, userID primitive.ObjectID, links map[string]string) {
+	t.Helper()
+
+	for slug, destination := range links {
+		if _, err := repo.CreateShortURL(context.Background(), models.ShortURL{UserID: userID, Slug: slug, OriginalURL: destination, Active: true}); err != nil {
+			t.Fatalf("CreateShortURL(%s): %v", slug, err)
+		}
+	}
+}
+
+func TestSelfLinksRejected(t *testing.T) {
+	repo := database.NewMemoryRepository()
+	h := newSelfLinkHandler(t, repo, policy.SelfLinksReject)
+	userID := primitive.NewObjectID()
+	mustCreateLinks(t, repo, userID, map[string]string{"docs": "https://example.com/docs"})
+
+	tests := []struct {
+		name        string
+		destination string
+		status      int
+	}{
+		{"request host", "http://sho.rt/docs", http.StatusUnprocessableEntity},
+		{"request host with a port", "https://SHO.RT:8443/docs", http.StatusUnprocessableEntity},
+		{"redirect API path", "https://sho.rt/api/r/docs", http.StatusUnprocessableEntity},
+		{"service root", "https://sho.rt/", http.StatusUnprocessableEntity},
+		{"configured service host", "https://links.example/docs", http.StatusUnprocessableEntity},
+		{"branded domain", "https://go.example.com/team", http.StatusUnprocessableEntity},
+		{"missing slug", "https://sho.rt/missing", http.StatusUnprocessableEntity},
+		{"subdomain of the service", "https://www.sho.rt/docs", http.StatusCreated},
+		{"elsewhere", "https://example.com/docs", http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(h.CreateShortURL, http.MethodPost, "/api/urls", `{"originalUrl":"`+tt.destination+`"}`, userID, nil)
+			if w.Code != tt.status {
+				t.Fatalf("CreateShortURL(%s) = %d %s, want %d", tt.destination, w.Code, w.Body, tt.status)
+			}
+		})
+	}
+}
+
+func TestSelfLinksResolved(t *testing.T) {
+	repo := database.NewMemoryRepository()
+	h := newSelfLinkHandler(t, repo, policy.SelfLinksResolve)
+	userID := primitive.NewObjectID()
+	mustCreateLinks(t, repo, userID, map[string]string{
+		"final":  "https://example.com/final",
+		"one":    "https://sho.rt/final",
+		"two":    "https://links.example/one",
+		"broken": "https://sho.rt/missing",
+		"trash":  "https://example.com/trash",
+	})
+	trash, err := repo.GetShortURLBySlug(context.Background(), "", "trash")
+	if err != nil || trash == nil {
+		t.Fatalf("GetShortURLBySlug = %+v, %v", trash, err)
+	}
+	if err := repo.DeleteShortURL(context.Background(), trash.ID, userID); err != nil {
+		t.Fatalf("DeleteShortURL: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		destination string
+		status      int
+		want        string
+	}{
+		{"short link", "http://sho.rt/final", http.StatusCreated, "https://example.com/final"},
+		{"chain of two", "https://sho.rt/one", http.StatusCreated, "https://example.com/final"},
+		{"chain deeper than allowed", "https://sho.rt/two", http.StatusUnprocessableEntity, ""},
+		{"missing slug", "https://sho.rt/missing", http.StatusUnprocessableEntity, ""},
+		{"chain to a missing slug", "https://sho.rt/broken", http.StatusUnprocessableEntity, ""},
+		{"link in the trash", "https://sho.rt/trash", http.StatusUnprocessableEntity, ""},
+		{"service root", "https://sho.rt/", http.StatusUnprocessableEntity, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(h.CreateShortURL, http.MethodPost, "/api/urls", `{"originalUrl":"`+tt.destination+`"}`, userID, nil)
+			if w.Code != tt.status {
+				t.Fatalf("CreateShortURL(%s) = %d %s, want %d", tt.destination, w.Code, w.Body, tt.status)
+			}
+			if tt.status != http.StatusCreated {
+				return
+			}
+			var link models.ShortURL
+			if err := json.NewDecoder(w.Body).Decode(&link); err != nil || link.OriginalURL != tt.want {
+				t.Fatalf("CreateShortURL(%s) = %+v, %v, want the destination %s", tt.destination, link, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedirectLoop(t *testing.T) {
+	repo := database.NewMemoryRepository()
+	h := newSelfLinkHandler(t, repo, policy.SelfLinksReject)
+	userID := primitive.NewObjectID()
+
+	// Links like these can't be created any more, but may predate a service host
+	mustCreateLinks(t, repo, userID, map[string]string{
+		"ping":     "https://sho.rt/pong",
+		"pong":     "https://links.example/ping",
+		"self":     "https://sho.rt/self",
+		"hop":      "https://sho.rt/final",
+		"final":    "https://example.com/final",
+		"deep":     "https://sho.rt/deeper",
+		"deeper":   "https://sho.rt/hop",
+		"off":      "https://example.com/off",
+		"to-off":   "https://sho.rt/off",
+		"branded":  "https://go.example.com/final",
+		"to-trash": "https://sho.rt/trash",
+		"trash":    "https://example.com/trash",
+	})
+	off, _ := repo.GetShortURLBySlug(context.Background(), "", "off")
+	off.Active = false
+	if _, err := repo.UpdateShortURL(context.Background(), *off, off.Version); err != nil {
+		t.Fatalf("UpdateShortURL: %v", err)
+	}
+	trash, _ := repo.GetShortURLBySlug(context.Background(), "", "trash")
+	if err := repo.DeleteShortURL(context.Background(), trash.ID, userID); err != nil {
+		t.Fatalf("DeleteShortURL: %v", err)
+	}
+	if _, err := repo.CreateShortURL(context.Background(), models.ShortURL{UserID: userID, Domain: "go.example.com", Slug: "final", OriginalURL: "https://example.com/branded", Active: true}); err != nil {
+		t.Fatalf("CreateShortURL: %v", err)
+	}
+
+	tests := []struct {
+		slug   string
+		status int
+		want   string
+	}{
+		{"ping", http.StatusLoopDetected, ""},
+		{"self", http.StatusLoopDetected, ""},
+		{"hop", http.StatusTemporaryRedirect, "https://example.com/final"},
+		{"deep", http.StatusLoopDetected, ""},
+		{"to-off", http.StatusTemporaryRedirect, "https://sho.rt/off"},
+		{"to-trash", http.StatusTemporaryRedirect, "https://sho.rt/trash"},
+		{"branded", http.StatusTemporaryRedirect, "https://example.com/branded"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.slug, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://sho.rt/"+tt.slug, nil)
+			r = mux.SetURLVars(r, map[string]string{"slug": tt.slug})
+			w := httptest.NewRecorder()
+			h.RedirectShortURL(w, r)
+
+			if w.Code != tt.status || w.Header().Get("Location") != tt.want {
+				t.Fatalf("redirect %s = %d %q, want %d %q", tt.slug, w.Code, w.Header().Get("Location"), tt.status, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"shortlink/internal/models"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// shortLink returns the fully qualified short link for slug on domain. Links
+// on the default domain are built from the configured public base URL or, if
+// there is none, from the scheme and host the request was sent to. Links on a
+// branded domain use its host with the same scheme.
+func (h *URLHandler) shortLink(r *http.Request, domain, slug string) string {
+	base := h.publicBaseURL
+	if base == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		base = scheme + "://" + r.Host
+	}
+	if domain != "" {
+		scheme, _, _ := strings.Cut(base, "://")
+		base = scheme + "://" + domain
+	}
+	return strings.TrimSuffix(base, "/") + "/" + url.PathEscape(slug)
+}
+
+// setShortLink fills in the short link of shortURL
+func (h *URLHandler) setShortLink(r *http.Request, shortURL *models.ShortURL) {
+	shortURL.ShortLink = h.shortLink(r, shortURL.Domain, shortURL.Slug)
+}
+
+// requestDomain returns the domain whose slugs the request can reach: the
+// branded domain it was sent to, or "" for the default domain
+func (h *URLHandler) requestDomain(r *http.Request) (string, error) {
+	domain, err := h.domains.lookup(r.Context(), r.Host)
+	if err != nil || domain == nil {
+		return "", err
+	}
+	return domain.Host, nil
+}
+
+// getRequestedShortURL looks up slug on the domain the request was sent to.
+// A request with more path after the slug only finds wildcard links.
+func (h *URLHandler) getRequestedShortURL(r *http.Request, slug string) (*models.ShortURL, error) {
+	domain, err := h.requestDomain(r)
+	if err != nil {
+		return nil, err
+	}
+	shortURL, err := h.repo.GetShortURLBySlug(r.Context(), domain, slug)
+	if err != nil || shortURL == nil {
+		return nil, err
+	}
+	if requestRest(r) != "" && !shortURL.Wildcard {
+		return nil, nil
+	}
+	return shortURL, nil
+}
+
+// setShortLinks fills in the short links of shortURLs
+func (h *URLHandler) setShortLinks(r *http.Request, shortURLs []models.ShortURL) {
+	for i := range shortURLs {
+		h.setShortLink(r, &shortURLs[i])
+	}
+}
+
+// RootShortLinks guards the short link routes at the root of the service:
+// reserved slugs are never resolved there, even for links created before
+// the slug was reserved, so they can't shadow the service's own paths.
+func (h *URLHandler) RootShortLinks(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.slugs.Reserved(mux.Vars(r)["slug"]) {
+			http.NotFound(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
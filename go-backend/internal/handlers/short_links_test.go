@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"shortlink/internal/database"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestShortLink(t *testing.T) {
+	tests := []struct {
+		name          string
+		publicBaseURL string
+		target        string
+		tls           bool
+		domain        string
+		want          string
+	}{
+		{"request host", "", "http://localhost:8080/api/urls", false, "", "http://localhost:8080/abc123"},
+		{"request host over TLS", "", "https://sho.rt/api/urls", true, "", "https://sho.rt/abc123"},
+		{"public base URL", "https://sho.rt", "http://backend:8080/api/urls", false, "", "https://sho.rt/abc123"},
+		{"public base URL with a path", "https://example.com/s", "http://backend:8080/api/urls", false, "", "https://example.com/s/abc123"},
+		{"branded domain", "https://sho.rt", "http://backend:8080/api/urls", false, "go.example.com", "https://go.example.com/abc123"},
+		{"branded domain without a public base URL", "", "http://sho.rt/api/urls", false, "go.example.com", "http://go.example.com/abc123"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestURLHandler(t, database.NewMemoryRepository())
+			h.publicBaseURL = tt.publicBaseURL
+			r := httptest.NewRequest(http.MethodPost, tt.target, nil)
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			if got := h.shortLink(r, tt.domain, "abc123"); got != tt.want {
+				t.Fatalf("shortLink = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateReservedSlug(t *testing.T) {
+	h := newTestURLHandler(t, database.NewMemoryRepository())
+	userID := primitive.NewObjectID()
+
+	tests := []struct {
+		slug   string
+		status int
+	}{
+		{"admin", http.StatusBadRequest},
+		{"Admin", http.StatusBadRequest},
+		{"API", http.StatusBadRequest},
+		{"Health", http.StatusBadRequest},
+		{"r", http.StatusBadRequest},
+		{"admins", http.StatusCreated},
+		{"api-docs", http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.slug, func(t *testing.T) {
+			w := serve(h.CreateShortURL, http.MethodPost, "/api/urls", `{"originalUrl":"https://example.com/`+tt.slug+`","slug":"`+tt.slug+`"}`, userID, nil)
+			if w.Code != tt.status {
+				t.Fatalf("CreateShortURL with slug %q = %d %s, want %d", tt.slug, w.Code, w.Body, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"regexp"
+	"shortlink/internal/models"
+	"shortlink/pkg/urlnorm"
+	"shortlink/pkg/utils"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxTemplateValueLength bounds how much of a request value is put into a destination
+const maxTemplateValueLength = 256
+
+// maxTemplatePathSegment is the highest {path.N} a template may use
+const maxTemplatePathSegment = 20
+
+// templateVariables are the placeholders that take no name
+var templateVariables = map[string]bool{
+	"path":          true,
+	"country":       true,
+	"referrer_host": true,
+	"device":        true,
+	"date":          true,
+	"year":          true,
+	"month":         true,
+	"day":           true,
+}
+
+// templateSecretHeaders can't be used in templates, as they would hand the
+// visitor's credentials for this service to the destination
+var templateSecretHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	linkPasswordHeader:    true,
+}
+
+var (
+	// templateNamePattern matches the name in {query.NAME} and {header.NAME}
+	templateNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+	// templateDefaultPattern matches the default in {name|default}
+	templateDefaultPattern = regexp.MustCompile(`^[A-Za-z0-9_.~-]*$`)
+)
+
+// urlPart is the part of a URL a placeholder is in, which decides how its value is escaped
+type urlPart int
+
+const (
+	urlPath urlPart = iota
+	urlQuery
+	urlFragment
+)
+
+// destinationTemplate is a destination URL with placeholders such as
+// {query.src}, which are filled in from each request that follows the link
+type destinationTemplate struct {
+	parts []templatePart
+}
+
+// templatePart is a literal piece of a template, or a placeholder if variable is set
+type templatePart struct {
+	literal string
+
+	variable string
+	name     string
+	fallback string
+	part     urlPart
+}
+
+// isDestinationTemplate reports whether rawURL is meant as a destination template
+func isDestinationTemplate(rawURL string) bool {
+	return strings.ContainsAny(rawURL, "{}")
+}
+
+// parseDestinationTemplate parses a destination template. Placeholders may
+// only appear in the path, query and fragment, so the host the template was
+// vetted with can't change.
+func parseDestinationTemplate(raw string) (*destinationTemplate, error) {
+	scheme, rest, ok := strings.Cut(raw, "://")
+	if !ok || strings.ContainsAny(scheme, "{}") {
+		return nil, errors.New("placeholders can only be used in the path, query string and fragment")
+	}
+	authorityEnd := len(scheme) + len("://") + len(rest)
+	if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+		authorityEnd = len(scheme) + len("://") + i
+	}
+	if strings.ContainsAny(raw[:authorityEnd], "{}") {
+		return nil, errors.New("placeholders can only be used in the path, query string and fragment")
+	}
+
+	t := &destinationTemplate{}
+	part := urlPath
+	literalStart := 0
+	for i := authorityEnd; i < len(raw); i++ {
+		switch raw[i] {
+		case '?':
+			if part == urlPath {
+				part = urlQuery
+			}
+		case '#':
+			part = urlFragment
+		case '}':
+			return nil, errors.New("unmatched }")
+		case '{':
+			end := strings.IndexByte(raw[i:], '}')
+			if end < 0 {
+				return nil, errors.New("unmatched {")
+			}
+			placeholder, err := parsePlaceholder(raw[i+1:i+end], part)
+			if err != nil {
+				return nil, err
+			}
+			t.parts = append(t.parts, templatePart{literal: raw[literalStart:i]}, placeholder)
+			i += end
+			literalStart = i + 1
+		}
+	}
+	t.parts = append(t.parts, templatePart{literal: raw[literalStart:]})
+
+	return t, nil
+}
+
+// parsePlaceholder parses the inside of a {placeholder} in part of a URL
+func parsePlaceholder(text string, part urlPart) (templatePart, error) {
+	spec, fallback, _ := strings.Cut(text, "|")
+	if !templateDefaultPattern.MatchString(fallback) {
+		return templatePart{}, fmt.Errorf("the default in {%s} may only use letters, digits and -._~", text)
+	}
+	placeholder := templatePart{variable: spec, fallback: fallback, part: part}
+
+	if templateVariables[spec] {
+		return placeholder, nil
+	}
+
+	variable, name, _ := strings.Cut(spec, ".")
+	placeholder.variable, placeholder.name = variable, name
+	switch variable {
+	case "path":
+		if n, err := strconv.Atoi(name); err != nil || n < 1 || n > maxTemplatePathSegment {
+			return templatePart{}, fmt.Errorf("{%s} must name a path segment from 1 to %d", spec, maxTemplatePathSegment)
+		}
+	case "query":
+		if !templateNamePattern.MatchString(name) {
+			return templatePart{}, fmt.Errorf("{%s} must name a query parameter", spec)
+		}
+	case "header":
+		if !templateNamePattern.MatchString(name) {
+			return templatePart{}, fmt.Errorf("{%s} must name a header", spec)
+		}
+		placeholder.name = textproto.CanonicalMIMEHeaderKey(name)
+		if templateSecretHeaders[placeholder.name] {
+			return templatePart{}, fmt.Errorf("the %s header can't be used", placeholder.name)
+		}
+	default:
+		return templatePart{}, fmt.Errorf("unknown placeholder {%s}", spec)
+	}
+
+	return placeholder, nil
+}
+
+// usesPath reports whether the template puts the path after the slug somewhere itself
+func (t *destinationTemplate) usesPath() bool {
+	for _, part := range t.parts {
+		if part.variable == "path" {
+			return true
+		}
+	}
+	return false
+}
+
+// sample fills every placeholder with a plain value, giving a URL that can
+// be vetted like any other destination
+func (t *destinationTemplate) sample() string {
+	return t.expand(func(templatePart) string { return "x" })
+}
+
+// expand fills in each placeholder with value, escaped for where it is in the URL
+func (t *destinationTemplate) expand(value func(templatePart) string) string {
+	var b strings.Builder
+	for _, part := range t.parts {
+		if part.variable == "" {
+			b.WriteString(part.literal)
+			continue
+		}
+
+		v := value(part)
+		if len(v) > maxTemplateValueLength {
+			v = strings.ToValidUTF8(v[:maxTemplateValueLength], "")
+		}
+		if v == "" {
+			v = part.fallback
+		}
+
+		switch {
+		case part.part == urlQuery:
+			b.WriteString(url.QueryEscape(v))
+		case part.variable == "path" && part.name == "":
+			// The whole path keeps its slashes
+			segments := strings.Split(v, "/")
+			for i, segment := range segments {
+				segments[i] = escapePathSegment(segment)
+			}
+			b.WriteString(strings.Join(segments, "/"))
+		default:
+			b.WriteString(escapePathSegment(v))
+		}
+	}
+	return b.String()
+}
+
+// escapePathSegment escapes a value for a path segment. Browsers read "..",
+// escaped or not, as a step up the path, so dot segments are left out and a
+// value can't climb out of the place the template gave it.
+func escapePathSegment(segment string) string {
+	if segment == "." || segment == ".." {
+		return ""
+	}
+	return url.PathEscape(segment)
+}
+
+// checkOriginalURL is checkDestination for a link's own destination, which
+// may also be a destination template. A template is vetted through a sample
+// expansion; its host is fixed, so every expansion passes the same checks.
+func (h *URLHandler) checkOriginalURL(w http.ResponseWriter, r *http.Request, rawURL string) (*urlnorm.Result, bool) {
+	if !isDestinationTemplate(rawURL) {
+		return h.checkDestination(w, r, rawURL)
+	}
+
+	t, err := parseDestinationTemplate(strings.TrimSpace(rawURL))
+	if err != nil {
+		http.Error(w, "Invalid destination template: "+err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	sample := t.sample()
+	checked, ok := h.checkDestination(w, r, sample)
+	if !ok {
+		return nil, false
+	}
+	if checked.Original != sample {
+		// A short link on this service was resolved to where it leads
+		http.Error(w, "Destination not allowed: a destination template can't point at a short link on this service", http.StatusUnprocessableEntity)
+		return nil, false
+	}
+
+	destination, err := h.normalizer.Normalize(rawURL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return destination, true
+}
+
+// expandDestination fills in destination, if it is a template, from the
+// request following shortURL. It also reports whether the template placed the
+// path after the slug itself. Destinations that aren't valid templates, such
+// as links saved with literal braces before templates existed, are returned
+// as they are.
+func (h *URLHandler) expandDestination(r *http.Request, shortURL *models.ShortURL, destination string) (string, bool) {
+	if !isDestinationTemplate(destination) {
+		return destination, false
+	}
+	t, err := parseDestinationTemplate(destination)
+	if err != nil {
+		return destination, false
+	}
+
+	now := time.Now().UTC()
+	rest := requestRest(r)
+	return t.expand(func(part templatePart) string {
+		switch part.variable {
+		case "path":
+			if part.name == "" {
+				return rest
+			}
+			n, _ := strconv.Atoi(part.name)
+			if segments := strings.Split(rest, "/"); rest != "" && n <= len(segments) {
+				return segments[n-1]
+			}
+			return ""
+		case "query":
+			// The link password is for this service, not the destination
+			if shortURL.PasswordHash != "" && part.name == linkPasswordParam {
+				return ""
+			}
+			return r.URL.Query().Get(part.name)
+		case "header":
+			return r.Header.Get(part.name)
+		case "country":
+			return strings.ToUpper(strings.TrimSpace(r.Header.Get(h.redirects.CountryHeader)))
+		case "referrer_host":
+			if referrer, err := url.Parse(r.Referer()); err == nil {
+				return strings.ToLower(referrer.Hostname())
+			}
+			return ""
+		case "device":
+			return utils.DetectDevice(r.UserAgent())
+		case "date":
+			return now.Format(time.DateOnly)
+		case "year":
+			return now.Format("2006")
+		case "month":
+			return now.Format("01")
+		case "day":
+			return now.Format("02")
+		}
+		return ""
+	}), t.usesPath()
+}
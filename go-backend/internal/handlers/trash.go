@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"shortlink/internal/auth"
+	"shortlink/internal/database"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetDeletedShortURLs lists the current user's trash, most recently deleted first
+func (h *URLHandler) GetDeletedShortURLs(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	shortURLs, err := h.repo.GetDeletedShortURLs(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Error retrieving deleted short URLs", http.StatusInternalServerError)
+		return
+	}
+
+	// Return the short URLs
+	h.setShortLinks(r, shortURLs)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shortURLs)
+}
+
+// RestoreShortURL takes a short URL back out of the trash
+func (h *URLHandler) RestoreShortURL(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Get ID from URL parameters
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+
+	// The slug was kept while the link was in the trash, so it can always come back
+	shortURL, err := h.repo.RestoreShortURL(r.Context(), id, userID)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			http.Error(w, "Short URL not found in trash", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error restoring short URL", http.StatusInternalServerError)
+		return
+	}
+
+	// Return the restored URL
+	h.setShortLink(r, shortURL)
+	setETag(w, shortURL)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shortURL)
+}
@@ -3,32 +3,65 @@ package handlers
 import (
         "context"
         "encoding/json"
+        "errors"
         "net/http"
+        "shortlink/internal/auth"
         "shortlink/internal/database"
         "shortlink/internal/models"
+        "shortlink/internal/policy"
+        "shortlink/pkg/urlnorm"
         "shortlink/pkg/utils"
+        "strconv"
+        "strings"
         "time"
 
         "github.com/gorilla/mux"
         "go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// maxSlugAttempts bounds how many generated slugs are tried before giving up
+const maxSlugAttempts = 5
+
 // URLHandler handles URL shortening API endpoints
 type URLHandler struct {
-        repo *database.Repository
+        repo         database.URLStore
+        domains      *Domains
+        slugs        *utils.SlugGenerators
+        normalizer   *urlnorm.Normalizer
+        policy       *policy.Engine
+        availability AvailabilityConfig
+        gate         *linkGate
+        redirects    RedirectConfig
+
+        // publicBaseURL is where short links are served, e.g. https://sho.rt
+        publicBaseURL string
 }
 
-// NewURLHandler creates a new URL handler
-func NewURLHandler(repo *database.Repository) *URLHandler {
+// NewURLHandler creates a new URL handler that resolves branded domains with
+// domains, generates slugs with slugs, validates destinations with normalizer
+// and vets them against policy.
+// Links that can't be followed get the responses in availability, and
+// password-protected links are unlocked as linkAccess says. Redirects are
+// cached and paced as redirects says. Short links are reported under
+// publicBaseURL, or the request's own host if it is empty.
+func NewURLHandler(repo database.URLStore, domains *Domains, slugs *utils.SlugGenerators, normalizer *urlnorm.Normalizer, policy *policy.Engine, availability AvailabilityConfig, linkAccess LinkAccessConfig, redirects RedirectConfig, publicBaseURL string) *URLHandler {
         return &URLHandler{
-                repo: repo,
+                repo:          repo,
+                domains:       domains,
+                slugs:         slugs,
+                normalizer:    normalizer,
+                policy:        policy,
+                availability:  availability,
+                gate:          newLinkGate(linkAccess),
+                redirects:     redirects,
+                publicBaseURL: publicBaseURL,
         }
 }
 
 // CreateShortURL handles the creation of a new short URL
 func (h *URLHandler) CreateShortURL(w http.ResponseWriter, r *http.Request) {
         // Get user ID from context (set by auth middleware)
-        userID, ok := r.Context().Value("userID").(primitive.ObjectID)
+        userID, ok := auth.UserIDFromContext(r.Context())
         if !ok {
                 http.Error(w, "Unauthorized", http.StatusUnauthorized)
                 return
@@ -42,79 +75,189 @@ func (h *URLHandler) CreateShortURL(w http.ResponseWriter, r *http.Request) {
                 return
         }
 
-        // Validate the request
-        if req.OriginalURL == "" {
-                http.Error(w, "Original URL is required", http.StatusBadRequest)
+        // Validate and normalize the destination
+        destination, ok := h.checkOriginalURL(w, r, req.OriginalURL)
+        if !ok {
                 return
         }
 
-        // Check if URL is valid
-        if !utils.IsValidURL(req.OriginalURL) {
-                http.Error(w, "Invalid URL format", http.StatusBadRequest)
+        // Check the caller may use the requested domain; links go on the default domain otherwise
+        var domain string
+        if req.Domain != "" {
+                granted, err := h.domains.grantedTo(r.Context(), req.Domain, userID)
+                if err != nil {
+                        http.Error(w, "Error checking domain", http.StatusInternalServerError)
+                        return
+                }
+                if granted == nil {
+                        http.Error(w, "You don't have access to this domain", http.StatusForbidden)
+                        return
+                }
+                domain = granted.Host
+        }
+
+        // Validate the custom slug; availability is enforced by the store on insert
+        customSlug := req.Slug != ""
+        if customSlug && !utils.IsValidSlug(req.Slug) {
+                http.Error(w, invalidSlugMessage, http.StatusBadRequest)
+                return
+        }
+        if customSlug && h.slugs.Reserved(req.Slug) {
+                http.Error(w, reservedSlugMessage, http.StatusBadRequest)
                 return
         }
 
-        // Generate a slug if not provided
-        if req.Slug == "" {
-                req.Slug = utils.GenerateSlug(6)
-        } else {
-                // Validate the custom slug
-                if !utils.IsValidSlug(req.Slug) {
-                        http.Error(w, "Invalid slug format. Use only letters, numbers, hyphens, and underscores", http.StatusBadRequest)
+        // Pick the slug generator, defaulting to the deployment's strategy
+        slugGenerator, ok := h.slugs.Get(req.SlugStrategy)
+        if !ok {
+                http.Error(w, "Unknown slug strategy. Use one of: "+strings.Join(utils.SlugStrategies, ", "), http.StatusBadRequest)
+                return
+        }
+
+        // Parse expiry date if provided
+        var expiresAt *time.Time
+        if req.ExpiresAt != nil {
+                expiresAt, err = parseExpiry(*req.ExpiresAt)
+                if err != nil {
+                        http.Error(w, "Invalid expiry date format", http.StatusBadRequest)
                         return
                 }
+        }
 
-                // Check if slug already exists
-                existingURL, err := h.repo.GetShortURLBySlug(r.Context(), req.Slug)
+        // Parse the activation time if provided; the store keeps scheduled links inactive
+        if req.StartsAt != nil {
+                http.Error(w, startsAtMessage, http.StatusBadRequest)
+                return
+        }
+        var activateAt *time.Time
+        if req.ActivateAt != nil {
+                activateAt, err = parseActivation(*req.ActivateAt)
                 if err != nil {
-                        http.Error(w, "Error checking slug availability", http.StatusInternalServerError)
+                        http.Error(w, "Invalid activation date format", http.StatusBadRequest)
                         return
                 }
-                if existingURL != nil {
-                        http.Error(w, "Slug already in use", http.StatusConflict)
+        }
+        if !activatesBeforeExpiry(activateAt, expiresAt) {
+                http.Error(w, "The activation date must be before the expiry date", http.StatusBadRequest)
+                return
+        }
+
+        // Parse the schedule and fallback destination if provided
+        schedule, err := normalizeSchedule(req.Schedule)
+        if err != nil {
+                http.Error(w, "Invalid schedule: "+err.Error(), http.StatusBadRequest)
+                return
+        }
+        var fallbackURL string
+        if req.FallbackURL != "" {
+                fallback, ok := h.checkDestination(w, r, req.FallbackURL)
+                if !ok {
                         return
                 }
+                fallbackURL = fallback.Original
+        }
+        if req.MaxClicks < 0 {
+                http.Error(w, "maxClicks can't be negative", http.StatusBadRequest)
+                return
+        }
+        if !validRedirectType(req.RedirectType) {
+                http.Error(w, invalidRedirectTypeMessage, http.StatusBadRequest)
+                return
+        }
+        if !validQueryPassthrough(req.QueryPassthrough) {
+                http.Error(w, invalidQueryPassthroughMessage, http.StatusBadRequest)
+                return
         }
 
-        // Parse expiry date if provided
-        var expiresAt *time.Time
-        if req.ExpiresAt != nil && *req.ExpiresAt != "" && *req.ExpiresAt != "never" {
-                var expiry time.Time
-                switch *req.ExpiresAt {
-                case "1day":
-                        expiry = time.Now().Add(24 * time.Hour)
-                case "7days":
-                        expiry = time.Now().Add(7 * 24 * time.Hour)
-                case "30days":
-                        expiry = time.Now().Add(30 * 24 * time.Hour)
-                default:
-                        // Try to parse as ISO string
-                        parsedTime, err := time.Parse(time.RFC3339, *req.ExpiresAt)
-                        if err != nil {
-                                http.Error(w, "Invalid expiry date format", http.StatusBadRequest)
-                                return
-                        }
-                        expiry = parsedTime
+        // Reuse the caller's existing link to the same destination if asked to.
+        // Only plain links are reused: a request with link settings always gets
+        // a new link, and an existing link with settings isn't handed out for
+        // a request without them.
+        if req.Dedupe && !hasLinkSettings(&req) {
+                existingURL, err := h.repo.GetActiveShortURLByNormalizedURL(r.Context(), userID, domain, destination.Normalized)
+                if err != nil {
+                        http.Error(w, "Error checking for an existing short URL", http.StatusInternalServerError)
+                        return
+                }
+                if existingURL != nil && plainShortURL(existingURL) {
+                        h.setShortLink(r, existingURL)
+                        w.Header().Set("Content-Type", "application/json")
+                        json.NewEncoder(w).Encode(existingURL)
+                        return
+                }
+        }
+
+        // Hash the link password if provided
+        var passwordHash string
+        if req.Password != "" {
+                if !validLinkPassword(req.Password) {
+                        http.Error(w, "Password must be at most 72 bytes", http.StatusBadRequest)
+                        return
+                }
+                passwordHash, err = auth.HashPassword(req.Password)
+                if err != nil {
+                        http.Error(w, "Error processing password", http.StatusInternalServerError)
+                        return
                 }
-                expiresAt = &expiry
         }
 
         // Create the short URL object
         shortURL := models.ShortURL{
-                UserID:      userID,
-                OriginalURL: req.OriginalURL,
-                Slug:        req.Slug,
-                ExpiresAt:   expiresAt,
+                UserID:           userID,
+                Domain:           domain,
+                OriginalURL:      destination.Original,
+                NormalizedURL:    destination.Normalized,
+                Slug:             req.Slug,
+                ExpiresAt:        expiresAt,
+                ActivateAt:       activateAt,
+                Schedule:         schedule,
+                FallbackURL:      fallbackURL,
+                MaxClicks:        req.MaxClicks,
+                PasswordHash:     passwordHash,
+                RedirectType:     req.RedirectType,
+                QueryPassthrough: req.QueryPassthrough,
+                Wildcard:         req.Wildcard,
         }
 
-        // Save to the database
-        createdURL, err := h.repo.CreateShortURL(r.Context(), shortURL)
+        // Save to the database, generating a fresh slug on each collision
+        var createdURL *models.ShortURL
+        for attempt := 1; ; attempt++ {
+                if !customSlug {
+                        shortURL.Slug, err = slugGenerator.GenerateSlug(r.Context())
+                        if err != nil {
+                                http.Error(w, "Error generating slug", http.StatusInternalServerError)
+                                return
+                        }
+                }
+
+                // A generated slug that happens to be reserved counts as a collision
+                if h.slugs.Reserved(shortURL.Slug) {
+                        createdURL, err = nil, database.ErrSlugTaken
+                } else {
+                        createdURL, err = h.repo.CreateShortURL(r.Context(), shortURL)
+                }
+                if !errors.Is(err, database.ErrSlugTaken) {
+                        break
+                }
+                if customSlug {
+                        http.Error(w, "Slug already in use", http.StatusConflict)
+                        return
+                }
+                if attempt == maxSlugAttempts {
+                        break
+                }
+        }
         if err != nil {
                 http.Error(w, "Error creating short URL", http.StatusInternalServerError)
                 return
         }
 
-        // Return the created URL
+        // Start the link's history
+        h.recordRevision(r.Context(), models.NewShortURLRevision(createdURL, models.RevisionCreate, userID, nil))
+
+        // Return the created URL with its full short link
+        h.setShortLink(r, createdURL)
+        setETag(w, createdURL)
         w.Header().Set("Content-Type", "application/json")
         w.WriteHeader(http.StatusCreated)
         json.NewEncoder(w).Encode(createdURL)
@@ -122,6 +265,13 @@ func (h *URLHandler) CreateShortURL(w http.ResponseWriter, r *http.Request) {
 
 // GetShortURL retrieves a short URL by ID
 func (h *URLHandler) GetShortURL(w http.ResponseWriter, r *http.Request) {
+        // Get user ID from context (set by auth middleware)
+        userID, ok := auth.UserIDFromContext(r.Context())
+        if !ok {
+                http.Error(w, "Unauthorized", http.StatusUnauthorized)
+                return
+        }
+
         // Get ID from URL parameters
         vars := mux.Vars(r)
         idStr := vars["id"]
@@ -140,20 +290,202 @@ func (h *URLHandler) GetShortURL(w http.ResponseWriter, r *http.Request) {
                 return
         }
 
-        if shortURL == nil {
+        // Links owned by other users are reported as missing so their IDs don't leak,
+        // and links in the trash are only visible there
+        if shortURL == nil || shortURL.UserID != userID || shortURL.DeletedAt != nil {
                 http.Error(w, "Short URL not found", http.StatusNotFound)
                 return
         }
 
         // Return the short URL
+        h.setShortLink(r, shortURL)
+        setETag(w, shortURL)
         w.Header().Set("Content-Type", "application/json")
         json.NewEncoder(w).Encode(shortURL)
 }
 
+// UpdateShortURL changes the destination, slug, expiry, activation, availability, redirect behaviour or active state of a short URL.
+// The update must name the version it is based on, in an If-Match header or the body.
+func (h *URLHandler) UpdateShortURL(w http.ResponseWriter, r *http.Request) {
+        // Get user ID from context (set by auth middleware)
+        userID, ok := auth.UserIDFromContext(r.Context())
+        if !ok {
+                http.Error(w, "Unauthorized", http.StatusUnauthorized)
+                return
+        }
+
+        // Get ID from URL parameters
+        vars := mux.Vars(r)
+        id, err := primitive.ObjectIDFromHex(vars["id"])
+        if err != nil {
+                http.Error(w, "Invalid ID format", http.StatusBadRequest)
+                return
+        }
+
+        // Parse the request body
+        var req models.URLUpdateRequest
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+                http.Error(w, "Invalid request body", http.StatusBadRequest)
+                return
+        }
+
+        // Get the current state of the link
+        shortURL, err := h.repo.GetShortURL(r.Context(), id)
+        if err != nil {
+                http.Error(w, "Error retrieving short URL", http.StatusInternalServerError)
+                return
+        }
+        if shortURL == nil || shortURL.UserID != userID || shortURL.DeletedAt != nil {
+                http.Error(w, "Short URL not found", http.StatusNotFound)
+                return
+        }
+
+        // Work out which version the update is based on
+        version, ok := requestVersion(r, req.Version, shortURL.Version)
+        if !ok {
+                http.Error(w, "Send the version being updated in an If-Match header or the request body", http.StatusPreconditionRequired)
+                return
+        }
+        if version != shortURL.Version {
+                http.Error(w, "Short URL has been modified since it was read", http.StatusPreconditionFailed)
+                return
+        }
+
+        // Apply the changes, validating them the same way as on creation
+        before := *shortURL
+        if req.OriginalURL != nil {
+                destination, ok := h.checkOriginalURL(w, r, *req.OriginalURL)
+                if !ok {
+                        return
+                }
+                shortURL.OriginalURL = destination.Original
+                shortURL.NormalizedURL = destination.Normalized
+        }
+        if req.Slug != nil {
+                shortURL.Slug = *req.Slug
+        }
+        if req.ExpiresAt != nil {
+                shortURL.ExpiresAt, err = parseExpiry(*req.ExpiresAt)
+                if err != nil {
+                        http.Error(w, "Invalid expiry date format", http.StatusBadRequest)
+                        return
+                }
+        }
+        if req.StartsAt != nil {
+                http.Error(w, startsAtMessage, http.StatusBadRequest)
+                return
+        }
+        if req.ActivateAt != nil {
+                shortURL.ActivateAt, err = parseActivation(*req.ActivateAt)
+                if err != nil {
+                        http.Error(w, "Invalid activation date format", http.StatusBadRequest)
+                        return
+                }
+                // Scheduling holds the link back; unscheduling releases it
+                shortURL.Active = shortURL.ActivateAt == nil
+        }
+        if req.Active != nil {
+                if *req.Active && shortURL.ActivateAt != nil {
+                        http.Error(w, "A link scheduled for activation can't be activated now; clear activateAt instead", http.StatusBadRequest)
+                        return
+                }
+                if !*req.Active && req.ActivateAt != nil && shortURL.ActivateAt != nil {
+                        http.Error(w, "A link can't be deactivated and scheduled for activation at once", http.StatusBadRequest)
+                        return
+                }
+                // Deactivating cancels a pending activation, so the lifecycle
+                // worker doesn't switch the link back on
+                if !*req.Active {
+                        shortURL.ActivateAt = nil
+                }
+                shortURL.Active = *req.Active
+        }
+        if req.Schedule != nil {
+                shortURL.Schedule, err = normalizeSchedule(req.Schedule)
+                if err != nil {
+                        http.Error(w, "Invalid schedule: "+err.Error(), http.StatusBadRequest)
+                        return
+                }
+        }
+        if req.FallbackURL != nil {
+                shortURL.FallbackURL = ""
+                if *req.FallbackURL != "" {
+                        fallback, ok := h.checkDestination(w, r, *req.FallbackURL)
+                        if !ok {
+                                return
+                        }
+                        shortURL.FallbackURL = fallback.Original
+                }
+        }
+        if req.MaxClicks != nil {
+                if *req.MaxClicks < 0 {
+                        http.Error(w, "maxClicks can't be negative", http.StatusBadRequest)
+                        return
+                }
+                shortURL.MaxClicks = *req.MaxClicks
+
+                // Raising the limit brings back a link its last click deactivated
+                if req.Active == nil && !before.Active && before.ActivateAt == nil && clicksUsedUp(&before) && !clicksUsedUp(shortURL) {
+                        shortURL.Active = true
+                }
+        }
+        if req.Password != nil {
+                shortURL.PasswordHash = ""
+                if *req.Password != "" {
+                        if !validLinkPassword(*req.Password) {
+                                http.Error(w, "Password must be at most 72 bytes", http.StatusBadRequest)
+                                return
+                        }
+                        shortURL.PasswordHash, err = auth.HashPassword(*req.Password)
+                        if err != nil {
+                                http.Error(w, "Error processing password", http.StatusInternalServerError)
+                                return
+                        }
+                }
+        }
+        if req.RedirectType != nil {
+                shortURL.RedirectType = *req.RedirectType
+        }
+        if req.QueryPassthrough != nil {
+                shortURL.QueryPassthrough = *req.QueryPassthrough
+        }
+        if req.Wildcard != nil {
+                shortURL.Wildcard = *req.Wildcard
+        }
+        if !h.checkSettings(w, &before, shortURL) {
+                return
+        }
+
+        // Save, unless someone else got there first
+        updatedURL, err := h.repo.UpdateShortURL(r.Context(), *shortURL, version)
+        if err != nil {
+                switch {
+                case errors.Is(err, database.ErrNotFound):
+                        http.Error(w, "Short URL not found", http.StatusNotFound)
+                case errors.Is(err, database.ErrVersionConflict):
+                        http.Error(w, "Short URL has been modified since it was read", http.StatusPreconditionFailed)
+                case errors.Is(err, database.ErrSlugTaken):
+                        http.Error(w, "Slug already in use", http.StatusConflict)
+                default:
+                        http.Error(w, "Error updating short URL", http.StatusInternalServerError)
+                }
+                return
+        }
+
+        // Record what changed
+        h.recordRevision(r.Context(), models.NewShortURLRevision(updatedURL, models.RevisionUpdate, userID, changedFields(&before, updatedURL)))
+
+        // Return the updated URL
+        h.setShortLink(r, updatedURL)
+        setETag(w, updatedURL)
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(updatedURL)
+}
+
 // GetAllShortURLs handles retrieving all short URLs for the current user
 func (h *URLHandler) GetAllShortURLs(w http.ResponseWriter, r *http.Request) {
         // Get user ID from context (set by auth middleware)
-        userID, ok := r.Context().Value("userID").(primitive.ObjectID)
+        userID, ok := auth.UserIDFromContext(r.Context())
         if !ok {
                 http.Error(w, "Unauthorized", http.StatusUnauthorized)
                 return
@@ -167,12 +499,20 @@ func (h *URLHandler) GetAllShortURLs(w http.ResponseWriter, r *http.Request) {
         }
 
         // Return the short URLs
+        h.setShortLinks(r, shortURLs)
         w.Header().Set("Content-Type", "application/json")
         json.NewEncoder(w).Encode(shortURLs)
 }
 
-// DeleteShortURL deletes a short URL by ID
+// DeleteShortURL moves a short URL to the trash
 func (h *URLHandler) DeleteShortURL(w http.ResponseWriter, r *http.Request) {
+        // Get user ID from context (set by auth middleware)
+        userID, ok := auth.UserIDFromContext(r.Context())
+        if !ok {
+                http.Error(w, "Unauthorized", http.StatusUnauthorized)
+                return
+        }
+
         // Get ID from URL parameters
         vars := mux.Vars(r)
         idStr := vars["id"]
@@ -184,9 +524,13 @@ func (h *URLHandler) DeleteShortURL(w http.ResponseWriter, r *http.Request) {
                 return
         }
 
-        // Delete the short URL from the database
-        err = h.repo.DeleteShortURL(r.Context(), id)
+        // Move the short URL to the trash; it is purged after the retention period
+        err = h.repo.DeleteShortURL(r.Context(), id, userID)
         if err != nil {
+                if errors.Is(err, database.ErrNotFound) {
+                        http.Error(w, "Short URL not found", http.StatusNotFound)
+                        return
+                }
                 http.Error(w, "Error deleting short URL", http.StatusInternalServerError)
                 return
         }
@@ -194,29 +538,34 @@ func (h *URLHandler) DeleteShortURL(w http.ResponseWriter, r *http.Request) {
         // Return success message
         w.Header().Set("Content-Type", "application/json")
         w.WriteHeader(http.StatusOK)
-        json.NewEncoder(w).Encode(map[string]string{"message": "Short URL deleted successfully"})
+        json.NewEncoder(w).Encode(map[string]string{"message": "Short URL moved to trash"})
 }
 
-// RedirectShortURL handles the redirection of a short URL
+// RedirectShortURL handles the redirection of a short URL. The slug is looked
+// up on the branded domain the request was sent to, or on the default domain.
 func (h *URLHandler) RedirectShortURL(w http.ResponseWriter, r *http.Request) {
         // Get slug from URL parameters
         vars := mux.Vars(r)
         slug := vars["slug"]
 
         // Get the short URL from the database
-        shortURL, err := h.repo.GetShortURLBySlug(r.Context(), slug)
+        shortURL, err := h.getRequestedShortURL(r, slug)
         if err != nil {
                 http.Error(w, "Error retrieving short URL", http.StatusInternalServerError)
                 return
         }
 
-        if shortURL == nil {
+        // Links in the trash keep their slug but no longer redirect
+        if shortURL == nil || shortURL.DeletedAt != nil {
                 http.Error(w, "Short URL not found", http.StatusNotFound)
                 return
         }
 
-        // Check if the URL is active and not expired
-        if !shortURL.Active {
+        // Check if the URL is active and not expired. A scheduled link counts as
+        // active once its time has come, even before the lifecycle worker gets
+        // to it; until then it is outside its availability window. A link whose
+        // last click deactivated it is answered as used up further down.
+        if !shortURL.Active && shortURL.ActivateAt == nil && !clicksUsedUp(shortURL) {
                 http.Error(w, "This link is inactive", http.StatusGone)
                 return
         }
@@ -226,6 +575,62 @@ func (h *URLHandler) RedirectShortURL(w http.ResponseWriter, r *http.Request) {
                 return
         }
 
+        // Password-protected links only go further once unlocked
+        if shortURL.PasswordHash != "" && !h.unlockShortURL(w, r, shortURL) {
+                return
+        }
+
+        // Outside its availability window the link sends visitors to its fallback, if it has one.
+        // Visits sent to the fallback are recorded, but don't count as clicks.
+        var destination string
+        direct := false
+        countClick := true
+        if !available(shortURL, time.Now()) {
+                if shortURL.FallbackURL == "" {
+                        http.Error(w, h.availability.UnavailableMessage, h.availability.UnavailableStatus)
+                        return
+                }
+                destination = shortURL.FallbackURL
+                countClick = false
+        } else {
+                // Skip over links to our own short links, refusing to redirect in a loop
+                destination, err = h.followSelfLinks(r.Context(), r.Host, shortURL)
+                if errors.Is(err, errRedirectLoop) {
+                        http.Error(w, "This link redirects in a loop", http.StatusLoopDetected)
+                        return
+                }
+                if err != nil {
+                        http.Error(w, "Error retrieving short URL", http.StatusInternalServerError)
+                        return
+                }
+
+                // Fill in destination templates, and carry the rest of the path and
+                // the query over if the link asks for it
+                var placedPath bool
+                direct = destination == shortURL.OriginalURL
+                destination, placedPath = h.expandDestination(r, shortURL, destination)
+                destination = passThrough(r, shortURL, destination, !placedPath)
+        }
+
+        // A link with a click limit counts the click before redirecting, so
+        // concurrent visitors can't get past the limit
+        if countClick && shortURL.MaxClicks > 0 {
+                err := h.countClick(r.Context(), shortURL)
+                switch {
+                case errors.Is(err, database.ErrClickLimitReached):
+                        if shortURL.FallbackURL == "" {
+                                http.Error(w, h.availability.ExhaustedMessage, h.availability.ExhaustedStatus)
+                                return
+                        }
+                        destination = shortURL.FallbackURL
+                        direct = false
+                case err != nil:
+                        http.Error(w, "Error recording click", http.StatusInternalServerError)
+                        return
+                }
+                countClick = false
+        }
+
         // Record the click event (in a goroutine to not block the redirection)
         go func() {
                 // Create a new context for the background operation
@@ -233,10 +638,12 @@ func (h *URLHandler) RedirectShortURL(w http.ResponseWriter, r *http.Request) {
                 defer cancel()
                 
                 // Increment the click count
-                _, err := h.repo.UpdateShortURLClicks(ctx, shortURL.ID)
-                if err != nil {
-                        // Just log the error, don't affect the user's redirect
-                        utils.LogError("Failed to update click count", err)
+                if countClick {
+                        err := h.countClick(ctx, shortURL)
+                        if err != nil {
+                                // Just log the error, don't affect the user's redirect
+                                utils.LogError("Failed to update click count", err)
+                        }
                 }
                 
                 // Create a click event
@@ -247,28 +654,68 @@ func (h *URLHandler) RedirectShortURL(w http.ResponseWriter, r *http.Request) {
                 
                 device := utils.DetectDevice(r.UserAgent())
                 
+                // Attribute the click to the version and destination that served it
                 clickEvent := models.ClickEvent{
-                        ShortURLID: shortURL.ID,
-                        IPAddress:  r.RemoteAddr,
-                        UserAgent:  r.UserAgent(),
-                        Referer:    referer,
-                        Device:     device,
+                        ShortURLID:      shortURL.ID,
+                        ShortURLVersion: shortURL.Version,
+                        Destination:     destination,
+                        IPAddress:       r.RemoteAddr,
+                        UserAgent:       r.UserAgent(),
+                        Referer:         referer,
+                        Device:          device,
                 }
                 
-                _, err = h.repo.CreateClickEvent(ctx, clickEvent)
+                _, err := h.repo.CreateClickEvent(ctx, clickEvent)
                 if err != nil {
                         utils.LogError("Failed to create click event", err)
                 }
         }()
 
-        // Redirect to the original URL
-        http.Redirect(w, r, shortURL.OriginalURL, http.StatusTemporaryRedirect)
+        // Send the visitor on the way the link asks for
+        h.writeRedirect(w, r, shortURL, destination, direct)
+}
+
+// countClick counts a click on shortURL. The click that uses up a limited
+// link deactivates it, which is saved as an expire revision like those of
+// the lifecycle worker.
+func (h *URLHandler) countClick(ctx context.Context, shortURL *models.ShortURL) error {
+        updated, err := h.repo.UpdateShortURLClicks(ctx, shortURL.ID)
+        if err != nil {
+                return err
+        }
+        if updated.MaxClicks > 0 && updated.Clicks == updated.MaxClicks {
+                h.recordRevision(ctx, models.NewShortURLRevision(updated, models.RevisionExpire, primitive.NilObjectID, changedFields(shortURL, updated)))
+        }
+        return nil
+}
+
+// clicksUsedUp reports whether shortURL has reached its click limit
+func clicksUsedUp(shortURL *models.ShortURL) bool {
+        return shortURL.MaxClicks > 0 && shortURL.Clicks >= shortURL.MaxClicks
 }
 
-// GetAnalytics retrieves analytics data for the dashboard
+// GetAnalytics retrieves analytics data for the current user's dashboard
 func (h *URLHandler) GetAnalytics(w http.ResponseWriter, r *http.Request) {
+        // Get user ID from context (set by auth middleware)
+        userID, ok := auth.UserIDFromContext(r.Context())
+        if !ok {
+                http.Error(w, "Unauthorized", http.StatusUnauthorized)
+                return
+        }
+
+        h.writeStats(w, r, userID)
+}
+
+// GetGlobalAnalytics retrieves analytics data across all users.
+// The route must be guarded by an admin check.
+func (h *URLHandler) GetGlobalAnalytics(w http.ResponseWriter, r *http.Request) {
+        h.writeStats(w, r, primitive.NilObjectID)
+}
+
+// writeStats writes the analytics data for userID, or for everyone if userID is nil
+func (h *URLHandler) writeStats(w http.ResponseWriter, r *http.Request, userID primitive.ObjectID) {
         // Get the analytics data
-        stats, err := h.repo.GetClickStats(r.Context())
+        stats, err := h.repo.GetClickStats(r.Context(), userID)
         if err != nil {
                 http.Error(w, "Error retrieving analytics data", http.StatusInternalServerError)
                 return
@@ -277,4 +724,177 @@ func (h *URLHandler) GetAnalytics(w http.ResponseWriter, r *http.Request) {
         // Return the analytics data
         w.Header().Set("Content-Type", "application/json")
         json.NewEncoder(w).Encode(stats)
-}
\ No newline at end of file
+}
+
+// invalidSlugMessage is the error returned for slugs that fail utils.IsValidSlug
+const invalidSlugMessage = "Invalid slug format. Use only letters, numbers, hyphens, and underscores"
+
+// reservedSlugMessage is the error returned for slugs reserved for the service's own paths
+const reservedSlugMessage = "This slug is reserved"
+
+// startsAtMessage is the error returned for requests that still send startsAt
+const startsAtMessage = "startsAt is not supported; use activateAt"
+
+// invalidRedirectTypeMessage is the error returned for redirect types that fail validRedirectType
+var invalidRedirectTypeMessage = "Invalid redirect type. Use one of: " + strings.Join(redirectTypes, ", ")
+
+// invalidQueryPassthroughMessage is the error returned for modes that fail validQueryPassthrough
+const invalidQueryPassthroughMessage = "Invalid query passthrough. Use \"" + models.QueryPassthroughLink + "\", \"" + models.QueryPassthroughRequest + "\" or \"\""
+
+// checkSettings validates the settings of shortURL that an update or a
+// rollback may have changed from before, the saved link. It writes an error
+// response and returns false if one is invalid. A slug the link already has
+// is kept even if it has been reserved since.
+func (h *URLHandler) checkSettings(w http.ResponseWriter, before, shortURL *models.ShortURL) bool {
+        if shortURL.Slug != before.Slug {
+                if !utils.IsValidSlug(shortURL.Slug) {
+                        http.Error(w, invalidSlugMessage, http.StatusBadRequest)
+                        return false
+                }
+                if h.slugs.Reserved(shortURL.Slug) {
+                        http.Error(w, reservedSlugMessage, http.StatusBadRequest)
+                        return false
+                }
+        }
+        if !activatesBeforeExpiry(shortURL.ActivateAt, shortURL.ExpiresAt) {
+                http.Error(w, "The activation date must be before the expiry date", http.StatusBadRequest)
+                return false
+        }
+        if !validRedirectType(shortURL.RedirectType) {
+                http.Error(w, invalidRedirectTypeMessage, http.StatusBadRequest)
+                return false
+        }
+        if !validQueryPassthrough(shortURL.QueryPassthrough) {
+                http.Error(w, invalidQueryPassthroughMessage, http.StatusBadRequest)
+                return false
+        }
+        return true
+}
+
+// checkDestination validates and normalizes a destination URL, resolves or
+// rejects links back to this service and applies the destination policy.
+// It writes an error response and returns false if the URL can't be used.
+func (h *URLHandler) checkDestination(w http.ResponseWriter, r *http.Request, rawURL string) (*urlnorm.Result, bool) {
+        if rawURL == "" {
+                http.Error(w, "Original URL is required", http.StatusBadRequest)
+                return nil, false
+        }
+
+        // Check the URL is valid and work out its canonical form
+        destination, err := h.normalizer.Normalize(rawURL)
+        if err != nil {
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return nil, false
+        }
+
+        // Reject or resolve destinations that are short links on this service
+        destination, err = h.resolveSelfLinks(r.Context(), r.Host, destination)
+        var violation *policy.Violation
+        if errors.As(err, &violation) {
+                http.Error(w, "Destination not allowed: "+violation.Reason, http.StatusUnprocessableEntity)
+                return nil, false
+        }
+        if err != nil {
+                http.Error(w, "Error resolving destination", http.StatusInternalServerError)
+                return nil, false
+        }
+
+        // Check the destination against the blocklists and IP filters
+        if err := h.policy.Check(destination.Normalized); err != nil {
+                http.Error(w, "Destination not allowed: "+err.Error(), http.StatusUnprocessableEntity)
+                return nil, false
+        }
+
+        return destination, true
+}
+
+// parseExpiry parses an expiry preset ("1day", "7days", "30days"), an RFC 3339
+// time, or "never" / "" for no expiry
+func parseExpiry(value string) (*time.Time, error) {
+        var expiry time.Time
+        switch value {
+        case "", "never":
+                return nil, nil
+        case "1day":
+                expiry = time.Now().Add(24 * time.Hour)
+        case "7days":
+                expiry = time.Now().Add(7 * 24 * time.Hour)
+        case "30days":
+                expiry = time.Now().Add(30 * 24 * time.Hour)
+        default:
+                // Try to parse as ISO string
+                parsedTime, err := time.Parse(time.RFC3339, value)
+                if err != nil {
+                        return nil, err
+                }
+                expiry = parsedTime
+        }
+        return &expiry, nil
+}
+
+// parseActivation parses an RFC 3339 activation time, or "" for none. A time
+// that has already passed means the link is active straight away, so it is
+// returned as no activation time.
+func parseActivation(value string) (*time.Time, error) {
+        if value == "" {
+                return nil, nil
+        }
+        activateAt, err := time.Parse(time.RFC3339, value)
+        if err != nil {
+                return nil, err
+        }
+        if !activateAt.After(time.Now()) {
+                return nil, nil
+        }
+        return &activateAt, nil
+}
+
+// hasLinkSettings reports whether req sets anything beyond the destination,
+// domain and slug strategy of the link to create
+func hasLinkSettings(req *models.URLRequest) bool {
+        return req.Slug != "" || req.ExpiresAt != nil || req.ActivateAt != nil || req.Schedule != nil || req.FallbackURL != "" ||
+                req.MaxClicks != 0 || req.Password != "" || req.RedirectType != "" || req.QueryPassthrough != "" || req.Wildcard
+}
+
+// plainShortURL reports whether shortURL has none of the settings hasLinkSettings looks for
+func plainShortURL(shortURL *models.ShortURL) bool {
+        return shortURL.ExpiresAt == nil && shortURL.ActivateAt == nil && shortURL.Schedule == nil && shortURL.FallbackURL == "" &&
+                shortURL.MaxClicks == 0 && shortURL.PasswordHash == "" && shortURL.RedirectType == "" && shortURL.QueryPassthrough == "" && !shortURL.Wildcard
+}
+
+// activatesBeforeExpiry reports whether a link that starts at activateAt
+// would become active before it expires
+func activatesBeforeExpiry(activateAt, expiresAt *time.Time) bool {
+        return activateAt == nil || expiresAt == nil || activateAt.Before(*expiresAt)
+}
+
+// setETag sets the ETag header to the version of shortURL
+func setETag(w http.ResponseWriter, shortURL *models.ShortURL) {
+        w.Header().Set("ETag", strconv.Quote(strconv.Itoa(shortURL.Version)))
+}
+
+// requestVersion returns the version an update is based on, taken from the
+// If-Match header or else from bodyVersion. "If-Match: *" matches current,
+// and a tag that isn't a version matches nothing. It reports false if
+// neither is given.
+func requestVersion(r *http.Request, bodyVersion *int, current int) (int, bool) {
+        ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+        if ifMatch == "*" {
+                return current, true
+        }
+        if ifMatch != "" {
+                tag, err := strconv.Unquote(strings.TrimPrefix(ifMatch, "W/"))
+                if err != nil {
+                        return -1, true
+                }
+                version, err := strconv.Atoi(tag)
+                if err != nil {
+                        return -1, true
+                }
+                return version, true
+        }
+        if bodyVersion != nil {
+                return *bodyVersion, true
+        }
+        return 0, false
+}
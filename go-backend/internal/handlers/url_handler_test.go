@@ -0,0 +1,435 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"shortlink/internal/auth"
+	"shortlink/internal/database"
+	"shortlink/internal/models"
+	"shortlink/internal/policy"
+	"shortlink/pkg/urlnorm"
+	"shortlink/pkg/utils"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// newTestURLHandler returns a URLHandler backed by repo with the default configuration
+func newTestURLHandler(t *testing.T, repo *database.MemoryRepository) *URLHandler {
+	t.Helper()
+
+	slugs, err := utils.NewSlugGenerators(utils.SlugConfig{Strategy: utils.SlugStrategyRandom, Length: 6, Reserved: utils.DefaultReservedSlugs}, nil)
+	if err != nil {
+		t.Fatalf("NewSlugGenerators: %v", err)
+	}
+	engine, err := policy.New(policy.Config{SelfLinks: policy.SelfLinksReject})
+	if err != nil {
+		t.Fatalf("policy.New: %v", err)
+	}
+	return NewURLHandler(repo, NewDomains(repo), slugs, urlnorm.New(urlnorm.DefaultOptions()), engine, AvailabilityConfig{}, LinkAccessConfig{}, RedirectConfig{}, "")
+}
+
+// serve calls handler as userID, or anonymously if userID is nil, with vars as the route variables
+func serve(handler http.HandlerFunc, method, target, body string, userID primitive.ObjectID, vars map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "http://sho.rt"+target, strings.NewReader(body))
+	if !userID.IsZero() {
+		r = r.WithContext(auth.WithUserID(r.Context(), userID))
+	}
+	r.Header.Set("If-Match", "*")
+	r = mux.SetURLVars(r, vars)
+
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestOwnership(t *testing.T) {
+	repo := database.NewMemoryRepository()
+	h := newTestURLHandler(t, repo)
+	alice, bob := primitive.NewObjectID(), primitive.NewObjectID()
+
+	w := serve(h.CreateShortURL, http.MethodPost, "/api/urls", `{"originalUrl":"https://example.com/alice"}`, alice, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("CreateShortURL = %d %s", w.Code, w.Body)
+	}
+	var link models.ShortURL
+	if err := json.NewDecoder(w.Body).Decode(&link); err != nil {
+		t.Fatalf("decoding the created link: %v", err)
+	}
+	if link.UserID != alice {
+		t.Fatalf("created link belongs to %s, want %s", link.UserID.Hex(), alice.Hex())
+	}
+	id := map[string]string{"id": link.ID.Hex()}
+	revision := map[string]string{"id": link.ID.Hex(), "version": "1"}
+
+	// Bob can't see, change or delete Alice's link, and isn't told it exists
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		body    string
+		vars    map[string]string
+	}{
+		{"get", h.GetShortURL, http.MethodGet, "", id},
+		{"update", h.UpdateShortURL, http.MethodPatch, `{"originalUrl":"https://example.com/bob"}`, id},
+		{"revisions", h.GetShortURLRevisions, http.MethodGet, "", id},
+		{"rollback", h.RollbackShortURL, http.MethodPost, "", revision},
+		{"delete", h.DeleteShortURL, http.MethodDelete, "", id},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(tt.handler, tt.method, "/api/urls/"+link.ID.Hex(), tt.body, primitive.NilObjectID, tt.vars); w.Code != http.StatusUnauthorized {
+				t.Fatalf("anonymous %s = %d, want %d", tt.name, w.Code, http.StatusUnauthorized)
+			}
+			if w := serve(tt.handler, tt.method, "/api/urls/"+link.ID.Hex(), tt.body, bob, tt.vars); w.Code != http.StatusNotFound {
+				t.Fatalf("%s by another user = %d %s, want %d", tt.name, w.Code, w.Body, http.StatusNotFound)
+			}
+		})
+	}
+
+	stored, err := repo.GetShortURL(context.Background(), link.ID)
+	if err != nil || stored == nil || stored.OriginalURL != "https://example.com/alice" || stored.DeletedAt != nil {
+		t.Fatalf("GetShortURL = %+v, %v, want Alice's link unchanged", stored, err)
+	}
+
+	// Each user only lists their own links
+	var links []models.ShortURL
+	if w := serve(h.GetAllShortURLs, http.MethodGet, "/api/urls", "", bob, nil); w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&links) != nil || len(links) != 0 {
+		t.Fatalf("GetAllShortURLs for another user = %d %v, want none", w.Code, links)
+	}
+	if w := serve(h.GetAllShortURLs, http.MethodGet, "/api/urls", "", alice, nil); w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&links) != nil || len(links) != 1 {
+		t.Fatalf("GetAllShortURLs for the owner = %d %v, want the link", w.Code, links)
+	}
+
+	// Alice can use her own link
+	if w := serve(h.GetShortURL, http.MethodGet, "/api/urls/"+link.ID.Hex(), "", alice, id); w.Code != http.StatusOK {
+		t.Fatalf("GetShortURL by the owner = %d %s", w.Code, w.Body)
+	}
+	if w := serve(h.UpdateShortURL, http.MethodPatch, "/api/urls/"+link.ID.Hex(), `{"originalUrl":"https://example.com/new"}`, alice, id); w.Code != http.StatusOK {
+		t.Fatalf("UpdateShortURL by the owner = %d %s", w.Code, w.Body)
+	}
+	if w := serve(h.RollbackShortURL, http.MethodPost, "/api/urls/"+link.ID.Hex(), "", alice, revision); w.Code != http.StatusOK {
+		t.Fatalf("RollbackShortURL by the owner = %d %s", w.Code, w.Body)
+	}
+	if w := serve(h.DeleteShortURL, http.MethodDelete, "/api/urls/"+link.ID.Hex(), "", alice, id); w.Code != http.StatusOK {
+		t.Fatalf("DeleteShortURL by the owner = %d %s", w.Code, w.Body)
+	}
+
+	// Only Alice can bring it back from the trash
+	if w := serve(h.GetDeletedShortURLs, http.MethodGet, "/api/trash", "", bob, nil); w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&links) != nil || len(links) != 0 {
+		t.Fatalf("GetDeletedShortURLs for another user = %d %v, want none", w.Code, links)
+	}
+	if w := serve(h.RestoreShortURL, http.MethodPost, "/api/trash/"+link.ID.Hex()+"/restore", "", bob, id); w.Code != http.StatusNotFound {
+		t.Fatalf("RestoreShortURL by another user = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := serve(h.RestoreShortURL, http.MethodPost, "/api/trash/"+link.ID.Hex()+"/restore", "", alice, id); w.Code != http.StatusOK {
+		t.Fatalf("RestoreShortURL by the owner = %d %s", w.Code, w.Body)
+	}
+}
+
+func TestUpdateShortURLVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		ifMatch string
+		body    string
+		status  int
+	}{
+		{"current version", `"1"`, `{"originalUrl":"https://example.com/new"}`, http.StatusOK},
+		{"weak tag", `W/"1"`, `{"originalUrl":"https://example.com/new"}`, http.StatusOK},
+		{"any version", "*", `{"originalUrl":"https://example.com/new"}`, http.StatusOK},
+		{"stale version", `"0"`, `{"originalUrl":"https://example.com/new"}`, http.StatusPreconditionFailed},
+		{"unquoted tag", "1", `{"originalUrl":"https://example.com/new"}`, http.StatusPreconditionFailed},
+		{"tag that isn't a version", `"abc"`, `{"originalUrl":"https://example.com/new"}`, http.StatusPreconditionFailed},
+		{"header wins over body", `"0"`, `{"originalUrl":"https://example.com/new","version":1}`, http.StatusPreconditionFailed},
+		{"body version", "", `{"originalUrl":"https://example.com/new","version":1}`, http.StatusOK},
+		{"stale body version", "", `{"originalUrl":"https://example.com/new","version":2}`, http.StatusPreconditionFailed},
+		{"no version", "", `{"originalUrl":"https://example.com/new"}`, http.StatusPreconditionRequired},
+		{"slug in use", `"1"`, `{"slug":"taken-slug"}`, http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := database.NewMemoryRepository()
+			h := newTestURLHandler(t, repo)
+			userID := primitive.NewObjectID()
+
+			if _, err := repo.CreateShortURL(context.Background(), models.ShortURL{UserID: userID, Slug: "taken-slug", OriginalURL: "https://example.com/"}); err != nil {
+				t.Fatalf("CreateShortURL: %v", err)
+			}
+			link, err := repo.CreateShortURL(context.Background(), models.ShortURL{UserID: userID, Slug: "patch-me", OriginalURL: "https://example.com/old"})
+			if err != nil {
+				t.Fatalf("CreateShortURL: %v", err)
+			}
+
+			r := httptest.NewRequest(http.MethodPatch, "http://sho.rt/api/urls/"+link.ID.Hex(), strings.NewReader(tt.body))
+			r = r.WithContext(auth.WithUserID(r.Context(), userID))
+			if tt.ifMatch != "" {
+				r.Header.Set("If-Match", tt.ifMatch)
+			}
+			r = mux.SetURLVars(r, map[string]string{"id": link.ID.Hex()})
+			w := httptest.NewRecorder()
+			h.UpdateShortURL(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("UpdateShortURL = %d %s, want %d", w.Code, w.Body, tt.status)
+			}
+			stored, err := repo.GetShortURL(context.Background(), link.ID)
+			if err != nil || stored == nil {
+				t.Fatalf("GetShortURL = %+v, %v", stored, err)
+			}
+			if tt.status != http.StatusOK {
+				if stored.Version != 1 || stored.OriginalURL != "https://example.com/old" {
+					t.Fatalf("rejected update changed the link to %+v", stored)
+				}
+				return
+			}
+			if stored.Version != 2 || stored.OriginalURL != "https://example.com/new" {
+				t.Fatalf("stored link = %+v, want version 2 with the new destination", stored)
+			}
+			if etag := w.Header().Get("ETag"); etag != `"2"` {
+				t.Fatalf("ETag = %s, want %q", etag, `"2"`)
+			}
+		})
+	}
+}
+
+func TestAnalyticsOwnership(t *testing.T) {
+	ctx := context.Background()
+	repo := database.NewMemoryRepository()
+	h := newTestURLHandler(t, repo)
+	alice, bob := primitive.NewObjectID(), primitive.NewObjectID()
+
+	stats := func(handler http.HandlerFunc, userID primitive.ObjectID) int {
+		t.Helper()
+		w := serve(handler, http.MethodGet, "/api/analytics", "", userID, nil)
+		var response models.StatsResponse
+		if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&response) != nil {
+			t.Fatalf("analytics = %d %s", w.Code, w.Body)
+		}
+		return response.TotalLinks
+	}
+
+	for i, userID := range []primitive.ObjectID{alice, alice, bob} {
+		if _, err := repo.CreateShortURL(ctx, models.ShortURL{
+			UserID:      userID,
+			Slug:        "analytics-" + string(rune('a'+i)),
+			OriginalURL: "https://example.com/",
+		}); err != nil {
+			t.Fatalf("CreateShortURL: %v", err)
+		}
+	}
+
+	if links := stats(h.GetAnalytics, alice); links != 2 {
+		t.Fatalf("GetAnalytics for Alice counts %d links, want 2", links)
+	}
+	if links := stats(h.GetAnalytics, bob); links != 1 {
+		t.Fatalf("GetAnalytics for Bob counts %d links, want 1", links)
+	}
+	if links := stats(h.GetGlobalAnalytics, bob); links != 3 {
+		t.Fatalf("GetGlobalAnalytics counts %d links, want 3", links)
+	}
+	if w := serve(h.GetAnalytics, http.MethodGet, "/api/analytics", "", primitive.NilObjectID, nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("anonymous GetAnalytics = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestDeactivateScheduledShortURL(t *testing.T) {
+	later := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"deactivate", `{"active":false}`, http.StatusOK},
+		{"deactivate and unschedule", `{"active":false,"activateAt":""}`, http.StatusOK},
+		{"deactivate and reschedule", `{"active":false,"activateAt":"` + later + `"}`, http.StatusBadRequest},
+		{"activate", `{"active":true}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := database.NewMemoryRepository()
+			h := newTestURLHandler(t, repo)
+			userID := primitive.NewObjectID()
+			activateAt := time.Now().Add(time.Minute)
+			link, err := repo.CreateShortURL(ctx, models.ShortURL{UserID: userID, Slug: "launch", OriginalURL: "https://example.com/", ActivateAt: &activateAt})
+			if err != nil {
+				t.Fatalf("CreateShortURL: %v", err)
+			}
+
+			w := serve(h.UpdateShortURL, http.MethodPatch, "/api/urls/"+link.ID.Hex(), tt.body, userID, map[string]string{"id": link.ID.Hex()})
+			if w.Code != tt.status {
+				t.Fatalf("UpdateShortURL = %d %s, want %d", w.Code, w.Body, tt.status)
+			}
+
+			// A deactivated link stays off once its activation time passes
+			changed, err := repo.ActivateScheduledShortURLs(ctx, activateAt.Add(time.Minute))
+			if err != nil {
+				t.Fatalf("ActivateScheduledShortURLs: %v", err)
+			}
+			if activated := len(changed) == 1; activated != (tt.status != http.StatusOK) {
+				t.Fatalf("ActivateScheduledShortURLs = %+v after %s", changed, tt.name)
+			}
+		})
+	}
+}
+
+// scriptedSequence returns the values in order, repeating the last, and counts the calls
+type scriptedSequence struct {
+	values []int64
+	calls  int
+}
+
+func (s *scriptedSequence) next(ctx context.Context) (int64, error) {
+	s.calls++
+	if len(s.values) == 0 {
+		return 0, errors.New("sequence unavailable")
+	}
+	return s.values[min(s.calls, len(s.values))-1], nil
+}
+
+// counterSlug returns the slug the counter strategy generates for n
+func counterSlug(t *testing.T, n int64) string {
+	t.Helper()
+
+	slugs, err := utils.NewSlugGenerators(utils.SlugConfig{Strategy: utils.SlugStrategyCounter, Length: 6}, (&scriptedSequence{values: []int64{n}}).next)
+	if err != nil {
+		t.Fatalf("NewSlugGenerators: %v", err)
+	}
+	generator, _ := slugs.Get("")
+	slug, err := generator.GenerateSlug(context.Background())
+	if err != nil {
+		t.Fatalf("GenerateSlug: %v", err)
+	}
+	return slug
+}
+
+func TestCreateShortURLSlugCollisions(t *testing.T) {
+	generated := `{"originalUrl":"https://example.com/new"}`
+
+	tests := []struct {
+		name     string
+		values   []int64
+		reserved []int64
+		body     string
+		status   int
+		calls    int
+		want     int64
+	}{
+		{"free slug", []int64{3}, nil, generated, http.StatusCreated, 1, 3},
+		{"retries taken slugs", []int64{1, 2, 3}, nil, generated, http.StatusCreated, 3, 3},
+		{"retries reserved slugs", []int64{4, 5}, []int64{4}, generated, http.StatusCreated, 2, 5},
+		{"gives up", []int64{1, 2, 1, 2, 1, 3}, nil, generated, http.StatusInternalServerError, maxSlugAttempts, 0},
+		{"generator fails", nil, nil, generated, http.StatusInternalServerError, 1, 0},
+		{"custom slug taken", []int64{3}, nil, `{"originalUrl":"https://example.com/new","slug":"taken"}`, http.StatusConflict, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := database.NewMemoryRepository()
+			userID := primitive.NewObjectID()
+			for _, slug := range []string{counterSlug(t, 1), counterSlug(t, 2), "taken"} {
+				if _, err := repo.CreateShortURL(ctx, models.ShortURL{UserID: userID, Slug: slug, OriginalURL: "https://example.com/other", Active: true}); err != nil {
+					t.Fatalf("CreateShortURL: %v", err)
+				}
+			}
+
+			var reserved []string
+			for _, n := range tt.reserved {
+				reserved = append(reserved, counterSlug(t, n))
+			}
+			sequence := &scriptedSequence{values: tt.values}
+			h := newTestURLHandler(t, repo)
+			h.slugs, _ = utils.NewSlugGenerators(utils.SlugConfig{Strategy: utils.SlugStrategyCounter, Length: 6, Reserved: reserved}, sequence.next)
+
+			w := serve(h.CreateShortURL, http.MethodPost, "/api/urls", tt.body, userID, nil)
+			if w.Code != tt.status || sequence.calls != tt.calls {
+				t.Fatalf("CreateShortURL = %d %s after %d slugs, want %d after %d", w.Code, w.Body, sequence.calls, tt.status, tt.calls)
+			}
+
+			links, err := repo.GetAllShortURLs(ctx, userID)
+			if err != nil {
+				t.Fatalf("GetAllShortURLs: %v", err)
+			}
+			if tt.status != http.StatusCreated {
+				if len(links) != 3 {
+					t.Fatalf("%d links stored after a failed create, want 3", len(links))
+				}
+				return
+			}
+			var link models.ShortURL
+			if err := json.NewDecoder(w.Body).Decode(&link); err != nil || link.Slug != counterSlug(t, tt.want) {
+				t.Fatalf("created slug %q, %v, want %q", link.Slug, err, counterSlug(t, tt.want))
+			}
+		})
+	}
+}
+
+func TestCreateShortURLDedupe(t *testing.T) {
+	later := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	tests := []struct {
+		name     string
+		existing models.ShortURL
+		body     string
+		status   int
+	}{
+		{"plain link", models.ShortURL{}, `{"originalUrl":"https://Example.com:443/docs","dedupe":true}`, http.StatusOK},
+		{"without dedupe", models.ShortURL{}, `{"originalUrl":"https://example.com/docs"}`, http.StatusCreated},
+		{"other destination", models.ShortURL{}, `{"originalUrl":"https://example.com/other","dedupe":true}`, http.StatusCreated},
+		{"custom slug", models.ShortURL{}, `{"originalUrl":"https://example.com/docs","dedupe":true,"slug":"my-docs"}`, http.StatusCreated},
+		{"expiry", models.ShortURL{}, `{"originalUrl":"https://example.com/docs","dedupe":true,"expiresAt":"` + later + `"}`, http.StatusCreated},
+		{"password", models.ShortURL{}, `{"originalUrl":"https://example.com/docs","dedupe":true,"password":"secret"}`, http.StatusCreated},
+		{"redirect type", models.ShortURL{}, `{"originalUrl":"https://example.com/docs","dedupe":true,"redirectType":"308"}`, http.StatusCreated},
+		{"max clicks", models.ShortURL{}, `{"originalUrl":"https://example.com/docs","dedupe":true,"maxClicks":1}`, http.StatusCreated},
+		{"wildcard", models.ShortURL{}, `{"originalUrl":"https://example.com/docs","dedupe":true,"wildcard":true}`, http.StatusCreated},
+		{"existing link has a password", models.ShortURL{PasswordHash: "hash"}, `{"originalUrl":"https://example.com/docs","dedupe":true}`, http.StatusCreated},
+		{"existing link is click-limited", models.ShortURL{MaxClicks: 3}, `{"originalUrl":"https://example.com/docs","dedupe":true}`, http.StatusCreated},
+		{"existing link redirects permanently", models.ShortURL{RedirectType: models.RedirectPermanent}, `{"originalUrl":"https://example.com/docs","dedupe":true}`, http.StatusCreated},
+		{"invalid slug", models.ShortURL{}, `{"originalUrl":"https://example.com/docs","dedupe":true,"slug":"no way"}`, http.StatusBadRequest},
+		{"reserved slug", models.ShortURL{}, `{"originalUrl":"https://example.com/docs","dedupe":true,"slug":"admin"}`, http.StatusBadRequest},
+		{"unknown redirect type", models.ShortURL{}, `{"originalUrl":"https://example.com/docs","dedupe":true,"redirectType":"sideways"}`, http.StatusBadRequest},
+		{"unknown slug strategy", models.ShortURL{}, `{"originalUrl":"https://example.com/docs","dedupe":true,"slugStrategy":"uuid"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := database.NewMemoryRepository()
+			h := newTestURLHandler(t, repo)
+			userID := primitive.NewObjectID()
+
+			existing := tt.existing
+			existing.UserID, existing.Slug, existing.Active = userID, "docs", true
+			existing.OriginalURL, existing.NormalizedURL = "https://example.com/docs", "https://example.com/docs"
+			stored, err := repo.CreateShortURL(ctx, existing)
+			if err != nil {
+				t.Fatalf("CreateShortURL: %v", err)
+			}
+
+			w := serve(h.CreateShortURL, http.MethodPost, "/api/urls", tt.body, userID, nil)
+			if w.Code != tt.status {
+				t.Fatalf("CreateShortURL = %d %s, want %d", w.Code, w.Body, tt.status)
+			}
+			if tt.status == http.StatusBadRequest {
+				return
+			}
+			var link models.ShortURL
+			if err := json.NewDecoder(w.Body).Decode(&link); err != nil {
+				t.Fatalf("decoding the link: %v", err)
+			}
+			if reused := link.ID == stored.ID; reused != (tt.status == http.StatusOK) {
+				t.Fatalf("CreateShortURL returned %s, existing link %s", link.ID.Hex(), stored.ID.Hex())
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -8,25 +9,169 @@ import (
 
 // ShortURL represents a shortened URL record
 type ShortURL struct {
-	ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
-	UserID      primitive.ObjectID  `bson:"userId" json:"userId"`
-	OriginalURL string              `bson:"originalUrl" json:"originalUrl"`
-	Slug        string              `bson:"slug" json:"slug"`
-	Clicks      int                 `bson:"clicks" json:"clicks"`
-	Active      bool                `bson:"active" json:"active"`
-	CreatedAt   time.Time           `bson:"createdAt" json:"createdAt"`
-	ExpiresAt   *time.Time          `bson:"expiresAt,omitempty" json:"expiresAt"`
+	ID               primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	UserID           primitive.ObjectID  `bson:"userId" json:"userId"`
+	Domain           string              `bson:"domain,omitempty" json:"domain"`
+	OriginalURL      string              `bson:"originalUrl" json:"originalUrl"`
+	NormalizedURL    string              `bson:"normalizedUrl,omitempty" json:"normalizedUrl"`
+	Slug             string              `bson:"slug" json:"slug"`
+	Clicks           int                 `bson:"clicks" json:"clicks"`
+	Active           bool                `bson:"active" json:"active"`
+	CreatedAt        time.Time           `bson:"createdAt" json:"createdAt"`
+	ExpiresAt        *time.Time          `bson:"expiresAt,omitempty" json:"expiresAt"`
+	Version          int                 `bson:"version" json:"version"`
+	DeletedAt        *time.Time          `bson:"deletedAt,omitempty" json:"deletedAt,omitempty"`
+	ActivateAt       *time.Time          `bson:"activateAt,omitempty" json:"activateAt"`
+	Schedule         *Schedule           `bson:"schedule,omitempty" json:"schedule"`
+	FallbackURL      string              `bson:"fallbackUrl,omitempty" json:"fallbackUrl"`
+	MaxClicks        int                 `bson:"maxClicks,omitempty" json:"maxClicks"`
+	PasswordHash     string              `bson:"passwordHash,omitempty" json:"-"`
+	RedirectType     string              `bson:"redirectType,omitempty" json:"redirectType"`
+	QueryPassthrough string              `bson:"queryPassthrough,omitempty" json:"queryPassthrough"`
+	Wildcard         bool                `bson:"wildcard,omitempty" json:"wildcard"`
+
+	// ShortLink is the fully qualified short link, filled in by the handlers
+	ShortLink        string              `bson:"-" json:"shortUrl,omitempty"`
+}
+
+// MarshalJSON adds passwordProtected to the JSON form of a short URL, which
+// never includes the password hash itself
+func (s ShortURL) MarshalJSON() ([]byte, error) {
+	type shortURL ShortURL
+	return json.Marshal(struct {
+		shortURL
+		PasswordProtected bool `json:"passwordProtected"`
+	}{shortURL(s), s.PasswordHash != ""})
+}
+
+// Redirect types. The status codes send visitors straight on; the other two
+// serve a page instead. An empty RedirectType means RedirectTemporary.
+const (
+	RedirectMovedPermanently = "301"
+	RedirectFound            = "302"
+	RedirectTemporary        = "307"
+	RedirectPermanent        = "308"
+
+	// RedirectInterstitial shows a page that moves on after a short delay
+	RedirectInterstitial = "interstitial"
+
+	// RedirectFrame shows the destination in a frame under the service's banner
+	RedirectFrame = "frame"
+)
+
+// Query passthrough modes, which forward the query string a short link is
+// visited with to its destination. An empty QueryPassthrough forwards nothing.
+const (
+	// QueryPassthroughLink keeps the destination's own value for a parameter
+	// the visitor also sent
+	QueryPassthroughLink = "link"
+
+	// QueryPassthroughRequest replaces the destination's value with the visitor's
+	QueryPassthroughRequest = "request"
+)
+
+// Schedule limits a short URL to recurring weekly windows, read in TimeZone
+type Schedule struct {
+	// TimeZone is an IANA time zone name such as "Europe/Berlin"; empty means UTC
+	TimeZone string           `bson:"timeZone" json:"timeZone"`
+	Windows  []ScheduleWindow `bson:"windows" json:"windows"`
+}
+
+// ScheduleWindow is a daily time range on some days of the week. Start and End
+// are "HH:MM" times; an End at or before Start runs past midnight into the next day.
+type ScheduleWindow struct {
+	// Days holds "mon" to "sun"; empty means every day
+	Days  []string `bson:"days,omitempty" json:"days,omitempty"`
+	Start string   `bson:"start" json:"start"`
+	End   string   `bson:"end" json:"end"`
 }
 
 // ClickEvent represents a click event on a shortened URL
 type ClickEvent struct {
-	ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
-	ShortURLID  primitive.ObjectID  `bson:"shortUrlId" json:"shortUrlId"`
-	IPAddress   string              `bson:"ipAddress" json:"ipAddress"`
-	UserAgent   string              `bson:"userAgent" json:"userAgent"`
-	Referer     string              `bson:"referer" json:"referer"`
-	CreatedAt   time.Time           `bson:"createdAt" json:"createdAt"`
-	Device      string              `bson:"device" json:"device"`
+	ID              primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	ShortURLID      primitive.ObjectID  `bson:"shortUrlId" json:"shortUrlId"`
+	ShortURLVersion int                 `bson:"shortUrlVersion" json:"shortUrlVersion"`
+	Destination     string              `bson:"destination" json:"destination"`
+	IPAddress       string              `bson:"ipAddress" json:"ipAddress"`
+	UserAgent       string              `bson:"userAgent" json:"userAgent"`
+	Referer         string              `bson:"referer" json:"referer"`
+	CreatedAt       time.Time           `bson:"createdAt" json:"createdAt"`
+	Device          string              `bson:"device" json:"device"`
+}
+
+// Revision actions
+const (
+	RevisionCreate   = "create"
+	RevisionUpdate   = "update"
+	RevisionRollback = "rollback"
+
+	// Saved by the lifecycle worker; ChangedBy is left empty
+	RevisionActivate = "activate"
+	RevisionExpire   = "expire"
+)
+
+// ShortURLRevision is an append-only snapshot of a short URL's editable fields,
+// taken each time a new version is saved
+type ShortURLRevision struct {
+	ID               primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ShortURLID       primitive.ObjectID `bson:"shortUrlId" json:"shortUrlId"`
+	Version          int                `bson:"version" json:"version"`
+	Action           string             `bson:"action" json:"action"`
+	Changes          []string           `bson:"changes" json:"changes"`
+	RolledBackTo     int                `bson:"rolledBackTo,omitempty" json:"rolledBackTo,omitempty"`
+	ChangedBy        primitive.ObjectID `bson:"changedBy" json:"changedBy"`
+	OriginalURL      string             `bson:"originalUrl" json:"originalUrl"`
+	NormalizedURL    string             `bson:"normalizedUrl,omitempty" json:"normalizedUrl"`
+	Slug             string             `bson:"slug" json:"slug"`
+	Active           bool               `bson:"active" json:"active"`
+	ExpiresAt        *time.Time         `bson:"expiresAt,omitempty" json:"expiresAt"`
+	ActivateAt       *time.Time         `bson:"activateAt,omitempty" json:"activateAt"`
+	Schedule         *Schedule          `bson:"schedule,omitempty" json:"schedule"`
+	FallbackURL      string             `bson:"fallbackUrl,omitempty" json:"fallbackUrl"`
+	MaxClicks        int                `bson:"maxClicks,omitempty" json:"maxClicks"`
+	PasswordHash     string             `bson:"passwordHash,omitempty" json:"-"`
+	RedirectType     string             `bson:"redirectType,omitempty" json:"redirectType"`
+	QueryPassthrough string             `bson:"queryPassthrough,omitempty" json:"queryPassthrough"`
+	Wildcard         bool               `bson:"wildcard,omitempty" json:"wildcard"`
+	CreatedAt        time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// NewShortURLRevision snapshots the current version of shortURL. changedBy
+// is empty for changes the service made on its own.
+func NewShortURLRevision(shortURL *ShortURL, action string, changedBy primitive.ObjectID, changes []string) ShortURLRevision {
+	if changes == nil {
+		changes = []string{}
+	}
+	return ShortURLRevision{
+		ShortURLID:       shortURL.ID,
+		Version:          shortURL.Version,
+		Action:           action,
+		Changes:          changes,
+		ChangedBy:        changedBy,
+		OriginalURL:      shortURL.OriginalURL,
+		NormalizedURL:    shortURL.NormalizedURL,
+		Slug:             shortURL.Slug,
+		Active:           shortURL.Active,
+		ExpiresAt:        shortURL.ExpiresAt,
+		ActivateAt:       shortURL.ActivateAt,
+		Schedule:         shortURL.Schedule,
+		FallbackURL:      shortURL.FallbackURL,
+		MaxClicks:        shortURL.MaxClicks,
+		PasswordHash:     shortURL.PasswordHash,
+		RedirectType:     shortURL.RedirectType,
+		QueryPassthrough: shortURL.QueryPassthrough,
+		Wildcard:         shortURL.Wildcard,
+	}
+}
+
+// MarshalJSON adds passwordProtected to the JSON form of a revision, which
+// never includes the password hash itself
+func (s ShortURLRevision) MarshalJSON() ([]byte, error) {
+	type revision ShortURLRevision
+	return json.Marshal(struct {
+		revision
+		PasswordProtected bool `json:"passwordProtected"`
+	}{revision(s), s.PasswordHash != ""})
 }
 
 // URLRequest is the request model for creating a short URL
@@ -34,6 +179,80 @@ type URLRequest struct {
 	OriginalURL string  `json:"originalUrl"`
 	Slug        string  `json:"slug"`
 	ExpiresAt   *string `json:"expiresAt"`
+
+	// Domain is the branded domain to serve the link on; empty uses the
+	// default domain. The caller must have been granted the domain.
+	Domain string `json:"domain"`
+
+	// ActivateAt schedules the link to start redirecting at a later time
+	ActivateAt *string `json:"activateAt"`
+
+	// StartsAt is refused; ActivateAt took its place
+	StartsAt json.RawMessage `json:"startsAt"`
+
+	// ActivateAt and Schedule limit when the link redirects; outside those
+	// times visitors go to FallbackURL, if there is one
+	Schedule    *Schedule `json:"schedule"`
+	FallbackURL string    `json:"fallbackUrl"`
+
+	// MaxClicks limits how many times the link redirects; 1 makes a one-time
+	// link and 0 means no limit
+	MaxClicks int `json:"maxClicks"`
+
+	// Password, if set, must be entered before the link redirects
+	Password string `json:"password"`
+
+	// RedirectType is how visitors are sent on, one of the Redirect
+	// constants; empty uses a 307 Temporary Redirect
+	RedirectType string `json:"redirectType"`
+
+	// QueryPassthrough forwards the visitor's query parameters to the
+	// destination, with QueryPassthroughLink or QueryPassthroughRequest
+	// deciding whose value wins; empty forwards nothing
+	QueryPassthrough string `json:"queryPassthrough"`
+
+	// Wildcard appends whatever path follows the slug to the destination's path
+	Wildcard bool `json:"wildcard"`
+
+	// SlugStrategy picks the slug generator when Slug is empty;
+	// empty uses the deployment default
+	SlugStrategy string `json:"slugStrategy"`
+
+	// Dedupe returns the caller's existing active link for the same
+	// destination instead of creating a new one
+	Dedupe bool `json:"dedupe"`
+}
+
+// URLUpdateRequest is the request model for updating a short URL.
+// Fields left out of the request are not changed.
+type URLUpdateRequest struct {
+	OriginalURL *string `json:"originalUrl"`
+	Slug        *string `json:"slug"`
+	ExpiresAt   *string `json:"expiresAt"`
+	ActivateAt  *string `json:"activateAt"`
+	Active      *bool   `json:"active"`
+
+	// StartsAt is refused; ActivateAt took its place
+	StartsAt json.RawMessage `json:"startsAt"`
+
+	// An empty FallbackURL clears it, as does a Schedule without windows
+	Schedule    *Schedule `json:"schedule"`
+	FallbackURL *string   `json:"fallbackUrl"`
+	MaxClicks   *int      `json:"maxClicks"`
+
+	// An empty Password removes the password
+	Password *string `json:"password"`
+
+	// An empty RedirectType goes back to the default
+	RedirectType *string `json:"redirectType"`
+
+	// An empty QueryPassthrough stops forwarding the query
+	QueryPassthrough *string `json:"queryPassthrough"`
+	Wildcard         *bool   `json:"wildcard"`
+
+	// Version is the version the update was based on; it may be sent in an
+	// If-Match header instead
+	Version *int `json:"version"`
 }
 
 // StatsResponse holds the analytics data returned for the dashboard
@@ -50,4 +269,91 @@ type DeviceStats struct {
 	Mobile  int `json:"mobile"`
 	Desktop int `json:"desktop"`
 	Tablet  int `json:"tablet"`
-}
\ No newline at end of file
+}
+
+// HealthResponse reports service health and the storage backend in use
+type HealthResponse struct {
+	Status   string `json:"status"`
+	Storage  string `json:"storage"`
+	Fallback bool   `json:"fallback"`
+}
+
+// User represents a registered account
+type User struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Username     string             `bson:"username" json:"username"`
+	PasswordHash string             `bson:"passwordHash" json:"-"`
+	Role         string             `bson:"role" json:"role"`
+	CreatedAt    time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// User roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Session represents a logged-in browser or client session
+type Session struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID `bson:"userId" json:"userId"`
+	TokenHash string             `bson:"tokenHash" json:"-"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	ExpiresAt time.Time          `bson:"expiresAt" json:"expiresAt"`
+}
+
+// AuthRequest is the request model for registering and logging in
+type AuthRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// APIKey represents a long-lived credential for programmatic access
+type APIKey struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID     primitive.ObjectID `bson:"userId" json:"userId"`
+	Name       string             `bson:"name" json:"name"`
+	Prefix     string             `bson:"prefix" json:"prefix"`
+	KeyHash    string             `bson:"keyHash" json:"-"`
+	Scopes     []string           `bson:"scopes" json:"scopes"`
+	CreatedAt  time.Time          `bson:"createdAt" json:"createdAt"`
+	LastUsedAt *time.Time         `bson:"lastUsedAt,omitempty" json:"lastUsedAt"`
+	RevokedAt  *time.Time         `bson:"revokedAt,omitempty" json:"revokedAt"`
+}
+
+// APIKeyRequest is the request model for issuing an API key
+type APIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// APIKeyResponse is returned once when a key is issued and carries the plaintext key
+type APIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// Domain is a branded host that short links can be served on, such as
+// go.team-a.example. Each domain has its own slug namespace, and only the
+// users in UserIDs may create links on it.
+type Domain struct {
+	ID        primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Host      string               `bson:"host" json:"host"`
+	UserIDs   []primitive.ObjectID `bson:"userIds" json:"userIds,omitempty"`
+	CreatedAt time.Time            `bson:"createdAt" json:"createdAt"`
+}
+
+// DomainRequest is the request model for registering a branded domain
+type DomainRequest struct {
+	Host string `json:"host"`
+}
+
+// DomainGrantRequest is the request model for granting a user a domain
+type DomainGrantRequest struct {
+	Username string `json:"username"`
+}
+
+// PolicyReloadResponse reports the destination policy after a reload
+type PolicyReloadResponse struct {
+	BlocklistSize int `json:"blocklistSize"`
+}
@@ -0,0 +1,362 @@
+// Package policy decides which destinations may be shortened.
+package policy
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Violation is returned when a destination is rejected by the policy
+type Violation struct {
+	Reason string
+}
+
+func (v *Violation) Error() string {
+	return v.Reason
+}
+
+// Ways of handling destinations that are short links on this service
+const (
+	// SelfLinksReject rejects them
+	SelfLinksReject = "reject"
+
+	// SelfLinksResolve replaces them with the destination they finally lead to
+	SelfLinksResolve = "resolve"
+)
+
+// ShortLinkPaths are the path prefixes under which this service serves short links
+var ShortLinkPaths = []string{"/api/r/", "/"}
+
+// Config describes the destination policy
+type Config struct {
+	// Blocklist and Allowlist hold domain patterns. A pattern is either an exact
+	// host name ("example.com") or a wildcard that matches any subdomain ("*.example.com").
+	Blocklist []string
+
+	// Allowlist, when not empty, rejects every host that doesn't match one of its patterns
+	Allowlist []string
+
+	// BlocklistFiles hold more blocklist patterns, one per line; "#" starts a comment.
+	// They are read at startup and again on every Reload.
+	BlocklistFiles []string
+
+	// AllowPrivateIPs permits private, loopback and link-local IP literals
+	AllowPrivateIPs bool
+
+	// ServiceHosts are the host names this service is reachable on
+	ServiceHosts []string
+
+	// SelfLinks is SelfLinksReject or SelfLinksResolve
+	SelfLinks string
+
+	// MaxChainDepth limits how many short links are followed when resolving
+	// a self link, or when redirecting through one
+	MaxChainDepth int
+}
+
+// ConfigFromEnv reads the destination policy from environment variables
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Blocklist:      splitList(os.Getenv("DESTINATION_BLOCKLIST")),
+		Allowlist:      splitList(os.Getenv("DESTINATION_ALLOWLIST")),
+		BlocklistFiles: splitList(os.Getenv("DESTINATION_BLOCKLIST_FILES")),
+		ServiceHosts:   splitList(os.Getenv("SERVICE_HOSTNAMES")),
+		SelfLinks:      strings.ToLower(strings.TrimSpace(os.Getenv("SELF_LINKS"))),
+		MaxChainDepth:  5,
+	}
+
+	if cfg.SelfLinks == "" {
+		cfg.SelfLinks = SelfLinksReject
+	}
+	if depth, err := strconv.Atoi(os.Getenv("MAX_LINK_CHAIN_DEPTH")); err == nil {
+		cfg.MaxChainDepth = depth
+	}
+
+	if allow, err := strconv.ParseBool(os.Getenv("DESTINATION_ALLOW_PRIVATE_IPS")); err == nil {
+		cfg.AllowPrivateIPs = allow
+	}
+
+	return cfg
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// domainSet matches host names against exact and wildcard patterns
+type domainSet struct {
+	exact    map[string]bool
+	suffixes []string
+}
+
+// newDomainSet compiles patterns into a domainSet
+func newDomainSet(patterns []string) (*domainSet, error) {
+	set := &domainSet{exact: make(map[string]bool)}
+	for _, pattern := range patterns {
+		if err := set.add(pattern); err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
+
+// add compiles a single pattern into the set
+func (s *domainSet) add(pattern string) error {
+	pattern = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(pattern)), ".")
+
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		if suffix == "" || strings.Contains(suffix, "*") {
+			return fmt.Errorf("invalid domain pattern %q", pattern)
+		}
+		s.suffixes = append(s.suffixes, "."+suffix)
+		return nil
+	}
+
+	if pattern == "" || strings.Contains(pattern, "*") {
+		return fmt.Errorf("invalid domain pattern %q", pattern)
+	}
+	s.exact[pattern] = true
+	return nil
+}
+
+// len reports how many patterns are in the set
+func (s *domainSet) len() int {
+	return len(s.exact) + len(s.suffixes)
+}
+
+// match returns the pattern matching host, if any
+func (s *domainSet) match(host string) (string, bool) {
+	if s.exact[host] {
+		return host, true
+	}
+	for _, suffix := range s.suffixes {
+		if strings.HasSuffix(host, suffix) {
+			return "*" + suffix, true
+		}
+	}
+	return "", false
+}
+
+// Engine checks destinations against the configured policy.
+// It is safe for concurrent use, including while Reload runs.
+type Engine struct {
+	cfg          Config
+	allowlist    *domainSet
+	serviceHosts map[string]bool
+
+	mu        sync.RWMutex
+	blocklist *domainSet
+}
+
+// New creates an engine for cfg, loading its blocklist files
+func New(cfg Config) (*Engine, error) {
+	allowlist, err := newDomainSet(cfg.Allowlist)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.SelfLinks != SelfLinksReject && cfg.SelfLinks != SelfLinksResolve {
+		return nil, fmt.Errorf("unknown self link mode %q (want %s or %s)", cfg.SelfLinks, SelfLinksReject, SelfLinksResolve)
+	}
+	if cfg.MaxChainDepth < 0 {
+		return nil, errors.New("maximum link chain depth can't be negative")
+	}
+
+	e := &Engine{
+		cfg:          cfg,
+		allowlist:    allowlist,
+		serviceHosts: make(map[string]bool),
+	}
+	for _, host := range cfg.ServiceHosts {
+		e.serviceHosts[HostWithoutPort(host)] = true
+	}
+	if err := e.Reload(); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// Reload re-reads the blocklist files. If any file can't be read the
+// current blocklist is kept.
+func (e *Engine) Reload() error {
+	blocklist, err := newDomainSet(e.cfg.Blocklist)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range e.cfg.BlocklistFiles {
+		if err := loadBlocklistFile(blocklist, path); err != nil {
+			return err
+		}
+	}
+
+	e.mu.Lock()
+	e.blocklist = blocklist
+	e.mu.Unlock()
+
+	return nil
+}
+
+// BlocklistSize reports how many blocklist patterns are loaded
+func (e *Engine) BlocklistSize() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.blocklist.len()
+}
+
+// loadBlocklistFile adds the patterns listed in the file at path to set
+func loadBlocklistFile(set *domainSet, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		pattern, _, _ := strings.Cut(scanner.Text(), "#")
+		if strings.TrimSpace(pattern) == "" {
+			continue
+		}
+		if err := set.add(pattern); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Check returns a *Violation if the destination rawURL may not be shortened.
+// rawURL should already be normalized, so that its host is lowercase punycode.
+func (e *Engine) Check(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return &Violation{Reason: "invalid URL"}
+	}
+	host := strings.TrimSuffix(u.Hostname(), ".")
+
+	// IP literals skip the domain lists
+	if ip := net.ParseIP(host); ip != nil {
+		if !e.cfg.AllowPrivateIPs && !isPublicIP(ip) {
+			return &Violation{Reason: fmt.Sprintf("destination %s is a private, loopback or link-local address", host)}
+		}
+		return nil
+	}
+	if !e.cfg.AllowPrivateIPs && (host == "localhost" || strings.HasSuffix(host, ".localhost")) {
+		return &Violation{Reason: fmt.Sprintf("destination %s is a loopback address", host)}
+	}
+	if isNumericHost(host) {
+		return &Violation{Reason: fmt.Sprintf("destination host %s looks like an encoded IP address", host)}
+	}
+
+	if e.allowlist.len() > 0 {
+		if _, ok := e.allowlist.match(host); !ok {
+			return &Violation{Reason: fmt.Sprintf("destination domain %s is not on the allowlist", host)}
+		}
+	}
+
+	e.mu.RLock()
+	pattern, blocked := e.blocklist.match(host)
+	e.mu.RUnlock()
+	if blocked {
+		return &Violation{Reason: fmt.Sprintf("destination domain %s is blocked (matches %s)", host, pattern)}
+	}
+
+	return nil
+}
+
+// ResolveSelfLinks reports whether self links should be resolved rather than rejected
+func (e *Engine) ResolveSelfLinks() bool {
+	return e.cfg.SelfLinks == SelfLinksResolve
+}
+
+// MaxChainDepth is the most short links that may be followed in a row
+func (e *Engine) MaxChainDepth() int {
+	return e.cfg.MaxChainDepth
+}
+
+// SelfLink reports whether rawURL points at this service, i.e. at one of the
+// configured service hosts or at requestHost, the host the current request was
+// sent to. If it is a short link, slug is its slug; otherwise slug is empty.
+func (e *Engine) SelfLink(rawURL, requestHost string) (slug string, self bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false
+	}
+
+	host := HostWithoutPort(u.Host)
+	if !e.serviceHosts[host] && (requestHost == "" || host != HostWithoutPort(requestHost)) {
+		return "", false
+	}
+
+	slug, _ = ShortLinkSlug(u.Path)
+	return slug, true
+}
+
+// ServiceHost reports whether host is one of the configured service hosts
+func (e *Engine) ServiceHost(host string) bool {
+	return e.serviceHosts[HostWithoutPort(host)]
+}
+
+// ShortLinkSlug returns the slug of the short link served at path, if path
+// is one of the ShortLinkPaths followed by a slug
+func ShortLinkSlug(path string) (string, bool) {
+	for _, prefix := range ShortLinkPaths {
+		if rest, ok := strings.CutPrefix(path, prefix); ok && rest != "" && !strings.Contains(rest, "/") {
+			return rest, true
+		}
+	}
+	return "", false
+}
+
+// HostWithoutPort lowercases host and strips any port and trailing dot
+func HostWithoutPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(strings.Trim(host, "[]")), ".")
+}
+
+// isPublicIP reports whether ip is routable on the public internet
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsPrivate() ||
+		ip.IsLoopback() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsUnspecified())
+}
+
+// isNumericHost reports whether every label of host is a decimal or 0x-prefixed
+// hex number, like "2130706433" or "0x7f.1". Browsers resolve these as IPv4
+// addresses, so they could be used to slip past the IP checks.
+func isNumericHost(host string) bool {
+	for _, label := range strings.Split(host, ".") {
+		digits, hex := "0123456789", strings.HasPrefix(label, "0x")
+		if hex {
+			label, digits = label[2:], "0123456789abcdef"
+		}
+		if label == "" && !hex {
+			return false
+		}
+		if strings.Trim(label, digits) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,239 @@
+package policy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsNumericHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"2130706433", true},
+		{"127.1", true},
+		{"0x7f.1", true},
+		{"0x7f000001", true},
+		{"0177.0.0.1", true},
+		{"0xAB", false},
+		{"example.com", false},
+		{"1.example", false},
+		{"123abc", false},
+		{"0x7g", false},
+		{"1..2", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := isNumericHost(tt.host); got != tt.want {
+			t.Errorf("isNumericHost(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestDomainSet(t *testing.T) {
+	set, err := newDomainSet([]string{"Example.com.", "*.bad.example", " spam.test "})
+	if err != nil {
+		t.Fatalf("newDomainSet: %v", err)
+	}
+	if set.len() != 3 {
+		t.Fatalf("len = %d, want 3", set.len())
+	}
+
+	tests := []struct {
+		host    string
+		pattern string
+		match   bool
+	}{
+		{"example.com", "example.com", true},
+		{"www.example.com", "", false},
+		{"spam.test", "spam.test", true},
+		{"a.bad.example", "*.bad.example", true},
+		{"a.b.bad.example", "*.bad.example", true},
+		{"bad.example", "", false},
+		{"notbad.example", "", false},
+	}
+
+	for _, tt := range tests {
+		pattern, match := set.match(tt.host)
+		if match != tt.match || pattern != tt.pattern {
+			t.Errorf("match(%q) = %q, %v, want %q, %v", tt.host, pattern, match, tt.pattern, tt.match)
+		}
+	}
+}
+
+func TestDomainSetRejectsBadPatterns(t *testing.T) {
+	for _, pattern := range []string{"", "*.", "*", "*.*.example", "a*.example", "ex*ample.com"} {
+		if _, err := newDomainSet([]string{pattern}); err == nil {
+			t.Errorf("newDomainSet(%q) succeeded, want an error", pattern)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		rawURL  string
+		allowed bool
+	}{
+		{"public host", Config{}, "https://example.com/", true},
+		{"public IPv4", Config{}, "https://93.184.216.34/", true},
+		{"public IPv6", Config{}, "https://[2606:2800:220:1::]/", true},
+		{"private IPv4", Config{}, "http://10.0.0.1/", false},
+		{"private 192.168", Config{}, "http://192.168.1.1:8080/", false},
+		{"loopback IPv4", Config{}, "http://127.0.0.1/", false},
+		{"loopback IPv6", Config{}, "http://[::1]/", false},
+		{"unique local IPv6", Config{}, "http://[fd00::1]/", false},
+		{"link-local", Config{}, "http://169.254.169.254/latest/meta-data", false},
+		{"IPv4-mapped IPv6 loopback", Config{}, "http://[::ffff:127.0.0.1]/", false},
+		{"unspecified", Config{}, "http://0.0.0.0/", false},
+		{"localhost", Config{}, "http://localhost/", false},
+		{"localhost subdomain", Config{}, "http://app.localhost./", false},
+		{"private IPs allowed", Config{AllowPrivateIPs: true}, "http://10.0.0.1/", true},
+		{"localhost allowed", Config{AllowPrivateIPs: true}, "http://localhost:3000/", true},
+		{"decimal IP", Config{}, "http://2130706433/", false},
+		{"hex IP", Config{}, "http://0x7f.1/", false},
+		{"numeric host even with private IPs allowed", Config{AllowPrivateIPs: true}, "http://0x7f000001/", false},
+		{"blocked domain", Config{Blocklist: []string{"evil.example"}}, "https://evil.example/x", false},
+		{"blocked domain with trailing dot", Config{Blocklist: []string{"evil.example"}}, "https://evil.example./x", false},
+		{"subdomain of a blocked domain", Config{Blocklist: []string{"evil.example"}}, "https://www.evil.example/", true},
+		{"blocked wildcard", Config{Blocklist: []string{"*.evil.example"}}, "https://www.evil.example/", false},
+		{"allowlisted", Config{Allowlist: []string{"*.corp.example"}}, "https://wiki.corp.example/", true},
+		{"not allowlisted", Config{Allowlist: []string{"*.corp.example"}}, "https://example.com/", false},
+		{"allowlisted but blocked", Config{Allowlist: []string{"*.corp.example"}, Blocklist: []string{"old.corp.example"}}, "https://old.corp.example/", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.SelfLinks = SelfLinksReject
+			e, err := New(tt.cfg)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+
+			err = e.Check(tt.rawURL)
+			var violation *Violation
+			if tt.allowed && err != nil {
+				t.Fatalf("Check(%q) = %v, want it allowed", tt.rawURL, err)
+			}
+			if !tt.allowed && !errors.As(err, &violation) {
+				t.Fatalf("Check(%q) = %v, want a *Violation", tt.rawURL, err)
+			}
+		})
+	}
+}
+
+func TestNewRejectsBadConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"unknown self link mode", Config{SelfLinks: "follow"}},
+		{"negative chain depth", Config{SelfLinks: SelfLinksResolve, MaxChainDepth: -1}},
+		{"bad allowlist pattern", Config{SelfLinks: SelfLinksReject, Allowlist: []string{"*"}}},
+		{"bad blocklist pattern", Config{SelfLinks: SelfLinksReject, Blocklist: []string{"a*b"}}},
+		{"missing blocklist file", Config{SelfLinks: SelfLinksReject, BlocklistFiles: []string{filepath.Join(t.TempDir(), "missing.txt")}}},
+	}
+
+	for _, tt := range tests {
+		if _, err := New(tt.cfg); err == nil {
+			t.Errorf("%s: New succeeded, want an error", tt.name)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	writeFile := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+
+	writeFile("# phishing\nphish.example\n\n*.malware.example # whole zone\n")
+	e, err := New(Config{Blocklist: []string{"spam.example"}, BlocklistFiles: []string{path}, SelfLinks: SelfLinksReject})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if e.BlocklistSize() != 3 {
+		t.Fatalf("BlocklistSize = %d, want 3", e.BlocklistSize())
+	}
+	if err := e.Check("https://a.malware.example/"); err == nil {
+		t.Fatalf("Check allowed a host blocked by the file")
+	}
+	if err := e.Check("https://new.example/"); err != nil {
+		t.Fatalf("Check = %v before new.example was blocked", err)
+	}
+
+	writeFile("new.example\n")
+	if err := e.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if e.BlocklistSize() != 2 {
+		t.Fatalf("BlocklistSize after Reload = %d, want 2", e.BlocklistSize())
+	}
+	if err := e.Check("https://new.example/"); err == nil {
+		t.Fatalf("Check allowed new.example after it was added to the file")
+	}
+	if err := e.Check("https://a.malware.example/"); err != nil {
+		t.Fatalf("Check = %v after a.malware.example was removed from the file", err)
+	}
+	if err := e.Check("https://spam.example/"); err == nil {
+		t.Fatalf("Check allowed spam.example, which is configured directly")
+	}
+
+	// A bad file leaves the loaded blocklist in place
+	writeFile("ok.example\nbad*.example\n")
+	if err := e.Reload(); err == nil {
+		t.Fatalf("Reload succeeded with an invalid pattern")
+	}
+	if err := e.Check("https://new.example/"); err == nil {
+		t.Fatalf("Check allowed new.example after a failed Reload")
+	}
+	if err := e.Check("https://ok.example/"); err != nil {
+		t.Fatalf("Check = %v for a pattern from a failed Reload", err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := e.Reload(); err == nil {
+		t.Fatalf("Reload succeeded with the file missing")
+	}
+	if e.BlocklistSize() != 2 {
+		t.Fatalf("BlocklistSize after a failed Reload = %d, want 2", e.BlocklistSize())
+	}
+}
+
+func TestSelfLink(t *testing.T) {
+	e, err := New(Config{ServiceHosts: []string{"Sho.rt:443"}, SelfLinks: SelfLinksResolve})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	tests := []struct {
+		rawURL      string
+		requestHost string
+		slug        string
+		self        bool
+	}{
+		{"https://sho.rt/abc", "", "abc", true},
+		{"https://sho.rt:8443/api/r/abc", "", "abc", true},
+		{"https://sho.rt/", "", "", true},
+		{"https://sho.rt/a/b", "", "", true},
+		{"https://links.example/abc", "links.example:8080", "abc", true},
+		{"https://links.example/abc", "", "", false},
+		{"https://example.com/abc", "links.example", "", false},
+	}
+
+	for _, tt := range tests {
+		slug, self := e.SelfLink(tt.rawURL, tt.requestHost)
+		if slug != tt.slug || self != tt.self {
+			t.Errorf("SelfLink(%q, %q) = %q, %v, want %q, %v", tt.rawURL, tt.requestHost, slug, self, tt.slug, tt.self)
+		}
+	}
+}
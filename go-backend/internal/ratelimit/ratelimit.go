@@ -0,0 +1,100 @@
+// Package ratelimit counts failed attempts, such as wrong passwords, and
+// reports when a key has failed too often.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// pruneThreshold is how many keys are tracked before expired ones are swept
+const pruneThreshold = 10000
+
+// window counts the failures of one key since start
+type window struct {
+	start    time.Time
+	failures int
+}
+
+// Limiter allows at most Limit failures per key in each fixed window of time.
+// It is safe for concurrent use. State is kept in memory, so it is per process
+// and lost on restart.
+type Limiter struct {
+	limit  int
+	period time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	windows map[string]*window
+}
+
+// New creates a limiter allowing limit failures per key every period.
+// A limit of zero or less never limits.
+func New(limit int, period time.Duration) *Limiter {
+	return &Limiter{
+		limit:   limit,
+		period:  period,
+		now:     time.Now,
+		windows: make(map[string]*window),
+	}
+}
+
+// Reservation is an attempt recorded by Reserve, remembering the window it
+// was counted in
+type Reservation struct {
+	key   string
+	start time.Time
+}
+
+// Reserve checks and records an attempt by key in one step. The attempt
+// counts as a failure until it is released, so concurrent attempts can't get
+// past the limit while their outcome is pending. If key may not make another
+// attempt, nothing is recorded and retryAfter is how long until it may.
+func (l *Limiter) Reserve(key string) (r Reservation, ok bool, retryAfter time.Duration) {
+	if l.limit <= 0 {
+		return Reservation{}, true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	w, found := l.windows[key]
+	if !found || now.Sub(w.start) >= l.period {
+		if len(l.windows) >= pruneThreshold {
+			l.prune(now)
+		}
+		w = &window{start: now}
+		l.windows[key] = w
+	}
+	if w.failures >= l.limit {
+		return Reservation{}, false, w.start.Add(l.period).Sub(now)
+	}
+	w.failures++
+	return Reservation{key: key, start: w.start}, true, 0
+}
+
+// Release takes back a reserved attempt that didn't fail
+func (l *Limiter) Release(r Reservation) {
+	if l.limit <= 0 || r.key == "" {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// An attempt reserved in a window that has since ended was dropped with
+	// it, and mustn't be taken off the failures of the window that replaced it
+	if w, found := l.windows[r.key]; found && w.start.Equal(r.start) && w.failures > 0 {
+		w.failures--
+	}
+}
+
+// prune forgets the keys whose window has ended. The caller must hold mu.
+func (l *Limiter) prune(now time.Time) {
+	for key, w := range l.windows {
+		if now.Sub(w.start) >= l.period {
+			delete(l.windows, key)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package ratelimit
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// clock is a settable time source for a Limiter
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+// newTestLimiter creates a limiter whose time only moves with the returned clock
+func newTestLimiter(limit int, period time.Duration) (*Limiter, *clock) {
+	c := &clock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	l := New(limit, period)
+	l.now = c.Now
+	return l, c
+}
+
+func TestReserve(t *testing.T) {
+	l, c := newTestLimiter(2, time.Minute)
+
+	steps := []struct {
+		name       string
+		key        string
+		advance    time.Duration
+		ok         bool
+		retryAfter time.Duration
+	}{
+		{"first", "a", 0, true, 0},
+		{"second", "a", 10 * time.Second, true, 0},
+		{"over the limit", "a", 10 * time.Second, false, 40 * time.Second},
+		{"other key", "b", 0, true, 0},
+		{"still over the limit", "a", 30 * time.Second, false, 10 * time.Second},
+		{"next window", "a", 10 * time.Second, true, 0},
+	}
+
+	for _, step := range steps {
+		c.now = c.now.Add(step.advance)
+		_, ok, retryAfter := l.Reserve(step.key)
+		if ok != step.ok || retryAfter != step.retryAfter {
+			t.Fatalf("%s: Reserve(%q) = %v, %v, want %v, %v", step.name, step.key, ok, retryAfter, step.ok, step.retryAfter)
+		}
+	}
+}
+
+func TestRelease(t *testing.T) {
+	l, c := newTestLimiter(1, time.Minute)
+
+	// An attempt that didn't fail frees its place
+	r, ok, _ := l.Reserve("a")
+	if !ok {
+		t.Fatalf("Reserve = false, want true")
+	}
+	l.Release(r)
+	r, ok, _ = l.Reserve("a")
+	if !ok {
+		t.Fatalf("Reserve after Release = false, want true")
+	}
+
+	// An attempt from a window that has ended doesn't free a place in the next
+	c.now = c.now.Add(time.Minute)
+	if _, ok, _ := l.Reserve("a"); !ok {
+		t.Fatalf("Reserve in the next window = false, want true")
+	}
+	l.Release(r)
+	if _, ok, _ := l.Reserve("a"); ok {
+		t.Fatalf("Reserve after releasing an old attempt = true, want the new window to stay full")
+	}
+
+	// Releasing what was never reserved does nothing
+	l.Release(Reservation{})
+	if _, ok, _ := l.Reserve("a"); ok {
+		t.Fatalf("Reserve after an empty Release = true, want false")
+	}
+}
+
+func TestReserveConcurrently(t *testing.T) {
+	l := New(5, time.Minute)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	reserved := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok, _ := l.Reserve("a"); ok {
+				mu.Lock()
+				reserved++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if reserved != 5 {
+		t.Fatalf("concurrent Reserve allowed %d attempts, want 5", reserved)
+	}
+}
+
+func TestNoLimit(t *testing.T) {
+	for _, limit := range []int{0, -1} {
+		l := New(limit, time.Minute)
+		for i := 0; i < 100; i++ {
+			r, ok, _ := l.Reserve("a")
+			if !ok {
+				t.Fatalf("New(%d).Reserve = false, want true", limit)
+			}
+			l.Release(r)
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	l, c := newTestLimiter(1, time.Minute)
+	for i := 0; i < pruneThreshold; i++ {
+		l.Reserve(strconv.Itoa(i))
+	}
+
+	c.now = c.now.Add(time.Minute)
+	l.Reserve("new")
+	if len(l.windows) != 1 {
+		t.Fatalf("%d keys tracked after pruning, want 1", len(l.windows))
+	}
+}
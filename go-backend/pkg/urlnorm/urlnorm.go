@@ -0,0 +1,192 @@
+// Package urlnorm validates destination URLs and reduces them to a canonical form,
+// so that different spellings of the same destination compare equal.
+package urlnorm
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+)
+
+// Errors returned by Normalize. The messages are safe to show to API clients.
+var (
+	ErrInvalidURL       = errors.New("invalid URL format")
+	ErrSchemeNotAllowed = errors.New("URL scheme is not allowed")
+	ErrInvalidHost      = errors.New("invalid host name")
+)
+
+// defaultPorts maps schemes to the port they imply
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ftp":   "21",
+}
+
+// Options controls which normalizations are applied
+type Options struct {
+	// AllowedSchemes lists the accepted schemes, in lowercase
+	AllowedSchemes []string
+
+	// StripDefaultPort removes ports that are implied by the scheme, e.g. :443 for https
+	StripDefaultPort bool
+
+	// StripFragment removes the #fragment
+	StripFragment bool
+
+	// SortQuery orders query parameters by name, keeping the order of repeated values
+	SortQuery bool
+}
+
+// DefaultOptions accepts http and https URLs and strips default ports and fragments
+func DefaultOptions() Options {
+	return Options{
+		AllowedSchemes:   []string{"http", "https"},
+		StripDefaultPort: true,
+		StripFragment:    true,
+	}
+}
+
+// OptionsFromEnv reads the normalization options from environment variables,
+// starting from DefaultOptions
+func OptionsFromEnv() Options {
+	opts := DefaultOptions()
+
+	if schemes := os.Getenv("URL_ALLOWED_SCHEMES"); schemes != "" {
+		opts.AllowedSchemes = nil
+		for _, scheme := range strings.Split(schemes, ",") {
+			if scheme = strings.ToLower(strings.TrimSpace(scheme)); scheme != "" {
+				opts.AllowedSchemes = append(opts.AllowedSchemes, scheme)
+			}
+		}
+	}
+	if strip, err := strconv.ParseBool(os.Getenv("URL_STRIP_DEFAULT_PORT")); err == nil {
+		opts.StripDefaultPort = strip
+	}
+	if strip, err := strconv.ParseBool(os.Getenv("URL_STRIP_FRAGMENT")); err == nil {
+		opts.StripFragment = strip
+	}
+	if sortQuery, err := strconv.ParseBool(os.Getenv("URL_SORT_QUERY")); err == nil {
+		opts.SortQuery = sortQuery
+	}
+
+	return opts
+}
+
+// Normalizer canonicalizes URLs according to its Options
+type Normalizer struct {
+	opts Options
+}
+
+// New creates a normalizer with the given options
+func New(opts Options) *Normalizer {
+	return &Normalizer{
+		opts: opts,
+	}
+}
+
+// Result holds a validated URL in the two forms the server stores
+type Result struct {
+	// Original is the URL as submitted, minus surrounding whitespace
+	Original string
+
+	// Normalized is the canonical form used to compare destinations
+	Normalized string
+}
+
+// Normalize validates raw and returns it along with its canonical form
+func (n *Normalizer) Normalize(raw string) (*Result, error) {
+	original := strings.TrimSpace(raw)
+	if original == "" || strings.IndexFunc(original, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	}) >= 0 {
+		return nil, ErrInvalidURL
+	}
+
+	u, err := url.Parse(original)
+	if err != nil {
+		return nil, ErrInvalidURL
+	}
+
+	// Only absolute URLs with an allowed scheme are accepted
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme == "" {
+		return nil, ErrInvalidURL
+	}
+	if !n.schemeAllowed(u.Scheme) {
+		return nil, fmt.Errorf("%w: %s", ErrSchemeNotAllowed, u.Scheme)
+	}
+	if u.Opaque != "" || u.Host == "" {
+		return nil, ErrInvalidURL
+	}
+
+	host, err := normalizeHost(u.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	port := u.Port()
+	if n.opts.StripDefaultPort && port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+	u.Host = host
+	if strings.Contains(host, ":") {
+		// IPv6 literals must stay bracketed
+		u.Host = "[" + host + "]"
+	}
+	if port != "" {
+		u.Host = net.JoinHostPort(host, port)
+	}
+
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	if n.opts.StripFragment {
+		u.Fragment = ""
+		u.RawFragment = ""
+	}
+	if n.opts.SortQuery && u.RawQuery != "" {
+		query, err := url.ParseQuery(u.RawQuery)
+		if err != nil {
+			return nil, ErrInvalidURL
+		}
+		// Encode sorts by key and keeps repeated values in order
+		u.RawQuery = query.Encode()
+	}
+
+	return &Result{
+		Original:   original,
+		Normalized: u.String(),
+	}, nil
+}
+
+// schemeAllowed reports whether scheme is in the allowlist
+func (n *Normalizer) schemeAllowed(scheme string) bool {
+	for _, allowed := range n.opts.AllowedSchemes {
+		if scheme == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeHost lowercases host and converts internationalized names to punycode
+func normalizeHost(host string) (string, error) {
+	if host == "" {
+		return "", ErrInvalidHost
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return strings.ToLower(host), nil
+	}
+
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidHost, host)
+	}
+	return strings.ToLower(ascii), nil
+}
@@ -0,0 +1,122 @@
+package urlnorm
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		raw  string
+		want string
+	}{
+		{"adds a root path", DefaultOptions(), "https://example.com", "https://example.com/"},
+		{"trims whitespace", DefaultOptions(), "  https://example.com/a  ", "https://example.com/a"},
+		{"lowercases scheme and host", DefaultOptions(), "HTTPS://Example.COM/Path", "https://example.com/Path"},
+		{"strips the default https port", DefaultOptions(), "https://example.com:443/a", "https://example.com/a"},
+		{"strips the default http port", DefaultOptions(), "http://example.com:80/a", "http://example.com/a"},
+		{"keeps other ports", DefaultOptions(), "https://example.com:8443/a", "https://example.com:8443/a"},
+		{"keeps a port that is only default for another scheme", DefaultOptions(), "http://example.com:443/", "http://example.com:443/"},
+		{"strips the fragment", DefaultOptions(), "https://example.com/a#top", "https://example.com/a"},
+		{"keeps the query as is", DefaultOptions(), "https://example.com/?b=2&a=1", "https://example.com/?b=2&a=1"},
+		{"converts IDNs to punycode", DefaultOptions(), "https://Bücher.example/", "https://xn--bcher-kva.example/"},
+		{"keeps IPv4 hosts", DefaultOptions(), "http://192.0.2.1:80/", "http://192.0.2.1/"},
+		{"keeps IPv6 hosts bracketed", DefaultOptions(), "http://[2001:DB8::1]/", "http://[2001:db8::1]/"},
+		{"keeps IPv6 hosts bracketed with a port", DefaultOptions(), "http://[2001:db8::1]:8080/", "http://[2001:db8::1]:8080/"},
+		{
+			name: "keeps default ports when asked",
+			opts: Options{AllowedSchemes: []string{"https"}},
+			raw:  "https://example.com:443/a#top",
+			want: "https://example.com:443/a#top",
+		},
+		{
+			name: "sorts the query",
+			opts: Options{AllowedSchemes: []string{"https"}, SortQuery: true},
+			raw:  "https://example.com/?b=2&a=1&b=1",
+			want: "https://example.com/?a=1&b=2&b=1",
+		},
+		{
+			name: "allows other schemes",
+			opts: Options{AllowedSchemes: []string{"ftp"}, StripDefaultPort: true},
+			raw:  "FTP://files.example:21/pub",
+			want: "ftp://files.example/pub",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := New(tt.opts).Normalize(tt.raw)
+			if err != nil {
+				t.Fatalf("Normalize(%q): %v", tt.raw, err)
+			}
+			if result.Normalized != tt.want {
+				t.Fatalf("Normalize(%q).Normalized = %q, want %q", tt.raw, result.Normalized, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeKeepsOriginal(t *testing.T) {
+	result, err := New(DefaultOptions()).Normalize(" HTTPS://Example.com:443/A#b\n")
+	if err != nil {
+		t.Fatalf("Normalize: %v", err)
+	}
+	if want := "HTTPS://Example.com:443/A#b"; result.Original != want {
+		t.Fatalf("Original = %q, want %q", result.Original, want)
+	}
+}
+
+func TestNormalizeRejects(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want error
+	}{
+		{"", ErrInvalidURL},
+		{"   ", ErrInvalidURL},
+		{"example.com/a", ErrInvalidURL},
+		{"/a/b", ErrInvalidURL},
+		{"https://exa mple.com/", ErrInvalidURL},
+		{"https://example.com/a\tb", ErrInvalidURL},
+		{"https://example.com/\x00", ErrInvalidURL},
+		{"https://", ErrInvalidURL},
+		{"https:example.com", ErrInvalidURL},
+		{"https://example.com:port/", ErrInvalidURL},
+		{"javascript:alert(1)", ErrSchemeNotAllowed},
+		{"ftp://example.com/", ErrSchemeNotAllowed},
+		{"data:text/html,hi", ErrSchemeNotAllowed},
+		{"https://:443/", ErrInvalidHost},
+		{"https://exa_mple..com/", ErrInvalidHost},
+	}
+
+	n := New(DefaultOptions())
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			if _, err := n.Normalize(tt.raw); !errors.Is(err, tt.want) {
+				t.Fatalf("Normalize(%q) error = %v, want %v", tt.raw, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOptionsFromEnv(t *testing.T) {
+	t.Setenv("URL_ALLOWED_SCHEMES", " HTTPS, ftp ,,")
+	t.Setenv("URL_STRIP_DEFAULT_PORT", "false")
+	t.Setenv("URL_STRIP_FRAGMENT", "not a bool")
+	t.Setenv("URL_SORT_QUERY", "true")
+
+	opts := OptionsFromEnv()
+	if len(opts.AllowedSchemes) != 2 || opts.AllowedSchemes[0] != "https" || opts.AllowedSchemes[1] != "ftp" {
+		t.Fatalf("AllowedSchemes = %q, want [https ftp]", opts.AllowedSchemes)
+	}
+	if opts.StripDefaultPort {
+		t.Fatalf("StripDefaultPort = true, want false")
+	}
+	if !opts.StripFragment {
+		t.Fatalf("StripFragment = false, want the default true")
+	}
+	if !opts.SortQuery {
+		t.Fatalf("SortQuery = false, want true")
+	}
+}
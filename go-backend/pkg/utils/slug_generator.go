@@ -0,0 +1,362 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	mathrand "math/rand"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Slug generation strategies
+const (
+	SlugStrategyRandom  = "random"
+	SlugStrategyCounter = "counter"
+	SlugStrategyHashids = "hashids"
+	SlugStrategyWords   = "words"
+)
+
+// SlugStrategies lists every supported slug generation strategy
+var SlugStrategies = []string{SlugStrategyRandom, SlugStrategyCounter, SlugStrategyHashids, SlugStrategyWords}
+
+// DefaultReservedSlugs are paths at the root of the service that short links
+// must not shadow: the API, health checks, static assets and the web app's pages
+var DefaultReservedSlugs = []string{
+	"api", "health", "static", "assets", "public", "dist", "src",
+	"auth", "login", "logout", "register", "dashboard", "admin", "settings", "app", "index", "r",
+}
+
+// Alphabets used for slug generation
+const (
+	base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+	// LookalikeChars are characters that are easily mistaken for one another
+	LookalikeChars = "0O1lI"
+)
+
+// SlugGenerator produces candidate slugs for new short URLs.
+// Slugs are not guaranteed to be free; callers retry when the store reports a collision.
+type SlugGenerator interface {
+	GenerateSlug(ctx context.Context) (string, error)
+}
+
+// SequenceFunc returns the next value of a persistent, monotonically increasing counter
+type SequenceFunc func(ctx context.Context) (int64, error)
+
+// WithoutLookalikes returns alphabet with the characters in LookalikeChars removed
+func WithoutLookalikes(alphabet string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(LookalikeChars, r) {
+			return -1
+		}
+		return r
+	}, alphabet)
+}
+
+// RandomSlugGenerator draws every character uniformly from Alphabet
+type RandomSlugGenerator struct {
+	Alphabet string
+	Length   int
+}
+
+// GenerateSlug returns a random slug
+func (g RandomSlugGenerator) GenerateSlug(ctx context.Context) (string, error) {
+	result := make([]byte, g.Length)
+	max := big.NewInt(int64(len(g.Alphabet)))
+
+	for i := range result {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		result[i] = g.Alphabet[n.Int64()]
+	}
+
+	return string(result), nil
+}
+
+// CounterSlugGenerator encodes the next value of a counter in Alphabet,
+// which is base62 unless look-alike characters have been removed
+type CounterSlugGenerator struct {
+	Next     SequenceFunc
+	Alphabet string
+}
+
+// GenerateSlug returns the next counter value, encoded
+func (g CounterSlugGenerator) GenerateSlug(ctx context.Context) (string, error) {
+	n, err := g.Next(ctx)
+	if err != nil {
+		return "", err
+	}
+	return encodeNumber(uint64(n), g.Alphabet, 0), nil
+}
+
+// hashidsBits is the size of the domain permuted by HashidsSlugGenerator
+const hashidsBits = 48
+
+// HashidsSlugGenerator encodes the next value of a counter so that consecutive
+// links don't get guessable consecutive slugs. The counter is run through a
+// keyed permutation and encoded in an alphabet shuffled by Salt, so slugs stay
+// unique without revealing how many links exist.
+type HashidsSlugGenerator struct {
+	Next      SequenceFunc
+	Salt      string
+	Alphabet  string
+	MinLength int
+}
+
+// GenerateSlug returns the next counter value, obfuscated
+func (g HashidsSlugGenerator) GenerateSlug(ctx context.Context) (string, error) {
+	n, err := g.Next(ctx)
+	if err != nil {
+		return "", err
+	}
+	if n < 0 || uint64(n) >= 1<<hashidsBits {
+		return "", fmt.Errorf("sequence value %d is outside the hashids range", n)
+	}
+
+	return encodeNumber(g.permute(uint64(n)), shuffleAlphabet(g.Alphabet, g.Salt), g.MinLength), nil
+}
+
+// permute applies a four-round Feistel network keyed by the salt.
+// It is a bijection on [0, 2^hashidsBits), so distinct inputs give distinct outputs.
+func (g HashidsSlugGenerator) permute(n uint64) uint64 {
+	const half = hashidsBits / 2
+	const mask = 1<<half - 1
+
+	left, right := n>>half, n&mask
+	for round := byte(0); round < 4; round++ {
+		var block [9]byte
+		block[0] = round
+		binary.BigEndian.PutUint64(block[1:], right)
+		sum := sha256.Sum256(append([]byte(g.Salt), block[:]...))
+
+		left, right = right, left^(binary.BigEndian.Uint64(sum[:8])&mask)
+	}
+
+	return left<<half | right
+}
+
+// shuffleAlphabet deterministically reorders alphabet using salt
+func shuffleAlphabet(alphabet, salt string) string {
+	sum := sha256.Sum256([]byte(salt))
+	rng := mathrand.New(mathrand.NewSource(int64(binary.BigEndian.Uint64(sum[:8]))))
+
+	shuffled := []byte(alphabet)
+	rng.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	return string(shuffled)
+}
+
+// encodeNumber writes n in the positional system whose digits are alphabet,
+// left-padded with the zero digit to at least minLength characters
+func encodeNumber(n uint64, alphabet string, minLength int) string {
+	base := uint64(len(alphabet))
+
+	var digits []byte
+	for {
+		digits = append(digits, alphabet[n%base])
+		n /= base
+		if n == 0 {
+			break
+		}
+	}
+	for len(digits) < minLength {
+		digits = append(digits, alphabet[0])
+	}
+
+	// Digits were produced least significant first
+	for i, j := 0, len(digits)-1; i < j; i, j = i+1, j-1 {
+		digits[i], digits[j] = digits[j], digits[i]
+	}
+	return string(digits)
+}
+
+// Word lists for WordSlugGenerator
+var (
+	slugAdjectives = []string{
+		"brave", "calm", "clever", "cosy", "eager", "fancy", "gentle", "happy",
+		"jolly", "keen", "lively", "lucky", "merry", "mighty", "nimble", "proud",
+		"quick", "quiet", "rapid", "shiny", "silly", "sleek", "smart", "snowy",
+		"sunny", "swift", "tidy", "vivid", "warm", "wild", "wise", "zesty",
+	}
+	slugNouns = []string{
+		"badger", "bison", "crane", "dingo", "dolphin", "eagle", "falcon", "ferret",
+		"gecko", "heron", "ibis", "koala", "lemur", "lynx", "marten", "moose",
+		"newt", "ocelot", "otter", "owl", "panda", "puffin", "quail", "raven",
+		"robin", "salmon", "seal", "tiger", "toucan", "walrus", "wombat", "yak",
+	}
+)
+
+// WordSlugGenerator builds human-readable slugs such as "brave-otter-42"
+type WordSlugGenerator struct {
+	// Separator joins the words and the number
+	Separator string
+
+	// MaxNumber bounds the trailing number; zero leaves it out
+	MaxNumber int
+}
+
+// GenerateSlug returns a random adjective-noun-number combination
+func (g WordSlugGenerator) GenerateSlug(ctx context.Context) (string, error) {
+	adjective, err := randomIndex(len(slugAdjectives))
+	if err != nil {
+		return "", err
+	}
+	noun, err := randomIndex(len(slugNouns))
+	if err != nil {
+		return "", err
+	}
+
+	parts := []string{slugAdjectives[adjective], slugNouns[noun]}
+	if g.MaxNumber > 0 {
+		number, err := randomIndex(g.MaxNumber)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, strconv.Itoa(number))
+	}
+
+	return strings.Join(parts, g.Separator), nil
+}
+
+// randomIndex returns a uniformly random integer in [0, n)
+func randomIndex(n int) (int, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(i.Int64()), nil
+}
+
+// SlugConfig selects and tunes the slug generators for a deployment
+type SlugConfig struct {
+	// Strategy is the generator used when a request doesn't ask for one
+	Strategy string
+
+	// Length is the length of random slugs
+	Length int
+
+	// Alphabet is used by the random, counter and hashids generators.
+	// Empty means the generator's default.
+	Alphabet string
+
+	// NoLookalikes removes LookalikeChars from the alphabets
+	NoLookalikes bool
+
+	// HashidsSalt keys the hashids permutation; changing it changes future slugs
+	HashidsSalt string
+
+	// HashidsMinLength pads hashids slugs to at least this many characters
+	HashidsMinLength int
+
+	// Reserved lists slugs that may not be used, compared case-insensitively
+	Reserved []string
+}
+
+// SlugConfigFromEnv reads the slug generation configuration from environment variables
+func SlugConfigFromEnv() SlugConfig {
+	cfg := SlugConfig{
+		Strategy:         strings.ToLower(strings.TrimSpace(os.Getenv("SLUG_STRATEGY"))),
+		Length:           6,
+		Alphabet:         os.Getenv("SLUG_ALPHABET"),
+		HashidsSalt:      os.Getenv("SLUG_HASHIDS_SALT"),
+		HashidsMinLength: 6,
+		Reserved:         append([]string(nil), DefaultReservedSlugs...),
+	}
+
+	if cfg.Strategy == "" {
+		cfg.Strategy = SlugStrategyRandom
+	}
+	if length, err := strconv.Atoi(os.Getenv("SLUG_LENGTH")); err == nil {
+		cfg.Length = length
+	}
+	if noLookalikes, err := strconv.ParseBool(os.Getenv("SLUG_NO_LOOKALIKES")); err == nil {
+		cfg.NoLookalikes = noLookalikes
+	}
+	if minLength, err := strconv.Atoi(os.Getenv("SLUG_HASHIDS_MIN_LENGTH")); err == nil {
+		cfg.HashidsMinLength = minLength
+	}
+	for _, slug := range strings.Split(os.Getenv("RESERVED_SLUGS"), ",") {
+		if slug = strings.TrimSpace(slug); slug != "" {
+			cfg.Reserved = append(cfg.Reserved, slug)
+		}
+	}
+
+	return cfg
+}
+
+// SlugGenerators holds one configured generator per strategy
+type SlugGenerators struct {
+	defaultStrategy string
+	generators      map[string]SlugGenerator
+	reserved        map[string]bool
+}
+
+// NewSlugGenerators builds the generators described by cfg.
+// next backs the counter and hashids strategies.
+func NewSlugGenerators(cfg SlugConfig, next SequenceFunc) (*SlugGenerators, error) {
+	if cfg.Length < 1 {
+		return nil, errors.New("slug length must be at least 1")
+	}
+
+	alphanumericAlphabet, base62 := alphanumeric, base62Alphabet
+	if cfg.Alphabet != "" {
+		if !IsValidSlug(cfg.Alphabet) {
+			return nil, errors.New("slug alphabet may only contain letters, numbers, hyphens and underscores")
+		}
+		// A repeated character would give two numbers the same counter or hashids slug
+		for i := range cfg.Alphabet {
+			if strings.IndexByte(cfg.Alphabet[i+1:], cfg.Alphabet[i]) >= 0 {
+				return nil, fmt.Errorf("slug alphabet repeats the character %q", cfg.Alphabet[i])
+			}
+		}
+		alphanumericAlphabet, base62 = cfg.Alphabet, cfg.Alphabet
+	}
+	if cfg.NoLookalikes {
+		alphanumericAlphabet, base62 = WithoutLookalikes(alphanumericAlphabet), WithoutLookalikes(base62)
+	}
+	if len(alphanumericAlphabet) < 2 || len(base62) < 2 {
+		return nil, errors.New("slug alphabet must have at least two characters")
+	}
+
+	g := &SlugGenerators{
+		defaultStrategy: cfg.Strategy,
+		generators: map[string]SlugGenerator{
+			SlugStrategyRandom:  RandomSlugGenerator{Alphabet: alphanumericAlphabet, Length: cfg.Length},
+			SlugStrategyCounter: CounterSlugGenerator{Next: next, Alphabet: base62},
+			SlugStrategyHashids: HashidsSlugGenerator{Next: next, Salt: cfg.HashidsSalt, Alphabet: base62, MinLength: cfg.HashidsMinLength},
+			SlugStrategyWords:   WordSlugGenerator{Separator: "-", MaxNumber: 100},
+		},
+		reserved: make(map[string]bool),
+	}
+	for _, slug := range cfg.Reserved {
+		g.reserved[strings.ToLower(slug)] = true
+	}
+	if _, ok := g.generators[cfg.Strategy]; !ok {
+		return nil, fmt.Errorf("unknown slug strategy %q (want one of %s)", cfg.Strategy, strings.Join(SlugStrategies, ", "))
+	}
+
+	return g, nil
+}
+
+// Get returns the generator for strategy, or the deployment default if strategy is empty
+func (g *SlugGenerators) Get(strategy string) (SlugGenerator, bool) {
+	if strategy == "" {
+		strategy = g.defaultStrategy
+	}
+	generator, ok := g.generators[strategy]
+	return generator, ok
+}
+
+// Reserved reports whether slug is reserved and may not be used for a short link
+func (g *SlugGenerators) Reserved(slug string) bool {
+	return g.reserved[strings.ToLower(slug)]
+}
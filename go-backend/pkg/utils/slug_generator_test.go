@@ -0,0 +1,228 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// sequence returns a SequenceFunc counting up from start
+func sequence(start int64) SequenceFunc {
+	n := start - 1
+	return func(ctx context.Context) (int64, error) {
+		n++
+		return n, nil
+	}
+}
+
+// decodeHashid reverses HashidsSlugGenerator.GenerateSlug for g
+func decodeHashid(t *testing.T, g HashidsSlugGenerator, slug string) uint64 {
+	t.Helper()
+
+	alphabet := shuffleAlphabet(g.Alphabet, g.Salt)
+	var n uint64
+	for i := 0; i < len(slug); i++ {
+		digit := strings.IndexByte(alphabet, slug[i])
+		if digit < 0 {
+			t.Fatalf("slug %q has %q, which isn't in the alphabet", slug, slug[i])
+		}
+		n = n*uint64(len(alphabet)) + uint64(digit)
+	}
+
+	// Undo the Feistel rounds in reverse order
+	const half = hashidsBits / 2
+	const mask = 1<<half - 1
+	left, right := n>>half, n&mask
+	for round := 3; round >= 0; round-- {
+		var block [9]byte
+		block[0] = byte(round)
+		binary.BigEndian.PutUint64(block[1:], left)
+		sum := sha256.Sum256(append([]byte(g.Salt), block[:]...))
+
+		left, right = right^(binary.BigEndian.Uint64(sum[:8])&mask), left
+	}
+	return left<<half | right
+}
+
+func TestHashidsRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	generators := []HashidsSlugGenerator{
+		{Salt: "pepper", Alphabet: base62Alphabet, MinLength: 6},
+		{Salt: "", Alphabet: base62Alphabet, MinLength: 0},
+		{Salt: "pepper", Alphabet: WithoutLookalikes(base62Alphabet), MinLength: 8},
+		{Salt: "another", Alphabet: "abcdef", MinLength: 4},
+	}
+	starts := []int64{0, 1, 1000, 1<<hashidsBits - 50}
+
+	for _, g := range generators {
+		for _, start := range starts {
+			g.Next = sequence(start)
+			for n := start; n < start+50; n++ {
+				slug, err := g.GenerateSlug(ctx)
+				if err != nil {
+					t.Fatalf("GenerateSlug(%d): %v", n, err)
+				}
+				if len(slug) < g.MinLength {
+					t.Fatalf("slug %q for %d is shorter than %d", slug, n, g.MinLength)
+				}
+				if got := decodeHashid(t, g, slug); got != uint64(n) {
+					t.Fatalf("slug %q decodes to %d, want %d", slug, got, n)
+				}
+			}
+		}
+	}
+}
+
+func TestHashidsSlugsAreUniqueAndUnordered(t *testing.T) {
+	ctx := context.Background()
+	g := HashidsSlugGenerator{Next: sequence(1), Salt: "pepper", Alphabet: base62Alphabet, MinLength: 6}
+
+	seen := make(map[string]bool)
+	previous, ascending := "", 0
+	for i := 0; i < 1000; i++ {
+		slug, err := g.GenerateSlug(ctx)
+		if err != nil {
+			t.Fatalf("GenerateSlug: %v", err)
+		}
+		if seen[slug] {
+			t.Fatalf("slug %q was generated twice", slug)
+		}
+		seen[slug] = true
+		if slug > previous {
+			ascending++
+		}
+		previous = slug
+	}
+	if ascending > 900 {
+		t.Fatalf("%d of 1000 slugs sort after the previous one; consecutive slugs look sequential", ascending)
+	}
+}
+
+func TestHashidsSaltChangesSlugs(t *testing.T) {
+	ctx := context.Background()
+	a := HashidsSlugGenerator{Next: sequence(42), Salt: "one", Alphabet: base62Alphabet, MinLength: 6}
+	b := HashidsSlugGenerator{Next: sequence(42), Salt: "two", Alphabet: base62Alphabet, MinLength: 6}
+
+	slugA, err := a.GenerateSlug(ctx)
+	if err != nil {
+		t.Fatalf("GenerateSlug: %v", err)
+	}
+	slugB, err := b.GenerateSlug(ctx)
+	if err != nil {
+		t.Fatalf("GenerateSlug: %v", err)
+	}
+	if slugA == slugB {
+		t.Fatalf("salts one and two both gave %q", slugA)
+	}
+}
+
+func TestHashidsRejectsOutOfRange(t *testing.T) {
+	for _, n := range []int64{-1, 1 << hashidsBits} {
+		g := HashidsSlugGenerator{Next: sequence(n), Alphabet: base62Alphabet}
+		if slug, err := g.GenerateSlug(context.Background()); err == nil {
+			t.Errorf("GenerateSlug(%d) = %q, want an error", n, slug)
+		}
+	}
+}
+
+func TestWithoutLookalikes(t *testing.T) {
+	tests := []struct {
+		alphabet string
+		want     string
+	}{
+		{base62Alphabet, "23456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"},
+		{alphanumeric, "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"},
+		{"0O1lI", ""},
+		{"xyz", "xyz"},
+	}
+
+	for _, tt := range tests {
+		if got := WithoutLookalikes(tt.alphabet); got != tt.want {
+			t.Errorf("WithoutLookalikes(%q) = %q, want %q", tt.alphabet, got, tt.want)
+		}
+	}
+}
+
+func TestNewSlugGeneratorsWithoutLookalikes(t *testing.T) {
+	ctx := context.Background()
+	for _, alphabet := range []string{"", "0O1lIabc"} {
+		generators, err := NewSlugGenerators(SlugConfig{
+			Strategy:         SlugStrategyRandom,
+			Length:           12,
+			Alphabet:         alphabet,
+			NoLookalikes:     true,
+			HashidsSalt:      "pepper",
+			HashidsMinLength: 6,
+		}, sequence(1))
+		if err != nil {
+			t.Fatalf("NewSlugGenerators(%q): %v", alphabet, err)
+		}
+
+		for _, strategy := range []string{SlugStrategyRandom, SlugStrategyCounter, SlugStrategyHashids} {
+			generator, ok := generators.Get(strategy)
+			if !ok {
+				t.Fatalf("Get(%q) found no generator", strategy)
+			}
+			for i := 0; i < 200; i++ {
+				slug, err := generator.GenerateSlug(ctx)
+				if err != nil {
+					t.Fatalf("%s GenerateSlug: %v", strategy, err)
+				}
+				if strings.ContainsAny(slug, LookalikeChars) {
+					t.Fatalf("%s slug %q with alphabet %q has a look-alike character", strategy, slug, alphabet)
+				}
+			}
+		}
+	}
+}
+
+func TestNewSlugGeneratorsRejectsBadConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  SlugConfig
+	}{
+		{"zero length", SlugConfig{Strategy: SlugStrategyRandom}},
+		{"unknown strategy", SlugConfig{Strategy: "uuid", Length: 6}},
+		{"invalid alphabet", SlugConfig{Strategy: SlugStrategyRandom, Length: 6, Alphabet: "ab/c"}},
+		{"repeated character", SlugConfig{Strategy: SlugStrategyRandom, Length: 6, Alphabet: "abca"}},
+		{"only look-alikes left", SlugConfig{Strategy: SlugStrategyRandom, Length: 6, Alphabet: "0O1x", NoLookalikes: true}},
+	}
+
+	for _, tt := range tests {
+		if _, err := NewSlugGenerators(tt.cfg, sequence(1)); err == nil {
+			t.Errorf("%s: NewSlugGenerators succeeded, want an error", tt.name)
+		}
+	}
+}
+
+func TestReserved(t *testing.T) {
+	t.Setenv("RESERVED_SLUGS", " Docs ,, pricing")
+	cfg := SlugConfigFromEnv()
+	generators, err := NewSlugGenerators(cfg, sequence(1))
+	if err != nil {
+		t.Fatalf("NewSlugGenerators: %v", err)
+	}
+
+	tests := []struct {
+		slug string
+		want bool
+	}{
+		{"api", true},
+		{"API", true},
+		{"Health", true},
+		{"docs", true},
+		{"DOCS", true},
+		{"pricing", true},
+		{"apis", false},
+		{"api-docs", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := generators.Reserved(tt.slug); got != tt.want {
+			t.Errorf("Reserved(%q) = %v, want %v", tt.slug, got, tt.want)
+		}
+	}
+}
@@ -1,4 +1,5 @@
-import { pgTable, text, serial, integer, boolean, timestamp } from "drizzle-orm/pg-core";
+import { pgTable, text, serial, integer, bigint, boolean, timestamp, jsonb, index, unique, uniqueIndex, primaryKey } from "drizzle-orm/pg-core";
+import { sql } from "drizzle-orm";
 import { createInsertSchema } from "drizzle-zod";
 import { z } from "zod";
 
@@ -6,6 +7,8 @@ export const users = pgTable("users", {
   id: serial("id").primaryKey(),
   username: text("username").notNull().unique(),
   password: text("password").notNull(),
+  role: text("role").notNull().default("user"),
+  createdAt: timestamp("created_at").notNull().defaultNow(),
 });
 
 export const insertUserSchema = createInsertSchema(users).pick({
@@ -19,13 +22,40 @@ export type User = typeof users.$inferSelect;
 // URL shortener schema
 export const shortUrls = pgTable("short_urls", {
   id: serial("id").primaryKey(),
+  userId: integer("user_id").references(() => users.id),
+  // Branded domain the link is served on; empty for the default domain
+  domain: text("domain").notNull().default(""),
   originalUrl: text("original_url").notNull(),
-  slug: text("slug").notNull().unique(),
+  normalizedUrl: text("normalized_url"),
+  slug: text("slug").notNull(),
   clicks: integer("clicks").notNull().default(0),
   active: boolean("active").notNull().default(true),
   createdAt: timestamp("created_at").notNull().defaultNow(),
   expiresAt: timestamp("expires_at"),
-});
+  version: integer("version").notNull().default(1),
+  deletedAt: timestamp("deleted_at"),
+  activateAt: timestamp("activate_at"),
+  schedule: jsonb("schedule").$type<{
+    timeZone: string;
+    windows: { days?: string[]; start: string; end: string }[];
+  }>(),
+  fallbackUrl: text("fallback_url"),
+  maxClicks: integer("max_clicks").notNull().default(0),
+  passwordHash: text("password_hash"),
+  // "301", "302", "307", "308", "interstitial" or "frame"; NULL redirects with 307
+  redirectType: text("redirect_type"),
+  // Forward the visitor's query string: "link" or "request" says whose value wins
+  queryPassthrough: text("query_passthrough"),
+  // Append the path after the slug to the destination's path
+  wildcard: boolean("wildcard").notNull().default(false),
+}, (table) => [
+  uniqueIndex("short_urls_domain_slug_idx").on(table.domain, table.slug),
+  index("short_urls_user_id_created_at_idx").on(table.userId, table.createdAt.desc()),
+  index("short_urls_user_id_normalized_url_idx").on(table.userId, table.normalizedUrl),
+  index("short_urls_deleted_at_idx").on(table.deletedAt).where(sql`${table.deletedAt} IS NOT NULL`),
+  index("short_urls_activate_at_idx").on(table.activateAt).where(sql`${table.activateAt} IS NOT NULL`),
+  index("short_urls_expires_at_idx").on(table.expiresAt).where(sql`${table.expiresAt} IS NOT NULL`),
+]);
 
 export const insertShortUrlSchema = createInsertSchema(shortUrls).pick({
   originalUrl: true,
@@ -40,15 +70,52 @@ export const insertShortUrlSchema = createInsertSchema(shortUrls).pick({
 export type InsertShortUrl = z.infer<typeof insertShortUrlSchema>;
 export type ShortUrl = typeof shortUrls.$inferSelect;
 
+// Append-only history of every version of a short URL
+export const shortUrlRevisions = pgTable("short_url_revisions", {
+  id: serial("id").primaryKey(),
+  shortUrlId: integer("short_url_id").notNull().references(() => shortUrls.id, { onDelete: "cascade" }),
+  version: integer("version").notNull(),
+  action: text("action").notNull(),
+  changes: text("changes").array().notNull().default([]),
+  rolledBackTo: integer("rolled_back_to"),
+  changedBy: integer("changed_by").references(() => users.id),
+  originalUrl: text("original_url").notNull(),
+  normalizedUrl: text("normalized_url"),
+  slug: text("slug").notNull(),
+  active: boolean("active").notNull(),
+  expiresAt: timestamp("expires_at"),
+  createdAt: timestamp("created_at").notNull().defaultNow(),
+  activateAt: timestamp("activate_at"),
+  schedule: jsonb("schedule").$type<{
+    timeZone: string;
+    windows: { days?: string[]; start: string; end: string }[];
+  }>(),
+  fallbackUrl: text("fallback_url"),
+  maxClicks: integer("max_clicks").notNull().default(0),
+  passwordHash: text("password_hash"),
+  redirectType: text("redirect_type"),
+  queryPassthrough: text("query_passthrough"),
+  wildcard: boolean("wildcard").notNull().default(false),
+}, (table) => [
+  unique("short_url_revisions_short_url_id_version_key").on(table.shortUrlId, table.version),
+]);
+
+export type ShortUrlRevision = typeof shortUrlRevisions.$inferSelect;
+
 // Analytics schema for referrers
 export const clickEvents = pgTable("click_events", {
   id: serial("id").primaryKey(),
   shortUrlId: integer("short_url_id").notNull(),
+  shortUrlVersion: integer("short_url_version"),
+  destination: text("destination"),
   referrer: text("referrer"),
   userAgent: text("user_agent"),
   timestamp: timestamp("timestamp").notNull().defaultNow(),
   device: text("device"),
-});
+  ipAddress: text("ip_address"),
+}, (table) => [
+  index("click_events_short_url_id_timestamp_idx").on(table.shortUrlId, table.timestamp.desc()),
+]);
 
 export const insertClickEventSchema = createInsertSchema(clickEvents).pick({
   shortUrlId: true,
@@ -59,3 +126,50 @@ export const insertClickEventSchema = createInsertSchema(clickEvents).pick({
 
 export type InsertClickEvent = z.infer<typeof insertClickEventSchema>;
 export type ClickEvent = typeof clickEvents.$inferSelect;
+
+
+// Login sessions and API keys used by the Go server
+export const sessions = pgTable("sessions", {
+  id: serial("id").primaryKey(),
+  userId: integer("user_id").notNull().references(() => users.id, { onDelete: "cascade" }),
+  tokenHash: text("token_hash").notNull().unique(),
+  createdAt: timestamp("created_at").notNull().defaultNow(),
+  expiresAt: timestamp("expires_at").notNull(),
+}, (table) => [
+  index("sessions_expires_at_idx").on(table.expiresAt),
+]);
+
+export const apiKeys = pgTable("api_keys", {
+  id: serial("id").primaryKey(),
+  userId: integer("user_id").notNull().references(() => users.id, { onDelete: "cascade" }),
+  name: text("name").notNull(),
+  prefix: text("prefix").notNull(),
+  keyHash: text("key_hash").notNull().unique(),
+  scopes: text("scopes").array().notNull().default([]),
+  createdAt: timestamp("created_at").notNull().defaultNow(),
+  lastUsedAt: timestamp("last_used_at"),
+  revokedAt: timestamp("revoked_at"),
+}, (table) => [
+  index("api_keys_user_id_idx").on(table.userId),
+]);
+
+// Branded short domains, and the users allowed to create links on them
+export const domains = pgTable("domains", {
+  id: serial("id").primaryKey(),
+  host: text("host").notNull().unique(),
+  createdAt: timestamp("created_at").notNull().defaultNow(),
+});
+
+export const domainGrants = pgTable("domain_grants", {
+  domainId: integer("domain_id").notNull().references(() => domains.id, { onDelete: "cascade" }),
+  userId: integer("user_id").notNull().references(() => users.id, { onDelete: "cascade" }),
+}, (table) => [
+  primaryKey({ columns: [table.domainId, table.userId] }),
+  index("domain_grants_user_id_idx").on(table.userId),
+]);
+
+// Named counters used by the Go server's sequential slug generators
+export const sequences = pgTable("sequences", {
+  name: text("name").primaryKey(),
+  value: bigint("value", { mode: "number" }).notNull(),
+});